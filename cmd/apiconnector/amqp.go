@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// amqpHeader is the AMQP 0-9-1 protocol header.
+const amqpHeader = "AMQP\x00\x00\x09\x01"
+
+// AMQP connection class methods (class 10).
+const (
+	amqpConnectionStart   = 10
+	amqpConnectionStartOk = 11
+	amqpConnectionTune    = 30
+	amqpConnectionTuneOk  = 31
+	amqpConnectionOpen    = 40
+	amqpConnectionOpenOk  = 41
+	amqpConnectionClose   = 50
+)
+
+// checkAMQP performs the AMQP 0-9-1 protocol header exchange and reads
+// connection.start, reporting the broker product and version. When the URL
+// carries credentials it also authenticates with PLAIN and opens the
+// virtual host named by the path (default "/").
+func checkAMQP(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	start := time.Now()
+
+	u, err := url.Parse(test.URL)
+	if err != nil || u.Hostname() == "" {
+		return "ERROR", 0, "Invalid URL"
+	}
+
+	defaultPort := "5672"
+	if u.Scheme == "amqps" {
+		defaultPort = "5671"
+	}
+	conn, err := dial(ctx, test, "tcp", hostPort(u, defaultPort))
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("Connect error: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(testTimeout(test)))
+
+	if u.Scheme == "amqps" {
+		conn, err = tlsClient(ctx, test, conn, u.Hostname())
+		if err != nil {
+			return "FAIL", 0, fmt.Sprintf("TLS handshake error: %v", err)
+		}
+	}
+
+	if _, err := io.WriteString(conn, amqpHeader); err != nil {
+		return "FAIL", 0, fmt.Sprintf("Header write error: %v", err)
+	}
+
+	br := bufio.NewReader(conn)
+	if peek, err := br.Peek(4); err == nil && string(peek) == "AMQP" {
+		return "FAIL", time.Since(start), "Server rejected AMQP 0-9-1"
+	}
+	method, args, err := amqpReadMethod(br)
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("connection.start read error: %v", err)
+	}
+	if method != amqpConnectionStart || len(args) < 2 {
+		return "FAIL", 0, fmt.Sprintf("Unexpected method 10.%d", method)
+	}
+	props := amqpTable(args[2:])
+	if product, ok := props["product"]; ok {
+		setDetail(test, "product", product)
+	}
+	if version, ok := props["version"]; ok {
+		setDetail(test, "version", version)
+	}
+
+	user := u.User.Username()
+	if user == "" {
+		return "OK", time.Since(start), ""
+	}
+	password, _ := u.User.Password()
+
+	var startOk []byte
+	startOk = binary.BigEndian.AppendUint32(startOk, 0) // empty client-properties
+	startOk = amqpAppendShortString(startOk, "PLAIN")
+	startOk = amqpAppendLongString(startOk, "\x00"+user+"\x00"+password)
+	startOk = amqpAppendShortString(startOk, "en_US")
+	if err := amqpWriteMethod(conn, amqpConnectionStartOk, startOk); err != nil {
+		return "FAIL", 0, fmt.Sprintf("connection.start-ok write error: %v", err)
+	}
+
+	method, args, err = amqpReadMethod(br)
+	if err != nil {
+		return "FAIL", time.Since(start), fmt.Sprintf("Authentication failed: %v", err)
+	}
+	if method == amqpConnectionClose {
+		return "FAIL", time.Since(start), amqpCloseReason(args)
+	}
+	if method != amqpConnectionTune || len(args) < 8 {
+		return "FAIL", 0, fmt.Sprintf("Unexpected method 10.%d", method)
+	}
+	// Echo the server's channel-max and frame-max; disable heartbeats.
+	tuneOk := append(append([]byte(nil), args[:6]...), 0, 0)
+	if err := amqpWriteMethod(conn, amqpConnectionTuneOk, tuneOk); err != nil {
+		return "FAIL", 0, fmt.Sprintf("connection.tune-ok write error: %v", err)
+	}
+
+	vhost := strings.TrimPrefix(u.Path, "/")
+	if vhost == "" {
+		vhost = "/"
+	}
+	open := amqpAppendShortString(nil, vhost)
+	open = append(open, 0, 0) // reserved shortstr, reserved bit
+	if err := amqpWriteMethod(conn, amqpConnectionOpen, open); err != nil {
+		return "FAIL", 0, fmt.Sprintf("connection.open write error: %v", err)
+	}
+	method, args, err = amqpReadMethod(br)
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("connection.open-ok read error: %v", err)
+	}
+	if method == amqpConnectionClose {
+		return "FAIL", time.Since(start), amqpCloseReason(args)
+	}
+	if method != amqpConnectionOpenOk {
+		return "FAIL", 0, fmt.Sprintf("Unexpected method 10.%d", method)
+	}
+	latency := time.Since(start)
+	setDetail(test, "auth", "ok")
+
+	closeArgs := []byte{0, 200}
+	closeArgs = amqpAppendShortString(closeArgs, "")
+	closeArgs = append(closeArgs, 0, 0, 0, 0)
+	amqpWriteMethod(conn, amqpConnectionClose, closeArgs)
+
+	return "OK", latency, ""
+}
+
+// amqpWriteMethod writes a connection-class method frame on channel 0.
+func amqpWriteMethod(w io.Writer, method uint16, args []byte) error {
+	payload := []byte{0, 10, byte(method >> 8), byte(method)}
+	payload = append(payload, args...)
+	frame := []byte{1, 0, 0}
+	frame = binary.BigEndian.AppendUint32(frame, uint32(len(payload)))
+	frame = append(frame, payload...)
+	frame = append(frame, 0xCE)
+	_, err := w.Write(frame)
+	return err
+}
+
+// amqpReadMethod reads the next connection-class method frame, skipping
+// heartbeats, and returns its method id and arguments.
+func amqpReadMethod(r io.Reader) (uint16, []byte, error) {
+	for {
+		var header [7]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return 0, nil, err
+		}
+		size := binary.BigEndian.Uint32(header[3:])
+		if size > 1<<20 {
+			return 0, nil, fmt.Errorf("frame too large (%d bytes)", size)
+		}
+		payload := make([]byte, size+1)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return 0, nil, err
+		}
+		if payload[size] != 0xCE {
+			return 0, nil, fmt.Errorf("invalid frame end")
+		}
+		if header[0] == 8 { // heartbeat
+			continue
+		}
+		if header[0] != 1 || size < 4 {
+			return 0, nil, fmt.Errorf("unexpected frame type %d", header[0])
+		}
+		if class := binary.BigEndian.Uint16(payload); class != 10 {
+			return 0, nil, fmt.Errorf("unexpected method class %d", class)
+		}
+		return binary.BigEndian.Uint16(payload[2:]), payload[4:size], nil
+	}
+}
+
+// amqpCloseReason formats the arguments of connection.close.
+func amqpCloseReason(args []byte) string {
+	if len(args) < 3 || len(args) < 3+int(args[2]) {
+		return "Connection closed by server"
+	}
+	code := binary.BigEndian.Uint16(args)
+	return fmt.Sprintf("Connection closed: %d %s", code, args[3:3+int(args[2])])
+}
+
+// amqpTable decodes the string-valued entries of an AMQP field table.
+func amqpTable(b []byte) map[string]string {
+	fields := make(map[string]string)
+	if len(b) < 4 {
+		return fields
+	}
+	size := int(binary.BigEndian.Uint32(b))
+	b = b[4:]
+	if size < len(b) {
+		b = b[:size]
+	}
+	for len(b) > 0 {
+		nameLen := int(b[0])
+		if len(b) < 2+nameLen {
+			break
+		}
+		name := string(b[1 : 1+nameLen])
+		typ := b[1+nameLen]
+		b = b[2+nameLen:]
+
+		var n int
+		switch typ {
+		case 't', 'b', 'B':
+			n = 1
+		case 's', 'u':
+			n = 2
+		case 'I', 'i', 'f':
+			n = 4
+		case 'D':
+			n = 5
+		case 'l', 'L', 'd', 'T':
+			n = 8
+		case 'V':
+			n = 0
+		case 'S', 'x', 'F', 'A':
+			if len(b) < 4 {
+				return fields
+			}
+			n = 4 + int(binary.BigEndian.Uint32(b))
+			if typ == 'S' && len(b) >= n {
+				fields[name] = string(b[4:n])
+			}
+		default:
+			return fields
+		}
+		if len(b) < n {
+			break
+		}
+		b = b[n:]
+	}
+	return fields
+}
+
+func amqpAppendShortString(b []byte, s string) []byte {
+	return append(append(b, byte(len(s))), s...)
+}
+
+func amqpAppendLongString(b []byte, s string) []byte {
+	return append(binary.BigEndian.AppendUint32(b, uint32(len(s))), s...)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+)
+
+// amqpStartArgs builds connection.start arguments for a RabbitMQ-like broker.
+func amqpStartArgs() []byte {
+	var table []byte
+	table = amqpAppendShortString(table, "product")
+	table = append(table, 'S')
+	table = amqpAppendLongString(table, "RabbitMQ")
+	table = amqpAppendShortString(table, "capabilities")
+	table = append(table, 'F', 0, 0, 0, 0)
+	table = amqpAppendShortString(table, "version")
+	table = append(table, 'S')
+	table = amqpAppendLongString(table, "3.13.0")
+
+	args := []byte{0, 9}
+	args = append(binary.BigEndian.AppendUint32(args, uint32(len(table))), table...)
+	args = amqpAppendLongString(args, "PLAIN AMQPLAIN")
+	return amqpAppendLongString(args, "en_US")
+}
+
+// fakeAMQP accepts the user guest with password guest.
+func fakeAMQP(t *testing.T) func(conn net.Conn) {
+	return func(conn net.Conn) {
+		header := make([]byte, 8)
+		if _, err := io.ReadFull(conn, header); err != nil || string(header) != amqpHeader {
+			t.Errorf("bad protocol header %q: %v", header, err)
+			return
+		}
+		amqpWriteMethod(conn, amqpConnectionStart, amqpStartArgs())
+
+		br := bufio.NewReader(conn)
+		method, args, err := amqpReadMethod(br)
+		if err != nil || method != amqpConnectionStartOk {
+			return
+		}
+		if !bytes.Contains(args, []byte("\x00guest\x00guest")) {
+			reason := append([]byte{0x01, 0x93}, amqpAppendShortString(nil, "ACCESS_REFUSED")...)
+			amqpWriteMethod(conn, amqpConnectionClose, append(reason, 0, 0, 0, 0))
+			return
+		}
+		amqpWriteMethod(conn, amqpConnectionTune, []byte{0x07, 0xFF, 0, 2, 0, 0, 0, 60})
+		if method, _, _ := amqpReadMethod(br); method != amqpConnectionTuneOk {
+			t.Errorf("expected tune-ok, got 10.%d", method)
+		}
+		if method, _, _ := amqpReadMethod(br); method != amqpConnectionOpen {
+			t.Errorf("expected open, got 10.%d", method)
+		}
+		amqpWriteMethod(conn, amqpConnectionOpenOk, []byte{0})
+		amqpReadMethod(br)
+	}
+}
+
+func TestCheckAMQP(t *testing.T) {
+	tests := []struct {
+		userinfo string
+		status   string
+		auth     string
+	}{
+		{"", "OK", ""},
+		{"guest:guest@", "OK", "ok"},
+		{"guest:wrong@", "FAIL", ""},
+	}
+
+	for _, tt := range tests {
+		addr := serveOnce(t, fakeAMQP(t))
+		test := &ConnectionTest{URL: "amqp://" + tt.userinfo + addr}
+		status, _, errMsg := checkAMQP(context.Background(), test)
+		if status != tt.status {
+			t.Errorf("checkAMQP(%q) = %s (%s), want %s", test.URL, status, errMsg, tt.status)
+		}
+		if test.Details["product"] != "RabbitMQ" || test.Details["version"] != "3.13.0" || test.Details["auth"] != tt.auth {
+			t.Errorf("checkAMQP(%q) Details = %v", test.URL, test.Details)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// cacheStatusHeaders are the response headers CDNs and caching proxies use
+// to report whether a response was served from cache.
+var cacheStatusHeaders = []string{"X-Cache", "Cf-Cache-Status", "X-Cache-Status", "X-Proxy-Cache", "Cdn-Cache"}
+
+// checkCache implements the "cache" option: it repeats the request and
+// compares the second response with the first to tell whether a cache in
+// front of the target served it. A cache status header reporting HIT, or
+// an Age header, counts as a hit. The result is reported as the "cache"
+// detail (hit or miss) along with the second response's "age" and whether
+// the ETag stayed the same; "cache=required" fails the check on a miss. It
+// returns a failure message, or "".
+func checkCache(client *http.Client, test *ConnectionTest, req *http.Request, first *http.Response) string {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Sprintf("Cache probe error: %v", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	hit := false
+	for _, name := range cacheStatusHeaders {
+		if v := resp.Header.Get(name); v != "" {
+			setDetail(test, "cache_status", v)
+			hit = strings.Contains(strings.ToUpper(v), "HIT")
+			break
+		}
+	}
+	if age, err := strconv.Atoi(resp.Header.Get("Age")); err == nil {
+		setDetail(test, "age", strconv.Itoa(age))
+		if _, ok := test.Details["cache_status"]; !ok {
+			hit = true
+		}
+	}
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		setDetail(test, "etag_stable", strconv.FormatBool(etag == first.Header.Get("ETag")))
+	}
+
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	setDetail(test, "cache", result)
+	if !hit && test.Options["cache"] == "required" {
+		return "Response not served from cache"
+	}
+	return ""
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCheckHTTPCache(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cdn":
+			// The first request fills the cache, later ones hit it.
+			if hits.Add(1) == 1 {
+				w.Header().Set("X-Cache", "MISS from edge")
+			} else {
+				w.Header().Set("X-Cache", "HIT from edge")
+			}
+			w.Header().Set("ETag", `"v1"`)
+		case "/age":
+			w.Header().Set("Age", "42")
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		target string
+		status string
+		cache  string
+	}{
+		{"/cdn cache", "OK", "hit"},
+		{"/age cache=required", "OK", "hit"},
+		{"/origin cache", "OK", "miss"},
+		{"/origin cache=required", "FAIL", "miss"},
+		{"/origin", "OK", ""},
+	}
+	for _, tt := range tests {
+		test := parseTestConfig("cdn=" + srv.URL + tt.target)
+		status, _, errMsg := checkHTTP(context.Background(), &test)
+		if status != tt.status || test.Details["cache"] != tt.cache {
+			t.Errorf("checkHTTP(%s) = %s (%s) cache %q, want %s %q", tt.target, status, errMsg, test.Details["cache"], tt.status, tt.cache)
+		}
+		if tt.target == "/cdn cache" && test.Details["etag_stable"] != "true" {
+			t.Errorf("checkHTTP(%s) etag_stable = %q, want true", tt.target, test.Details["etag_stable"])
+		}
+	}
+}
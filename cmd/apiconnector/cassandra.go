@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"time"
+)
+
+// CQL native protocol opcodes.
+const (
+	cqlOpError         = 0x00
+	cqlOpStartup       = 0x01
+	cqlOpReady         = 0x02
+	cqlOpAuthenticate  = 0x03
+	cqlOpOptions       = 0x05
+	cqlOpSupported     = 0x06
+	cqlOpQuery         = 0x07
+	cqlOpResult        = 0x08
+	cqlOpAuthChallenge = 0x0E
+	cqlOpAuthResponse  = 0x0F
+	cqlOpAuthSuccess   = 0x10
+)
+
+// cqlProtocolError is the CQL error code a server returns for a protocol
+// version it does not speak.
+const cqlProtocolError = 0x000A
+
+// checkCassandra completes the CQL native protocol OPTIONS/STARTUP exchange,
+// trying protocol v4 and falling back to v3. URL credentials answer a
+// PasswordAuthenticator challenge. The "query" option also reads
+// release_version from system.local, proving the node executes queries.
+func checkCassandra(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	start := time.Now()
+
+	u, err := url.Parse(test.URL)
+	if err != nil || u.Hostname() == "" {
+		return "ERROR", 0, "Invalid URL"
+	}
+
+	var errMsg string
+	for _, version := range []byte{4, 3} {
+		var retry bool
+		retry, errMsg = cassandraSession(ctx, test, u, version)
+		if errMsg == "" {
+			return "OK", time.Since(start), ""
+		}
+		if !retry {
+			break
+		}
+	}
+	return "FAIL", 0, errMsg
+}
+
+// cassandraSession runs the check over one connection at the given protocol
+// version. retry reports whether the server rejected the version itself.
+func cassandraSession(ctx context.Context, test *ConnectionTest, u *url.URL, version byte) (retry bool, errMsg string) {
+	conn, err := dial(ctx, test, "tcp", hostPort(u, "9042"))
+	if err != nil {
+		return false, fmt.Sprintf("Connect error: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(testTimeout(test)))
+
+	op, body, err := cqlRoundTrip(conn, version, cqlOpOptions, nil)
+	if err != nil {
+		return false, fmt.Sprintf("OPTIONS error: %v", err)
+	}
+	if op == cqlOpError {
+		code, msg := cqlError(body)
+		return code == cqlProtocolError, fmt.Sprintf("OPTIONS error: %s", msg)
+	}
+	if op != cqlOpSupported {
+		return false, fmt.Sprintf("Unexpected OPTIONS response opcode 0x%02x", op)
+	}
+	supported := cqlStringMultimap(body)
+	cqlVersion := "3.0.0"
+	if v := supported["CQL_VERSION"]; len(v) > 0 {
+		cqlVersion = v[0]
+	}
+
+	op, body, err = cqlRoundTrip(conn, version, cqlOpStartup, cqlAppendStringMap(nil, map[string]string{"CQL_VERSION": cqlVersion}))
+	if err != nil {
+		return false, fmt.Sprintf("STARTUP error: %v", err)
+	}
+	switch op {
+	case cqlOpReady:
+	case cqlOpAuthenticate:
+		if u.User == nil {
+			return false, fmt.Sprintf("Server requires authentication (%s)", cqlString(body))
+		}
+		password, _ := u.User.Password()
+		token := []byte("\x00" + u.User.Username() + "\x00" + password)
+		op, body, err = cqlRoundTrip(conn, version, cqlOpAuthResponse, cqlAppendBytes(nil, token))
+		if err != nil {
+			return false, fmt.Sprintf("Authentication error: %v", err)
+		}
+		if op == cqlOpError {
+			_, msg := cqlError(body)
+			return false, fmt.Sprintf("Authentication failed: %s", msg)
+		}
+		if op != cqlOpAuthSuccess {
+			return false, fmt.Sprintf("Unexpected authentication response opcode 0x%02x", op)
+		}
+		setDetail(test, "auth", "ok")
+	case cqlOpError:
+		code, msg := cqlError(body)
+		return code == cqlProtocolError, fmt.Sprintf("STARTUP error: %s", msg)
+	default:
+		return false, fmt.Sprintf("Unexpected STARTUP response opcode 0x%02x", op)
+	}
+	setDetail(test, "protocol", fmt.Sprintf("v%d", version))
+
+	if !boolOption(test, "query") {
+		return false, ""
+	}
+
+	q := cqlAppendLongString(nil, "SELECT release_version FROM system.local")
+	q = binary.BigEndian.AppendUint16(q, 0x0001) // consistency ONE
+	q = append(q, 0)                             // no query flags
+	op, body, err = cqlRoundTrip(conn, version, cqlOpQuery, q)
+	if err != nil {
+		return false, fmt.Sprintf("Query error: %v", err)
+	}
+	if op == cqlOpError {
+		_, msg := cqlError(body)
+		return false, fmt.Sprintf("Query failed: %s", msg)
+	}
+	if op != cqlOpResult {
+		return false, fmt.Sprintf("Unexpected query response opcode 0x%02x", op)
+	}
+	release, err := cqlFirstCell(body)
+	if err != nil {
+		return false, fmt.Sprintf("Invalid query result: %v", err)
+	}
+	setDetail(test, "release_version", release)
+	return false, ""
+}
+
+// cqlRoundTrip sends one request frame on stream 0 and reads the response.
+func cqlRoundTrip(conn net.Conn, version, opcode byte, body []byte) (byte, []byte, error) {
+	frame := []byte{version, 0, 0, 0, opcode}
+	frame = binary.BigEndian.AppendUint32(frame, uint32(len(body)))
+	if _, err := conn.Write(append(frame, body...)); err != nil {
+		return 0, nil, err
+	}
+
+	header := make([]byte, 9)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return 0, nil, err
+	}
+	if header[0]&0x80 == 0 {
+		return 0, nil, errors.New("not a CQL response frame")
+	}
+	n := binary.BigEndian.Uint32(header[5:])
+	if n > 1<<20 {
+		return 0, nil, fmt.Errorf("frame too large (%d bytes)", n)
+	}
+	resp := make([]byte, n)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return 0, nil, err
+	}
+	return header[4], resp, nil
+}
+
+// cqlError decodes an ERROR body into its code and message.
+func cqlError(body []byte) (uint32, string) {
+	if len(body) < 4 {
+		return 0, "malformed error"
+	}
+	code := binary.BigEndian.Uint32(body)
+	return code, fmt.Sprintf("error 0x%04x: %s", code, cqlString(body[4:]))
+}
+
+// cqlString decodes a [string]: a 2-byte length followed by UTF-8 bytes.
+func cqlString(b []byte) string {
+	s, _ := cqlReadString(b)
+	return s
+}
+
+func cqlReadString(b []byte) (string, []byte) {
+	if len(b) < 2 {
+		return "", nil
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return "", nil
+	}
+	return string(b[2 : 2+n]), b[2+n:]
+}
+
+// cqlStringMultimap decodes a [string multimap] such as the SUPPORTED body.
+func cqlStringMultimap(b []byte) map[string][]string {
+	m := make(map[string][]string)
+	if len(b) < 2 {
+		return m
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	b = b[2:]
+	for i := 0; i < n && len(b) >= 2; i++ {
+		var key string
+		key, b = cqlReadString(b)
+		if len(b) < 2 {
+			break
+		}
+		count := int(binary.BigEndian.Uint16(b))
+		b = b[2:]
+		for j := 0; j < count; j++ {
+			var v string
+			v, b = cqlReadString(b)
+			m[key] = append(m[key], v)
+		}
+	}
+	return m
+}
+
+func cqlAppendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func cqlAppendLongString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(s)))
+	return append(b, s...)
+}
+
+func cqlAppendBytes(b, v []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(v)))
+	return append(b, v...)
+}
+
+func cqlAppendStringMap(b []byte, m map[string]string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(m)))
+	for k, v := range m {
+		b = cqlAppendString(b, k)
+		b = cqlAppendString(b, v)
+	}
+	return b
+}
+
+// cqlFirstCell returns the first column of the first row of a Rows RESULT,
+// assuming a text-like column type.
+func cqlFirstCell(body []byte) (string, error) {
+	if len(body) < 16 || binary.BigEndian.Uint32(body) != 2 {
+		return "", errors.New("not a rows result")
+	}
+	flags := binary.BigEndian.Uint32(body[4:])
+	columns := int(binary.BigEndian.Uint32(body[8:]))
+	b := body[12:]
+	if flags&0x0002 != 0 { // has_more_pages: skip paging state
+		if len(b) < 4 {
+			return "", errors.New("truncated paging state")
+		}
+		n := int(int32(binary.BigEndian.Uint32(b)))
+		if n < 0 {
+			n = 0
+		}
+		if len(b) < 4+n {
+			return "", errors.New("truncated paging state")
+		}
+		b = b[4+n:]
+	}
+	if flags&0x0004 != 0 { // no_metadata
+		columns = 0
+	}
+	if flags&0x0001 != 0 { // global_tables_spec
+		_, b = cqlReadString(b)
+		_, b = cqlReadString(b)
+	}
+	for i := 0; i < columns; i++ {
+		if flags&0x0001 == 0 {
+			_, b = cqlReadString(b)
+			_, b = cqlReadString(b)
+		}
+		_, b = cqlReadString(b) // column name
+		if len(b) < 2 {
+			return "", errors.New("truncated column spec")
+		}
+		if id := binary.BigEndian.Uint16(b); id != 0x000D && id != 0x0001 && id != 0x000A {
+			return "", fmt.Errorf("unsupported column type 0x%04x", id)
+		}
+		b = b[2:]
+	}
+	if len(b) < 8 || binary.BigEndian.Uint32(b) == 0 {
+		return "", errors.New("no rows")
+	}
+	n := int(int32(binary.BigEndian.Uint32(b[4:])))
+	b = b[8:]
+	if n < 0 || len(b) < n {
+		return "", errors.New("truncated cell")
+	}
+	return string(b[:n]), nil
+}
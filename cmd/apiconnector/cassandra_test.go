@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+)
+
+// cassandraServer answers CQL requests on conn, rejecting protocol versions
+// above maxVersion and requiring cassandra/cassandra when auth is set.
+func cassandraServer(conn net.Conn, maxVersion byte, auth bool) {
+	for {
+		header := make([]byte, 9)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		body := make([]byte, binary.BigEndian.Uint32(header[5:]))
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return
+		}
+		version := header[0]
+		reply := func(op byte, b []byte) {
+			frame := []byte{0x80 | version, 0, 0, 0, op}
+			frame = binary.BigEndian.AppendUint32(frame, uint32(len(b)))
+			conn.Write(append(frame, b...))
+		}
+		replyError := func(code uint32, msg string) {
+			reply(cqlOpError, cqlAppendString(binary.BigEndian.AppendUint32(nil, code), msg))
+		}
+
+		if version > maxVersion {
+			replyError(cqlProtocolError, "Invalid or unsupported protocol version")
+			return
+		}
+		switch header[4] {
+		case cqlOpOptions:
+			b := binary.BigEndian.AppendUint16(nil, 1)
+			b = cqlAppendString(b, "CQL_VERSION")
+			b = binary.BigEndian.AppendUint16(b, 1)
+			reply(cqlOpSupported, cqlAppendString(b, "3.4.5"))
+		case cqlOpStartup:
+			if auth {
+				reply(cqlOpAuthenticate, cqlAppendString(nil, "org.apache.cassandra.auth.PasswordAuthenticator"))
+			} else {
+				reply(cqlOpReady, nil)
+			}
+		case cqlOpAuthResponse:
+			if !bytes.Equal(body[4:], []byte("\x00cassandra\x00cassandra")) {
+				replyError(0x0100, "Provided username and/or password are incorrect")
+				return
+			}
+			reply(cqlOpAuthSuccess, binary.BigEndian.AppendUint32(nil, 0xFFFFFFFF))
+		case cqlOpQuery:
+			b := binary.BigEndian.AppendUint32(nil, 2) // Rows
+			b = binary.BigEndian.AppendUint32(b, 1)    // global_tables_spec
+			b = binary.BigEndian.AppendUint32(b, 1)
+			b = cqlAppendString(cqlAppendString(b, "system"), "local")
+			b = cqlAppendString(b, "release_version")
+			b = binary.BigEndian.AppendUint16(b, 0x000D)
+			b = binary.BigEndian.AppendUint32(b, 1)
+			reply(cqlOpResult, cqlAppendBytes(b, []byte("4.1.4")))
+		}
+	}
+}
+
+func TestCheckCassandra(t *testing.T) {
+	tests := []struct {
+		name   string
+		url    string
+		auth   bool
+		status string
+	}{
+		{"no auth", "cassandra://%s", false, "OK"},
+		{"auth", "cassandra://cassandra:cassandra@%s", true, "OK"},
+		{"bad password", "cassandra://cassandra:wrong@%s", true, "FAIL"},
+		{"missing credentials", "cassandra://%s", true, "FAIL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := serveOnce(t, func(conn net.Conn) { cassandraServer(conn, 4, tt.auth) })
+			test := parseTestConfig("db=" + fmt.Sprintf(tt.url, addr) + " query")
+			status, _, errMsg := checkCassandra(context.Background(), &test)
+			if status != tt.status {
+				t.Fatalf("checkCassandra = %s (%s), want %s", status, errMsg, tt.status)
+			}
+			if status == "OK" && (test.Details["protocol"] != "v4" || test.Details["release_version"] != "4.1.4") {
+				t.Errorf("Details = %v, want protocol=v4 release_version=4.1.4", test.Details)
+			}
+		})
+	}
+}
+
+func TestCheckCassandraProtocolFallback(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				cassandraServer(conn, 3, false)
+			}()
+		}
+	}()
+
+	test := &ConnectionTest{URL: "cassandra://" + lis.Addr().String()}
+	if status, _, errMsg := checkCassandra(context.Background(), test); status != "OK" {
+		t.Fatalf("checkCassandra = %s (%s), want OK", status, errMsg)
+	}
+	if test.Details["protocol"] != "v3" {
+		t.Errorf("protocol = %q, want v3", test.Details["protocol"])
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+)
+
+var showCerts = flag.Bool("show-certs", false, "print the certificate chain presented by each TLS target")
+
+// recordChain keeps the certificate chain a server presented in test.Certs
+// for -show-certs, with the "chain" detail (see chainIssue).
+func recordChain(test *ConnectionTest, certs []*x509.Certificate, roots *x509.CertPool) {
+	test.Certs, test.ChainIssue = certs, chainIssue(certs, roots)
+	if test.ChainIssue != "" {
+		setDetail(test, "chain", "incomplete")
+	} else {
+		setDetail(test, "chain", "complete")
+	}
+}
+
+// recordChainError records the chain from a failed certificate
+// verification for -show-certs: crypto/tls aborts the handshake before
+// VerifyConnection runs, which would hide exactly the chains worth looking
+// at.
+func recordChainError(test *ConnectionTest, err error) {
+	var certErr *tls.CertificateVerificationError
+	if *showCerts && errors.As(err, &certErr) {
+		roots, _ := rootCAs(test)
+		recordChain(test, certErr.UnverifiedCertificates, roots)
+	}
+}
+
+// chainIssue follows the presented chain from the leaf through the
+// certificates that issued each other and describes the gap when it ends in
+// neither a self-signed certificate nor one issued by a trusted root: the
+// server is not sending an intermediate, which only clients that fetch or
+// cache intermediates tolerate. It returns "" for a complete chain.
+func chainIssue(certs []*x509.Certificate, roots *x509.CertPool) string {
+	if len(certs) == 0 {
+		return ""
+	}
+	cert := chainEnd(certs)
+	if bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+		return ""
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); err == nil {
+		return ""
+	}
+	return fmt.Sprintf("issuer %q of %q not presented", cert.Issuer.String(), cert.Subject.String())
+}
+
+// chainEnd returns the last certificate reached from the leaf by following
+// issuers among the presented certificates, in any order.
+func chainEnd(certs []*x509.Certificate) *x509.Certificate {
+	cert, used := certs[0], map[int]bool{0: true}
+	for {
+		next := -1
+		for i, c := range certs {
+			if !used[i] && bytes.Equal(cert.RawIssuer, c.RawSubject) && cert.CheckSignatureFrom(c) == nil {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			return cert
+		}
+		cert, used[next] = certs[next], true
+	}
+}
+
+// formatCerts renders test.Certs for -show-certs: subject, issuer, SANs,
+// key type and validity of each certificate, and a note when the chain is
+// incomplete. It returns "" when no chain was recorded.
+func formatCerts(test *ConnectionTest) string {
+	if len(test.Certs) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	for i, cert := range test.Certs {
+		fmt.Fprintf(&b, "  [%d] %s\n", i, cert.Subject)
+		fmt.Fprintf(&b, "      issuer:  %s\n", cert.Issuer)
+		if sans := certSANs(cert); len(sans) > 0 {
+			fmt.Fprintf(&b, "      sans:    %s\n", strings.Join(sans, ", "))
+		}
+		fmt.Fprintf(&b, "      key:     %s\n", keyType(cert))
+		fmt.Fprintf(&b, "      valid:   %s to %s\n", cert.NotBefore.UTC().Format("2006-01-02"), cert.NotAfter.UTC().Format("2006-01-02"))
+	}
+	if test.ChainIssue != "" {
+		fmt.Fprintf(&b, "  chain incomplete: %s\n", test.ChainIssue)
+	}
+	return b.String()
+}
+
+// certSANs lists the DNS names, IP addresses, email addresses and URIs a
+// certificate is valid for.
+func certSANs(cert *x509.Certificate) []string {
+	sans := append([]string{}, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+	return sans
+}
+
+// keyType describes a certificate's public key, e.g. "RSA 2048" or
+// "ECDSA P-256".
+func keyType(cert *x509.Certificate) string {
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d", key.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ECDSA " + key.Curve.Params().Name
+	case ed25519.PublicKey:
+		return "Ed25519"
+	}
+	return cert.PublicKeyAlgorithm.String()
+}
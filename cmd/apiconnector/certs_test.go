@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// issueCert creates a certificate for name signed by parent (self-signed
+// when parent is nil), applying any edits to the template. CA certificates
+// can sign further ones.
+func issueCert(t *testing.T, name string, ca bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, edits ...func(*x509.Certificate)) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(90 * 24 * time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  ca,
+	}
+	if ca {
+		tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	} else {
+		tmpl.DNSNames = []string{name}
+		tmpl.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	}
+	for _, edit := range edits {
+		edit(tmpl)
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestShowCerts(t *testing.T) {
+	root, rootKey := issueCert(t, "Test Root", true, nil, nil)
+	inter, interKey := issueCert(t, "Test Intermediate", true, root, rootKey)
+	leaf, leafKey := issueCert(t, "api.test", false, inter, interKey)
+
+	serve := func(chain ...*x509.Certificate) string {
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		cert := tls.Certificate{PrivateKey: leafKey}
+		for _, c := range chain {
+			cert.Certificate = append(cert.Certificate, c.Raw)
+		}
+		srv.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+		srv.StartTLS()
+		t.Cleanup(srv.Close)
+		return strings.TrimPrefix(srv.URL, "https://")
+	}
+	complete, incomplete := serve(leaf, inter), serve(leaf)
+
+	tlsRootCAs = x509.NewCertPool()
+	tlsRootCAs.AddCert(root)
+	*showCerts = true
+	defer func() { tlsRootCAs, *showCerts = nil, false }()
+
+	test := parseTestConfig("edge=tls://" + complete)
+	if status, _, errMsg := checkTLS(context.Background(), &test); status != "OK" || test.Details["chain"] != "complete" {
+		t.Errorf("checkTLS with full chain = %s (%s) %v, want OK chain=complete", status, errMsg, test.Details)
+	}
+	out := formatCerts(&test)
+	for _, want := range []string{"[0] CN=api.test", "[1] CN=Test Intermediate", "issuer:  CN=Test Root", "sans:    api.test, 127.0.0.1", "key:     ECDSA P-256", "valid:   "} {
+		if !strings.Contains(out, want) {
+			t.Errorf("formatCerts = %q, want %q", out, want)
+		}
+	}
+	if strings.Contains(out, "incomplete") {
+		t.Errorf("formatCerts = %q, want no chain note", out)
+	}
+
+	// A missing intermediate fails verification, but the chain is still
+	// recorded and the gap named.
+	test = parseTestConfig("edge=tls://" + incomplete)
+	if status, _, errMsg := checkTLS(context.Background(), &test); status != "FAIL" || !strings.Contains(errMsg, "unknown authority") || test.Details["chain"] != "incomplete" {
+		t.Errorf("checkTLS with missing intermediate = %s (%s) %v, want FAIL chain=incomplete", status, errMsg, test.Details)
+	}
+	if out := formatCerts(&test); !strings.Contains(out, `chain incomplete: issuer "CN=Test Intermediate" of "CN=api.test" not presented`) {
+		t.Errorf("formatCerts = %q, want chain incomplete note", out)
+	}
+
+	test = parseTestConfig("edge=https://" + complete)
+	if status, _, errMsg := checkHTTP(context.Background(), &test); status != "OK" || len(test.Certs) != 2 {
+		t.Errorf("checkHTTP with -show-certs = %s (%s), %d certs, want OK with 2", status, errMsg, len(test.Certs))
+	}
+}
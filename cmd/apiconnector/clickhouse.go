@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// checkClickHouse runs "SELECT version()" over the ClickHouse HTTP interface
+// (clickhouse:// on port 8123, clickhouses:// over HTTPS on 8443) and reports
+// the server version, proving queries execute rather than just that the
+// port answers. URL credentials are sent as X-ClickHouse-User/Key.
+func checkClickHouse(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	u, err := url.Parse(test.URL)
+	if err != nil || u.Hostname() == "" {
+		return "ERROR", 0, "Invalid URL"
+	}
+
+	target := url.URL{Scheme: "http", Host: hostPort(u, "8123"), Path: "/"}
+	if u.Scheme == "clickhouses" {
+		target.Scheme, target.Host = "https", hostPort(u, "8443")
+	}
+
+	start := time.Now()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", target.String(), strings.NewReader("SELECT version()"))
+	if err != nil {
+		return "ERROR", 0, fmt.Sprintf("Request creation error: %v", err)
+	}
+	if u.User != nil {
+		req.Header.Set("X-ClickHouse-User", u.User.Username())
+		if password, ok := u.User.Password(); ok {
+			req.Header.Set("X-ClickHouse-Key", password)
+		}
+	}
+
+	resp, err := newHTTPClient(test).Do(req)
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("HTTP error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("Read error: %v", err)
+	}
+	latency := time.Since(start)
+
+	if code := resp.Header.Get("X-ClickHouse-Exception-Code"); code != "" || resp.StatusCode != http.StatusOK {
+		msg := strings.TrimSpace(string(body))
+		if i := strings.IndexByte(msg, '\n'); i >= 0 {
+			msg = msg[:i]
+		}
+		return "FAIL", 0, fmt.Sprintf("Query failed (HTTP %d): %s", resp.StatusCode, msg)
+	}
+
+	version := strings.TrimSpace(string(body))
+	if version == "" {
+		return "FAIL", 0, "Empty query result"
+	}
+	setDetail(test, "version", version)
+
+	return "OK", latency, ""
+}
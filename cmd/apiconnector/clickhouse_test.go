@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckClickHouse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query, _ := io.ReadAll(r.Body)
+		if r.Header.Get("X-ClickHouse-User") != "default" || r.Header.Get("X-ClickHouse-Key") != "secret" {
+			w.Header().Set("X-ClickHouse-Exception-Code", "516")
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte("Code: 516. DB::Exception: default: Authentication failed. (AUTHENTICATION_FAILED)\n"))
+			return
+		}
+		if string(query) != "SELECT version()" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte("24.3.1.2672\n"))
+	}))
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "http://")
+
+	tests := []struct {
+		userinfo string
+		status   string
+	}{
+		{"default:secret@", "OK"},
+		{"default:wrong@", "FAIL"},
+	}
+	for _, tt := range tests {
+		test := &ConnectionTest{URL: "clickhouse://" + tt.userinfo + addr}
+		status, _, errMsg := checkClickHouse(context.Background(), test)
+		if status != tt.status {
+			t.Errorf("checkClickHouse(%q) = %s (%s), want %s", test.URL, status, errMsg, tt.status)
+		}
+		if status == "OK" && test.Details["version"] != "24.3.1.2672" {
+			t.Errorf("version = %q, want 24.3.1.2672", test.Details["version"])
+		}
+	}
+}
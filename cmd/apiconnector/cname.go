@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// defaultMaxCNAME is how many CNAME hops the "cname" option allows before
+// a check WARNs, when it names no limit.
+const defaultMaxCNAME = 3
+
+// maxCNAMEChain bounds the chains traceCNAME follows, as a guard against
+// CNAME loops.
+const maxCNAMEChain = 16
+
+// traceCNAME queries server, the resolver that answered a lookup of host,
+// for its qtype records and follows the CNAME records in the answers. It
+// records "cname" with the names the chain leads through
+// ("example.cdn.net->edge.cdn.net"), "answers" with the final addresses
+// and "ttl" with their lowest TTL, and returns the name the chain dangles
+// at, with no records and no further CNAME, or "" when it resolves.
+func traceCNAME(ctx context.Context, test *ConnectionTest, server, host string, qtype dnsmessage.Type) (string, error) {
+	name := strings.ToLower(strings.TrimSuffix(host, ".")) + "."
+	var chain []string
+	for {
+		msg, err := cnameQuery(ctx, test, server, name, qtype)
+		if err != nil {
+			return "", err
+		}
+
+		advanced := false
+		for follow := true; follow; {
+			follow = false
+			for _, rr := range msg.Answers {
+				target, ok := rr.Body.(*dnsmessage.CNAMEResource)
+				if !ok || !strings.EqualFold(rr.Header.Name.String(), name) {
+					continue
+				}
+				name = strings.ToLower(target.CNAME.String())
+				chain = append(chain, strings.TrimSuffix(name, "."))
+				if len(chain) > maxCNAMEChain {
+					return "", fmt.Errorf("CNAME chain longer than %d", maxCNAMEChain)
+				}
+				follow, advanced = true, true
+			}
+		}
+		if len(chain) > 0 {
+			setDetail(test, "cname", strings.Join(chain, "->"))
+		}
+
+		var answers []string
+		var ttl uint32
+		for _, rr := range msg.Answers {
+			if rr.Header.Type != qtype || !strings.EqualFold(rr.Header.Name.String(), name) {
+				continue
+			}
+			switch body := rr.Body.(type) {
+			case *dnsmessage.AResource:
+				answers = append(answers, net.IP(body.A[:]).String())
+			case *dnsmessage.AAAAResource:
+				answers = append(answers, net.IP(body.AAAA[:]).String())
+			}
+			if len(answers) == 1 || rr.Header.TTL < ttl {
+				ttl = rr.Header.TTL
+			}
+		}
+		if len(answers) > 0 {
+			setDetail(test, "answers", strings.Join(answers, ","))
+			setDetail(test, "ttl", (time.Duration(ttl) * time.Second).String())
+			return "", nil
+		}
+		// A resolver may stop partway along a long chain, so the last name
+		// is asked for once more before calling it dangling.
+		if !advanced {
+			if len(chain) == 0 {
+				return "", nil
+			}
+			return chain[len(chain)-1], nil
+		}
+	}
+}
+
+// cnameQuery sends one query to the DNS server at server over the same
+// transport as test's lookups.
+func cnameQuery(ctx context.Context, test *ConnectionTest, server, name string, qtype dnsmessage.Type) (*dnsmessage.Message, error) {
+	query, id, err := dnsBuildQuery(name, qtype)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialDNS(ctx, test, "udp", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(testTimeout(test)))
+
+	var reply []byte
+	if _, ok := conn.(net.PacketConn); ok {
+		if _, err := conn.Write(query); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, 65535)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		reply = buf[:n]
+	} else if reply, err = dnsExchangeStream(conn, query); err != nil {
+		return nil, err
+	}
+	return dnsParseReply(reply, id)
+}
+
+// cnameStatus applies the "cname" option's chain limit to a completed test
+// that recorded a "cname" chain: more hops than the limit (default
+// defaultMaxCNAME) degrade it to WARN, as every hop adds a lookup and a
+// dependency on another zone.
+func cnameStatus(test *ConnectionTest) (string, string) {
+	v, chain := test.Options["cname"], test.Details["cname"]
+	if test.Error != "" || v == "" || v == "false" {
+		return test.Status, test.Error
+	}
+	limit := defaultMaxCNAME
+	if v != "true" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit < 0 {
+			return "ERROR", fmt.Sprintf("Invalid cname %q", v)
+		}
+	}
+	if hops := strings.Count(chain, "->") + 1; chain != "" && hops > limit {
+		setDetail(test, "cname_hops", strconv.Itoa(hops))
+		return "WARN", ""
+	}
+	return test.Status, test.Error
+}
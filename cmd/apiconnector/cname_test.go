@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestCNAMEChain(t *testing.T) {
+	chains := map[string][]string{
+		"www.test.": {"a.test.", "b.test."},
+		"bad.test.": {"gone.test."},
+	}
+	server := serveDNS(t, func(b *dnsmessage.Builder, q dnsmessage.Question) {
+		name := q.Name
+		for _, target := range chains[q.Name.String()] {
+			next := dnsmessage.MustNewName(target)
+			b.CNAMEResource(dnsmessage.ResourceHeader{Name: name, Class: dnsmessage.ClassINET, TTL: 300}, dnsmessage.CNAMEResource{CNAME: next})
+			name = next
+		}
+		if q.Type == dnsmessage.TypeA && name.String() != "gone.test." {
+			b.AResource(dnsmessage.ResourceHeader{Name: name, Class: dnsmessage.ClassINET, TTL: 60}, dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}})
+		}
+	})
+
+	test := parseTestConfig("api=https://www.test cname dns_server=" + server)
+	ips, err := lookupHost(context.Background(), &test, "tcp4", "www.test")
+	if err != nil || len(ips) != 1 {
+		t.Fatalf("lookupHost = %v, %v", ips, err)
+	}
+	if test.Details["cname"] != "a.test->b.test" || test.Details["answers"] != "127.0.0.1" || test.Details["ttl"] != "1m0s" {
+		t.Errorf("details = %v, want cname=a.test->b.test answers=127.0.0.1 ttl=1m0s", test.Details)
+	}
+	if status, _ := cnameStatus(&test); status == "WARN" {
+		t.Errorf("cnameStatus with 2 hops = WARN, want the default limit of %d to pass", defaultMaxCNAME)
+	}
+	test.Options["cname"] = "1"
+	if status, _ := cnameStatus(&test); status != "WARN" || test.Details["cname_hops"] != "2" {
+		t.Errorf("cnameStatus with cname=1 = %s %v, want WARN cname_hops=2", status, test.Details)
+	}
+	test.Options["cname"] = "many"
+	if status, errMsg := cnameStatus(&test); status != "ERROR" {
+		t.Errorf("cnameStatus with cname=many = %s (%s), want ERROR", status, errMsg)
+	}
+
+	test = parseTestConfig("api=https://bad.test cname dns_server=" + server)
+	_, err = lookupHost(context.Background(), &test, "tcp4", "bad.test")
+	if err == nil || !strings.Contains(err.Error(), "dangling CNAME to gone.test") || test.Details["cname_dangling"] != "gone.test" {
+		t.Errorf("lookupHost of dangling CNAME = %v %v, want dangling CNAME to gone.test", err, test.Details)
+	}
+}
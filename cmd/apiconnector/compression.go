@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// acceptEncoding returns the Accept-Encoding offered by HTTP checks with the
+// "compression" option: gzip, which decodeBody can decode for assertions,
+// and br only when "compression=br" asks for it.
+func acceptEncoding(test *ConnectionTest) string {
+	if test.Options["compression"] == "br" {
+		return "gzip, br"
+	}
+	return "gzip"
+}
+
+// decodeBody handles a response body read by readBody under the
+// "compression" option. The request offered acceptEncoding itself, so Go's
+// transport left the body encoded: decodeBody records the encoding the
+// server chose and the body size on the wire ("compressed", from size) and
+// decoded ("size"), and returns the decoded body. Brotli bodies, only
+// offered under "compression=br", cannot be decoded and are returned as
+// received.
+func decodeBody(test *ConnectionTest, resp *http.Response, raw []byte, size int64) ([]byte, error) {
+	encoding := strings.ToLower(resp.Header.Get("Content-Encoding"))
+	if encoding == "" {
+		encoding = "identity"
+	}
+	setDetail(test, "encoding", encoding)
+	setDetail(test, "compressed", strconv.FormatInt(size, 10))
+
+	body := raw
+	switch encoding {
+	case "identity":
+	case "gzip":
+		zr, err := gzip.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return nil, fmt.Errorf("gzip: %v", err)
+		}
+		if body, err = io.ReadAll(io.LimitReader(zr, maxBodySize)); err != nil {
+			return nil, fmt.Errorf("gzip: %v", err)
+		}
+	default:
+		return raw, nil
+	}
+	setDetail(test, "size", strconv.Itoa(len(body)))
+	return body, nil
+}
+
+// checkCompression applies the "compression" option to the encoding
+// recorded by decodeBody: "required" fails an uncompressed response, and an
+// encoding name ("gzip", "br") requires that encoding. It returns a failure
+// message, or "".
+func checkCompression(test *ConnectionTest) string {
+	want, got := test.Options["compression"], test.Details["encoding"]
+	switch want {
+	case "", "true":
+		return ""
+	case "required":
+		if got == "identity" {
+			return "Response not compressed"
+		}
+		return ""
+	}
+	if got != want {
+		return fmt.Sprintf("Response encoding is %s, want %s", got, want)
+	}
+	return ""
+}
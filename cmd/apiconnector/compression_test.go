@@ -0,0 +1,55 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCheckHTTPCompression(t *testing.T) {
+	payload := strings.Repeat(`{"status":"ok"}`, 100)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/gzip" && strings.Contains(r.Header.Get("Accept-Encoding"), "gzip"):
+			w.Header().Set("Content-Encoding", "gzip")
+			zw := gzip.NewWriter(w)
+			zw.Write([]byte(payload))
+			zw.Close()
+		case r.URL.Path == "/br" && strings.Contains(r.Header.Get("Accept-Encoding"), "br"):
+			w.Header().Set("Content-Encoding", "br")
+			w.Write([]byte{0x1b, 0x00})
+		default:
+			w.Write([]byte(payload))
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		target   string
+		status   string
+		encoding string
+	}{
+		{"/gzip compression", "OK", "gzip"},
+		{"/gzip compression=required expect_body=status", "OK", "gzip"},
+		{"/plain compression", "OK", "identity"},
+		{"/plain compression=required", "FAIL", "identity"},
+		{"/br compression=br", "OK", "br"},
+		{"/br compression", "OK", "identity"},
+		{"/br compression=required", "FAIL", "identity"},
+		{"/gzip compression=br", "FAIL", "gzip"},
+	}
+	for _, tt := range tests {
+		test := parseTestConfig("api=" + srv.URL + tt.target)
+		status, _, errMsg := checkHTTP(context.Background(), &test)
+		if status != tt.status || test.Details["encoding"] != tt.encoding {
+			t.Errorf("checkHTTP(%s) = %s (%s) %v, want %s with encoding %s", tt.target, status, errMsg, test.Details, tt.status, tt.encoding)
+		}
+		if compressed, _ := strconv.Atoi(test.Details["compressed"]); tt.encoding == "gzip" && (test.Details["size"] != "1500" || compressed >= 1500) {
+			t.Errorf("checkHTTP(%s) sizes = %s/%s, want compressed below 1500/1500", tt.target, test.Details["compressed"], test.Details["size"])
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configTargets holds the targets listed in -config files, checked before
+// those on the command line.
+var configTargets []string
+
+func init() {
+	flag.Var(configFile{defaultHeaders, &configTargets}, "config", "YAML `file` of targets and defaults such as headers for all HTTP targets (see config.yaml)")
+}
+
+// config is the layout of a -config file. Targets use the command line
+// syntax; the defaults apply to every HTTP target like the -user-agent and
+// -header flags.
+type config struct {
+	Defaults struct {
+		UserAgent string            `yaml:"user_agent"`
+		Headers   map[string]string `yaml:"headers"`
+	} `yaml:"defaults"`
+	Targets []string `yaml:"targets"`
+}
+
+// configFile loads -config flags into the default headers and the target
+// list. The -user-agent and -header flags win over a file's defaults,
+// whichever order they are given in, as does an earlier file.
+type configFile struct {
+	headers headerFlags
+	targets *[]string
+}
+
+func (c configFile) String() string { return "" }
+
+func (c configFile) Set(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var cfg config
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && err != io.EOF {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	for name, value := range cfg.Defaults.Headers {
+		if !headerNamePattern.MatchString(name) {
+			return fmt.Errorf("%s: invalid header name %q", path, name)
+		}
+		if _, ok := c.headers[http.CanonicalHeaderKey(name)]; !ok {
+			c.headers[http.CanonicalHeaderKey(name)] = value
+		}
+	}
+	if cfg.Defaults.UserAgent != "" && *userAgent == "" {
+		*userAgent = cfg.Defaults.UserAgent
+	}
+	*c.targets = append(*c.targets, cfg.Targets...)
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigFile(t *testing.T) {
+	defer func(ua string) { *userAgent = ua }(*userAgent)
+	*userAgent = ""
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte(`
+defaults:
+  user_agent: uptime-probe/1.0
+  headers:
+    x-env: prod
+    X-Team: payments
+targets:
+  - api=http://localhost:8080/health
+  - db=postgres://localhost:5432
+`), 0o644)
+
+	headers := headerFlags{"X-Team": "platform"}
+	var targets []string
+	if err := (configFile{headers, &targets}).Set(path); err != nil {
+		t.Fatal(err)
+	}
+	if want := "X-Env: prod, X-Team: platform"; headers.String() != want {
+		t.Errorf("headers = %v, want %s with the -header flag winning", headers, want)
+	}
+	if *userAgent != "uptime-probe/1.0" {
+		t.Errorf("user agent = %q, want uptime-probe/1.0", *userAgent)
+	}
+	if strings.Join(targets, " ") != "api=http://localhost:8080/health db=postgres://localhost:5432" {
+		t.Errorf("targets = %q", targets)
+	}
+
+	for _, bad := range []string{"defaults:\n  header:\n    X-Env: prod\n", "defaults:\n  headers:\n    \"X Env\": prod\n"} {
+		os.WriteFile(path, []byte(bad), 0o644)
+		if err := (configFile{headerFlags{}, &targets}).Set(path); err == nil {
+			t.Errorf("Set(%q) = nil, want an error", bad)
+		}
+	}
+}
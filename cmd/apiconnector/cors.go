@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// corsPreflight sends the OPTIONS preflight a browser would send before a
+// cross-origin request to test's URL, from the origin in the "cors" option.
+// The requested method is the test's method (GET by default) unless
+// "cors_method" names another, and "cors_headers" lists the request headers
+// to ask for, comma-separated. The response must allow the origin, the
+// method and each header. It returns a failure message, or "".
+func corsPreflight(ctx context.Context, client *http.Client, test *ConnectionTest) string {
+	origin := test.Options["cors"]
+	method := test.Options["cors_method"]
+	if method == "" {
+		method = test.Method
+	}
+	if method == "" {
+		method = http.MethodGet
+	}
+	method = strings.ToUpper(method)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodOptions, test.URL, nil)
+	if err != nil {
+		return fmt.Sprintf("Request creation error: %v", err)
+	}
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Access-Control-Request-Method", method)
+	var headers []string
+	if v := test.Options["cors_headers"]; v != "" {
+		headers = strings.Split(v, ",")
+		req.Header.Set("Access-Control-Request-Headers", strings.ToLower(v))
+	}
+
+	// Browsers do not follow redirects of a preflight.
+	preflight := *client
+	preflight.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	resp, err := preflight.Do(req)
+	if err != nil {
+		return fmt.Sprintf("CORS preflight error: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Sprintf("CORS preflight returned HTTP %d", resp.StatusCode)
+	}
+	allowOrigin := resp.Header.Get("Access-Control-Allow-Origin")
+	if allowOrigin != "*" && allowOrigin != origin {
+		return fmt.Sprintf("CORS origin %s not allowed (Access-Control-Allow-Origin: %q)", origin, allowOrigin)
+	}
+	setDetail(test, "cors_origin", allowOrigin)
+
+	// Simple methods need not be listed.
+	simple := method == http.MethodGet || method == http.MethodHead || method == http.MethodPost
+	allowMethods := resp.Header.Get("Access-Control-Allow-Methods")
+	if !simple && !corsListAllows(allowMethods, method) {
+		return fmt.Sprintf("CORS method %s not allowed (Access-Control-Allow-Methods: %q)", method, allowMethods)
+	}
+
+	allowHeaders := resp.Header.Get("Access-Control-Allow-Headers")
+	for _, h := range headers {
+		if h = strings.TrimSpace(h); h != "" && !corsListAllows(allowHeaders, h) {
+			return fmt.Sprintf("CORS header %s not allowed (Access-Control-Allow-Headers: %q)", h, allowHeaders)
+		}
+	}
+	return ""
+}
+
+// corsListAllows reports whether a comma-separated Access-Control-Allow-*
+// list contains name, case-insensitively, or the "*" wildcard.
+func corsListAllows(list, name string) bool {
+	for _, v := range strings.Split(list, ",") {
+		if v = strings.TrimSpace(v); v == "*" || strings.EqualFold(v, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckHTTPCORS(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			if r.Header.Get("Origin") == "https://app.example.com" {
+				w.Header().Set("Access-Control-Allow-Origin", "https://app.example.com")
+				w.Header().Set("Access-Control-Allow-Methods", "GET, PUT")
+				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		options string
+		status  string
+	}{
+		{"cors=https://app.example.com", "OK"},
+		{"cors=https://evil.example.com", "FAIL"},
+		{"cors=https://app.example.com cors_method=PUT cors_headers=Content-Type,authorization", "OK"},
+		{"cors=https://app.example.com cors_method=DELETE", "FAIL"},
+		{"cors=https://app.example.com cors_headers=X-Trace-Id", "FAIL"},
+	}
+	for _, tt := range tests {
+		test := parseTestConfig("api=" + srv.URL + " " + tt.options)
+		if status, _, errMsg := checkHTTP(context.Background(), &test); status != tt.status {
+			t.Errorf("checkHTTP(%s) = %s (%s), want %s", tt.options, status, errMsg, tt.status)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build go1.25
+
+package main
+
+import "crypto/tls"
+
+// curveName returns the key exchange group negotiated on a TLS connection.
+func curveName(state tls.ConnectionState) string {
+	if state.CurveID == 0 {
+		return ""
+	}
+	return state.CurveID.String()
+}
@@ -0,0 +1,11 @@
+//go:build !go1.25
+
+package main
+
+import "crypto/tls"
+
+// curveName returns "": crypto/tls only reports the negotiated key
+// exchange group from Go 1.25.
+func curveName(state tls.ConnectionState) string {
+	return ""
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// digestTransport answers HTTP Digest authentication challenges (RFC 7616)
+// for the "digest_auth" option: a request refused with a 401 Digest
+// challenge is sent once more with the computed Authorization header.
+// MD5 and SHA-256, their -sess variants and qop=auth are supported.
+type digestTransport struct {
+	base           http.RoundTripper
+	user, password string
+}
+
+// newDigestTransport wraps base for a "digest_auth=user[:password]" option;
+// without a password, $DIGEST_AUTH_PASSWORD is used.
+func newDigestTransport(base http.RoundTripper, auth string) digestTransport {
+	user, password, ok := strings.Cut(auth, ":")
+	if !ok {
+		password = os.Getenv("DIGEST_AUTH_PASSWORD")
+	}
+	return digestTransport{base: base, user: user, password: password}
+}
+
+func (t digestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	challenge := digestChallenge(resp.Header.Values("WWW-Authenticate"))
+	if challenge == nil || (req.Body != nil && req.GetBody == nil) {
+		return resp, nil
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	auth, err := digestAuthorization(challenge, t.user, t.password, req.Method, req.URL.RequestURI())
+	if err != nil {
+		return nil, err
+	}
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	retry.Header.Set("Authorization", auth)
+	return t.base.RoundTrip(retry)
+}
+
+// digestChallenge returns the parameters of the best Digest challenge among
+// WWW-Authenticate values, preferring SHA-256 over MD5, or nil if there is
+// none.
+func digestChallenge(values []string) map[string]string {
+	var best map[string]string
+	for _, v := range values {
+		scheme, rest, _ := strings.Cut(strings.TrimSpace(v), " ")
+		if !strings.EqualFold(scheme, "Digest") {
+			continue
+		}
+		params := digestParams(rest)
+		if digestHash(params["algorithm"]) == nil {
+			continue
+		}
+		if best == nil || strings.HasPrefix(strings.ToUpper(params["algorithm"]), "SHA-256") {
+			best = params
+		}
+	}
+	return best
+}
+
+// digestParams parses comma-separated key=value pairs whose values may be
+// quoted strings containing commas.
+func digestParams(s string) map[string]string {
+	params := make(map[string]string)
+	for s = strings.TrimSpace(s); s != ""; {
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		rest = strings.TrimSpace(rest)
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			var b strings.Builder
+			i := 1
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+				}
+				b.WriteByte(rest[i])
+			}
+			value, rest = b.String(), rest[min(i+1, len(rest)):]
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+			value = strings.TrimSpace(value)
+			rest = "," + rest
+		}
+		params[key] = value
+
+		_, s, _ = strings.Cut(rest, ",")
+		s = strings.TrimSpace(s)
+	}
+	return params
+}
+
+// digestHash returns the hash constructor for a Digest algorithm name
+// (MD5 when empty), or nil if it is unsupported.
+func digestHash(algorithm string) func() hash.Hash {
+	switch strings.TrimSuffix(strings.ToUpper(algorithm), "-SESS") {
+	case "", "MD5":
+		return md5.New
+	case "SHA-256":
+		return sha256.New
+	}
+	return nil
+}
+
+// digestAuthorization computes the Authorization header answering
+// challenge for a request with method and uri.
+func digestAuthorization(challenge map[string]string, user, password, method, uri string) (string, error) {
+	newHash := digestHash(challenge["algorithm"])
+	h := func(parts ...string) string {
+		d := newHash()
+		io.WriteString(d, strings.Join(parts, ":"))
+		return hex.EncodeToString(d.Sum(nil))
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	cnonce, nc := hex.EncodeToString(b), "00000001"
+	realm, nonce := challenge["realm"], challenge["nonce"]
+
+	ha1 := h(user, realm, password)
+	if strings.HasSuffix(strings.ToUpper(challenge["algorithm"]), "-SESS") {
+		ha1 = h(ha1, nonce, cnonce)
+	}
+	ha2 := h(method, uri)
+
+	qop := ""
+	for _, q := range strings.Split(challenge["qop"], ",") {
+		if strings.TrimSpace(q) == "auth" {
+			qop = "auth"
+		}
+	}
+	if challenge["qop"] != "" && qop == "" {
+		return "", fmt.Errorf("digest auth: unsupported qop %q", challenge["qop"])
+	}
+
+	var response string
+	if qop != "" {
+		response = h(ha1, nonce, nc, cnonce, qop, ha2)
+	} else {
+		response = h(ha1, nonce, ha2)
+	}
+
+	header := fmt.Sprintf(`Digest username=%q, realm=%q, nonce=%q, uri=%q, response=%q`, user, realm, nonce, uri, response)
+	if alg := challenge["algorithm"]; alg != "" {
+		header += ", algorithm=" + alg
+	}
+	if qop != "" {
+		header += fmt.Sprintf(`, qop=%s, nc=%s, cnonce=%q`, qop, nc, cnonce)
+	}
+	if opaque, ok := challenge["opaque"]; ok {
+		header += fmt.Sprintf(`, opaque=%q`, opaque)
+	}
+	return header, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// digestServer protects every path with Digest auth for user "admin" and
+// password "cam3ra", using the algorithm named by the "alg" query parameter.
+func digestServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		alg := r.URL.Query().Get("alg")
+		h := func(s string) string {
+			if strings.HasPrefix(alg, "SHA-256") {
+				return fmt.Sprintf("%x", sha256.Sum256([]byte(s)))
+			}
+			return fmt.Sprintf("%x", md5.Sum([]byte(s)))
+		}
+
+		auth, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Digest ")
+		if ok {
+			p := digestParams(auth)
+			ha1 := h("admin:cameras:cam3ra")
+			if strings.HasSuffix(alg, "-sess") {
+				ha1 = h(ha1 + ":n0nce:" + p["cnonce"])
+			}
+			want := h(ha1 + ":n0nce:" + p["nc"] + ":" + p["cnonce"] + ":auth:" + h(r.Method+":"+p["uri"]))
+			body, _ := io.ReadAll(r.Body)
+			if p["username"] == "admin" && p["response"] == want && p["opaque"] == "op,aque" && p["uri"] == r.URL.RequestURI() && string(body) == r.URL.Query().Get("body") {
+				return
+			}
+		}
+		if alg != "" {
+			alg = ", algorithm=" + alg
+		}
+		w.Header().Add("WWW-Authenticate", `Basic realm="cameras"`)
+		w.Header().Add("WWW-Authenticate", `Digest realm="cameras", qop="auth,auth-int", nonce="n0nce", opaque="op,aque"`+alg)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+}
+
+func TestCheckHTTPDigestAuth(t *testing.T) {
+	srv := digestServer(t)
+	defer srv.Close()
+
+	tests := []struct {
+		target string
+		status string
+	}{
+		{"/?alg= digest_auth=admin:cam3ra", "OK"},
+		{"/?alg=MD5 digest_auth=admin:cam3ra", "OK"},
+		{"/?alg=SHA-256 digest_auth=admin:cam3ra", "OK"},
+		{"/?alg=SHA-256-sess digest_auth=admin:cam3ra", "OK"},
+		{"/?alg=MD5 digest_auth=admin:wrong", "HTTP 401"},
+		{"/?alg=MD5", "HTTP 401"},
+		{"/?alg=MD5&body=ptz digest_auth=admin:cam3ra body=ptz", "OK"},
+	}
+	for _, tt := range tests {
+		test := parseTestConfig("cam=" + srv.URL + tt.target)
+		if status, _, errMsg := checkHTTP(context.Background(), &test); status != tt.status {
+			t.Errorf("checkHTTP(%s) = %s (%s), want %s", tt.target, status, errMsg, tt.status)
+		}
+	}
+
+	t.Setenv("DIGEST_AUTH_PASSWORD", "cam3ra")
+	test := parseTestConfig("cam=" + srv.URL + "/?alg=MD5 digest_auth=admin")
+	if status, _, errMsg := checkHTTP(context.Background(), &test); status != "OK" {
+		t.Errorf("checkHTTP with $DIGEST_AUTH_PASSWORD = %s (%s), want OK", status, errMsg)
+	}
+}
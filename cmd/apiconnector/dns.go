@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsTypes maps record type mnemonics to their wire values.
+var dnsTypes = map[string]dnsmessage.Type{
+	"A":     dnsmessage.TypeA,
+	"AAAA":  dnsmessage.TypeAAAA,
+	"CNAME": dnsmessage.TypeCNAME,
+	"MX":    dnsmessage.TypeMX,
+	"NS":    dnsmessage.TypeNS,
+	"PTR":   dnsmessage.TypePTR,
+	"SOA":   dnsmessage.TypeSOA,
+	"SRV":   dnsmessage.TypeSRV,
+	"TXT":   dnsmessage.TypeTXT,
+}
+
+// dnsRCodes maps response codes to their conventional mnemonics.
+var dnsRCodes = map[dnsmessage.RCode]string{
+	dnsmessage.RCodeSuccess:        "NOERROR",
+	dnsmessage.RCodeFormatError:    "FORMERR",
+	dnsmessage.RCodeServerFailure:  "SERVFAIL",
+	dnsmessage.RCodeNameError:      "NXDOMAIN",
+	dnsmessage.RCodeNotImplemented: "NOTIMP",
+	dnsmessage.RCodeRefused:        "REFUSED",
+}
+
+// checkDNS sends a query to the resolver named in the URL and asserts on
+// the reply. The path is the query name (dns://10.0.0.2/example.com) and
+// the options select the record type ("type=MX", default A), force TCP
+// ("tcp"), require an answer ("expect=93.184.216.34") or a response code
+// ("rcode=NXDOMAIN", default NOERROR).
+func checkDNS(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	start := time.Now()
+
+	u, err := url.Parse(test.URL)
+	if err != nil || u.Hostname() == "" {
+		return "ERROR", 0, "Invalid URL"
+	}
+
+	name := strings.TrimPrefix(u.Path, "/")
+	if name == "" {
+		name = "."
+	}
+	typeName := strings.ToUpper(test.Options["type"])
+	if typeName == "" {
+		typeName = "A"
+	}
+	qtype, ok := dnsTypes[typeName]
+	if !ok {
+		return "ERROR", 0, fmt.Sprintf("Unsupported record type %s", typeName)
+	}
+
+	msg, err := dnsQuery(ctx, test, hostPort(u, "53"), boolOption(test, "tcp"), name, qtype)
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("DNS query error: %v", err)
+	}
+	latency := time.Since(start)
+
+	rcode := dnsRCodeName(msg.Header.RCode)
+	answers := dnsAnswers(msg)
+	setDetail(test, "rcode", rcode)
+	if len(answers) > 0 {
+		setDetail(test, "answers", strings.Join(answers, ","))
+	}
+
+	wantRCode := strings.ToUpper(test.Options["rcode"])
+	if wantRCode == "" {
+		wantRCode = "NOERROR"
+	}
+	if rcode != wantRCode {
+		return "FAIL", latency, fmt.Sprintf("Response code %s, expected %s", rcode, wantRCode)
+	}
+	if want := test.Options["expect"]; want != "" && !containsFold(answers, strings.TrimSuffix(want, ".")) {
+		return "FAIL", latency, fmt.Sprintf("No %s answer matching %s", typeName, want)
+	}
+
+	return "OK", latency, ""
+}
+
+// dnsQuery sends a recursive query for name to server, over UDP unless tcp
+// is set or the UDP reply is truncated.
+func dnsQuery(ctx context.Context, test *ConnectionTest, server string, tcp bool, name string, qtype dnsmessage.Type) (*dnsmessage.Message, error) {
+	query, id, err := dnsBuildQuery(name, qtype)
+	if err != nil {
+		return nil, err
+	}
+
+	if !tcp {
+		reply, err := dnsExchangeUDP(ctx, test, server, query)
+		if err != nil {
+			return nil, err
+		}
+		msg, err := dnsParseReply(reply, id)
+		if err != nil || !msg.Header.Truncated {
+			return msg, err
+		}
+	}
+
+	reply, err := dnsExchangeTCP(ctx, test, server, query)
+	if err != nil {
+		return nil, err
+	}
+	return dnsParseReply(reply, id)
+}
+
+// dnsBuildQuery encodes a single-question recursive query.
+func dnsBuildQuery(name string, qtype dnsmessage.Type) ([]byte, uint16, error) {
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	qname, err := dnsmessage.NewName(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	var idBytes [2]byte
+	if _, err := rand.Read(idBytes[:]); err != nil {
+		return nil, 0, err
+	}
+	id := binary.BigEndian.Uint16(idBytes[:])
+
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true})
+	if err := b.StartQuestions(); err != nil {
+		return nil, 0, err
+	}
+	if err := b.Question(dnsmessage.Question{Name: qname, Type: qtype, Class: dnsmessage.ClassINET}); err != nil {
+		return nil, 0, err
+	}
+	query, err := b.Finish()
+	return query, id, err
+}
+
+func dnsExchangeUDP(ctx context.Context, test *ConnectionTest, server string, query []byte) ([]byte, error) {
+	conn, err := dial(ctx, test, "udp", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(testTimeout(test)))
+
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 65535)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+func dnsExchangeTCP(ctx context.Context, test *ConnectionTest, server string, query []byte) ([]byte, error) {
+	conn, err := dial(ctx, test, "tcp", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(testTimeout(test)))
+	return dnsExchangeStream(conn, query)
+}
+
+// dnsExchangeStream sends a length-prefixed query over a stream
+// connection and reads the length-prefixed reply.
+func dnsExchangeStream(conn net.Conn, query []byte) ([]byte, error) {
+	if _, err := conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(query))), query...)); err != nil {
+		return nil, err
+	}
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+	reply := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+func dnsParseReply(reply []byte, id uint16) (*dnsmessage.Message, error) {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(reply); err != nil {
+		return nil, err
+	}
+	if msg.Header.ID != id || !msg.Header.Response {
+		return nil, fmt.Errorf("reply does not match query")
+	}
+	return &msg, nil
+}
+
+// dnsAnswers renders the answer section as strings, one per record.
+func dnsAnswers(msg *dnsmessage.Message) []string {
+	var answers []string
+	for _, rr := range msg.Answers {
+		switch body := rr.Body.(type) {
+		case *dnsmessage.AResource:
+			answers = append(answers, net.IP(body.A[:]).String())
+		case *dnsmessage.AAAAResource:
+			answers = append(answers, net.IP(body.AAAA[:]).String())
+		case *dnsmessage.CNAMEResource:
+			answers = append(answers, strings.TrimSuffix(body.CNAME.String(), "."))
+		case *dnsmessage.MXResource:
+			answers = append(answers, strings.TrimSuffix(body.MX.String(), "."))
+		case *dnsmessage.NSResource:
+			answers = append(answers, strings.TrimSuffix(body.NS.String(), "."))
+		case *dnsmessage.PTRResource:
+			answers = append(answers, strings.TrimSuffix(body.PTR.String(), "."))
+		case *dnsmessage.SRVResource:
+			answers = append(answers, fmt.Sprintf("%s:%d", strings.TrimSuffix(body.Target.String(), "."), body.Port))
+		case *dnsmessage.TXTResource:
+			answers = append(answers, strings.Join(body.TXT, ""))
+		case *dnsmessage.SOAResource:
+			answers = append(answers, strings.TrimSuffix(body.NS.String(), "."))
+		}
+	}
+	return answers
+}
+
+func dnsRCodeName(rcode dnsmessage.RCode) string {
+	if name, ok := dnsRCodes[rcode]; ok {
+		return name
+	}
+	return fmt.Sprintf("RCODE%d", rcode)
+}
+
+// containsFold reports whether list contains s, ignoring case.
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsReply answers "example.com. A" with 93.184.216.34 and anything else
+// with NXDOMAIN.
+func dnsReply(t *testing.T, query []byte) []byte {
+	var q dnsmessage.Message
+	if err := q.Unpack(query); err != nil {
+		t.Error(err)
+		return nil
+	}
+	header := dnsmessage.Header{ID: q.Header.ID, Response: true, RecursionAvailable: true}
+	question := q.Questions[0]
+	found := question.Name.String() == "example.com." && question.Type == dnsmessage.TypeA
+	if !found {
+		header.RCode = dnsmessage.RCodeNameError
+	}
+
+	b := dnsmessage.NewBuilder(nil, header)
+	b.StartQuestions()
+	b.Question(question)
+	b.StartAnswers()
+	if found {
+		b.AResource(dnsmessage.ResourceHeader{Name: question.Name, Class: dnsmessage.ClassINET, TTL: 300},
+			dnsmessage.AResource{A: [4]byte{93, 184, 216, 34}})
+	}
+	reply, err := b.Finish()
+	if err != nil {
+		t.Error(err)
+	}
+	return reply
+}
+
+// serveDNSUDP answers UDP queries until the test finishes.
+func serveDNSUDP(t *testing.T) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			pc.WriteTo(dnsReply(t, buf[:n]), addr)
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+func TestCheckDNS(t *testing.T) {
+	udpAddr := serveDNSUDP(t)
+
+	tests := []struct {
+		target string
+		status string
+	}{
+		{"/example.com", "OK"},
+		{"/example.com expect=93.184.216.34", "OK"},
+		{"/example.com expect=10.0.0.1", "FAIL"},
+		{"/missing.example.com", "FAIL"},
+		{"/missing.example.com rcode=nxdomain", "OK"},
+		{"/example.com type=BOGUS", "ERROR"},
+	}
+
+	for _, tt := range tests {
+		test := parseTestConfig("dns=dns://" + udpAddr + tt.target)
+		status, _, errMsg := checkDNS(context.Background(), &test)
+		if status != tt.status {
+			t.Errorf("checkDNS(%q) = %s (%s), want %s", tt.target, status, errMsg, tt.status)
+		}
+	}
+}
+
+func TestCheckDNSOverTCP(t *testing.T) {
+	addr := serveOnce(t, func(conn net.Conn) {
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return
+		}
+		query := make([]byte, int(length[0])<<8|int(length[1]))
+		if _, err := io.ReadFull(conn, query); err != nil {
+			return
+		}
+		reply := dnsReply(t, query)
+		conn.Write(append([]byte{byte(len(reply) >> 8), byte(len(reply))}, reply...))
+	})
+
+	test := parseTestConfig("dns=dns://" + addr + "/example.com tcp")
+	status, _, errMsg := checkDNS(context.Background(), &test)
+	if status != "OK" || test.Details["answers"] != "93.184.216.34" {
+		t.Errorf("checkDNS over TCP = %s (%s) %v, want OK with answer", status, errMsg, test.Details)
+	}
+}
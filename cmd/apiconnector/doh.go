@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+var (
+	dohFlag = flag.String("doh", "", "resolve target names with DNS-over-HTTPS at `URL`, e.g. https://cloudflare-dns.com/dns-query")
+	dotFlag = flag.String("dot", "", "resolve target names with DNS-over-TLS at `host[:port]` (default port 853)")
+)
+
+// dialDoH returns a connection for the Go resolver that carries its
+// queries to the DNS-over-HTTPS endpoint at rawURL (RFC 8484). The resolver
+// treats it as a stream and frames each message with a length; each query
+// is POSTed as application/dns-message and the reply framed in turn. The
+// endpoint's certificate is verified against the same roots as the
+// target's (see rootCAs).
+func dialDoH(test *ConnectionTest, rawURL string) (net.Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("invalid DoH URL %q", rawURL)
+	}
+	roots, err := rootCAs(test)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{
+		Timeout:   testTimeout(test),
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}, ForceAttemptHTTP2: true},
+	}
+
+	conn, server := net.Pipe()
+	go func() {
+		defer server.Close()
+		defer client.CloseIdleConnections()
+		for {
+			var length [2]byte
+			if _, err := io.ReadFull(server, length[:]); err != nil {
+				return
+			}
+			query := make([]byte, binary.BigEndian.Uint16(length[:]))
+			if _, err := io.ReadFull(server, query); err != nil {
+				return
+			}
+			reply, err := dohExchange(client, u.String(), query)
+			if err != nil {
+				return
+			}
+			if _, err := server.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(reply))), reply...)); err != nil {
+				return
+			}
+		}
+	}()
+	return conn, nil
+}
+
+// dialDoT opens a DNS-over-TLS connection (RFC 7858) to server for the Go
+// resolver, which frames its queries as over TCP. The server's certificate
+// must be valid for its host name or IP address, against the same roots as
+// the target's.
+func dialDoT(ctx context.Context, test *ConnectionTest, dialer *net.Dialer, server string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(server)
+	if err != nil {
+		return nil, err
+	}
+	roots, err := rootCAs(test)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", server)
+	if err != nil {
+		return nil, err
+	}
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: host, RootCAs: roots})
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("DoT: %v", err)
+	}
+	return tlsConn, nil
+}
+
+// dohExchange POSTs a DNS query to a DoH endpoint and returns the reply.
+func dohExchange(client *http.Client, endpoint string, query []byte) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 65535))
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// checkElasticsearch queries _cluster/health on an Elasticsearch or
+// OpenSearch node. es:// speaks HTTP and ess:// HTTPS; URL credentials are
+// sent as basic auth. A green cluster is OK, yellow is WARN and red fails.
+// The "min_nodes" option fails the check when fewer nodes have joined.
+func checkElasticsearch(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	u, err := url.Parse(test.URL)
+	if err != nil || u.Hostname() == "" {
+		return "ERROR", 0, "Invalid URL"
+	}
+
+	minNodes := 0
+	if v := test.Options["min_nodes"]; v != "" {
+		if minNodes, err = strconv.Atoi(v); err != nil {
+			return "ERROR", 0, fmt.Sprintf("Invalid min_nodes: %v", err)
+		}
+	}
+
+	target := *u
+	target.Scheme = "http"
+	if u.Scheme == "ess" {
+		target.Scheme = "https"
+	}
+	target.Host = hostPort(u, "9200")
+	target.Path = "/_cluster/health"
+	target.RawQuery = ""
+
+	start := time.Now()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", target.String(), nil)
+	if err != nil {
+		return "ERROR", 0, fmt.Sprintf("Request creation error: %v", err)
+	}
+	resp, err := newHTTPClient(test).Do(req)
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("HTTP error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "FAIL", 0, fmt.Sprintf("Cluster health returned HTTP %d", resp.StatusCode)
+	}
+
+	var health struct {
+		ClusterName   string `json:"cluster_name"`
+		Status        string `json:"status"`
+		NumberOfNodes int    `json:"number_of_nodes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		return "FAIL", 0, fmt.Sprintf("Invalid cluster health response: %v", err)
+	}
+	latency := time.Since(start)
+
+	setDetail(test, "cluster", health.ClusterName)
+	setDetail(test, "health", health.Status)
+	setDetail(test, "nodes", strconv.Itoa(health.NumberOfNodes))
+
+	if health.NumberOfNodes < minNodes {
+		return "FAIL", 0, fmt.Sprintf("Cluster has %d nodes, want at least %d", health.NumberOfNodes, minNodes)
+	}
+
+	switch health.Status {
+	case "green":
+		return "OK", latency, ""
+	case "yellow":
+		return "WARN", latency, ""
+	case "red":
+		return "FAIL", 0, "Cluster status red"
+	default:
+		return "FAIL", 0, fmt.Sprintf("Unknown cluster status %q", health.Status)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckElasticsearch(t *testing.T) {
+	tests := []struct {
+		health  string
+		options string
+		status  string
+	}{
+		{"green", "", "OK"},
+		{"yellow", "", "WARN"},
+		{"red", "", "FAIL"},
+		{"green", "min_nodes=3", "OK"},
+		{"green", "min_nodes=4", "FAIL"},
+	}
+
+	for _, tt := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/_cluster/health" {
+				http.NotFound(w, r)
+				return
+			}
+			if user, pass, ok := r.BasicAuth(); !ok || user != "elastic" || pass != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprintf(w, `{"cluster_name":"logs","status":%q,"number_of_nodes":3}`, tt.health)
+		}))
+
+		url := strings.Replace(srv.URL, "http://", "es://elastic:secret@", 1)
+		test := parseTestConfig("search=" + url + " " + tt.options)
+		status, _, errMsg := checkElasticsearch(context.Background(), &test)
+		if status != tt.status {
+			t.Errorf("health %s %s: status = %s (%s), want %s", tt.health, tt.options, status, errMsg, tt.status)
+		}
+		if test.Details["cluster"] != "logs" || test.Details["nodes"] != "3" {
+			t.Errorf("health %s: details = %v", tt.health, test.Details)
+		}
+		srv.Close()
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// checkEtcd queries an etcd member's /health and /version endpoints; etcds://
+// uses HTTPS. With the "status" option it also calls the gRPC
+// Maintenance.Status API and fails when the member sees no leader, which
+// catches a member that is up but partitioned from quorum.
+func checkEtcd(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	start := time.Now()
+
+	u, err := url.Parse(test.URL)
+	if err != nil || u.Hostname() == "" {
+		return "ERROR", 0, "Invalid URL"
+	}
+
+	base := url.URL{Scheme: "http", Host: hostPort(u, "2379"), User: u.User}
+	if u.Scheme == "etcds" {
+		base.Scheme = "https"
+	}
+	client := newHTTPClient(test)
+
+	var health struct {
+		Health string `json:"health"`
+		Reason string `json:"reason"`
+	}
+	if errMsg := httpGetJSON(ctx, client, base.String()+"/health", &health); errMsg != "" {
+		return "FAIL", 0, errMsg
+	}
+	if health.Health != "true" {
+		if health.Reason != "" {
+			return "FAIL", 0, fmt.Sprintf("Member unhealthy: %s", health.Reason)
+		}
+		return "FAIL", 0, "Member unhealthy"
+	}
+
+	var version struct {
+		Server  string `json:"etcdserver"`
+		Cluster string `json:"etcdcluster"`
+	}
+	if errMsg := httpGetJSON(ctx, client, base.String()+"/version", &version); errMsg != "" {
+		return "FAIL", 0, errMsg
+	}
+	setDetail(test, "version", version.Server)
+
+	if !boolOption(test, "status") {
+		return "OK", time.Since(start), ""
+	}
+
+	creds := insecure.NewCredentials()
+	if u.Scheme == "etcds" {
+		config, err := tlsConfig(test, u.Hostname())
+		if err != nil {
+			return "ERROR", 0, fmt.Sprintf("TLS configuration error: %v", err)
+		}
+		creds = credentials.NewTLS(config)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, testTimeout(test))
+	defer cancel()
+
+	conn, err := grpc.DialContext(ctx, base.Host, grpc.WithTransportCredentials(creds), grpcDialer(test))
+	if err != nil {
+		return "ERROR", 0, fmt.Sprintf("gRPC dial error: %v", err)
+	}
+	defer conn.Close()
+
+	req, resp := []byte{}, []byte{}
+	if err := conn.Invoke(ctx, "/etcdserverpb.Maintenance/Status", &req, &resp, grpc.ForceCodec(rawCodec{})); err != nil {
+		return "FAIL", 0, fmt.Sprintf("Status error: %v", err)
+	}
+	leader, raftTerm, err := etcdParseStatus(resp)
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("Invalid status response: %v", err)
+	}
+	setDetail(test, "raft_term", strconv.FormatUint(raftTerm, 10))
+	if leader == 0 {
+		return "FAIL", 0, "Member has no leader"
+	}
+	setDetail(test, "leader", strconv.FormatUint(leader, 16))
+
+	return "OK", time.Since(start), ""
+}
+
+// etcdParseStatus extracts the leader and raftTerm fields from an encoded
+// etcdserverpb.StatusResponse.
+func etcdParseStatus(b []byte) (leader, raftTerm uint64, err error) {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return 0, 0, protowire.ParseError(n)
+		}
+		b = b[n:]
+		if typ == protowire.VarintType && (num == 4 || num == 6) {
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return 0, 0, protowire.ParseError(n)
+			}
+			if num == 4 {
+				leader = v
+			} else {
+				raftTerm = v
+			}
+			b = b[n:]
+			continue
+		}
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return 0, 0, protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return leader, raftTerm, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// fakeEtcd serves /health, /version and, over h2c on the same port,
+// Maintenance.Status reporting leader.
+func fakeEtcd(t *testing.T, health string, leader uint64) string {
+	status := protowire.AppendTag(nil, 2, protowire.BytesType)
+	status = protowire.AppendString(status, "3.5.12")
+	status = protowire.AppendTag(status, 4, protowire.VarintType)
+	status = protowire.AppendVarint(status, leader)
+	status = protowire.AppendTag(status, 6, protowire.VarintType)
+	status = protowire.AppendVarint(status, 7)
+
+	gs := grpc.NewServer(grpc.ForceServerCodec(rawCodec{}))
+	gs.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "etcdserverpb.Maintenance",
+		HandlerType: (*any)(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "Status",
+			Handler: func(_ any, _ context.Context, dec func(any) error, _ grpc.UnaryServerInterceptor) (any, error) {
+				var req []byte
+				if err := dec(&req); err != nil {
+					return nil, err
+				}
+				return &status, nil
+			},
+		}},
+	}, struct{}{})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(health))
+	})
+	mux.HandleFunc("/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"etcdserver":"3.5.12","etcdcluster":"3.5.0"}`))
+	})
+	srv := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			gs.ServeHTTP(w, r)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}), &http2.Server{}))
+	t.Cleanup(srv.Close)
+	return strings.TrimPrefix(srv.URL, "http://")
+}
+
+func TestCheckEtcd(t *testing.T) {
+	tests := []struct {
+		name    string
+		health  string
+		leader  uint64
+		options string
+		status  string
+	}{
+		{"healthy", `{"health":"true","reason":""}`, 0x8e9e05c52164694d, "", "OK"},
+		{"unhealthy", `{"health":"false","reason":"RAFT NO LEADER"}`, 0, "", "FAIL"},
+		{"status", `{"health":"true","reason":""}`, 0x8e9e05c52164694d, "status", "OK"},
+		{"partitioned", `{"health":"true","reason":""}`, 0, "status", "FAIL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := fakeEtcd(t, tt.health, tt.leader)
+			test := parseTestConfig("kv=etcd://" + addr + " " + tt.options)
+			status, _, errMsg := checkEtcd(context.Background(), &test)
+			if status != tt.status {
+				t.Fatalf("checkEtcd = %s (%s), want %s", status, errMsg, tt.status)
+			}
+			if tt.name == "status" && (test.Details["leader"] != "8e9e05c52164694d" || test.Details["raft_term"] != "7") {
+				t.Errorf("Details = %v, want leader and raft_term", test.Details)
+			}
+		})
+	}
+}
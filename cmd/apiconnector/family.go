@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ipv4Only = flag.Bool("4", false, "connect to targets over IPv4 only")
+	ipv6Only = flag.Bool("6", false, "connect to targets over IPv6 only")
+)
+
+// addressFamily returns the address family test connects over: "4", "6",
+// "dual" to check both, or "" for either. The "family" option accepts 4, 6,
+// ipv4, ipv6, dual or any, and wins over -4 and -6. It returns false for
+// an invalid option.
+func addressFamily(test *ConnectionTest) (string, bool) {
+	switch v := strings.ToLower(test.Options["family"]); v {
+	case "4", "ipv4":
+		return "4", true
+	case "6", "ipv6":
+		return "6", true
+	case "dual":
+		return "dual", true
+	case "any":
+		return "", true
+	case "":
+	default:
+		return "", false
+	}
+	switch {
+	case *ipv4Only:
+		return "4", true
+	case *ipv6Only:
+		return "6", true
+	}
+	return "", true
+}
+
+// familyNetwork narrows a "tcp" or "udp" dial network to test's address
+// family, so that names resolve to, and addresses must be, of that family.
+func familyNetwork(test *ConnectionTest, network string) string {
+	family, _ := addressFamily(test)
+	if (family == "4" || family == "6") && (network == "tcp" || network == "udp") {
+		return network + family
+	}
+	return network
+}
+
+// connectFamilies runs connectAddresses for test, once per address family
+// when the family is "dual". Each path's result is reported as the "ipv4"
+// and "ipv6" details, e.g. "OK[12ms]" or "FAIL" with the error in
+// "ipv4_error" or "ipv6_error"; the other details and latency come from the
+// first path that worked. One broken path makes the check WARN, and both
+// fail it.
+func connectFamilies(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	family, ok := addressFamily(test)
+	if !ok {
+		return "ERROR", 0, fmt.Sprintf("Invalid family %q", test.Options["family"])
+	}
+	if family != "dual" {
+		return connectAddresses(ctx, test)
+	}
+
+	type path struct {
+		family  string
+		status  string
+		latency time.Duration
+		errMsg  string
+		run     ConnectionTest
+	}
+	var paths []path
+	for _, f := range []string{"4", "6"} {
+		run := cloneTest(test, "family", f)
+		status, latency, errMsg := connectAddresses(ctx, &run)
+		test.Samples = append(test.Samples, run.Samples...)
+		test.Trace = append(test.Trace, run.Trace...)
+		paths = append(paths, path{f, status, latency, errMsg, run})
+	}
+
+	var worked *path
+	var errs []string
+	for i := range paths {
+		p := &paths[i]
+		if p.errMsg != "" {
+			errs = append(errs, fmt.Sprintf("IPv%s: %s", p.family, p.errMsg))
+		} else if worked == nil {
+			worked = p
+		}
+	}
+	if worked == nil {
+		return "FAIL", 0, strings.Join(errs, "; ")
+	}
+	test.Details, test.Certs, test.ChainIssue = worked.run.Details, worked.run.Certs, worked.run.ChainIssue
+	status := worked.status
+	for _, p := range paths {
+		key := "ipv" + p.family
+		if p.errMsg != "" {
+			setDetail(test, key, p.status)
+			setDetail(test, key+"_error", p.errMsg)
+			status = "WARN"
+			continue
+		}
+		setDetail(test, key, fmt.Sprintf("%s[%s]", p.status, formatDuration(p.latency)))
+	}
+	return status, worked.latency, ""
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAddressFamily(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	tests := []struct {
+		options, status, errMsg string
+		details                 map[string]string
+	}{
+		{"family=4", "OK", "", nil},
+		{"family=ipv6", "FAIL", "", nil},
+		{"family=any", "OK", "", nil},
+		{"family=5", "ERROR", `Invalid family "5"`, nil},
+		// The IPv4-only server leaves the IPv6 path broken.
+		{"family=dual", "WARN", "", map[string]string{"ipv6": "FAIL"}},
+	}
+	for _, tt := range tests {
+		test := parseTestConfig("api=" + srv.URL + " " + tt.options)
+		status, _, errMsg := connectFamilies(context.Background(), &test)
+		if status != tt.status || (tt.errMsg != "" && errMsg != tt.errMsg) {
+			t.Errorf("%s: status %s (%s), want %s %s", tt.options, status, errMsg, tt.status, tt.errMsg)
+		}
+		for k, v := range tt.details {
+			if test.Details[k] != v {
+				t.Errorf("%s: details %v, want %s=%s", tt.options, test.Details, k, v)
+			}
+		}
+		if tt.options == "family=dual" && (!strings.HasPrefix(test.Details["ipv4"], "OK[") || test.Details["ipv6_error"] == "") {
+			t.Errorf("family=dual: details %v, want ipv4=OK[...] and ipv6_error", test.Details)
+		}
+	}
+
+	*ipv6Only = true
+	defer func() { *ipv6Only = false }()
+	test := parseTestConfig("api=" + srv.URL)
+	if status, _, _ := connectFamilies(context.Background(), &test); status != "FAIL" {
+		t.Errorf("-6 against an IPv4 server = %s, want FAIL", status)
+	}
+	test = parseTestConfig("api=" + srv.URL + " family=4")
+	if status, _, errMsg := connectFamilies(context.Background(), &test); status != "OK" {
+		t.Errorf("family=4 with -6 = %s (%s), want OK", status, errMsg)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"text/template"
+)
+
+var formatFlag = flag.String("format", "", "print each result with the Go `template`, e.g. '{{.Service}} {{.Status}} {{.Latency}}', instead of the text output")
+
+// resultTemplate is the parsed -format template, nil without one.
+var resultTemplate *template.Template
+
+// parseFormat parses the -format template. Templates see the fields of
+// a result (Service, Method, URL, Status, LatencyMS, Error, Details,
+// SamplesMS, Started, Finished) and its Latency, and may render any value
+// as JSON with the json function.
+func parseFormat() error {
+	if *formatFlag == "" {
+		return nil
+	}
+	t, err := template.New("format").Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(*formatFlag)
+	if err != nil {
+		return fmt.Errorf("invalid -format: %v", err)
+	}
+	resultTemplate = t
+	return nil
+}
+
+// writeFormat prints test's result with the -format template, on a line of
+// its own.
+func writeFormat(w io.Writer, test *ConnectionTest) error {
+	if err := resultTemplate.Execute(w, newResult(test)); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
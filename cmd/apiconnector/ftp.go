@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// checkFTP validates the FTP 220 banner. When the URL has credentials, or
+// the "anonymous" option is set, it logs in and opens a passive-mode data
+// connection to verify the PASV port range is reachable. The ftps scheme
+// uses implicit TLS; the "starttls" option upgrades ftp:// with AUTH TLS.
+func checkFTP(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	start := time.Now()
+
+	u, err := url.Parse(test.URL)
+	if err != nil || u.Hostname() == "" {
+		return "ERROR", 0, "Invalid URL"
+	}
+
+	defaultPort := "21"
+	if u.Scheme == "ftps" {
+		defaultPort = "990"
+	}
+	conn, err := dial(ctx, test, "tcp", hostPort(u, defaultPort))
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("Connect error: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(testTimeout(test)))
+
+	if u.Scheme == "ftps" {
+		conn, err = tlsClient(ctx, test, conn, u.Hostname())
+		if err != nil {
+			return "FAIL", 0, fmt.Sprintf("TLS handshake error: %v", err)
+		}
+	}
+
+	text := textproto.NewConn(conn)
+	if _, msg, err := text.ReadResponse(220); err != nil {
+		return "FAIL", time.Since(start), fmt.Sprintf("Banner error: %v", err)
+	} else {
+		setDetail(test, "banner", strings.SplitN(msg, "\n", 2)[0])
+	}
+
+	if boolOption(test, "starttls") && u.Scheme != "ftps" {
+		if _, _, err := ftpCmd(text, 234, "AUTH TLS"); err != nil {
+			return "FAIL", time.Since(start), fmt.Sprintf("AUTH TLS error: %v", err)
+		}
+		conn, err = tlsClient(ctx, test, conn, u.Hostname())
+		if err != nil {
+			return "FAIL", 0, fmt.Sprintf("TLS handshake error: %v", err)
+		}
+		text = textproto.NewConn(conn)
+	}
+
+	user := u.User.Username()
+	password, _ := u.User.Password()
+	if user == "" && boolOption(test, "anonymous") {
+		user, password = "anonymous", "apiconnector@"
+	}
+	if user == "" {
+		ftpCmd(text, 221, "QUIT")
+		return "OK", time.Since(start), ""
+	}
+
+	code, msg, err := ftpCmd(text, 0, "USER %s", user)
+	if err == nil && code == 331 {
+		code, msg, err = ftpCmd(text, 0, "PASS %s", password)
+	}
+	if err != nil {
+		return "FAIL", time.Since(start), fmt.Sprintf("Login failed: %v", err)
+	}
+	if code != 230 {
+		return "FAIL", time.Since(start), fmt.Sprintf("Login failed: %d %s", code, msg)
+	}
+	setDetail(test, "login", "ok")
+
+	dataAddr, err := ftpPassive(text, u.Hostname())
+	if err != nil {
+		return "FAIL", time.Since(start), fmt.Sprintf("Passive mode error: %v", err)
+	}
+	setDetail(test, "pasv", dataAddr)
+	data, err := dial(ctx, test, "tcp", dataAddr)
+	if err != nil {
+		return "FAIL", time.Since(start), fmt.Sprintf("Data channel %s unreachable: %v", dataAddr, err)
+	}
+	data.Close()
+	latency := time.Since(start)
+
+	ftpCmd(text, 221, "QUIT")
+	return "OK", latency, ""
+}
+
+// ftpCmd sends a command and reads its reply. A non-zero expectCode makes
+// any other reply code an error.
+func ftpCmd(text *textproto.Conn, expectCode int, format string, args ...interface{}) (int, string, error) {
+	id, err := text.Cmd(format, args...)
+	if err != nil {
+		return 0, "", err
+	}
+	text.StartResponse(id)
+	defer text.EndResponse(id)
+	return text.ReadResponse(expectCode)
+}
+
+// ftpPassive requests a passive data port, preferring EPSV and falling back
+// to PASV, and returns the address to dial.
+func ftpPassive(text *textproto.Conn, host string) (string, error) {
+	if code, msg, err := ftpCmd(text, 0, "EPSV"); err == nil && code == 229 {
+		// 229 Entering Extended Passive Mode (|||6446|)
+		open, close := strings.Index(msg, "("), strings.LastIndex(msg, ")")
+		if open >= 0 && close > open+1 {
+			fields := strings.Split(msg[open+1:close], string(msg[open+1]))
+			if len(fields) == 5 {
+				if _, err := strconv.Atoi(fields[3]); err == nil {
+					return net.JoinHostPort(host, fields[3]), nil
+				}
+			}
+		}
+		return "", fmt.Errorf("malformed EPSV reply %q", msg)
+	}
+
+	_, msg, err := ftpCmd(text, 227, "PASV")
+	if err != nil {
+		return "", err
+	}
+	// 227 Entering Passive Mode (h1,h2,h3,h4,p1,p2)
+	open, close := strings.Index(msg, "("), strings.LastIndex(msg, ")")
+	if open < 0 || close < open {
+		return "", fmt.Errorf("malformed PASV reply %q", msg)
+	}
+	parts := strings.Split(msg[open+1:close], ",")
+	if len(parts) != 6 {
+		return "", fmt.Errorf("malformed PASV reply %q", msg)
+	}
+	p1, err1 := strconv.Atoi(parts[4])
+	p2, err2 := strconv.Atoi(parts[5])
+	if err1 != nil || err2 != nil {
+		return "", fmt.Errorf("malformed PASV reply %q", msg)
+	}
+	return net.JoinHostPort(strings.Join(parts[:4], "."), strconv.Itoa(p1*256+p2)), nil
+}
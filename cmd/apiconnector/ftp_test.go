@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+// fakeFTP accepts anonymous logins and offers an EPSV data port backed by
+// dataAddr, or answers EPSV with an error when epsv is false.
+func fakeFTP(dataAddr string, epsv bool) func(conn net.Conn) {
+	_, dataPort, _ := net.SplitHostPort(dataAddr)
+	return func(conn net.Conn) {
+		conn.Write([]byte("220-Welcome\r\n220 FTP ready\r\n"))
+		br := bufio.NewReader(conn)
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.Fields(line)[0]
+			switch {
+			case cmd == "USER" && strings.Contains(line, "anonymous"):
+				conn.Write([]byte("331 Password required\r\n"))
+			case cmd == "USER":
+				conn.Write([]byte("530 Not logged in\r\n"))
+			case cmd == "PASS":
+				conn.Write([]byte("230 Logged in\r\n"))
+			case cmd == "EPSV" && epsv:
+				fmt.Fprintf(conn, "229 Entering Extended Passive Mode (|||%s|)\r\n", dataPort)
+			case cmd == "EPSV":
+				conn.Write([]byte("500 Unknown command\r\n"))
+			case cmd == "PASV":
+				var p int
+				fmt.Sscanf(dataPort, "%d", &p)
+				fmt.Fprintf(conn, "227 Entering Passive Mode (127,0,0,1,%d,%d)\r\n", p/256, p%256)
+			case cmd == "QUIT":
+				conn.Write([]byte("221 Goodbye\r\n"))
+				return
+			}
+		}
+	}
+}
+
+func TestCheckFTP(t *testing.T) {
+	tests := []struct {
+		userinfo string
+		options  string
+		epsv     bool
+		status   string
+		login    string
+		errMsg   string
+	}{
+		{"", "", true, "OK", "", ""},
+		{"", " anonymous", true, "OK", "ok", ""},
+		{"", " anonymous", false, "OK", "ok", ""},
+		{"bob:pw@", "", true, "FAIL", "", "Login failed: 530 Not logged in"},
+	}
+
+	for _, tt := range tests {
+		dataAddr := serveOnce(t, func(conn net.Conn) {})
+		addr := serveOnce(t, fakeFTP(dataAddr, tt.epsv))
+		test := parseTestConfig("ftp=ftp://" + tt.userinfo + addr + tt.options)
+		status, _, errMsg := checkFTP(context.Background(), &test)
+		if status != tt.status || errMsg != tt.errMsg {
+			t.Errorf("checkFTP(%q%s) = %s (%s), want %s (%s)", test.URL, tt.options, status, errMsg, tt.status, tt.errMsg)
+		}
+		if test.Details["login"] != tt.login {
+			t.Errorf("checkFTP(%q%s) login = %q, want %q", test.URL, tt.options, test.Details["login"], tt.login)
+		}
+	}
+}
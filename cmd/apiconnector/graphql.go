@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// graphqlIntrospection is the default query: small, but it proves the
+// schema is loaded.
+const graphqlIntrospection = "{__schema{queryType{name}}}"
+
+// checkGraphQL POSTs a query to a GraphQL endpoint (graphql:// over HTTP,
+// graphqls:// over HTTPS, path defaulting to /graphql) and fails if the
+// response carries errors, even with HTTP 200. The "query" option replaces
+// the default introspection query; "query=@file" reads it from a file.
+func checkGraphQL(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	u, err := url.Parse(test.URL)
+	if err != nil || u.Hostname() == "" {
+		return "ERROR", 0, "Invalid URL"
+	}
+
+	query := graphqlIntrospection
+	if v := test.Options["query"]; v != "" {
+		query = v
+		if name, ok := strings.CutPrefix(v, "@"); ok {
+			b, err := os.ReadFile(name)
+			if err != nil {
+				return "ERROR", 0, fmt.Sprintf("Query file error: %v", err)
+			}
+			query = string(b)
+		}
+	}
+	body, _ := json.Marshal(map[string]string{"query": query})
+
+	target := *u
+	target.Scheme = "http"
+	if u.Scheme == "graphqls" {
+		target.Scheme = "https"
+	}
+	if target.Path == "" || target.Path == "/" {
+		target.Path = "/graphql"
+	}
+
+	start := time.Now()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", target.String(), bytes.NewReader(body))
+	if err != nil {
+		return "ERROR", 0, fmt.Sprintf("Request creation error: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := newHTTPClient(test).Do(req)
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("HTTP error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return "FAIL", 0, fmt.Sprintf("HTTP %d", resp.StatusCode)
+		}
+		return "FAIL", 0, fmt.Sprintf("Invalid GraphQL response: %v", err)
+	}
+	latency := time.Since(start)
+
+	if len(result.Errors) > 0 {
+		return "FAIL", 0, fmt.Sprintf("GraphQL error: %s", result.Errors[0].Message)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "FAIL", 0, fmt.Sprintf("HTTP %d", resp.StatusCode)
+	}
+	if len(result.Data) == 0 || string(result.Data) == "null" {
+		return "FAIL", 0, "GraphQL response has no data"
+	}
+
+	if query == graphqlIntrospection {
+		var data struct {
+			Schema struct {
+				QueryType struct {
+					Name string `json:"name"`
+				} `json:"queryType"`
+			} `json:"__schema"`
+		}
+		if json.Unmarshal(result.Data, &data) == nil && data.Schema.QueryType.Name != "" {
+			setDetail(test, "schema", data.Schema.QueryType.Name)
+		}
+	}
+
+	return "OK", latency, ""
+}
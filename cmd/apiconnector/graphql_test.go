@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckGraphQL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Query string `json:"query"`
+		}
+		if r.Method != "POST" || r.URL.Path != "/graphql" || json.NewDecoder(r.Body).Decode(&req) != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		switch req.Query {
+		case graphqlIntrospection:
+			w.Write([]byte(`{"data":{"__schema":{"queryType":{"name":"Query"}}}}`))
+		case "{__typename}":
+			w.Write([]byte(`{"data":{"__typename":"Query"}}`))
+		default:
+			w.Write([]byte(`{"data":null,"errors":[{"message":"Cannot query field \"missing\""}]}`))
+		}
+	}))
+	defer srv.Close()
+
+	queryFile := filepath.Join(t.TempDir(), "query.graphql")
+	if err := os.WriteFile(queryFile, []byte("{__typename}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		options string
+		status  string
+	}{
+		{"", "OK"},
+		{"query={__typename}", "OK"},
+		{"query=@" + queryFile, "OK"},
+		{"query={missing}", "FAIL"},
+	}
+	for _, tt := range tests {
+		url := strings.Replace(srv.URL, "http://", "graphql://", 1)
+		test := parseTestConfig("api=" + url + " " + tt.options)
+		status, _, errMsg := checkGraphQL(context.Background(), &test)
+		if status != tt.status {
+			t.Errorf("checkGraphQL(%q) = %s (%s), want %s", tt.options, status, errMsg, tt.status)
+		}
+		if tt.options == "" && test.Details["schema"] != "Query" {
+			t.Errorf("schema = %q, want Query", test.Details["schema"])
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// checkGRPC calls grpc.health.v1.Health/Check on the target. The URL path,
+// if present, names the service to query (grpc://host:50051/pkg.Service);
+// otherwise the overall server health is requested. The grpcs scheme
+// connects over TLS. With the "method" option an arbitrary unary method is
+// called instead (see grpcInvoke).
+func checkGRPC(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	start := time.Now()
+
+	u, err := url.Parse(test.URL)
+	if err != nil || u.Hostname() == "" {
+		return "ERROR", 0, "Invalid URL"
+	}
+
+	creds := insecure.NewCredentials()
+	defaultPort := "80"
+	if u.Scheme == "grpcs" {
+		config, err := tlsConfig(test, u.Hostname())
+		if err != nil {
+			return "ERROR", 0, fmt.Sprintf("TLS configuration error: %v", err)
+		}
+		creds = credentials.NewTLS(config)
+		defaultPort = "443"
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, testTimeout(test))
+	defer cancel()
+
+	conn, err := grpc.DialContext(ctx, hostPort(u, defaultPort), grpc.WithTransportCredentials(creds), grpcDialer(test))
+	if err != nil {
+		return "ERROR", 0, fmt.Sprintf("gRPC dial error: %v", err)
+	}
+	defer conn.Close()
+
+	if test.Options["method"] != "" {
+		if errMsg := grpcInvoke(ctx, conn, test); errMsg != "" {
+			return "FAIL", 0, errMsg
+		}
+		return "OK", time.Since(start), ""
+	}
+
+	service := strings.TrimPrefix(u.Path, "/")
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("Health check error: %v", err)
+	}
+
+	latency := time.Since(start)
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return "FAIL", latency, fmt.Sprintf("Health status %s", resp.GetStatus())
+	}
+
+	return "OK", latency, ""
+}
+
+// grpcDialer makes gRPC connections for test go through dial, so that
+// transport options such as "socks" and "proxy_protocol" apply.
+func grpcDialer(test *ConnectionTest) grpc.DialOption {
+	return grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+		return dial(ctx, test, "tcp", addr)
+	})
+}
+
+// rawCodec passes pre-encoded protobuf messages through unchanged, letting
+// checks call methods whose generated types are not vendored. Messages must
+// be *[]byte.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v any) ([]byte, error) {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return nil, fmt.Errorf("rawCodec: unexpected message type %T", v)
+	}
+	return *b, nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v any) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("rawCodec: unexpected message type %T", v)
+	}
+	*b = append((*b)[:0], data...)
+	return nil
+}
+
+func (rawCodec) Name() string { return "proto" }
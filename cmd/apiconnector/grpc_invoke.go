@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// grpcInvoke calls the unary method named by the "method" option
+// (pkg.Service/Method), resolving its types through server reflection. The
+// request comes from the "body" option as JSON ("body=@file" reads a file).
+// The call must end with the status code in the "code" option (default OK),
+// and "expect=field.path=value" asserts on a field of the JSON response. It
+// returns "" on success or a display error message.
+func grpcInvoke(ctx context.Context, conn *grpc.ClientConn, test *ConnectionTest) string {
+	service, method, ok := strings.Cut(test.Options["method"], "/")
+	if !ok || service == "" || method == "" {
+		return "Invalid method: expected method=pkg.Service/Method"
+	}
+
+	wantCode := codes.OK
+	if v := test.Options["code"]; v != "" {
+		if err := wantCode.UnmarshalJSON([]byte(`"` + strings.ToUpper(v) + `"`)); err != nil {
+			return fmt.Sprintf("Invalid code: %v", err)
+		}
+	}
+
+	body, err := requestBody(test)
+	if err != nil {
+		return fmt.Sprintf("Body error: %v", err)
+	}
+	if len(body) == 0 {
+		body = []byte("{}")
+	}
+
+	md, err := grpcResolveMethod(ctx, conn, service, method)
+	if err != nil {
+		return fmt.Sprintf("Reflection error: %v", err)
+	}
+	if md.IsStreamingClient() || md.IsStreamingServer() {
+		return fmt.Sprintf("Method %s is not unary", md.FullName())
+	}
+
+	req := dynamicpb.NewMessage(md.Input())
+	if err := protojson.Unmarshal(body, req); err != nil {
+		return fmt.Sprintf("Invalid request body: %v", err)
+	}
+	resp := dynamicpb.NewMessage(md.Output())
+	err = conn.Invoke(ctx, "/"+service+"/"+method, req, resp)
+
+	code := status.Code(err)
+	setDetail(test, "code", code.String())
+	if code != wantCode {
+		if err != nil {
+			return fmt.Sprintf("Call error: %v", status.Convert(err).Message())
+		}
+		return fmt.Sprintf("Call returned %s, want %s", code, wantCode)
+	}
+
+	if expect := test.Options["expect"]; expect != "" && err == nil {
+		path, want, _ := strings.Cut(expect, "=")
+		b, err := protojson.MarshalOptions{EmitUnpopulated: true}.Marshal(resp)
+		if err != nil {
+			return fmt.Sprintf("Response encoding error: %v", err)
+		}
+		var v any
+		if err := json.Unmarshal(b, &v); err != nil {
+			return fmt.Sprintf("Response encoding error: %v", err)
+		}
+		got, ok := jsonField(v, path)
+		if !ok {
+			return fmt.Sprintf("Response has no field %s", path)
+		}
+		if fmt.Sprint(got) != want {
+			return fmt.Sprintf("Response field %s is %v, want %s", path, got, want)
+		}
+	}
+
+	return ""
+}
+
+// grpcResolveMethod fetches the file descriptors defining service over the
+// reflection API, following imports the server did not send, and returns
+// the named method.
+func grpcResolveMethod(ctx context.Context, conn *grpc.ClientConn, service, method string) (protoreflect.MethodDescriptor, error) {
+	stream, err := rpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.CloseSend()
+
+	files := make(map[string]*descriptorpb.FileDescriptorProto)
+	request := func(req *rpb.ServerReflectionRequest) error {
+		if err := stream.Send(req); err != nil {
+			return err
+		}
+		resp, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		if e := resp.GetErrorResponse(); e != nil {
+			return fmt.Errorf("%s", e.GetErrorMessage())
+		}
+		for _, b := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			fd := &descriptorpb.FileDescriptorProto{}
+			if err := proto.Unmarshal(b, fd); err != nil {
+				return err
+			}
+			files[fd.GetName()] = fd
+		}
+		return nil
+	}
+
+	if err := request(&rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: service},
+	}); err != nil {
+		return nil, err
+	}
+	for missing := true; missing; {
+		missing = false
+		for _, fd := range files {
+			for _, dep := range fd.GetDependency() {
+				if _, ok := files[dep]; ok {
+					continue
+				}
+				missing = true
+				if err := request(&rpb.ServerReflectionRequest{
+					MessageRequest: &rpb.ServerReflectionRequest_FileByFilename{FileByFilename: dep},
+				}); err != nil {
+					return nil, err
+				}
+				if _, ok := files[dep]; !ok {
+					return nil, fmt.Errorf("server did not return %s", dep)
+				}
+			}
+		}
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, fd := range files {
+		set.File = append(set.File, fd)
+	}
+	registry, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, err
+	}
+	d, err := registry.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, err
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", service)
+	}
+	md := sd.Methods().ByName(protoreflect.Name(method))
+	if md == nil {
+		return nil, fmt.Errorf("service %s has no method %s", service, method)
+	}
+	return md, nil
+}
+
+// jsonField walks a dot-separated path through decoded JSON objects and
+// arrays (numeric segments index arrays).
+func jsonField(v any, path string) (any, bool) {
+	for _, key := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]any:
+			var ok bool
+			if v, ok = node[key]; !ok {
+				return nil, false
+			}
+		case []any:
+			var i int
+			if _, err := fmt.Sscanf(key, "%d", &i); err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			v = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+func TestCheckGRPCInvoke(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	hs := health.NewServer()
+	hs.SetServingStatus("down.Service", healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(srv, hs)
+	reflection.Register(srv)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	tests := []struct {
+		options string
+		status  string
+		code    string
+	}{
+		{`method=grpc.health.v1.Health/Check body={"service":""} expect=status=SERVING`, "OK", "OK"},
+		{`method=grpc.health.v1.Health/Check body={"service":"down.Service"} expect=status=SERVING`, "FAIL", "OK"},
+		{`method=grpc.health.v1.Health/Check body={"service":"missing"}`, "FAIL", "NotFound"},
+		{`method=grpc.health.v1.Health/Check body={"service":"missing"} code=not_found`, "OK", "NotFound"},
+		{`method=grpc.health.v1.Health/Watch`, "FAIL", ""},
+		{`method=grpc.health.v1.Health/Nope`, "FAIL", ""},
+		{`method=grpc.health.v1.Health/Check body={"bogus":1}`, "FAIL", ""},
+	}
+
+	for _, tt := range tests {
+		test := parseTestConfig("rpc=grpc://" + lis.Addr().String() + " " + tt.options)
+		status, _, errMsg := checkGRPC(context.Background(), &test)
+		if status != tt.status || test.Details["code"] != tt.code {
+			t.Errorf("checkGRPC(%s) = %s (%s) code=%q, want %s code=%q", tt.options, status, errMsg, test.Details["code"], tt.status, tt.code)
+		}
+	}
+}
+
+func TestJSONField(t *testing.T) {
+	v := map[string]any{"user": map[string]any{"roles": []any{"admin", "dev"}}}
+	if got, ok := jsonField(v, "user.roles.1"); !ok || got != "dev" {
+		t.Errorf("jsonField(user.roles.1) = %v, %v, want dev", got, ok)
+	}
+	if _, ok := jsonField(v, "user.name"); ok {
+		t.Error("jsonField(user.name) found a missing field")
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestCheckGRPC(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	hs := health.NewServer()
+	hs.SetServingStatus("ok.Service", healthpb.HealthCheckResponse_SERVING)
+	hs.SetServingStatus("down.Service", healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(srv, hs)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	tests := []struct {
+		path   string
+		status string
+	}{
+		{"", "OK"},
+		{"/ok.Service", "OK"},
+		{"/down.Service", "FAIL"},
+		{"/missing.Service", "FAIL"},
+	}
+
+	for _, tt := range tests {
+		test := &ConnectionTest{URL: "grpc://" + lis.Addr().String() + tt.path}
+		status, _, errMsg := checkGRPC(context.Background(), test)
+		if status != tt.status {
+			t.Errorf("checkGRPC(%q) = %s (%s), want %s", test.URL, status, errMsg, tt.status)
+		}
+	}
+}
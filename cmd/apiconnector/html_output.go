@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// htmlReport is the page -output html writes: a summary and a table of
+// results, self-contained so it can be mailed, archived as a CI artifact
+// or attached to an incident ticket. A test with several latency samples
+// gets an inline SVG sparkline of them.
+var htmlReport = template.Must(template.New("report").Funcs(template.FuncMap{
+	"latency":   func(ms float64) string { return formatDuration(time.Duration(ms * float64(time.Millisecond))) },
+	"details":   sortedDetails,
+	"stamp":     func(t time.Time) string { return t.UTC().Format(time.RFC3339) },
+	"sparkline": sparkline,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>API connectivity report</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: .4em .8em; border-bottom: 1px solid #ddd; vertical-align: top; }
+.OK { color: #1a7f37; } .WARN { color: #9a6700; } .FAIL, .ERROR { color: #cf222e; }
+td.status { font-weight: bold; }
+td.details { font-family: monospace; font-size: .9em; }
+td.details .error { color: #cf222e; font-weight: bold; }
+svg.sparkline { vertical-align: middle; margin-left: .5em; }
+svg.sparkline polyline { fill: none; stroke: #0969da; stroke-width: 1.5; }
+</style>
+</head>
+<body>
+<h1>API connectivity report</h1>
+<p>{{stamp .Started}} &middot; <span class="OK">{{.Summary.OK}} OK</span>, <span class="WARN">{{.Summary.Warn}} WARN</span>, <span class="FAIL">{{.Summary.Fail}} FAIL</span></p>
+<table>
+<tr><th>Service</th><th>URL</th><th>Status</th><th>Latency</th><th>Error / details</th></tr>
+{{- range .Results}}
+<tr><td>{{.Service}}</td><td>{{.URL}}</td><td class="status {{.Status}}">{{.Status}}</td><td>{{latency .LatencyMS}}
+{{- with .SamplesMS}}<svg class="sparkline" width="{{$.SparkWidth}}" height="{{$.SparkHeight}}" viewBox="0 0 {{$.SparkWidth}} {{$.SparkHeight}}"><polyline points="{{sparkline .}}"/></svg>{{end -}}
+</td><td class="details">{{with .Error}}<div class="error">{{.}}</div>{{end}}{{range details .Details}}{{.}}<br>{{end}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+// The size of a sparkline, in pixels.
+const (
+	sparkWidth  = 80
+	sparkHeight = 16
+)
+
+// writeHTML writes r as a standalone HTML page.
+func writeHTML(w io.Writer, r *report) error {
+	return htmlReport.Execute(w, struct {
+		*report
+		SparkWidth, SparkHeight int
+	}{r, sparkWidth, sparkHeight})
+}
+
+// sparkline returns the SVG polyline points plotting samples, left to right,
+// scaled to the sparkline's size with the slowest sample at the top.
+func sparkline(samples []float64) string {
+	max := 0.0
+	for _, v := range samples {
+		if v > max {
+			max = v
+		}
+	}
+	points := make([]string, len(samples))
+	for i, v := range samples {
+		x := float64(sparkWidth) * float64(i) / float64(len(samples)-1)
+		y := float64(sparkHeight)
+		if max > 0 {
+			y -= float64(sparkHeight-2) * v / max
+		}
+		points[i] = fmt.Sprintf("%.1f,%.1f", x, y)
+	}
+	return strings.Join(points, " ")
+}
+
+// sortedDetails renders details as "key=value" strings in key order.
+func sortedDetails(details map[string]string) []string {
+	keys := make([]string, 0, len(details))
+	for k := range details {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		keys[i] = k + "=" + details[k]
+	}
+	return keys
+}
@@ -0,0 +1,839 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+var (
+	forceHTTP2 = flag.Bool("http2", false, "force HTTP/2 for http(s) targets, using prior knowledge for cleartext http://")
+	basicAuth  = flag.String("basic-auth", "", "HTTP basic auth `user[:password]` for all targets; the password defaults to $BASIC_AUTH_PASSWORD")
+	bearer     = flag.String("bearer", "", "bearer `token` (or @file) sent to all HTTP targets")
+	proxy      = flag.String("proxy", "", "HTTP proxy `URL` for HTTP targets, overriding HTTP_PROXY/HTTPS_PROXY; \"none\" connects directly")
+	userAgent  = flag.String("user-agent", "", "User-Agent `string` sent to all HTTP targets instead of Go's default")
+
+	// defaultHeaders holds the -header flags, added to every HTTP request.
+	defaultHeaders = headerFlags{}
+)
+
+func init() {
+	flag.Var(defaultHeaders, "header", "`Name: Value` header sent to all HTTP targets (repeatable)")
+}
+
+// headerFlags collects repeated -header flags.
+type headerFlags map[string]string
+
+func (h headerFlags) String() string {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		names[i] = name + ": " + h[name]
+	}
+	return strings.Join(names, ", ")
+}
+
+func (h headerFlags) Set(v string) error {
+	name, value, ok := strings.Cut(v, ":")
+	if !ok || !headerNamePattern.MatchString(name) {
+		return fmt.Errorf("expected \"Name: Value\"")
+	}
+	h[http.CanonicalHeaderKey(name)] = strings.TrimSpace(value)
+	return nil
+}
+
+// responseAssertions are the options that fail a non-2xx response.
+var responseAssertions = []string{"expect_type", "expect_charset", "expect_body", "expect_json"}
+
+// checkHTTP sends a request (GET unless the test names another method) to
+// an http:// or https:// target and reports the negotiated protocol and the
+// "http_status" code. Any 2xx response is OK; other codes are reported as
+// the status. HTTP/2 is forced by the -http2 flag or the per-test "http2"
+// option.
+//
+// The request: "body" supplies a body (see requestBody), "upload" POSTs a
+// multipart/form-data file instead (see uploadBody), "head" sends HEAD
+// rather than GET, falling back to GET when the server rejects it, and
+// "cors" sends a CORS preflight first (see corsPreflight). Redirects are
+// only followed with "follow_redirects" (see redirectChain): the chain is
+// reported, a loop fails the check and an https:// to http:// downgrade is
+// a warning.
+//
+// The response: HTTPS connections report their TLS parameters, warning on a
+// weak cipher (see setTLSState), and the time spent connecting, in the
+// handshake and waiting for the server (see phaseTimer). They must
+// negotiate any "expect_alpn" protocol (see matchALPN), satisfy
+// "min_tls"/"max_tls" (see checkTLSVersions) and, with "ocsp", must not be
+// revoked (see checkRevocation). The body is always read to report transfer
+// metrics (see readBody), and "max_size" fails a larger one. Rate limit
+// headers are reported (see checkRateLimit), as are the authentication
+// schemes offered by a 401 or 407 and, when audited, the security headers
+// (see auditSecurity). Headers must satisfy "expect_header.<Name>" (see
+// matchHeaders; "header_mismatch=warn" only warns). A 2xx response must
+// also satisfy "expect_type" and "expect_charset" (see matchContentType),
+// "compression" (see checkCompression), "expect_body" (see matchBody) and
+// "expect_json" (see matchJSON); with any of the responseAssertions set,
+// another response fails. "keepalive" repeats it to check connection
+// reuse (see checkKeepAlive), and "cache" to check caching (see checkCache).
+func checkHTTP(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	start := time.Now()
+
+	client := newHTTPClient(test)
+	chain, err := newRedirectChain(test, start)
+	if err != nil {
+		return "ERROR", 0, fmt.Sprintf("Invalid follow_redirects: %v", err)
+	}
+	if chain != nil {
+		client.CheckRedirect = chain.checkRedirect
+	}
+
+	body, err := requestBody(test)
+	if err != nil {
+		return "ERROR", 0, fmt.Sprintf("Body error: %v", err)
+	}
+	var contentType string
+	if body != nil {
+		contentType = bodyContentType(test, body)
+	}
+	upload := test.Options["upload"] != ""
+	if upload {
+		if body, contentType, err = uploadBody(test); err != nil {
+			return "ERROR", 0, fmt.Sprintf("Upload error: %v", err)
+		}
+	}
+
+	// Create request with context
+	method := test.Method
+	if method == "" {
+		method = "GET"
+		if upload {
+			method = "POST"
+		}
+	}
+	headFirst := boolOption(test, "head") && method == "GET"
+	if headFirst {
+		method = "HEAD"
+	}
+	newRequest := func(method string) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, method, test.URL, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if test.Options["compression"] != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding(test))
+		}
+		return req, nil
+	}
+	req, err := newRequest(method)
+	if err != nil {
+		return "ERROR", 0, fmt.Sprintf("Request creation error: %v", err)
+	}
+	timer := &phaseTimer{}
+	req = timer.trace(req)
+
+	if test.Options["cors"] != "" {
+		if errMsg := corsPreflight(ctx, client, test); errMsg != "" {
+			return "FAIL", 0, errMsg
+		}
+	}
+
+	resp, err := client.Do(req)
+	if headFirst && err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		// The server does not support HEAD; fall back to GET.
+		resp.Body.Close()
+		method = "GET"
+		req, _ = newRequest(method)
+		resp, err = client.Do(timer.trace(req))
+	}
+	if headFirst {
+		setDetail(test, "method", method)
+	}
+	if chain != nil && chain.err != "" {
+		setDetail(test, "redirects", chain.String())
+		return "FAIL", 0, chain.err
+	}
+	if err != nil {
+		recordChainError(test, err)
+		return "FAIL", 0, fmt.Sprintf("HTTP error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	latency := time.Since(start)
+	setDetail(test, "proto", resp.Proto)
+	setDetail(test, "http_status", strconv.Itoa(resp.StatusCode))
+	tlsWarn := false
+	if resp.TLS != nil {
+		tlsWarn = setTLSState(test, *resp.TLS)
+		setCertExpiry(test, *resp.TLS)
+		timer.record(test)
+	} else if verbose > 0 {
+		timer.record(test)
+	}
+	if chain != nil && len(chain.hops) > 0 {
+		chain.record(resp.Request, resp.StatusCode)
+		setDetail(test, "redirects", chain.String())
+		if chain.downgrade != "" {
+			setDetail(test, "downgrade", chain.downgrade)
+		}
+	}
+
+	if test.Details["client_cert"] == "requested" {
+		setDetail(test, "without_cert", probeWithoutClientCert(ctx, test, hostPort(resp.Request.URL, "443"), resp.Request.URL.Hostname()))
+	}
+	if resp.TLS != nil {
+		if status, errMsg := checkTLSVersions(ctx, test, hostPort(resp.Request.URL, "443"), resp.Request.URL.Hostname()); status != "" {
+			return status, 0, errMsg
+		}
+		switch status, errMsg := checkRevocation(ctx, test, *resp.TLS); status {
+		case "":
+		case "WARN":
+			tlsWarn = true
+		default:
+			return status, 0, errMsg
+		}
+	}
+	if errMsg := matchALPN(test); errMsg != "" {
+		return "FAIL", 0, errMsg
+	}
+
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		setDetail(test, "auth_schemes", strings.Join(authSchemes(resp.Header.Values("WWW-Authenticate")), ","))
+	case http.StatusProxyAuthRequired:
+		setDetail(test, "auth_schemes", strings.Join(authSchemes(resp.Header.Values("Proxy-Authenticate")), ","))
+	}
+
+	status := "OK"
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		status = fmt.Sprintf("HTTP %d", resp.StatusCode)
+	} else if (chain != nil && chain.downgrade != "") || tlsWarn {
+		status = "WARN"
+	}
+
+	auditSecurity(test, resp)
+	low, err := checkRateLimit(test, resp.Header)
+	if err != nil {
+		return "ERROR", 0, fmt.Sprintf("Invalid ratelimit_warn: %v", err)
+	}
+	if low && status == "OK" {
+		status = "WARN"
+	}
+
+	if errMsg := matchHeaders(test, resp.Header); errMsg != "" {
+		if test.Options["header_mismatch"] != "warn" {
+			return "FAIL", 0, errMsg
+		}
+		setDetail(test, "header_mismatch", errMsg)
+		if status == "OK" {
+			status = "WARN"
+		}
+	}
+
+	var maxSize int64
+	if v := test.Options["max_size"]; v != "" {
+		if maxSize, err = parseSize(v); err != nil {
+			return "ERROR", 0, fmt.Sprintf("Invalid max_size: %v", err)
+		}
+	}
+	respBody, size, err := readBody(test, resp, start, maxSize)
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("Body read error: %v", err)
+	}
+	if maxSize > 0 && size > maxSize {
+		return "FAIL", 0, fmt.Sprintf("Response body exceeds max_size %s", test.Options["max_size"])
+	}
+
+	if resp.StatusCode/100 != 2 {
+		// An assertion on the response body cannot pass an error page.
+		for _, key := range responseAssertions {
+			if test.Options[key] != "" {
+				return "FAIL", 0, fmt.Sprintf("HTTP %d: %s not evaluated", resp.StatusCode, key)
+			}
+		}
+	}
+	if resp.StatusCode/100 == 2 {
+		if errMsg := checkCompression(test); errMsg != "" {
+			return "FAIL", 0, errMsg
+		}
+		if errMsg := matchContentType(test, resp.Header.Get("Content-Type")); errMsg != "" {
+			return "FAIL", 0, errMsg
+		}
+		if expectBody := test.Options["expect_body"]; expectBody != "" {
+			if errMsg := matchBody(expectBody, respBody); errMsg != "" {
+				return "FAIL", 0, errMsg
+			}
+		}
+		if expectJSON := test.Options["expect_json"]; expectJSON != "" {
+			if errMsg := matchJSON(expectJSON, respBody); errMsg != "" {
+				return "FAIL", 0, errMsg
+			}
+		}
+		if v := test.Options["keepalive"]; v != "" {
+			n := defaultKeepAliveRequests
+			if v != "true" {
+				if n, err = strconv.Atoi(v); err != nil || n < 1 {
+					return "ERROR", 0, fmt.Sprintf("Invalid keepalive %q", v)
+				}
+			}
+			broken, errMsg := checkKeepAlive(client, test, n, func() (*http.Request, error) { return newRequest(method) })
+			if errMsg != "" {
+				return "FAIL", 0, errMsg
+			}
+			if broken && status == "OK" {
+				status = "WARN"
+			}
+		}
+		if test.Options["cache"] != "" {
+			req, _ := newRequest(method)
+			if errMsg := checkCache(client, test, req, resp); errMsg != "" {
+				return "FAIL", 0, errMsg
+			}
+		}
+	}
+
+	return status, latency, ""
+}
+
+// newHTTPClient builds the client used for a test's HTTP requests. The
+// headers from requestHeaders are added to every request, Digest challenges
+// are answered for "digest_auth" (see digestTransport) and NTLM for
+// "ntlm_auth" (see ntlmTransport), cookies are kept
+// per "session" (see sessionJar), and redirects are
+// not followed so the first response is what gets judged, unless the caller
+// replaces CheckRedirect.
+func newHTTPClient(test *ConnectionTest) *http.Client {
+	config, err := tlsConfig(test, "")
+	if err != nil {
+		return &http.Client{Transport: errorTransport{err}}
+	}
+
+	proxyFunc, err := httpProxy(test)
+	if err != nil {
+		return &http.Client{Transport: errorTransport{err}}
+	}
+
+	var transport http.RoundTripper
+	if *forceHTTP2 || boolOption(test, "http2") {
+		transport = http2Transport{
+			tls: &http2.Transport{
+				TLSClientConfig: config,
+				DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+					conn, err := traceConnect(ctx, network, addr, func() (net.Conn, error) {
+						return dialProxied(ctx, test, proxyFunc, "https", network, addr)
+					})
+					if err != nil {
+						return nil, err
+					}
+					tlsConn := tls.Client(conn, cfg)
+					if err := traceHandshake(ctx, tlsConn); err != nil {
+						conn.Close()
+						return nil, err
+					}
+					return tlsConn, nil
+				},
+			},
+			// Cleartext HTTP/2 with prior knowledge (h2c).
+			h2c: &http2.Transport{
+				AllowHTTP: true,
+				DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+					return traceConnect(ctx, network, addr, func() (net.Conn, error) {
+						return dialProxied(ctx, test, proxyFunc, "http", network, addr)
+					})
+				},
+			},
+		}
+	} else {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dial(ctx, test, network, addr)
+		}
+		t.TLSClientConfig = config
+		t.Proxy = proxyFunc
+		transport = t
+	}
+
+	if verbose >= 2 {
+		transport = traceTransport{base: transport, test: test}
+	}
+	if headers, err := requestHeaders(test); err != nil {
+		transport = errorTransport{err}
+	} else if len(headers) > 0 {
+		transport = headerTransport{base: transport, headers: headers}
+	}
+	if auth := test.Options["digest_auth"]; auth != "" {
+		transport = newDigestTransport(transport, auth)
+	}
+	if auth := test.Options["ntlm_auth"]; auth != "" {
+		transport = newNTLMTransport(transport, auth)
+	}
+
+	return &http.Client{
+		Timeout:   testTimeout(test),
+		Transport: transport,
+		Jar:       sessionJar(test.Options["session"]),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+var (
+	sessionJarsMu sync.Mutex
+	sessionJars   = map[string]http.CookieJar{}
+)
+
+// sessionJar returns the cookie jar shared by all tests naming the same
+// "session", so that cookies set by one request (a login, say) are sent by
+// the tests after it. It returns nil, meaning no cookies are kept, for an
+// empty name.
+func sessionJar(name string) http.CookieJar {
+	if name == "" {
+		return nil
+	}
+	sessionJarsMu.Lock()
+	defer sessionJarsMu.Unlock()
+	jar, ok := sessionJars[name]
+	if !ok {
+		jar, _ = cookiejar.New(nil)
+		sessionJars[name] = jar
+	}
+	return jar
+}
+
+// maxBodySize bounds how much of a response body is read for assertions.
+const maxBodySize = 1 << 20
+
+// matchBody checks a response body against an "expect_body" spec: a
+// substring, or a regular expression when prefixed with "~". A leading "!"
+// negates the match. It returns a failure message, or "" on success.
+func matchBody(spec string, body []byte) string {
+	negate := false
+	if rest, ok := strings.CutPrefix(spec, "!"); ok {
+		negate, spec = true, rest
+	}
+
+	var found bool
+	if pattern, ok := strings.CutPrefix(spec, "~"); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Sprintf("Invalid expect_body regexp: %v", err)
+		}
+		found = re.Match(body)
+	} else {
+		found = bytes.Contains(body, []byte(spec))
+	}
+
+	switch {
+	case negate && found:
+		return fmt.Sprintf("Body matches %q", spec)
+	case !negate && !found:
+		return fmt.Sprintf("Body does not match %q", spec)
+	}
+	return ""
+}
+
+// matchHeaders checks the response headers against the test's
+// "expect_header.<Name>" options. A value is matched exactly, or as a
+// regular expression when prefixed with "~"; a bare option only requires
+// the header to be present. It returns a message describing the first
+// mismatch in header name order, or "" when all match.
+func matchHeaders(test *ConnectionTest, header http.Header) string {
+	var names []string
+	for key := range test.Options {
+		if name, ok := strings.CutPrefix(key, "expect_header."); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		want := test.Options["expect_header."+name]
+		name = http.CanonicalHeaderKey(name)
+		values, ok := header[name]
+		if !ok {
+			return fmt.Sprintf("Header %s missing", name)
+		}
+		got := strings.Join(values, ", ")
+		if pattern, ok := strings.CutPrefix(want, "~"); ok {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Sprintf("Invalid expect_header.%s regexp: %v", name, err)
+			}
+			if !re.MatchString(got) {
+				return fmt.Sprintf("Header %s is %q, want match for %q", name, got, pattern)
+			}
+		} else if want != "true" && got != want {
+			return fmt.Sprintf("Header %s is %q, want %q", name, got, want)
+		}
+	}
+	return ""
+}
+
+// matchContentType checks a response Content-Type against the
+// "expect_type" option (a media type such as "application/json", or
+// "text/*") and the "expect_charset" option, both compared
+// case-insensitively. A charset is expected to be declared. It returns a
+// failure message, or "" on success.
+func matchContentType(test *ConnectionTest, contentType string) string {
+	wantType, wantCharset := test.Options["expect_type"], test.Options["expect_charset"]
+	if wantType == "" && wantCharset == "" {
+		return ""
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Sprintf("Content-Type %q is invalid", contentType)
+	}
+	if wantType != "" {
+		want := strings.ToLower(wantType)
+		prefix, wildcard := strings.CutSuffix(want, "/*")
+		if !(mediaType == want || wildcard && strings.HasPrefix(mediaType, prefix+"/")) {
+			return fmt.Sprintf("Content-Type is %s, want %s", mediaType, wantType)
+		}
+	}
+	if wantCharset != "" && !strings.EqualFold(params["charset"], wantCharset) {
+		return fmt.Sprintf("Charset is %q, want %s", params["charset"], wantCharset)
+	}
+	return ""
+}
+
+// matchJSON checks a JSON response body against an "expect_json" spec of the
+// form "$.path==value" or "$.path!=value" ("=" is accepted for "=="). The
+// path is dot-separated from the root "$", with "[n]" or ".n" indexing
+// arrays; a bare path only requires the field to exist. The value is
+// compared as jsonEqual does. It returns a failure message, or "" on
+// success.
+func matchJSON(spec string, body []byte) string {
+	path, op, want := spec, "", ""
+	if i := strings.IndexAny(spec, "!="); i >= 0 {
+		path, op = spec[:i], "=="
+		switch rest := spec[i:]; {
+		case strings.HasPrefix(rest, "!="):
+			op, want = "!=", rest[2:]
+		case strings.HasPrefix(rest, "=="):
+			want = rest[2:]
+		default:
+			want = strings.TrimPrefix(rest, "=")
+		}
+	}
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	path = strings.NewReplacer("[", ".", "]", "").Replace(path)
+
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return fmt.Sprintf("Body is not JSON: %v", err)
+	}
+	if path != "" {
+		var ok bool
+		if v, ok = jsonField(v, path); !ok {
+			return fmt.Sprintf("Body has no field $.%s", path)
+		}
+	}
+
+	got := "null"
+	if v != nil {
+		got = fmt.Sprint(v)
+	}
+	switch {
+	case op == "==" && !jsonEqual(v, want):
+		return fmt.Sprintf("Body field $.%s is %s, want %s", path, got, want)
+	case op == "!=" && jsonEqual(v, want):
+		return fmt.Sprintf("Body field $.%s is %s", path, got)
+	}
+	return ""
+}
+
+// jsonEqual reports whether the decoded JSON value v equals want, as the
+// option text gives it: a quoted JSON string ("up") matches only that
+// string, a number matches any equal number (8 matches 8.0), and other
+// text matches the value as it prints, so that up, true and null work
+// unquoted.
+func jsonEqual(v any, want string) bool {
+	if len(want) >= 2 && want[0] == '"' && want[len(want)-1] == '"' {
+		var s string
+		if err := json.Unmarshal([]byte(want), &s); err == nil {
+			got, ok := v.(string)
+			return ok && got == s
+		}
+	}
+	if n, ok := v.(float64); ok {
+		if w, err := strconv.ParseFloat(want, 64); err == nil {
+			return n == w
+		}
+	}
+	if v == nil {
+		return want == "null"
+	}
+	return fmt.Sprint(v) == want
+}
+
+// stdinBody caches standard input so several targets can use "body=@-".
+var stdinBody = sync.OnceValues(func() ([]byte, error) {
+	return io.ReadAll(os.Stdin)
+})
+
+// requestBody returns the body given by the test's "body" option: inline
+// text, "@file" to read a file, or "@-" to read standard input. It returns
+// nil when the option is unset.
+func requestBody(test *ConnectionTest) ([]byte, error) {
+	v, ok := test.Options["body"]
+	if !ok {
+		return nil, nil
+	}
+	name, ok := strings.CutPrefix(v, "@")
+	if !ok {
+		return []byte(v), nil
+	}
+	if name == "-" {
+		return stdinBody()
+	}
+	return os.ReadFile(name)
+}
+
+// bodyContentType picks the Content-Type for a request body: the
+// "content_type" option if set, JSON for bodies that parse as JSON, and
+// otherwise a sniffed type.
+func bodyContentType(test *ConnectionTest, body []byte) string {
+	if ct := test.Options["content_type"]; ct != "" {
+		return ct
+	}
+	if json.Valid(body) {
+		return "application/json"
+	}
+	return http.DetectContentType(body)
+}
+
+// httpGetJSON fetches target and decodes its JSON body into v, returning a
+// display error message on failure.
+func httpGetJSON(ctx context.Context, client *http.Client, target string, v any) string {
+	req, err := http.NewRequestWithContext(ctx, "GET", target, nil)
+	if err != nil {
+		return fmt.Sprintf("Request creation error: %v", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Sprintf("HTTP error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Sprintf("Invalid response from %s (HTTP %d): %v", req.URL.Path, resp.StatusCode, err)
+	}
+	return ""
+}
+
+// http2Transport forces HTTP/2, speaking h2c to http:// URLs and negotiating
+// h2 over TLS for https:// URLs.
+type http2Transport struct {
+	tls, h2c *http2.Transport
+}
+
+func (t http2Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "http" {
+		return t.h2c.RoundTrip(req)
+	}
+	return t.tls.RoundTrip(req)
+}
+
+// dialProxied connects to addr for a scheme URL through the HTTP proxy
+// proxyFunc picks for it, if any, by a CONNECT tunnel, for transports such
+// as HTTP/2's that dial for themselves; otherwise it dials addr directly.
+func dialProxied(ctx context.Context, test *ConnectionTest, proxyFunc func(*http.Request) (*url.URL, error), scheme, network, addr string) (net.Conn, error) {
+	if proxyFunc == nil {
+		return dial(ctx, test, network, addr)
+	}
+	target := &url.URL{Scheme: scheme, Host: addr}
+	proxyURL, err := proxyFunc(&http.Request{URL: target, Header: http.Header{}})
+	if err != nil {
+		return nil, err
+	}
+	if proxyURL == nil {
+		return dial(ctx, test, network, addr)
+	}
+
+	defaultPort := "80"
+	if proxyURL.Scheme == "https" {
+		defaultPort = "443"
+	}
+	conn, err := dial(ctx, test, network, hostPort(proxyURL, defaultPort))
+	if err != nil {
+		return nil, err
+	}
+	if proxyURL.Scheme == "https" {
+		config, err := tlsConfig(test, proxyURL.Hostname())
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		tlsConn := tls.Client(conn, config)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	connect := &http.Request{Method: http.MethodConnect, URL: &url.URL{Opaque: addr}, Host: addr, Header: http.Header{}}
+	if u := proxyURL.User; u != nil {
+		password, _ := u.Password()
+		connect.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(u.Username()+":"+password)))
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+	if err := connect.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), connect)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy CONNECT: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy CONNECT: %s", resp.Status)
+	}
+	return conn, nil
+}
+
+// httpProxy returns the proxy function for a test's HTTP transport. The
+// "proxy" option (or the -proxy flag) names a proxy URL, or "none" to force
+// a direct connection; otherwise HTTP_PROXY, HTTPS_PROXY and NO_PROXY apply
+// unless the test already goes through a SOCKS5 proxy.
+// The proxy used is recorded in the "proxy" detail.
+func httpProxy(test *ConnectionTest) (func(*http.Request) (*url.URL, error), error) {
+	setting := test.Options["proxy"]
+	if setting == "" {
+		setting = *proxy
+	}
+
+	var pick func(*http.Request) (*url.URL, error)
+	switch setting {
+	case "":
+		if viaSOCKS(test) {
+			return nil, nil
+		}
+		pick = http.ProxyFromEnvironment
+	case "none", "direct":
+		return nil, nil
+	default:
+		u, err := url.Parse(setting)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", setting)
+		}
+		pick = http.ProxyURL(u)
+	}
+
+	return func(req *http.Request) (*url.URL, error) {
+		u, err := pick(req)
+		if u != nil {
+			setDetail(test, "proxy", u.Host)
+		}
+		return u, err
+	}, nil
+}
+
+// requestHeaders returns the headers to add to a test's HTTP requests: the
+// -user-agent and -header defaults, an Authorization header from the
+// "basic_auth" or "bearer"/"bearer_env" options (falling back to the
+// -basic-auth and -bearer flags), and finally the test's own headers.
+func requestHeaders(test *ConnectionTest) (map[string]string, error) {
+	headers := make(map[string]string, len(defaultHeaders)+len(test.Headers)+2)
+	if *userAgent != "" {
+		headers["User-Agent"] = *userAgent
+	}
+	for name, value := range defaultHeaders {
+		headers[name] = value
+	}
+
+	auth := test.Options["basic_auth"]
+	token := test.Options["bearer"]
+	if name := test.Options["bearer_env"]; name != "" {
+		if token = os.Getenv(name); token == "" {
+			return nil, fmt.Errorf("bearer token variable %s is not set", name)
+		}
+	}
+	if auth == "" && token == "" {
+		auth, token = *basicAuth, *bearer
+	}
+
+	switch {
+	case auth != "":
+		user, password, ok := strings.Cut(auth, ":")
+		if !ok {
+			password = os.Getenv("BASIC_AUTH_PASSWORD")
+		}
+		headers["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+	case token != "":
+		if name, ok := strings.CutPrefix(token, "@"); ok {
+			b, err := os.ReadFile(name)
+			if err != nil {
+				return nil, fmt.Errorf("bearer token: %v", err)
+			}
+			token = strings.TrimSpace(string(b))
+		}
+		headers["Authorization"] = "Bearer " + token
+	}
+
+	for name, value := range test.Headers {
+		headers[name] = value
+	}
+	return headers, nil
+}
+
+// headerTransport sets fixed headers on each request before passing it on.
+// A "Host" header overrides the request's virtual host.
+type headerTransport struct {
+	base    http.RoundTripper
+	headers map[string]string
+}
+
+func (t headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for name, value := range t.headers {
+		if name == "Host" {
+			req.Host = value
+			continue
+		}
+		req.Header.Set(name, value)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// errorTransport fails every request, deferring a client setup error to the
+// point where the check reports it.
+type errorTransport struct {
+	err error
+}
+
+func (t errorTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, t.err
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// checkHTTP3 requests an h3:// target (h3://host/path) over QUIC, dialed
+// through the shared resolve, family and DNS options (see dialQUIC), and
+// reports the negotiated QUIC version and TLS parameters (see setTLSState),
+// failing unless any "expect_alpn" protocol is negotiated. It then repeats
+// the request over HTTP/2 on TCP and reports the latency difference, so
+// HTTP/3 rollout can be verified per edge location.
+func checkHTTP3(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	httpsURL, err := h3ToHTTPS(test.URL)
+	if err != nil {
+		return "ERROR", 0, "Invalid URL"
+	}
+
+	config, err := tlsConfig(test, "")
+	if err != nil {
+		return "ERROR", 0, fmt.Sprintf("TLS configuration error: %v", err)
+	}
+
+	var conn quic.EarlyConnection
+	var transports []*quic.Transport
+	rt := &http3.RoundTripper{
+		TLSClientConfig: config,
+		QuicConfig:      &quic.Config{HandshakeIdleTimeout: testConnectTimeout(test)},
+		Dial: func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlyConnection, error) {
+			tr, c, err := dialQUIC(ctx, test, addr, tlsCfg, cfg)
+			if tr != nil {
+				transports = append(transports, tr)
+			}
+			conn = c
+			return c, err
+		},
+	}
+	defer func() {
+		rt.Close()
+		for _, tr := range transports {
+			tr.Close()
+		}
+	}()
+
+	start := time.Now()
+	resp, err := timedGet(ctx, &http.Client{Transport: rt, Timeout: testTimeout(test)}, httpsURL)
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("HTTP/3 error: %v", err)
+	}
+	latency := time.Since(start)
+	setDetail(test, "proto", resp.Proto)
+	weakCipher := false
+	if resp.TLS != nil {
+		weakCipher = setTLSState(test, *resp.TLS)
+		setCertExpiry(test, *resp.TLS)
+	}
+	if errMsg := matchALPN(test); errMsg != "" {
+		return "FAIL", 0, errMsg
+	}
+	if conn != nil {
+		setDetail(test, "quic", conn.ConnectionState().Version.String())
+	}
+
+	h2Client := &http.Client{
+		Timeout: testTimeout(test),
+		Transport: &http.Transport{
+			ForceAttemptHTTP2: true,
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return dial(ctx, test, network, addr)
+			},
+		},
+	}
+	h2Start := time.Now()
+	if h2Resp, err := timedGet(ctx, h2Client, httpsURL); err != nil {
+		setDetail(test, "h2", "error")
+	} else {
+		h2Latency := time.Since(h2Start)
+		setDetail(test, "h2", fmt.Sprintf("%s %s", h2Resp.Proto, formatDuration(h2Latency)))
+		setDetail(test, "h3_delta", formatSignedDuration(latency-h2Latency))
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Sprintf("HTTP %d", resp.StatusCode), latency, ""
+	}
+	if weakCipher {
+		return "WARN", latency, ""
+	}
+	return "OK", latency, ""
+}
+
+// dialQUIC opens a QUIC connection for test like dial does for TCP: over
+// its address family (see familyNetwork), to any -resolve or "resolve"
+// address (see resolveAddr) or else the first address lookupHost finds,
+// recording "ip" and "ptr" the same way. It returns the transport owning
+// the UDP socket, which the caller closes once done with the connection.
+func dialQUIC(ctx context.Context, test *ConnectionTest, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Transport, quic.EarlyConnection, error) {
+	network := familyNetwork(test, "udp")
+	addr, ip, err := resolveAddr(test, addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ip != "" {
+		setDetail(test, "resolve", ip)
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	if net.ParseIP(host) == nil {
+		ips, err := lookupHost(ctx, test, network, host)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(ips) == 0 {
+			return nil, nil, fmt.Errorf("no addresses for %s", host)
+		}
+		host = ips[0].String()
+	}
+	raddr, err := net.ResolveUDPAddr(network, net.JoinHostPort(host, port))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pc, err := net.ListenUDP(network, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	tr := &quic.Transport{Conn: pc}
+	conn, err := tr.DialEarly(ctx, raddr, tlsCfg, cfg)
+	if err != nil {
+		tr.Close()
+		return nil, nil, err
+	}
+	if reversePTR(test) {
+		lookupPTR(ctx, test, raddr)
+	} else if verbose > 0 || tableColumn("ip") {
+		setDetail(test, "ip", raddr.IP.String())
+	}
+	return tr, conn, nil
+}
+
+// h3ToHTTPS rewrites an h3:// URL to the https:// URL it addresses.
+func h3ToHTTPS(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return "", fmt.Errorf("invalid URL %q", rawURL)
+	}
+	u.Scheme = "https"
+	return u.String(), nil
+}
+
+// timedGet performs a GET and drains the body so the full response time is
+// measured.
+func timedGet(ctx context.Context, client *http.Client, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp, nil
+}
+
+// formatSignedDuration formats d like formatDuration with an explicit sign.
+func formatSignedDuration(d time.Duration) string {
+	if d < 0 {
+		return "-" + formatDuration(-d)
+	}
+	return "+" + formatDuration(d)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// serveHTTP3 serves handler over HTTP/3 on a local UDP port with a
+// certificate for "h3.test" and 127.0.0.1, trusted for the test, and
+// returns the port.
+func serveHTTP3(t *testing.T, handler http.Handler) string {
+	t.Helper()
+	leaf, key := issueCert(t, "h3.test", false, nil, nil)
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http3.Server{
+		Handler:   handler,
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{leaf.Raw}, PrivateKey: key}}},
+	}
+	go srv.Serve(pc)
+	t.Cleanup(func() {
+		srv.Close()
+		pc.Close()
+	})
+
+	tlsRootCAs = x509.NewCertPool()
+	tlsRootCAs.AddCert(leaf)
+	t.Cleanup(func() { tlsRootCAs = nil })
+	_, port, _ := net.SplitHostPort(pc.LocalAddr().String())
+	return port
+}
+
+func TestCheckHTTP3(t *testing.T) {
+	port := serveHTTP3(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+
+	tests := []struct {
+		target string
+		status string
+	}{
+		{"/ resolve=127.0.0.1", "OK"},
+		{"/down resolve=127.0.0.1", "HTTP 503"},
+		{"/ resolve=127.0.0.1 family=6", "FAIL"},
+	}
+	for _, tt := range tests {
+		test := parseTestConfig("edge=h3://h3.test:" + port + tt.target)
+		status, _, errMsg := checkHTTP3(context.Background(), &test)
+		if status != tt.status {
+			t.Errorf("checkHTTP3(%s) = %s (%s), want %s", tt.target, status, errMsg, tt.status)
+		}
+		if test.Details["resolve"] != "127.0.0.1" {
+			t.Errorf("checkHTTP3(%s) resolve = %q, want 127.0.0.1", tt.target, test.Details["resolve"])
+		}
+		if status == "OK" && (!strings.HasPrefix(test.Details["proto"], "HTTP/3") || test.Details["quic"] == "") {
+			t.Errorf("checkHTTP3(%s) details = %v, want proto HTTP/3 and quic", tt.target, test.Details)
+		}
+	}
+}
+
+func TestH3ToHTTPS(t *testing.T) {
+	tests := []struct {
+		in, want string
+		wantErr  bool
+	}{
+		{"h3://example.com/health", "https://example.com/health", false},
+		{"h3://example.com:8443/?q=1", "https://example.com:8443/?q=1", false},
+		{"h3:///nohost", "", true},
+	}
+	for _, tt := range tests {
+		got, err := h3ToHTTPS(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("h3ToHTTPS(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestFormatSignedDuration(t *testing.T) {
+	if got := formatSignedDuration(-12_000_000); got != "-12ms" {
+		t.Errorf("formatSignedDuration(-12ms) = %q", got)
+	}
+	if got := formatSignedDuration(3_000_000); got != "+3ms" {
+		t.Errorf("formatSignedDuration(3ms) = %q", got)
+	}
+}
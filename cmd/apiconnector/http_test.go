@@ -0,0 +1,587 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func TestCheckHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/missing":
+			http.NotFound(w, r)
+		case r.URL.Path == "/post-only" && r.Method != "POST":
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		target string
+		status string
+	}{
+		{"/health", "OK"},
+		{"/missing", "HTTP 404"},
+		{"/post-only", "HTTP 405"},
+		{"POST /post-only", "OK"},
+	}
+	for _, tt := range tests {
+		method, path, found := strings.Cut(tt.target, " ")
+		if !found {
+			method, path = "", tt.target
+		}
+		test := &ConnectionTest{Method: method, URL: srv.URL + path}
+		status, _, errMsg := checkHTTP(context.Background(), test)
+		if status != tt.status || test.Details["proto"] != "HTTP/1.1" {
+			t.Errorf("checkHTTP(%s) = %s (%s) %v, want %s over HTTP/1.1", tt.target, status, errMsg, test.Details, tt.status)
+		}
+	}
+}
+
+func TestCheckHTTPHeaders(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "tenant.example.com" || r.Header.Get("X-Api-Key") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer srv.Close()
+
+	test := parseTestConfig("api=" + srv.URL + " Host:tenant.example.com X-Api-Key:secret")
+	if status, _, errMsg := checkHTTP(context.Background(), &test); status != "OK" {
+		t.Errorf("checkHTTP with headers = %s (%s), want OK", status, errMsg)
+	}
+
+	test = parseTestConfig("api=" + srv.URL)
+	if status, _, _ := checkHTTP(context.Background(), &test); status != "HTTP 403" {
+		t.Errorf("checkHTTP without headers = %s, want HTTP 403", status)
+	}
+}
+
+func TestCheckHTTPDefaultHeaders(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.UserAgent() != r.URL.Query().Get("ua") || r.Header.Get("X-Team") != r.URL.Query().Get("team") {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer srv.Close()
+
+	*userAgent = "apiconnector-probe/1.0"
+	for _, h := range []string{"X-Team: payments", "x-env:prod"} {
+		if err := defaultHeaders.Set(h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func() {
+		*userAgent = ""
+		delete(defaultHeaders, "X-Team")
+		delete(defaultHeaders, "X-Env")
+	}()
+	if err := defaultHeaders.Set("no value"); err == nil {
+		t.Error("defaultHeaders.Set without a colon succeeded, want error")
+	}
+
+	tests := []struct {
+		options string
+		query   string
+	}{
+		{"", "ua=apiconnector-probe/1.0&team=payments"},
+		{"User-Agent:custom X-Team:search", "ua=custom&team=search"},
+	}
+	for _, tt := range tests {
+		test := parseTestConfig("api=" + srv.URL + "/?" + tt.query + " " + tt.options)
+		if status, _, errMsg := checkHTTP(context.Background(), &test); status != "OK" {
+			t.Errorf("checkHTTP(%s) = %s (%s), want OK", tt.options, status, errMsg)
+		}
+	}
+}
+
+func TestCheckHTTPBasicAuth(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "admin" || pass != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	t.Setenv("BASIC_AUTH_PASSWORD", "s3cret")
+	tests := []struct {
+		options string
+		flag    string
+		status  string
+	}{
+		{"", "", "HTTP 401"},
+		{"basic_auth=admin:s3cret", "", "OK"},
+		{"basic_auth=admin", "", "OK"},
+		{"basic_auth=admin:wrong", "", "HTTP 401"},
+		{"", "admin:s3cret", "OK"},
+		{"basic_auth=admin:wrong", "admin:s3cret", "HTTP 401"},
+	}
+	for _, tt := range tests {
+		*basicAuth = tt.flag
+		test := parseTestConfig("api=" + srv.URL + " " + tt.options)
+		if status, _, errMsg := checkHTTP(context.Background(), &test); status != tt.status {
+			t.Errorf("checkHTTP(%q, -basic-auth=%q) = %s (%s), want %s", tt.options, tt.flag, status, errMsg, tt.status)
+		}
+	}
+	*basicAuth = ""
+}
+
+func TestCheckHTTPBearer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tok123" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	file := filepath.Join(t.TempDir(), "token")
+	os.WriteFile(file, []byte("tok123\n"), 0o600)
+	t.Setenv("API_TOKEN", "tok123")
+
+	tests := []struct {
+		options string
+		flag    string
+		status  string
+	}{
+		{"bearer=tok123", "", "OK"},
+		{"bearer=@" + file, "", "OK"},
+		{"bearer_env=API_TOKEN", "", "OK"},
+		{"bearer_env=UNSET_TOKEN", "", "FAIL"},
+		{"bearer=@" + file + ".missing", "", "FAIL"},
+		{"", "@" + file, "OK"},
+		{"bearer=other", "tok123", "HTTP 401"},
+	}
+	for _, tt := range tests {
+		*bearer = tt.flag
+		test := parseTestConfig("api=" + srv.URL + " " + tt.options)
+		if status, _, errMsg := checkHTTP(context.Background(), &test); status != tt.status {
+			t.Errorf("checkHTTP(%q, -bearer=%q) = %s (%s), want %s", tt.options, tt.flag, status, errMsg, tt.status)
+		}
+	}
+	*bearer = ""
+}
+
+func TestCheckHTTPProxy(t *testing.T) {
+	proxySrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !r.URL.IsAbs() || r.URL.Host != "backend.invalid" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer proxySrv.Close()
+	proxyHost := strings.TrimPrefix(proxySrv.URL, "http://")
+
+	tests := []struct {
+		options string
+		flag    string
+		status  string
+		via     string
+	}{
+		{"proxy=" + proxySrv.URL, "", "OK", proxyHost},
+		{"", proxySrv.URL, "OK", proxyHost},
+		{"proxy=none", proxySrv.URL, "FAIL", ""},
+		{"proxy=::bad", "", "FAIL", ""},
+	}
+	for _, tt := range tests {
+		*proxy = tt.flag
+		test := parseTestConfig("api=http://backend.invalid/health " + tt.options)
+		status, _, errMsg := checkHTTP(context.Background(), &test)
+		if status != tt.status || test.Details["proxy"] != tt.via {
+			t.Errorf("checkHTTP(%q, -proxy=%q) = %s (%s) %v, want %s via %q", tt.options, tt.flag, status, errMsg, test.Details, tt.status, tt.via)
+		}
+	}
+	*proxy = ""
+}
+
+func TestCheckHTTPBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		q := r.URL.Query()
+		if string(body) != q.Get("body") || r.Header.Get("Content-Type") != q.Get("type") {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	const xmlBody = `<?xml version="1.0"?><ping/>`
+	file := filepath.Join(t.TempDir(), "payload.xml")
+	if err := os.WriteFile(file, []byte(xmlBody), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		options     string
+		body        string
+		contentType string
+	}{
+		{`body={"ping":true}`, `{"ping":true}`, "application/json"},
+		{"body=@" + file, xmlBody, "text/xml; charset=utf-8"},
+		{"body=ping content_type=text/plain", "ping", "text/plain"},
+		{"body=ping Content-Type:application/x-custom", "ping", "application/x-custom"},
+	}
+	for _, tt := range tests {
+		q := url.Values{"body": {tt.body}, "type": {tt.contentType}}
+		test := parseTestConfig("api=POST " + srv.URL + "/?" + q.Encode() + " " + tt.options)
+		if status, _, errMsg := checkHTTP(context.Background(), &test); status != "OK" {
+			t.Errorf("checkHTTP(%s) = %s (%s), want OK", tt.options, status, errMsg)
+		}
+	}
+
+	test := parseTestConfig("api=POST " + srv.URL + " body=@" + filepath.Join(t.TempDir(), "missing"))
+	if status, _, _ := checkHTTP(context.Background(), &test); status != "ERROR" {
+		t.Errorf("checkHTTP with missing body file = %s, want ERROR", status)
+	}
+}
+
+func TestCheckHTTPExpectBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"status":"ok","version":"1.4.2"}`)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		expect string
+		status string
+	}{
+		{`"status":"ok"`, "OK"},
+		{`"status":"down"`, "FAIL"},
+		{`~"version":"1\.\d+`, "OK"},
+		{`~"version":"2\.`, "FAIL"},
+		{`!"status":"down"`, "OK"},
+		{`!~status`, "FAIL"},
+		{`~(`, "FAIL"},
+	}
+	for _, tt := range tests {
+		test := parseTestConfig("api=" + srv.URL + " expect_body=" + tt.expect)
+		if status, _, errMsg := checkHTTP(context.Background(), &test); status != tt.status {
+			t.Errorf("checkHTTP(expect_body=%s) = %s (%s), want %s", tt.expect, status, errMsg, tt.status)
+		}
+	}
+}
+
+func TestCheckHTTPExpectBodyError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		io.WriteString(w, `{"status":"down"}`)
+	}))
+	defer srv.Close()
+
+	test := parseTestConfig("api=" + srv.URL + ` expect_body="status":"ok"`)
+	status, _, errMsg := checkHTTP(context.Background(), &test)
+	if status != "FAIL" || errMsg != "HTTP 503: expect_body not evaluated" {
+		t.Errorf("checkHTTP(expect_body) on a 503 = %s (%s), want FAIL", status, errMsg)
+	}
+	if got := resultStatus(&ConnectionTest{Status: status, Error: errMsg}); got != "FAIL" {
+		t.Errorf("result status = %s, want FAIL", got)
+	}
+}
+
+func TestMatchJSON(t *testing.T) {
+	body := []byte(`{"status":"up","code":"8","pool":8,"ratio":0.5,"ready":true,"error":null}`)
+	tests := []struct {
+		spec string
+		ok   bool
+	}{
+		{`$.status==up`, true},
+		{`$.status=="up"`, true},
+		{`$.status=="down"`, false},
+		{`$.status!="up"`, false},
+		{`$.pool==8`, true},
+		{`$.pool==8.0`, true},
+		{`$.pool=="8"`, false},
+		{`$.code=="8"`, true},
+		{`$.ratio==0.5`, true},
+		{`$.ready==true`, true},
+		{`$.ready==false`, false},
+		{`$.ready=="true"`, false},
+		{`$.error==null`, true},
+		{`$.error=="null"`, false},
+	}
+	for _, tt := range tests {
+		if errMsg := matchJSON(tt.spec, body); (errMsg == "") != tt.ok {
+			t.Errorf("matchJSON(%s) = %q, want ok %v", tt.spec, errMsg, tt.ok)
+		}
+	}
+}
+
+func TestCheckHTTPExpectJSONError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		io.WriteString(w, `{"status":"up"}`)
+	}))
+	defer srv.Close()
+
+	test := parseTestConfig("api=" + srv.URL + " expect_json=$.status==up")
+	if status, _, errMsg := checkHTTP(context.Background(), &test); status != "FAIL" || errMsg != "HTTP 503: expect_json not evaluated" {
+		t.Errorf("checkHTTP(expect_json) on a 503 = %s (%s), want FAIL", status, errMsg)
+	}
+}
+
+func TestCheckHTTPExpectJSON(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"status":"UP","checks":{"db":{"status":"up","pool":8},"disks":[{"free":true}]},"error":null}`)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		expect string
+		status string
+	}{
+		{"$.checks.db.status==up", "OK"},
+		{"$.checks.db.status=up", "OK"},
+		{`$.checks.db.status=="up"`, "OK"},
+		{`$.checks.db.status!="up"`, "FAIL"},
+		{"$.checks.db.status==down", "FAIL"},
+		{"$.checks.db.status!=down", "OK"},
+		{"$.status!=UP", "FAIL"},
+		{"$.checks.db.pool==8", "OK"},
+		{"$.checks.disks[0].free==true", "OK"},
+		{"$.error==null", "OK"},
+		{"$.checks.cache", "FAIL"},
+		{"$.checks.db", "OK"},
+	}
+	for _, tt := range tests {
+		test := parseTestConfig("api=" + srv.URL + " expect_json=" + tt.expect)
+		if status, _, errMsg := checkHTTP(context.Background(), &test); status != tt.status {
+			t.Errorf("checkHTTP(expect_json=%s) = %s (%s), want %s", tt.expect, status, errMsg, tt.status)
+		}
+	}
+}
+
+func TestCheckHTTPExpectHeaders(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Served-By", "eu-west-1a")
+		w.Header().Set("Cache-Control", "no-store")
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		options string
+		status  string
+	}{
+		{"expect_header.X-Served-By=~^eu-", "OK"},
+		{"expect_header.x-served-by=~^us-", "FAIL"},
+		{"expect_header.Cache-Control", "OK"},
+		{"expect_header.Cache-Control=no-store expect_header.X-Served-By=eu-west-1a", "OK"},
+		{"expect_header.Cache-Control=no-cache", "FAIL"},
+		{"expect_header.Cache-Control=no-cache header_mismatch=warn", "WARN"},
+		{"expect_header.Etag", "FAIL"},
+	}
+	for _, tt := range tests {
+		test := parseTestConfig("api=" + srv.URL + " " + tt.options)
+		if status, _, errMsg := checkHTTP(context.Background(), &test); status != tt.status {
+			t.Errorf("checkHTTP(%s) = %s (%s), want %s", tt.options, status, errMsg, tt.status)
+		}
+	}
+}
+
+func TestCheckHTTPSession(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: "s3cr3t", Path: "/"})
+		case "/me":
+			if c, err := r.Cookie("sid"); err != nil || c.Value != "s3cr3t" {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		}
+	}))
+	defer srv.Close()
+	defer func() { sessionJars = map[string]http.CookieJar{} }()
+
+	tests := []struct {
+		target string
+		status string
+	}{
+		{"/me session=flow", "HTTP 401"},
+		{"/login session=flow", "OK"},
+		{"/me session=flow", "OK"},
+		{"/me session=other", "HTTP 401"},
+		{"/me", "HTTP 401"},
+	}
+	for _, tt := range tests {
+		test := parseTestConfig("api=" + srv.URL + tt.target)
+		if status, _, errMsg := checkHTTP(context.Background(), &test); status != tt.status {
+			t.Errorf("checkHTTP(%s) = %s (%s), want %s", tt.target, status, errMsg, tt.status)
+		}
+	}
+}
+
+func TestCheckHTTPHead(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead && r.URL.Path == "/nohead" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		target string
+		method string
+	}{
+		{"/file head", "HEAD"},
+		{"/nohead head", "GET"},
+		{"/file", ""},
+	}
+	for _, tt := range tests {
+		test := parseTestConfig("api=" + srv.URL + tt.target)
+		status, _, errMsg := checkHTTP(context.Background(), &test)
+		if status != "OK" || test.Details["method"] != tt.method {
+			t.Errorf("checkHTTP(%s) = %s (%s) method %q, want OK method %q", tt.target, status, errMsg, test.Details["method"], tt.method)
+		}
+	}
+}
+
+func TestCheckHTTPExpectContentType(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.URL.Query().Get("type"))
+		if r.URL.Query().Has("down") {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		contentType string
+		options     string
+		status      string
+	}{
+		{"application/json", "expect_type=application/json", "OK"},
+		{"Application/JSON; charset=UTF-8", "expect_type=application/json expect_charset=utf-8", "OK"},
+		{"text/html; charset=utf-8", "expect_type=application/json", "FAIL"},
+		{"text/plain", "expect_type=text/*", "OK"},
+		{"application/json", "expect_charset=utf-8", "FAIL"},
+		{"application/json; charset=iso-8859-1", "expect_charset=utf-8", "FAIL"},
+		{"", "expect_type=application/json", "FAIL"},
+		{"application/json; charset=utf-8", "down expect_charset=utf-8", "FAIL"},
+	}
+	for _, tt := range tests {
+		q := url.Values{"type": {tt.contentType}}
+		options, down := strings.CutPrefix(tt.options, "down ")
+		if down {
+			q.Set("down", "")
+		}
+		test := parseTestConfig("api=" + srv.URL + "/?" + q.Encode() + " " + options)
+		if status, _, errMsg := checkHTTP(context.Background(), &test); status != tt.status {
+			t.Errorf("checkHTTP(%q, %s) = %s (%s), want %s", tt.contentType, tt.options, status, errMsg, tt.status)
+		}
+	}
+}
+
+func TestCheckHTTPCertExpiry(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	tlsRootCAs = x509.NewCertPool()
+	tlsRootCAs.AddCert(srv.Certificate())
+	defer func() { tlsRootCAs = nil }()
+
+	test := parseTestConfig("web=" + srv.URL)
+	status, _, errMsg := checkHTTP(context.Background(), &test)
+	if status != "OK" || test.Details["cert_expires"] != srv.Certificate().NotAfter.UTC().Format("2006-01-02") || test.Details["cert_days"] == "" {
+		t.Errorf("checkHTTP(%s) = %s (%s) %v, want OK with cert_expires and cert_days", srv.URL, status, errMsg, test.Details)
+	}
+}
+
+func TestCheckHTTPPriorKnowledge(t *testing.T) {
+	srv := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), &http2.Server{}))
+	defer srv.Close()
+
+	test := parseTestConfig("api=" + srv.URL + " http2")
+	status, _, errMsg := checkHTTP(context.Background(), &test)
+	if status != "OK" || test.Details["proto"] != "HTTP/2.0" {
+		t.Errorf("checkHTTP with http2 = %s (%s) %v, want OK over HTTP/2.0", status, errMsg, test.Details)
+	}
+
+	*forceHTTP2 = true
+	defer func() { *forceHTTP2 = false }()
+	test = ConnectionTest{URL: srv.URL}
+	if status, _, errMsg := checkHTTP(context.Background(), &test); status != "OK" || test.Details["proto"] != "HTTP/2.0" {
+		t.Errorf("checkHTTP with -http2 = %s (%s) %v, want OK over HTTP/2.0", status, errMsg, test.Details)
+	}
+}
+
+func TestCheckHTTPForcedHTTP2Fallback(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	test := parseTestConfig("api=" + srv.URL + " http2")
+	if status, _, _ := checkHTTP(context.Background(), &test); status != "FAIL" {
+		t.Errorf("checkHTTP with http2 against HTTP/1.1-only server = %s, want FAIL", status)
+	}
+}
+
+// connectProxy returns an HTTP proxy that tunnels CONNECT requests for
+// backend.invalid to backend, recording the targets it was asked for.
+func connectProxy(t *testing.T, backend string) (*httptest.Server, *[]string) {
+	var targets []string
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		targets = append(targets, r.Method+" "+r.Host)
+		mu.Unlock()
+		host, _, _ := net.SplitHostPort(r.Host)
+		if r.Method != http.MethodConnect || host != "backend.invalid" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		upstream, err := net.Dial("tcp", backend)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			upstream.Close()
+			return
+		}
+		io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+		go func() {
+			io.Copy(upstream, conn)
+			upstream.Close()
+		}()
+		io.Copy(conn, upstream)
+		conn.Close()
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &targets
+}
+
+func TestCheckHTTP2Proxy(t *testing.T) {
+	h2cSrv := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), &http2.Server{}))
+	defer h2cSrv.Close()
+	tlsSrv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tlsSrv.EnableHTTP2 = true
+	tlsSrv.StartTLS()
+	defer tlsSrv.Close()
+
+	for _, tt := range []struct {
+		scheme string
+		srv    *httptest.Server
+	}{
+		{"http", h2cSrv},
+		{"https", tlsSrv},
+	} {
+		proxySrv, targets := connectProxy(t, tt.srv.Listener.Addr().String())
+		_, port, _ := net.SplitHostPort(tt.srv.Listener.Addr().String())
+		test := parseTestConfig("api=" + tt.scheme + "://backend.invalid:" + port + "/health http2 skip_verify proxy=" + proxySrv.URL)
+		status, _, errMsg := checkHTTP(context.Background(), &test)
+		if status != "OK" || test.Details["proto"] != "HTTP/2.0" || test.Details["proxy"] != strings.TrimPrefix(proxySrv.URL, "http://") {
+			t.Errorf("checkHTTP(%s, http2 via proxy) = %s (%s) %v, want OK over HTTP/2.0 via the proxy", tt.scheme, status, errMsg, test.Details)
+		}
+		if want := "CONNECT backend.invalid:" + port; len(*targets) != 1 || (*targets)[0] != want {
+			t.Errorf("proxy requests = %q, want %q", *targets, want)
+		}
+	}
+}
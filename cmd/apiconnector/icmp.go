@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// icmpReplyTimeout bounds the wait for each echo reply.
+const icmpReplyTimeout = time.Second
+
+// checkICMP sends ICMP echo requests to the URL host (icmp://10.0.0.1) and
+// reports the average round-trip time and packet loss. It uses a raw socket
+// when privileged and falls back to an unprivileged datagram socket
+// otherwise. The "count" option sets the number of probes (default 3); the
+// check fails only if every probe is lost.
+func checkICMP(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	u, err := url.Parse(test.URL)
+	if err != nil || u.Hostname() == "" {
+		return "ERROR", 0, "Invalid URL"
+	}
+
+	count := 3
+	if v := test.Options["count"]; v != "" {
+		if count, err = strconv.Atoi(v); err != nil || count < 1 {
+			return "ERROR", 0, fmt.Sprintf("Invalid count %q", v)
+		}
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil || len(addrs) == 0 {
+		return "FAIL", 0, fmt.Sprintf("Resolve error: %v", err)
+	}
+	ip := addrs[0].IP
+
+	conn, dst, proto, echoType, err := icmpListen(ip)
+	if err != nil {
+		return "ERROR", 0, fmt.Sprintf("ICMP socket error: %v", err)
+	}
+	defer conn.Close()
+
+	var received int
+	var total time.Duration
+	id := os.Getpid() & 0xFFFF
+	buf := make([]byte, 1500)
+	for seq := 1; seq <= count; seq++ {
+		select {
+		case <-ctx.Done():
+			return "ERROR", 0, "context cancelled"
+		default:
+		}
+
+		msg := icmp.Message{
+			Type: echoType,
+			Body: &icmp.Echo{ID: id, Seq: seq, Data: []byte("apiconnector")},
+		}
+		packet, err := msg.Marshal(nil)
+		if err != nil {
+			return "ERROR", 0, fmt.Sprintf("ICMP encode error: %v", err)
+		}
+
+		sent := time.Now()
+		if _, err := conn.WriteTo(packet, dst); err != nil {
+			return "FAIL", 0, fmt.Sprintf("ICMP send error: %v", err)
+		}
+		conn.SetReadDeadline(sent.Add(icmpReplyTimeout))
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				break
+			}
+			reply, err := icmp.ParseMessage(proto, buf[:n])
+			if err != nil {
+				continue
+			}
+			if echo, ok := reply.Body.(*icmp.Echo); ok && echo.Seq == seq &&
+				(reply.Type == ipv4.ICMPTypeEchoReply || reply.Type == ipv6.ICMPTypeEchoReply) {
+				received++
+				total += time.Since(sent)
+				break
+			}
+		}
+	}
+
+	loss := 100 * (count - received) / count
+	setDetail(test, "loss", strconv.Itoa(loss)+"%")
+	if received == 0 {
+		return "FAIL", 0, fmt.Sprintf("No echo replies from %s (%d sent)", ip, count)
+	}
+	rtt := total / time.Duration(received)
+	setDetail(test, "rtt", formatDuration(rtt))
+
+	return "OK", rtt, ""
+}
+
+// icmpListen opens an ICMP socket suitable for ip, preferring a raw socket
+// and falling back to an unprivileged one. It returns the socket, the
+// destination address in the form that socket expects, the protocol number
+// for parsing replies and the echo request type.
+func icmpListen(ip net.IP) (*icmp.PacketConn, net.Addr, int, icmp.Type, error) {
+	network, unprivileged, address, proto := "ip4:icmp", "udp4", "0.0.0.0", 1
+	var echoType icmp.Type = ipv4.ICMPTypeEcho
+	if ip.To4() == nil {
+		network, unprivileged, address, proto = "ip6:ipv6-icmp", "udp6", "::", 58
+		echoType = ipv6.ICMPTypeEchoRequest
+	}
+
+	if conn, err := icmp.ListenPacket(network, address); err == nil {
+		return conn, &net.IPAddr{IP: ip}, proto, echoType, nil
+	}
+	conn, err := icmp.ListenPacket(unprivileged, address)
+	if err != nil {
+		return nil, nil, 0, nil, err
+	}
+	return conn, &net.UDPAddr{IP: ip}, proto, echoType, nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+func TestCheckICMPLoopback(t *testing.T) {
+	conn, _, _, _, err := icmpListen(net.IPv4(127, 0, 0, 1))
+	if err != nil {
+		t.Skipf("ICMP sockets unavailable: %v", err)
+	}
+	conn.Close()
+
+	test := parseTestConfig("lo=icmp://127.0.0.1 count=2")
+	status, _, errMsg := checkICMP(context.Background(), &test)
+	if status != "OK" || test.Details["loss"] != "0%" {
+		t.Errorf("checkICMP(127.0.0.1) = %s (%s) %v, want OK with 0%% loss", status, errMsg, test.Details)
+	}
+}
+
+func TestCheckICMPInvalidCount(t *testing.T) {
+	test := parseTestConfig("lo=icmp://127.0.0.1 count=zero")
+	if status, _, _ := checkICMP(context.Background(), &test); status != "ERROR" {
+		t.Errorf("checkICMP with invalid count = %s, want ERROR", status)
+	}
+}
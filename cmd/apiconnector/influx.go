@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// checkInflux queries InfluxDB's /health endpoint (influx:// on port 8086,
+// influxs:// over HTTPS) and requires status "pass", reporting the server
+// version.
+func checkInflux(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	start := time.Now()
+
+	u, err := url.Parse(test.URL)
+	if err != nil || u.Hostname() == "" {
+		return "ERROR", 0, "Invalid URL"
+	}
+
+	target := url.URL{Scheme: "http", Host: hostPort(u, "8086"), Path: "/health"}
+	if u.Scheme == "influxs" {
+		target.Scheme = "https"
+	}
+
+	var health struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+		Version string `json:"version"`
+	}
+	if errMsg := httpGetJSON(ctx, newHTTPClient(test), target.String(), &health); errMsg != "" {
+		return "FAIL", 0, errMsg
+	}
+	if health.Version != "" {
+		setDetail(test, "version", health.Version)
+	}
+	if health.Status != "pass" {
+		return "FAIL", time.Since(start), fmt.Sprintf("Health status %q: %s", health.Status, health.Message)
+	}
+
+	return "OK", time.Since(start), ""
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckInflux(t *testing.T) {
+	tests := []struct {
+		code   int
+		body   string
+		status string
+	}{
+		{200, `{"name":"influxdb","message":"ready for queries and writes","status":"pass","version":"v2.7.5"}`, "OK"},
+		{503, `{"name":"influxdb","message":"not ready","status":"fail","version":"v2.7.5"}`, "FAIL"},
+		{200, `<html>proxy error</html>`, "FAIL"},
+	}
+
+	for _, tt := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/health" {
+				http.NotFound(w, r)
+				return
+			}
+			w.WriteHeader(tt.code)
+			w.Write([]byte(tt.body))
+		}))
+
+		test := &ConnectionTest{URL: strings.Replace(srv.URL, "http://", "influx://", 1)}
+		status, _, errMsg := checkInflux(context.Background(), test)
+		if status != tt.status {
+			t.Errorf("checkInflux(%s) = %s (%s), want %s", tt.body, status, errMsg, tt.status)
+		}
+		if status == "OK" && test.Details["version"] != "v2.7.5" {
+			t.Errorf("version = %q, want v2.7.5", test.Details["version"])
+		}
+		srv.Close()
+	}
+}
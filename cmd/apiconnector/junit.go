@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// junitSuites is the root of a JUnit XML report, in the dialect Jenkins,
+// GitLab and Buildkite read.
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Errors   int          `xml:"errors,attr"`
+	Time     string       `xml:"time,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	Errors    int         `xml:"errors,attr"`
+	Time      string      `xml:"time,attr"`
+	Timestamp string      `xml:"timestamp,attr"`
+	Cases     []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitProblem `xml:"failure,omitempty"`
+	Error     *junitProblem `xml:"error,omitempty"`
+	SystemOut *junitText    `xml:"system-out,omitempty"`
+}
+
+type junitText struct {
+	Text string `xml:",cdata"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnit writes r as a JUnit XML report with one test case per
+// service, classed by URL scheme. Failed checks are failures and invalid
+// target definitions errors, with the message as CI shows it; the status,
+// URL and details go to the case's system-out.
+func writeJUnit(w io.Writer, r *report) error {
+	elapsed := junitSeconds(r.Finished.Sub(r.Started))
+	suite := junitSuite{Name: "apiconnector", Tests: len(r.Results), Time: elapsed, Timestamp: r.Started.UTC().Format(time.RFC3339)}
+	for _, res := range r.Results {
+		c := junitCase{Name: res.Service, ClassName: "apiconnector", Time: junitSeconds(res.Finished.Sub(res.Started))}
+		if u, err := url.Parse(res.URL); err == nil && u.Scheme != "" {
+			c.ClassName += "." + strings.ToLower(u.Scheme)
+		}
+		switch res.Status {
+		case "FAIL":
+			suite.Failures++
+			c.Failure = &junitProblem{Message: res.Error, Type: res.Status, Text: res.Error}
+		case "ERROR":
+			suite.Errors++
+			c.Error = &junitProblem{Message: res.Error, Type: res.Status, Text: res.Error}
+		}
+		c.SystemOut = &junitText{junitOutput(res)}
+		suite.Cases = append(suite.Cases, c)
+	}
+	suites := junitSuites{Name: "apiconnector", Tests: suite.Tests, Failures: suite.Failures, Errors: suite.Errors, Time: elapsed, Suites: []junitSuite{suite}}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// junitOutput renders a result's status, URL, latency and details, one per
+// line, for a test case's system-out.
+func junitOutput(res result) string {
+	lines := []string{
+		"status=" + res.Status,
+		"url=" + res.URL,
+		fmt.Sprintf("latency=%s", formatDuration(time.Duration(res.LatencyMS*float64(time.Millisecond)))),
+	}
+	return strings.Join(append(lines, sortedDetails(res.Details)...), "\n")
+}
+
+// junitSeconds formats d as JUnit's fractional seconds.
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kafka API keys used by the broker check.
+const (
+	kafkaProduceKey     = 0
+	kafkaFetchKey       = 1
+	kafkaMetadataKey    = 3
+	kafkaApiVersionsKey = 18
+)
+
+// kafkaVersionDetails names the details reporting the version range a
+// broker supports for the key APIs clients depend on.
+var kafkaVersionDetails = map[int16]string{
+	kafkaProduceKey:  "produce",
+	kafkaFetchKey:    "fetch",
+	kafkaMetadataKey: "metadata",
+}
+
+// Kafka error code returned for a missing topic.
+const kafkaUnknownTopic = 3
+
+// checkKafka sends ApiVersions and Metadata requests to a broker, reporting
+// the broker id, cluster size, number of supported APIs and the versions of
+// Produce, Fetch and Metadata it supports ("produce", "fetch" and
+// "metadata", e.g. "v0-v9"). A URL path
+// (kafka://broker:9092/orders) additionally requires that topic to exist.
+func checkKafka(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	start := time.Now()
+
+	u, err := url.Parse(test.URL)
+	if err != nil || u.Hostname() == "" {
+		return "ERROR", 0, "Invalid URL"
+	}
+	topic := strings.TrimPrefix(u.Path, "/")
+
+	conn, err := dial(ctx, test, "tcp", hostPort(u, "9092"))
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("Connect error: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(testTimeout(test)))
+
+	resp, err := kafkaRequest(conn, kafkaApiVersionsKey, 0, 1, nil)
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("ApiVersions error: %v", err)
+	}
+	if code := resp.int16(); code != 0 {
+		return "FAIL", time.Since(start), fmt.Sprintf("ApiVersions error code %d", code)
+	}
+	metadataVersion := int16(0)
+	apis := resp.int32()
+	for i := int32(0); i < apis && resp.err == nil; i++ {
+		key, min, max := resp.int16(), resp.int16(), resp.int16()
+		if key == kafkaMetadataKey {
+			metadataVersion = max
+		}
+		if name, ok := kafkaVersionDetails[key]; ok && resp.err == nil {
+			setDetail(test, name, fmt.Sprintf("v%d-v%d", min, max))
+		}
+	}
+	if resp.err != nil {
+		return "FAIL", 0, fmt.Sprintf("Invalid ApiVersions response: %v", resp.err)
+	}
+	setDetail(test, "apis", strconv.Itoa(int(apis)))
+
+	// Metadata v4 lets us disable topic auto-creation; v1 is the fallback
+	// for brokers older than 1.0.
+	version := int16(1)
+	if metadataVersion >= 4 {
+		version = 4
+	}
+	var body []byte
+	if topic == "" {
+		body = binary.BigEndian.AppendUint32(body, 0)
+	} else {
+		body = binary.BigEndian.AppendUint32(body, 1)
+		body = kafkaAppendString(body, topic)
+	}
+	if version >= 4 {
+		body = append(body, 0) // allow_auto_topic_creation = false
+	}
+
+	resp, err = kafkaRequest(conn, kafkaMetadataKey, version, 2, body)
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("Metadata error: %v", err)
+	}
+	latency := time.Since(start)
+
+	if version >= 3 {
+		resp.int32() // throttle_time_ms
+	}
+	brokers := resp.int32()
+	for i := int32(0); i < brokers && resp.err == nil; i++ {
+		id, host, port := resp.int32(), resp.string(), resp.int32()
+		resp.string() // rack
+		if kafkaSameBroker(u, host, port) || brokers == 1 {
+			setDetail(test, "broker_id", strconv.Itoa(int(id)))
+		}
+	}
+	if version >= 2 {
+		resp.string() // cluster_id
+	}
+	setDetail(test, "controller", strconv.Itoa(int(resp.int32())))
+	setDetail(test, "brokers", strconv.Itoa(int(brokers)))
+
+	if topic != "" {
+		topics := resp.int32()
+		for i := int32(0); i < topics && resp.err == nil; i++ {
+			code, name := resp.int16(), resp.string()
+			if name != topic {
+				break
+			}
+			switch code {
+			case 0:
+				return "OK", latency, ""
+			case kafkaUnknownTopic:
+				return "FAIL", latency, fmt.Sprintf("Topic %s does not exist", topic)
+			default:
+				return "FAIL", latency, fmt.Sprintf("Topic %s error code %d", topic, code)
+			}
+		}
+		if resp.err != nil {
+			return "FAIL", 0, fmt.Sprintf("Invalid Metadata response: %v", resp.err)
+		}
+		return "FAIL", latency, fmt.Sprintf("Topic %s missing from metadata", topic)
+	}
+
+	if resp.err != nil {
+		return "FAIL", 0, fmt.Sprintf("Invalid Metadata response: %v", resp.err)
+	}
+	return "OK", latency, ""
+}
+
+// kafkaSameBroker reports whether an advertised broker address is the one
+// named in u.
+func kafkaSameBroker(u *url.URL, host string, port int32) bool {
+	return strings.EqualFold(host, u.Hostname()) && strconv.Itoa(int(port)) == u.Port()
+}
+
+// kafkaRequest sends a request with a v1 header and returns a reader
+// positioned after the response correlation id.
+func kafkaRequest(conn net.Conn, apiKey, apiVersion int16, correlationID int32, body []byte) (*kafkaReader, error) {
+	var msg []byte
+	msg = binary.BigEndian.AppendUint32(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, uint16(apiKey))
+	msg = binary.BigEndian.AppendUint16(msg, uint16(apiVersion))
+	msg = binary.BigEndian.AppendUint32(msg, uint32(correlationID))
+	msg = kafkaAppendString(msg, "apiconnector")
+	msg = append(msg, body...)
+	binary.BigEndian.PutUint32(msg, uint32(len(msg)-4))
+	if _, err := conn.Write(msg); err != nil {
+		return nil, err
+	}
+
+	var size [4]byte
+	if _, err := io.ReadFull(conn, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n < 4 || n > 64<<20 {
+		return nil, fmt.Errorf("invalid response size %d", n)
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(conn, payload); err != nil {
+		return nil, err
+	}
+	r := &kafkaReader{b: payload}
+	if id := r.int32(); id != correlationID {
+		return nil, fmt.Errorf("correlation id %d, expected %d", id, correlationID)
+	}
+	return r, nil
+}
+
+func kafkaAppendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// kafkaReader decodes big-endian protocol primitives, recording the first
+// short read in err.
+type kafkaReader struct {
+	b   []byte
+	err error
+}
+
+func (r *kafkaReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || len(r.b) < n {
+		r.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	p := r.b[:n]
+	r.b = r.b[n:]
+	return p
+}
+
+func (r *kafkaReader) int16() int16 {
+	if p := r.next(2); p != nil {
+		return int16(binary.BigEndian.Uint16(p))
+	}
+	return 0
+}
+
+func (r *kafkaReader) int32() int32 {
+	if p := r.next(4); p != nil {
+		return int32(binary.BigEndian.Uint32(p))
+	}
+	return 0
+}
+
+// string reads a nullable string; null is returned as "".
+func (r *kafkaReader) string() string {
+	n := r.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(r.next(int(n)))
+}
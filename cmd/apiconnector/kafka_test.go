@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+)
+
+// fakeKafka answers ApiVersions v0 and Metadata v4 for a single broker
+// that hosts the "orders" topic.
+func fakeKafka(t *testing.T) func(conn net.Conn) {
+	return func(conn net.Conn) {
+		_, portStr, _ := net.SplitHostPort(conn.LocalAddr().String())
+		port, _ := strconv.Atoi(portStr)
+		for {
+			var size [4]byte
+			if _, err := io.ReadFull(conn, size[:]); err != nil {
+				return
+			}
+			req := make([]byte, binary.BigEndian.Uint32(size[:]))
+			if _, err := io.ReadFull(conn, req); err != nil {
+				return
+			}
+			r := &kafkaReader{b: req}
+			key, _, correlationID := r.int16(), r.int16(), r.int32()
+			r.string()
+
+			resp := binary.BigEndian.AppendUint32(nil, uint32(correlationID))
+			switch key {
+			case kafkaApiVersionsKey:
+				resp = append(resp, 0, 0, 0, 0, 0, 3)
+				resp = append(resp, 0, kafkaProduceKey, 0, 3, 0, 9)
+				resp = append(resp, 0, kafkaMetadataKey, 0, 0, 0, 12)
+				resp = append(resp, 0, kafkaApiVersionsKey, 0, 0, 0, 3)
+			case kafkaMetadataKey:
+				r.int32()
+				topic := r.string()
+				resp = append(resp, 0, 0, 0, 0, 0, 0, 0, 1)
+				resp = binary.BigEndian.AppendUint32(resp, 7)
+				resp = kafkaAppendString(resp, "127.0.0.1")
+				resp = binary.BigEndian.AppendUint32(resp, uint32(port))
+				resp = append(resp, 0xFF, 0xFF, 0xFF, 0xFF) // null rack, null cluster id
+				resp = binary.BigEndian.AppendUint32(resp, 7)
+				resp = binary.BigEndian.AppendUint32(resp, 1)
+				if topic == "orders" {
+					resp = append(resp, 0, 0)
+				} else {
+					resp = append(resp, 0, kafkaUnknownTopic)
+				}
+				resp = kafkaAppendString(resp, topic)
+				resp = append(resp, 0, 0, 0, 0, 0)
+			default:
+				t.Errorf("unexpected API key %d", key)
+				return
+			}
+			conn.Write(append(binary.BigEndian.AppendUint32(nil, uint32(len(resp))), resp...))
+		}
+	}
+}
+
+func TestCheckKafka(t *testing.T) {
+	tests := []struct {
+		path   string
+		status string
+	}{
+		{"", "OK"},
+		{"/orders", "OK"},
+		{"/missing", "FAIL"},
+	}
+
+	for _, tt := range tests {
+		addr := serveOnce(t, fakeKafka(t))
+		test := &ConnectionTest{URL: "kafka://" + addr + tt.path}
+		status, _, errMsg := checkKafka(context.Background(), test)
+		if status != tt.status {
+			t.Errorf("checkKafka(%q) = %s (%s), want %s", test.URL, status, errMsg, tt.status)
+		}
+		if test.Details["broker_id"] != "7" || test.Details["apis"] != "3" {
+			t.Errorf("Details = %v, want broker_id=7 apis=3", test.Details)
+		}
+		if test.Details["produce"] != "v3-v9" || test.Details["metadata"] != "v0-v12" || test.Details["fetch"] != "" {
+			t.Errorf("Details = %v, want produce=v3-v9 metadata=v0-v12 and no fetch", test.Details)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+)
+
+// defaultKeepAliveRequests is the number of extra requests sent by a bare
+// "keepalive" option.
+const defaultKeepAliveRequests = 3
+
+// checkKeepAlive implements the "keepalive=N" option: after the check's own
+// request, it sends n more on the same client and traces
+// whether each reused the idle connection. The "connections" detail counts
+// the new connections those requests needed, and "keepalive" is "ok" when
+// there were none or "broken" otherwise, which makes the check a warning:
+// a load balancer that silently closes idle connections doubles latency.
+// It returns whether keep-alive is broken, or a failure message.
+func checkKeepAlive(client *http.Client, test *ConnectionTest, n int, newRequest func() (*http.Request, error)) (bool, string) {
+	newConns := 0
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if !info.Reused {
+				newConns++
+			}
+		},
+	}
+	for i := 0; i < n; i++ {
+		req, err := newRequest()
+		if err != nil {
+			return false, fmt.Sprintf("Request creation error: %v", err)
+		}
+		resp, err := client.Do(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+		if err != nil {
+			return false, fmt.Sprintf("Keep-alive request error: %v", err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	setDetail(test, "connections", strconv.Itoa(newConns))
+	if newConns > 0 {
+		setDetail(test, "keepalive", "broken")
+		return true, ""
+	}
+	setDetail(test, "keepalive", "ok")
+	return false, ""
+}
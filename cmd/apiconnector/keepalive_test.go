@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckHTTPKeepAlive(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/close" {
+			w.Header().Set("Connection", "close")
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		target      string
+		status      string
+		keepalive   string
+		connections string
+	}{
+		{"/ keepalive", "OK", "ok", "0"},
+		{"/ keepalive=5", "OK", "ok", "0"},
+		{"/close keepalive=4", "WARN", "broken", "4"},
+		{"/ keepalive=0", "ERROR", "", ""},
+	}
+	for _, tt := range tests {
+		test := parseTestConfig("lb=" + srv.URL + tt.target)
+		status, _, errMsg := checkHTTP(context.Background(), &test)
+		if status != tt.status || test.Details["keepalive"] != tt.keepalive || test.Details["connections"] != tt.connections {
+			t.Errorf("checkHTTP(%s) = %s (%s) %v, want %s keepalive=%s connections=%s", tt.target, status, errMsg, test.Details, tt.status, tt.keepalive, tt.connections)
+		}
+	}
+}
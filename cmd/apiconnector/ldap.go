@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// ldapResultNames names the LDAP result codes most often seen on bind.
+var ldapResultNames = map[int]string{
+	0:  "success",
+	7:  "authMethodNotSupported",
+	8:  "strongerAuthRequired",
+	13: "confidentialityRequired",
+	32: "noSuchObject",
+	34: "invalidDNSyntax",
+	48: "inappropriateAuthentication",
+	49: "invalidCredentials",
+	50: "insufficientAccessRights",
+	51: "busy",
+	52: "unavailable",
+	53: "unwillingToPerform",
+}
+
+// checkLDAP performs an LDAPv3 simple bind and reports the result code.
+// The bind DN comes from the "bind_dn" option or the URL username, and the
+// password from the URL or the LDAP_PASSWORD environment variable; with
+// neither the bind is anonymous. The ldaps scheme uses implicit TLS.
+func checkLDAP(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	start := time.Now()
+
+	u, err := url.Parse(test.URL)
+	if err != nil || u.Hostname() == "" {
+		return "ERROR", 0, "Invalid URL"
+	}
+
+	bindDN := test.Options["bind_dn"]
+	if bindDN == "" {
+		bindDN = u.User.Username()
+	}
+	password, ok := u.User.Password()
+	if !ok && bindDN != "" {
+		password = os.Getenv("LDAP_PASSWORD")
+	}
+
+	defaultPort := "389"
+	if u.Scheme == "ldaps" {
+		defaultPort = "636"
+	}
+	conn, err := dial(ctx, test, "tcp", hostPort(u, defaultPort))
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("Connect error: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(testTimeout(test)))
+
+	if u.Scheme == "ldaps" {
+		conn, err = tlsClient(ctx, test, conn, u.Hostname())
+		if err != nil {
+			return "FAIL", 0, fmt.Sprintf("TLS handshake error: %v", err)
+		}
+	}
+
+	bind := berTLV(0x60, berConcat(
+		berTLV(0x02, []byte{3}),
+		berTLV(0x04, []byte(bindDN)),
+		berTLV(0x80, []byte(password)),
+	))
+	if _, err := conn.Write(berTLV(0x30, berConcat(berTLV(0x02, []byte{1}), bind))); err != nil {
+		return "FAIL", 0, fmt.Sprintf("Bind write error: %v", err)
+	}
+
+	br := bufio.NewReader(conn)
+	tag, msg, err := berRead(br)
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("Bind response read error: %v", err)
+	}
+	latency := time.Since(start)
+	if tag != 0x30 {
+		return "FAIL", latency, fmt.Sprintf("Unexpected response tag 0x%02x", tag)
+	}
+	fields, err := berElements(msg)
+	if err != nil || len(fields) < 2 || fields[1].tag != 0x61 {
+		return "FAIL", latency, "Malformed bind response"
+	}
+	result, err := berElements(fields[1].value)
+	if err != nil || len(result) < 3 || result[0].tag != 0x0A {
+		return "FAIL", latency, "Malformed bind response"
+	}
+	code := 0
+	for _, b := range result[0].value {
+		code = code<<8 | int(b)
+	}
+	name := ldapResultNames[code]
+	if name == "" {
+		name = "code " + strconv.Itoa(code)
+	}
+	setDetail(test, "result", name)
+
+	// UnbindRequest
+	conn.Write(berTLV(0x30, berConcat(berTLV(0x02, []byte{2}), berTLV(0x42, nil))))
+
+	if code != 0 {
+		msg := fmt.Sprintf("Bind failed: %d %s", code, name)
+		if diag := string(result[2].value); diag != "" {
+			msg += ": " + diag
+		}
+		return "FAIL", latency, msg
+	}
+	if bindDN == "" {
+		setDetail(test, "bind", "anonymous")
+	}
+
+	return "OK", latency, ""
+}
+
+// berElement is a decoded BER tag-length-value.
+type berElement struct {
+	tag   byte
+	value []byte
+}
+
+// berTLV encodes a single BER element with a definite length.
+func berTLV(tag byte, value []byte) []byte {
+	b := []byte{tag}
+	switch n := len(value); {
+	case n < 0x80:
+		b = append(b, byte(n))
+	case n <= 0xFF:
+		b = append(b, 0x81, byte(n))
+	case n <= 0xFFFF:
+		b = append(b, 0x82, byte(n>>8), byte(n))
+	default:
+		b = append(b, 0x83, byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(b, value...)
+}
+
+func berConcat(parts ...[]byte) []byte {
+	var b []byte
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+	return b
+}
+
+// berRead reads one element from r.
+func berRead(r *bufio.Reader) (byte, []byte, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length := int(first)
+	if first&0x80 != 0 {
+		n := int(first & 0x7F)
+		if n == 0 || n > 3 {
+			return 0, nil, fmt.Errorf("unsupported length encoding")
+		}
+		length = 0
+		for i := 0; i < n; i++ {
+			b, err := r.ReadByte()
+			if err != nil {
+				return 0, nil, err
+			}
+			length = length<<8 | int(b)
+		}
+	}
+	value := make([]byte, length)
+	if _, err := io.ReadFull(r, value); err != nil {
+		return 0, nil, err
+	}
+	return tag, value, nil
+}
+
+// berElements splits constructed content into its child elements.
+func berElements(b []byte) ([]berElement, error) {
+	var out []berElement
+	for len(b) > 0 {
+		if len(b) < 2 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		tag, length, hdr := b[0], int(b[1]), 2
+		if b[1]&0x80 != 0 {
+			n := int(b[1] & 0x7F)
+			if n == 0 || n > 3 || len(b) < 2+n {
+				return nil, fmt.Errorf("unsupported length encoding")
+			}
+			length = 0
+			for _, c := range b[2 : 2+n] {
+				length = length<<8 | int(c)
+			}
+			hdr += n
+		}
+		if len(b) < hdr+length {
+			return nil, io.ErrUnexpectedEOF
+		}
+		out = append(out, berElement{tag: tag, value: b[hdr : hdr+length]})
+		b = b[hdr+length:]
+	}
+	return out, nil
+}
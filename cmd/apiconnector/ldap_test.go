@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"testing"
+)
+
+// fakeLDAP accepts anonymous binds and cn=admin with password "secret".
+func fakeLDAP(conn net.Conn) {
+	_, msg, err := berRead(bufio.NewReader(conn))
+	if err != nil {
+		return
+	}
+	fields, _ := berElements(msg)
+	bind, _ := berElements(fields[1].value)
+	dn, password := string(bind[1].value), string(bind[2].value)
+
+	code, diag := byte(0), ""
+	if dn != "" && (dn != "cn=admin,dc=example,dc=org" || password != "secret") {
+		code, diag = 49, "80090308: LdapErr: DSID-0C09044E"
+	}
+	resp := berTLV(0x61, berConcat(berTLV(0x0A, []byte{code}), berTLV(0x04, nil), berTLV(0x04, []byte(diag))))
+	conn.Write(berTLV(0x30, berConcat(berTLV(0x02, []byte{1}), resp)))
+}
+
+func TestCheckLDAP(t *testing.T) {
+	tests := []struct {
+		userinfo string
+		options  string
+		status   string
+		result   string
+	}{
+		{"", "", "OK", "success"},
+		{":secret@", " bind_dn=cn=admin,dc=example,dc=org", "OK", "success"},
+		{"cn=admin%2Cdc=example%2Cdc=org:secret@", "", "OK", "success"},
+		{":wrong@", " bind_dn=cn=admin,dc=example,dc=org", "FAIL", "invalidCredentials"},
+	}
+
+	for _, tt := range tests {
+		addr := serveOnce(t, fakeLDAP)
+		test := parseTestConfig("ldap=ldap://" + tt.userinfo + addr + tt.options)
+		status, _, errMsg := checkLDAP(context.Background(), &test)
+		if status != tt.status || test.Details["result"] != tt.result {
+			t.Errorf("checkLDAP(%q%s) = %s (%s) %v, want %s %s", test.URL, tt.options, status, errMsg, test.Details, tt.status, tt.result)
+		}
+	}
+}
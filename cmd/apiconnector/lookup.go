@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+	netproxy "golang.org/x/net/proxy"
+)
+
+var (
+	dnsServerFlag = flag.String("dns-server", "", "resolve target names with the DNS server at `host[:port]` instead of those in /etc/resolv.conf")
+	ptrFlag       = flag.Bool("ptr", false, "look up the reverse DNS name of the address each target connected to")
+)
+
+// dnsTrace counts the queries a lookup sends and remembers the server the
+// last one went to, which is the one that answered when the lookup
+// succeeds.
+type dnsTrace struct {
+	mu       sync.Mutex
+	attempts int
+	server   string
+}
+
+// lookupHost resolves host for a connection over network, with the Go
+// resolver so the queries it sends can be traced. It records the "dns"
+// detail with the lookup time, "dns_server" with the resolver that answered
+// ("hosts" for an /etc/hosts entry) and "dns_attempts" with the number of
+// queries sent, A and AAAA counting separately, and at -v "resolved" with
+// the addresses found. Queries go to the resolver named by dnsResolver, if
+// any, instead of those in /etc/resolv.conf. With the "cname" option the
+// answering resolver is asked once more to report the CNAME chain (see
+// traceCNAME).
+func lookupHost(ctx context.Context, test *ConnectionTest, network, host string) ([]net.IP, error) {
+	trace := &dnsTrace{}
+	resolver := newResolver(test, trace)
+	start := time.Now()
+	ips, err := resolver.LookupIP(ctx, ipNetwork(network), host)
+	setDetail(test, "dns", formatDuration(time.Since(start)))
+	if err == nil && verbose > 0 {
+		addrs := make([]string, len(ips))
+		for i, ip := range ips {
+			addrs[i] = ip.String()
+		}
+		setDetail(test, "resolved", strings.Join(addrs, ","))
+	}
+	trace.mu.Lock()
+	defer trace.mu.Unlock()
+	setDetail(test, "dns_attempts", fmt.Sprint(trace.attempts))
+	if trace.server != "" {
+		setDetail(test, "dns_server", trace.server)
+	} else if err == nil {
+		setDetail(test, "dns_server", "hosts")
+	}
+
+	if v := test.Options["cname"]; v != "" && v != "false" && trace.server != "" {
+		qtype := dnsmessage.TypeA
+		if ipNetwork(network) == "ip6" {
+			qtype = dnsmessage.TypeAAAA
+		}
+		dangling, cnameErr := traceCNAME(ctx, test, trace.server, host, qtype)
+		switch {
+		case cnameErr != nil:
+			setDetail(test, "cname_error", cnameErr.Error())
+		case dangling != "":
+			setDetail(test, "cname_dangling", dangling)
+			if err != nil {
+				err = fmt.Errorf("lookup %s: dangling CNAME to %s", host, dangling)
+			}
+		}
+	}
+	return ips, err
+}
+
+// newResolver returns a Go resolver that sends test's queries to the
+// resolver named by dnsResolver, if any, counting them in trace.
+func newResolver(test *ConnectionTest, trace *dnsTrace) *net.Resolver {
+	_, server := dnsResolver(test)
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			if server != "" {
+				address = server
+			}
+			trace.mu.Lock()
+			trace.attempts++
+			trace.server = address
+			trace.mu.Unlock()
+			return dialDNS(ctx, test, network, address)
+		},
+	}
+}
+
+// dialDNS connects to the DNS server at address for test, over DoH or DoT
+// when dnsResolver names such a server, and otherwise over network.
+func dialDNS(ctx context.Context, test *ConnectionTest, network, address string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: testConnectTimeout(test)}
+	switch kind, server := dnsResolver(test); kind {
+	case "doh":
+		return dialDoH(test, server)
+	case "dot":
+		return dialDoT(ctx, test, dialer, server)
+	}
+	return dialer.DialContext(ctx, network, address)
+}
+
+// dnsResolver returns how test's names are resolved: "dns" with a DNS
+// server (port 53 when none is given), "doh" with a DNS-over-HTTPS URL or
+// "dot" with a DNS-over-TLS server (port 853 by default), from the
+// "dns_server", "doh" or "dot" option, or else the matching flag. It
+// returns "" for the system resolvers, which "system" selects over a flag
+// default.
+func dnsResolver(test *ConnectionTest) (string, string) {
+	resolvers := []struct {
+		kind, option string
+		flag         *string
+	}{
+		{"dns", "dns_server", dnsServerFlag},
+		{"doh", "doh", dohFlag},
+		{"dot", "dot", dotFlag},
+	}
+	kind, server := "", ""
+	for _, r := range resolvers {
+		if v := test.Options[r.option]; v != "" {
+			kind, server = r.kind, v
+			break
+		}
+	}
+	for _, r := range resolvers {
+		if v := *r.flag; server == "" && v != "" {
+			kind, server = r.kind, v
+		}
+	}
+	if server == "" || server == "system" {
+		return "", ""
+	}
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		switch kind {
+		case "dns":
+			server = net.JoinHostPort(strings.Trim(server, "[]"), "53")
+		case "dot":
+			server = net.JoinHostPort(strings.Trim(server, "[]"), "853")
+		}
+	}
+	return kind, server
+}
+
+// reversePTR reports whether test's connected address is looked up in
+// reverse DNS, by the "ptr" option or the -ptr flag.
+func reversePTR(test *ConnectionTest) bool {
+	if v := test.Options["ptr"]; v != "" {
+		return boolOption(test, "ptr")
+	}
+	return *ptrFlag
+}
+
+// lookupPTR records the address test connected to as the "ip" detail and
+// its reverse DNS name as "ptr", "none" when it has none, which helps tell
+// which CDN PoP or backend answered. The lookup uses test's resolver and is
+// bounded by the connect timeout; its failure is not the check's.
+func lookupPTR(ctx context.Context, test *ConnectionTest, addr net.Addr) {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return
+	}
+	setDetail(test, "ip", host)
+	ctx, cancel := context.WithTimeout(ctx, testConnectTimeout(test))
+	defer cancel()
+	names, err := newResolver(test, &dnsTrace{}).LookupAddr(ctx, host)
+	if err != nil || len(names) == 0 {
+		setDetail(test, "ptr", "none")
+		return
+	}
+	setDetail(test, "ptr", strings.TrimSuffix(names[0], "."))
+}
+
+// ipNetwork maps a dial network to the address family to look up: "ip4"
+// for "tcp4" or "udp4", "ip6" for "tcp6" or "udp6", otherwise "ip".
+func ipNetwork(network string) string {
+	switch {
+	case strings.HasSuffix(network, "4"):
+		return "ip4"
+	case strings.HasSuffix(network, "6"):
+		return "ip6"
+	}
+	return "ip"
+}
+
+// dialResolved dials addr after resolving its host with lookupHost, trying
+// each address in turn with an even share of the remaining connect timeout,
+// as net.Dialer does. IP addresses are dialed directly.
+func dialResolved(ctx context.Context, test *ConnectionTest, dialer netproxy.ContextDialer, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return dialer.DialContext(ctx, network, addr)
+	}
+	ips, err := lookupHost(ctx, test, network, host)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, testConnectTimeout(test))
+	defer cancel()
+	var firstErr error
+	for i, ip := range ips {
+		attemptCtx := ctx
+		if deadline, ok := ctx.Deadline(); ok && i < len(ips)-1 {
+			var attemptCancel context.CancelFunc
+			attemptCtx, attemptCancel = context.WithTimeout(ctx, time.Until(deadline)/time.Duration(len(ips)-i))
+			defer attemptCancel()
+		}
+		conn, err := dialer.DialContext(attemptCtx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr == nil {
+		firstErr = fmt.Errorf("no addresses for %s", host)
+	}
+	return nil, firstErr
+}
+
+// connectAddresses runs retryConnect for test, or with the "all_ips" option
+// once against each address its host name resolves to (over its address
+// family), so that one dead backend behind round-robin DNS is not hidden by
+// the others. Each address's result is reported in the "addresses" detail,
+// e.g. "10.0.0.1=OK[12ms],10.0.0.2=FAIL"; any failed address fails the
+// check, and the latency is that of the slowest.
+func connectAddresses(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	host := targetHost(test)
+	if !boolOption(test, "all_ips") || host == "" || net.ParseIP(host) != nil || test.Options["resolve"] != "" {
+		return retryConnect(ctx, test)
+	}
+	ips, err := lookupHost(ctx, test, familyNetwork(test, "tcp"), host)
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("DNS error: %v", err)
+	}
+
+	status, latency := "OK", time.Duration(0)
+	var details map[string]string
+	var results, errs []string
+	for _, ip := range ips {
+		run := cloneTest(test, "resolve", ip.String())
+		s, l, errMsg := retryConnect(ctx, &run)
+		test.Samples = append(test.Samples, run.Samples...)
+		test.Trace = append(test.Trace, run.Trace...)
+		if errMsg != "" {
+			results = append(results, fmt.Sprintf("%s=%s", ip, s))
+			errs = append(errs, fmt.Sprintf("%s: %s", ip, errMsg))
+			continue
+		}
+		results = append(results, fmt.Sprintf("%s=%s[%s]", ip, s, formatDuration(l)))
+		if s == "WARN" {
+			status = s
+		}
+		if l > latency {
+			latency = l
+		}
+		if details == nil {
+			details, test.Certs, test.ChainIssue = run.Details, run.Certs, run.ChainIssue
+		}
+	}
+
+	for k, v := range test.Details {
+		if details == nil {
+			details = map[string]string{}
+		}
+		details[k] = v
+	}
+	delete(details, "resolve")
+	test.Details = details
+	setDetail(test, "addresses", strings.Join(results, ","))
+	if len(errs) > 0 {
+		return "FAIL", latency, fmt.Sprintf("%d of %d addresses failed: %s", len(errs), len(ips), strings.Join(errs, "; "))
+	}
+	return status, latency, ""
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestLookupTiming(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	port := srv.URL[strings.LastIndex(srv.URL, ":")+1:]
+	dnsServer := serveDNSRecords(t, map[string][]net.IP{"api.test.": {net.ParseIP("127.0.0.1")}})
+
+	test := parseTestConfig("api=http://api.test:" + port + " dns_server=" + dnsServer)
+	if status, _, errMsg := checkHTTP(context.Background(), &test); status != "OK" {
+		t.Fatalf("checkHTTP = %s (%s), want OK", status, errMsg)
+	}
+	if test.Details["dns"] == "" || test.Details["dns_server"] != dnsServer || test.Details["dns_attempts"] == "0" {
+		t.Errorf("details = %v, want dns time answered by %s", test.Details, dnsServer)
+	}
+
+	// Addresses need no lookup.
+	test = parseTestConfig("api=" + srv.URL)
+	checkHTTP(context.Background(), &test)
+	if _, ok := test.Details["dns"]; ok {
+		t.Errorf("details for IP target = %v, want no dns", test.Details)
+	}
+}
+
+func TestLookupDNSServer(t *testing.T) {
+	server := serveDNSUDP(t)
+
+	test := parseTestConfig("api=https://example.com dns_server=" + server)
+	ips, err := lookupHost(context.Background(), &test, "tcp", "example.com")
+	if err != nil || len(ips) != 1 || ips[0].String() != "93.184.216.34" {
+		t.Fatalf("lookupHost via %s = %v, %v, want 93.184.216.34", server, ips, err)
+	}
+	if test.Details["dns_server"] != server || test.Details["dns_attempts"] != "2" {
+		t.Errorf("details = %v, want dns_server=%s dns_attempts=2", test.Details, server)
+	}
+
+	*dnsServerFlag = "10.0.0.2"
+	defer func() { *dnsServerFlag = "" }()
+	for _, tt := range []struct{ option, kind, server string }{
+		{"", "dns", "10.0.0.2:53"},
+		{" dns_server=[2001:db8::53]", "dns", "[2001:db8::53]:53"},
+		{" dns_server=10.0.0.3:5353", "dns", "10.0.0.3:5353"},
+		{" dns_server=system", "", ""},
+		{" doh=https://dns.test/dns-query", "doh", "https://dns.test/dns-query"},
+		{" dot=dns.test", "dot", "dns.test:853"},
+	} {
+		test := parseTestConfig("api=https://example.com" + tt.option)
+		if kind, server := dnsResolver(&test); kind != tt.kind || server != tt.server {
+			t.Errorf("dnsResolver(%q) = %q %q, want %q %q", tt.option, kind, server, tt.kind, tt.server)
+		}
+	}
+}
+
+func TestLookupDoH(t *testing.T) {
+	var contentType string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		query, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(dnsReply(t, query))
+	}))
+	defer srv.Close()
+	tlsRootCAs = x509.NewCertPool()
+	tlsRootCAs.AddCert(srv.Certificate())
+	defer func() { tlsRootCAs = nil }()
+
+	test := parseTestConfig("api=https://example.com doh=" + srv.URL + "/dns-query")
+	ips, err := lookupHost(context.Background(), &test, "tcp4", "example.com")
+	if err != nil || len(ips) != 1 || ips[0].String() != "93.184.216.34" {
+		t.Fatalf("lookupHost via DoH = %v, %v, want 93.184.216.34", ips, err)
+	}
+	if contentType != "application/dns-message" || test.Details["dns_server"] != srv.URL+"/dns-query" || test.Details["dns_attempts"] != "1" {
+		t.Errorf("details = %v, content type %q, want DoH server in 1 attempt", test.Details, contentType)
+	}
+
+	// The endpoint's certificate must verify.
+	tlsRootCAs = x509.NewCertPool()
+	test = parseTestConfig("api=https://example.com doh=" + srv.URL + "/dns-query")
+	if _, err := lookupHost(context.Background(), &test, "tcp4", "example.com"); err == nil {
+		t.Error("lookupHost via untrusted DoH endpoint succeeded")
+	}
+}
+
+func TestLookupDoT(t *testing.T) {
+	root, rootKey := issueCert(t, "Test Root", true, nil, nil)
+	leaf, leafKey := issueCert(t, "dns.test", false, root, rootKey)
+	lis, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{leaf.Raw}, PrivateKey: leafKey}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				var length [2]byte
+				for {
+					if _, err := io.ReadFull(conn, length[:]); err != nil {
+						return
+					}
+					query := make([]byte, binary.BigEndian.Uint16(length[:]))
+					if _, err := io.ReadFull(conn, query); err != nil {
+						return
+					}
+					reply := dnsReply(t, query)
+					conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(reply))), reply...))
+				}
+			}()
+		}
+	}()
+	tlsRootCAs = x509.NewCertPool()
+	tlsRootCAs.AddCert(root)
+	defer func() { tlsRootCAs = nil }()
+
+	test := parseTestConfig("api=https://example.com dot=" + lis.Addr().String())
+	ips, err := lookupHost(context.Background(), &test, "tcp4", "example.com")
+	if err != nil || len(ips) != 1 || ips[0].String() != "93.184.216.34" {
+		t.Fatalf("lookupHost via DoT = %v, %v, want 93.184.216.34", ips, err)
+	}
+	if test.Details["dns_server"] != lis.Addr().String() {
+		t.Errorf("details = %v, want dns_server=%s", test.Details, lis.Addr())
+	}
+
+	// The resolver's certificate must be valid for the name it is reached by.
+	_, port, _ := net.SplitHostPort(lis.Addr().String())
+	test = parseTestConfig("api=https://example.com dot=localhost:" + port)
+	if _, err := lookupHost(context.Background(), &test, "tcp4", "example.com"); err == nil {
+		t.Error("lookupHost via DoT server with mismatched certificate succeeded")
+	}
+}
+
+// serveDNSRecords answers A and AAAA queries over UDP from records, keyed
+// by fully qualified name, until the test finishes.
+func serveDNSRecords(t *testing.T, records map[string][]net.IP) string {
+	return serveDNS(t, func(b *dnsmessage.Builder, q dnsmessage.Question) {
+		rh := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 60}
+		for _, ip := range records[q.Name.String()] {
+			if ip4 := ip.To4(); ip4 != nil && q.Type == dnsmessage.TypeA {
+				b.AResource(rh, dnsmessage.AResource{A: [4]byte(ip4)})
+			} else if ip4 == nil && q.Type == dnsmessage.TypeAAAA {
+				b.AAAAResource(rh, dnsmessage.AAAAResource{AAAA: [16]byte(ip)})
+			}
+		}
+	})
+}
+
+// serveDNS answers UDP queries with the records answer adds until the test
+// finishes.
+func serveDNS(t *testing.T, answer func(b *dnsmessage.Builder, q dnsmessage.Question)) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var q dnsmessage.Message
+			if err := q.Unpack(buf[:n]); err != nil {
+				continue
+			}
+			question := q.Questions[0]
+			b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: q.Header.ID, Response: true, RecursionAvailable: true})
+			b.StartQuestions()
+			b.Question(question)
+			b.StartAnswers()
+			answer(&b, question)
+			reply, _ := b.Finish()
+			pc.WriteTo(reply, addr)
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+func TestAllIPs(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	port := srv.URL[strings.LastIndex(srv.URL, ":")+1:]
+	server := serveDNSRecords(t, map[string][]net.IP{
+		"one.test.": {net.ParseIP("127.0.0.1")},
+		"rr.test.":  {net.ParseIP("127.0.0.1"), net.ParseIP("127.0.0.2")},
+	})
+
+	test := parseTestConfig("api=http://one.test:" + port + " all_ips dns_server=" + server)
+	if status, _, errMsg := connectAddresses(context.Background(), &test); status != "OK" || !strings.HasPrefix(test.Details["addresses"], "127.0.0.1=OK[") || test.Details["dns_server"] != server {
+		t.Errorf("all_ips with one address = %s (%s) %v, want OK", status, errMsg, test.Details)
+	}
+	if _, ok := test.Details["resolve"]; ok {
+		t.Errorf("all_ips details = %v, want no resolve", test.Details)
+	}
+
+	// Only 127.0.0.1 is listening, so the second backend is dead.
+	test = parseTestConfig("api=http://rr.test:" + port + " all_ips dns_server=" + server)
+	status, _, errMsg := connectAddresses(context.Background(), &test)
+	if status != "FAIL" || !strings.HasPrefix(errMsg, "1 of 2 addresses failed: 127.0.0.2: ") || !strings.Contains(test.Details["addresses"], "127.0.0.2=FAIL") {
+		t.Errorf("all_ips with a dead address = %s (%s) %v, want FAIL naming 127.0.0.2", status, errMsg, test.Details)
+	}
+
+	test = parseTestConfig("api=http://rr.test:" + port + " resolve=127.0.0.1")
+	if status, _, errMsg := checkHTTP(context.Background(), &test); status != "OK" || test.Details["resolve"] != "127.0.0.1" {
+		t.Errorf("resolve=127.0.0.1 = %s (%s) %v, want OK", status, errMsg, test.Details)
+	}
+}
+
+func TestLookupPTR(t *testing.T) {
+	// 127.0.0.2 rather than 127.0.0.1, which /etc/hosts may name before
+	// any query is sent.
+	ln, err := net.Listen("tcp", "127.0.0.2:0")
+	if err != nil {
+		t.Skipf("no 127.0.0.2 loopback address: %v", err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.Listener.Close()
+	srv.Listener = ln
+	srv.Start()
+	defer srv.Close()
+	named := serveDNS(t, func(b *dnsmessage.Builder, q dnsmessage.Question) {
+		if q.Type == dnsmessage.TypePTR && q.Name.String() == "2.0.0.127.in-addr.arpa." {
+			b.PTRResource(dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 60}, dnsmessage.PTRResource{PTR: dnsmessage.MustNewName("edge-1.cdn.test.")})
+		}
+	})
+	unnamed := serveDNS(t, func(*dnsmessage.Builder, dnsmessage.Question) {})
+
+	test := parseTestConfig("api=" + srv.URL + " ptr dns_server=" + named)
+	if status, _, errMsg := checkHTTP(context.Background(), &test); status != "OK" || test.Details["ip"] != "127.0.0.2" || test.Details["ptr"] != "edge-1.cdn.test" {
+		t.Errorf("checkHTTP with ptr = %s (%s) %v, want ip=127.0.0.2 ptr=edge-1.cdn.test", status, errMsg, test.Details)
+	}
+	test = parseTestConfig("api=" + srv.URL + " ptr dns_server=" + unnamed)
+	if checkHTTP(context.Background(), &test); test.Details["ptr"] != "none" {
+		t.Errorf("checkHTTP with ptr and no PTR record = %v, want ptr=none", test.Details)
+	}
+
+	*ptrFlag = true
+	defer func() { *ptrFlag = false }()
+	test = parseTestConfig("api=" + srv.URL + " ptr=false")
+	checkHTTP(context.Background(), &test)
+	if _, ok := test.Details["ptr"]; ok {
+		t.Errorf("checkHTTP with ptr=false = %v, want no ptr", test.Details)
+	}
+}
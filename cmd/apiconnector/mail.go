@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// checkIMAP validates the IMAP greeting and, with the "capability" option,
+// reports the CAPABILITY response. The imaps scheme uses implicit TLS.
+func checkIMAP(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	start := time.Now()
+
+	conn, br, status, errMsg := mailConnect(ctx, test, "imaps", "143", "993")
+	if errMsg != "" {
+		return status, 0, errMsg
+	}
+	defer conn.Close()
+
+	greeting, err := br.ReadString('\n')
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("Greeting read error: %v", err)
+	}
+	greeting = strings.TrimSpace(greeting)
+	if !strings.HasPrefix(greeting, "* OK") && !strings.HasPrefix(greeting, "* PREAUTH") {
+		return "FAIL", time.Since(start), fmt.Sprintf("Unexpected greeting %q", greeting)
+	}
+
+	if boolOption(test, "capability") {
+		if _, err := io.WriteString(conn, "a1 CAPABILITY\r\n"); err != nil {
+			return "FAIL", 0, fmt.Sprintf("CAPABILITY write error: %v", err)
+		}
+		var capabilities string
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				return "FAIL", 0, fmt.Sprintf("CAPABILITY read error: %v", err)
+			}
+			line = strings.TrimSpace(line)
+			if rest, ok := strings.CutPrefix(line, "* CAPABILITY "); ok {
+				capabilities = rest
+			}
+			if strings.HasPrefix(line, "a1 ") {
+				if !strings.HasPrefix(line, "a1 OK") {
+					return "FAIL", time.Since(start), fmt.Sprintf("CAPABILITY failed: %s", line)
+				}
+				break
+			}
+		}
+		setDetail(test, "capabilities", strings.Join(strings.Fields(capabilities), ","))
+	}
+	latency := time.Since(start)
+
+	io.WriteString(conn, "a2 LOGOUT\r\n")
+	return "OK", latency, ""
+}
+
+// checkPOP3 validates the POP3 +OK greeting and, with the "capability"
+// option, reports the CAPA response. The pop3s scheme uses implicit TLS.
+func checkPOP3(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	start := time.Now()
+
+	conn, br, status, errMsg := mailConnect(ctx, test, "pop3s", "110", "995")
+	if errMsg != "" {
+		return status, 0, errMsg
+	}
+	defer conn.Close()
+
+	greeting, err := br.ReadString('\n')
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("Greeting read error: %v", err)
+	}
+	greeting = strings.TrimSpace(greeting)
+	if !strings.HasPrefix(greeting, "+OK") {
+		return "FAIL", time.Since(start), fmt.Sprintf("Unexpected greeting %q", greeting)
+	}
+
+	if boolOption(test, "capability") {
+		if _, err := io.WriteString(conn, "CAPA\r\n"); err != nil {
+			return "FAIL", 0, fmt.Sprintf("CAPA write error: %v", err)
+		}
+		status, err := br.ReadString('\n')
+		if err != nil {
+			return "FAIL", 0, fmt.Sprintf("CAPA read error: %v", err)
+		}
+		if !strings.HasPrefix(status, "+OK") {
+			return "FAIL", time.Since(start), fmt.Sprintf("CAPA failed: %s", strings.TrimSpace(status))
+		}
+		var capabilities []string
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				return "FAIL", 0, fmt.Sprintf("CAPA read error: %v", err)
+			}
+			line = strings.TrimSpace(line)
+			if line == "." {
+				break
+			}
+			if fields := strings.Fields(line); len(fields) > 0 {
+				capabilities = append(capabilities, fields[0])
+			}
+		}
+		setDetail(test, "capabilities", strings.Join(capabilities, ","))
+	}
+	latency := time.Since(start)
+
+	io.WriteString(conn, "QUIT\r\n")
+	return "OK", latency, ""
+}
+
+// mailConnect dials a mail server, using implicit TLS when the URL scheme
+// is tlsScheme. It returns a status and failure message instead of an
+// error so the callers can report them directly: ERROR for an invalid URL,
+// FAIL when the server cannot be reached.
+func mailConnect(ctx context.Context, test *ConnectionTest, tlsScheme, plainPort, tlsPort string) (net.Conn, *bufio.Reader, string, string) {
+	u, err := url.Parse(test.URL)
+	if err != nil || u.Hostname() == "" {
+		return nil, nil, "ERROR", "Invalid URL"
+	}
+
+	port := plainPort
+	if u.Scheme == tlsScheme {
+		port = tlsPort
+	}
+	conn, err := dial(ctx, test, "tcp", hostPort(u, port))
+	if err != nil {
+		return nil, nil, "FAIL", fmt.Sprintf("Connect error: %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(testTimeout(test)))
+
+	if u.Scheme == tlsScheme {
+		tlsConn, err := tlsClient(ctx, test, conn, u.Hostname())
+		if err != nil {
+			conn.Close()
+			return nil, nil, "FAIL", fmt.Sprintf("TLS handshake error: %v", err)
+		}
+		conn = tlsConn
+	}
+	return conn, bufio.NewReader(conn), "", ""
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+)
+
+func fakeIMAP(conn net.Conn) {
+	conn.Write([]byte("* OK [CAPABILITY IMAP4rev1] Dovecot ready.\r\n"))
+	br := bufio.NewReader(conn)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch {
+		case strings.HasPrefix(line, "a1 CAPABILITY"):
+			conn.Write([]byte("* CAPABILITY IMAP4rev1 STARTTLS AUTH=PLAIN\r\na1 OK Capability completed.\r\n"))
+		case strings.HasPrefix(line, "a2 LOGOUT"):
+			conn.Write([]byte("* BYE Logging out\r\na2 OK Logout completed.\r\n"))
+			return
+		}
+	}
+}
+
+func fakePOP3(conn net.Conn) {
+	conn.Write([]byte("+OK Dovecot ready.\r\n"))
+	br := bufio.NewReader(conn)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch {
+		case strings.HasPrefix(line, "CAPA"):
+			conn.Write([]byte("+OK\r\nTOP\r\nUIDL\r\nSASL PLAIN\r\n.\r\n"))
+		case strings.HasPrefix(line, "QUIT"):
+			conn.Write([]byte("+OK Logging out.\r\n"))
+			return
+		}
+	}
+}
+
+func TestCheckIMAP(t *testing.T) {
+	test := parseTestConfig("imap=imap://" + serveOnce(t, fakeIMAP) + " capability")
+	status, _, errMsg := checkIMAP(context.Background(), &test)
+	if status != "OK" {
+		t.Fatalf("checkIMAP = %s (%s), want OK", status, errMsg)
+	}
+	if got := test.Details["capabilities"]; got != "IMAP4rev1,STARTTLS,AUTH=PLAIN" {
+		t.Errorf("capabilities = %q", got)
+	}
+}
+
+func TestCheckPOP3(t *testing.T) {
+	test := parseTestConfig("pop=pop3://" + serveOnce(t, fakePOP3) + " capability")
+	status, _, errMsg := checkPOP3(context.Background(), &test)
+	if status != "OK" {
+		t.Fatalf("checkPOP3 = %s (%s), want OK", status, errMsg)
+	}
+	if got := test.Details["capabilities"]; got != "TOP,UIDL,SASL" {
+		t.Errorf("capabilities = %q", got)
+	}
+}
+
+func TestCheckIMAPBadGreeting(t *testing.T) {
+	addr := serveOnce(t, func(conn net.Conn) {
+		conn.Write([]byte("* BYE Too many connections\r\n"))
+	})
+	test := &ConnectionTest{URL: "imap://" + addr}
+	if status, _, _ := checkIMAP(context.Background(), test); status != "FAIL" {
+		t.Errorf("checkIMAP with BYE greeting = %s, want FAIL", status)
+	}
+}
+
+func TestMailInvalidURL(t *testing.T) {
+	test := &ConnectionTest{URL: "imap:///inbox"}
+	if status, _, errMsg := checkIMAP(context.Background(), test); status != "ERROR" {
+		t.Errorf("checkIMAP(%q) = %s (%s), want ERROR", test.URL, status, errMsg)
+	}
+	test = &ConnectionTest{URL: "pop3://%zz"}
+	if status, _, errMsg := checkPOP3(context.Background(), test); status != "ERROR" {
+		t.Errorf("checkPOP3(%q) = %s (%s), want ERROR", test.URL, status, errMsg)
+	}
+}
@@ -2,11 +2,18 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
 	"fmt"
+	"math"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
@@ -16,12 +23,37 @@ import (
 )
 
 type ConnectionTest struct {
-	Service     string
-	URL         string
-	Status      string
-	Latency     time.Duration
-	Headers     map[string]string
-	Error       string
+	Service string
+	Method  string
+	URL     string
+	Status  string
+	Latency time.Duration
+	Headers map[string]string
+	Error   string
+
+	// Options holds per-test checker settings given after the URL, e.g.
+	// "ws=wss://host/socket ping". A bare key is stored as "true".
+	Options map[string]string
+
+	// Details holds extra facts reported by protocol-aware checkers, such
+	// as a server version or per-phase timings.
+	Details map[string]string
+
+	// Certs holds the certificate chain a TLS target presented, and
+	// ChainIssue what is missing from it, recorded for -show-certs.
+	Certs      []*x509.Certificate
+	ChainIssue string
+
+	// Started and Finished bound the test's run, for structured output.
+	Started, Finished time.Time
+
+	// Samples holds the latency of each successful attempt, address or
+	// address family checked, when there are several (see retryConnect).
+	Samples []time.Duration
+
+	// Trace holds the lines -vv prints under the result, such as HTTP
+	// headers (see traceTransport).
+	Trace []string
 }
 
 func main() {
@@ -35,26 +67,64 @@ func main() {
 
 	go func() {
 		<-sigChan
-		fmt.Println("\nReceived shutdown signal, cancelling...")
+		fmt.Fprintln(os.Stderr, "\nReceived shutdown signal, cancelling...")
 		cancel()
 	}()
 
-	if len(os.Args) < 2 {
+	flag.Usage = printUsage
+	flag.Parse()
+
+	if flag.NArg() < 1 && len(configTargets) == 0 {
 		printUsage()
 		os.Exit(1)
 	}
 
-	fmt.Println(color.CyanString("\n=== API CONNECTIVITY TEST ===\n"))
+	if err := setColor(*colorMode); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if _, ok := outputFormats[*outputFormat]; !ok && *outputFormat != "text" {
+		fmt.Fprintf(os.Stderr, "Error: unknown output format %q\n", *outputFormat)
+		os.Exit(1)
+	}
+	if *reportFile != "" && *outputFormat == "text" {
+		fmt.Fprintln(os.Stderr, "Error: -report-file needs an -output format other than text")
+		os.Exit(1)
+	}
+	if *formatFlag != "" && *outputFormat != "text" && *reportFile == "" {
+		fmt.Fprintln(os.Stderr, "Error: -format replaces the text output; use it with -output text, or with a -report-file")
+		os.Exit(1)
+	}
+	if err := parseFormat(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := parseColumns(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if textOutput() && !*quiet && !*summaryOnly {
+		fmt.Println(color.CyanString("\n=== API CONNECTIVITY TEST ===\n"))
+	}
 
 	var tests []ConnectionTest
-	for _, arg := range os.Args[1:] {
+	for _, arg := range append(configTargets, flag.Args()...) {
 		test := parseTestConfig(arg)
+		if err := expandEnv(&test); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", test.Service, err)
+			os.Exit(1)
+		}
 		tests = append(tests, test)
 	}
+	tests = expandSRV(ctx, tests)
 
 	// Run tests with context
 	if err := runConnectionTestsWithContext(ctx, tests); err != nil {
-		fmt.Printf("Error: %v\n", err)
+		if textOutput() {
+			fmt.Printf("Error: %v\n", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
 		os.Exit(1)
 	}
 }
@@ -62,30 +132,111 @@ func main() {
 func printUsage() {
 	fmt.Println(color.CyanString("apiconnector - API Connectivity Tester"))
 	fmt.Println()
-	fmt.Println("Usage: apiconnector <service1> <service2> ...")
-	fmt.Println("Format: name=http://url[:port]")
+	fmt.Println("Usage: apiconnector [flags] <service1> <service2> ...")
+	fmt.Println("       apiconnector -config config.yaml [flags] [<service> ...]")
+	fmt.Println("Format: name=[METHOD ]http://url[:port] [option=value ...]")
 	fmt.Println()
 	fmt.Println("Examples:")
 	fmt.Println("  apiconnector api=http://localhost:8080/health")
 	fmt.Println("  db=postgres://localhost:5432")
+	fmt.Println("  \"ws=wss://example.com/socket ping\"")
+	fmt.Println()
+	fmt.Println("Flags:")
+	flag.CommandLine.SetOutput(os.Stdout)
+	flag.PrintDefaults()
 }
 
+// httpMethodPattern matches an HTTP method token in a target definition.
+var httpMethodPattern = regexp.MustCompile(`^[A-Z]+$`)
+
+// headerNamePattern matches the name part of a "Name:Value" header field.
+var headerNamePattern = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+
 func parseTestConfig(config string) ConnectionTest {
 	test := ConnectionTest{}
 	parts := strings.SplitN(config, "=", 2)
 	if len(parts) == 2 {
 		test.Service = parts[0]
-		test.URL = parts[1]
+		fields := strings.Fields(parts[1])
+		// An optional HTTP method may precede the URL: "api=POST http://...".
+		if len(fields) > 1 && httpMethodPattern.MatchString(fields[0]) {
+			test.Method = fields[0]
+			fields = fields[1:]
+		}
+		if len(fields) > 0 {
+			test.URL = fields[0]
+			for _, field := range fields[1:] {
+				// "Name:Value" adds a request header, e.g. "Host:api.internal".
+				if name, value, ok := strings.Cut(field, ":"); ok && headerNamePattern.MatchString(name) {
+					if test.Headers == nil {
+						test.Headers = make(map[string]string)
+					}
+					test.Headers[http.CanonicalHeaderKey(name)] = value
+					continue
+				}
+				if test.Options == nil {
+					test.Options = make(map[string]string)
+				}
+				key, value, found := strings.Cut(field, "=")
+				if !found {
+					value = "true"
+				}
+				test.Options[strings.ToLower(key)] = value
+			}
+		}
 	}
 	return test
 }
 
+// envRefPattern matches a "${NAME}" environment variable reference.
+var envRefPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces "${NAME}" references in test's URL, header values and
+// option values (such as an inline body) with the named environment
+// variables, so secrets and per-environment hosts stay out of the command
+// line. Other uses of "$" are left alone. It fails on the first reference
+// to an unset variable.
+func expandEnv(test *ConnectionTest) error {
+	var missing string
+	expand := func(s string) string {
+		return envRefPattern.ReplaceAllStringFunc(s, func(ref string) string {
+			name := envRefPattern.FindStringSubmatch(ref)[1]
+			v, ok := os.LookupEnv(name)
+			if !ok && missing == "" {
+				missing = name
+			}
+			return v
+		})
+	}
+
+	test.URL = expand(test.URL)
+	for name, value := range test.Headers {
+		test.Headers[name] = expand(value)
+	}
+	for key, value := range test.Options {
+		test.Options[key] = expand(value)
+	}
+	if missing != "" {
+		return fmt.Errorf("environment variable %s is not set", missing)
+	}
+	return nil
+}
+
+// boolOption reports whether the named per-test option is set to a true value.
+func boolOption(test *ConnectionTest, key string) bool {
+	v, err := strconv.ParseBool(test.Options[key])
+	return err == nil && v
+}
+
 func runConnectionTests(tests []ConnectionTest) error {
 	return runConnectionTestsWithContext(context.Background(), tests)
 }
 
 func runConnectionTestsWithContext(ctx context.Context, tests []ConnectionTest) error {
-	var success, failure int
+	var success, warning, failure int
+	started := time.Now()
+	text := textOutput()
+	var rows []*ConnectionTest // for a -columns table
 
 	for i := range tests {
 		select {
@@ -95,19 +246,75 @@ func runConnectionTestsWithContext(ctx context.Context, tests []ConnectionTest)
 		}
 
 		test := &tests[i]
-		test.Status, test.Latency, test.Error = testConnect(ctx, test.URL)
-
-		if test.Error == "" {
+		test.Started = time.Now()
+		test.Status, test.Latency, test.Error = connectFamilies(ctx, test)
+		test.Status, test.Error = latencyStatus(test)
+		test.Status, test.Error = certStatus(test)
+		test.Status, test.Error = cnameStatus(test)
+		test.Finished = time.Now()
+
+		switch resultStatus(test) {
+		case "WARN":
+			warning++
+		case "OK":
 			success++
-			fmt.Printf("%-20s %s (%s)\n", test.Service, color.GreenString("OK"), formatDuration(test.Latency))
-		} else {
+		default:
 			failure++
+		}
+		if resultTemplate != nil {
+			if err := writeFormat(os.Stdout, test); err != nil {
+				return err
+			}
+		}
+		if streamOutput() {
+			if err := writeResultJSON(os.Stdout, newResult(test)); err != nil {
+				return err
+			}
+		}
+		if !text || !textResult(test) {
+			continue
+		}
+		if resultColumns != nil {
+			rows = append(rows, test)
+			continue
+		}
+		details := formatDetails(test.Details)
+		if verbose > 0 {
+			details = ""
+		}
+		if test.Error == "" && test.Status == "WARN" {
+			fmt.Printf("%-20s %s (%s)%s\n", test.Service, color.YellowString("WARN"), formatDuration(test.Latency), details)
+		} else if test.Error == "" {
+			fmt.Printf("%-20s %s (%s)%s\n", test.Service, color.GreenString("OK"), formatDuration(test.Latency), details)
+		} else {
 			fmt.Printf("%-20s %s (%s)\n", test.Service, color.RedString("FAIL"), test.Error)
 		}
+		if verbose > 0 {
+			fmt.Print(formatVerbose(test))
+		}
+		if *showCerts {
+			fmt.Print(formatCerts(test))
+		}
 	}
 
-	fmt.Println()
-	fmt.Printf("Summary: %d OK, %d FAIL\n", success, failure)
+	if len(rows) > 0 {
+		if err := writeTable(os.Stdout, resultColumns, rows); err != nil {
+			return err
+		}
+	}
+	if text && textSummary(failure) {
+		if !*summaryOnly {
+			fmt.Println()
+		}
+		if warning > 0 {
+			fmt.Printf("Summary: %d OK, %d WARN, %d FAIL\n", success, warning, failure)
+		} else {
+			fmt.Printf("Summary: %d OK, %d FAIL\n", success, failure)
+		}
+	}
+	if err := writeReport(newReport(tests, started)); err != nil {
+		return err
+	}
 
 	if failure > 0 {
 		return fmt.Errorf("%d connection failures", failure)
@@ -116,8 +323,236 @@ func runConnectionTestsWithContext(ctx context.Context, tests []ConnectionTest)
 	return nil
 }
 
-func testConnect(ctx context.Context, url string) (string, time.Duration, string) {
+// defaultRetryBackoff is the delay before the first retry when the
+// "retries" option is set without "retry_backoff".
+const defaultRetryBackoff = 500 * time.Millisecond
+
+// retryConnect runs testConnect, retrying a failed test up to "retries"
+// more times. The delay starts at "retry_backoff" and doubles after each
+// attempt. When retries are enabled the "attempts" detail records how many
+// attempts were made, and "retried" whether an attempt after a failure
+// succeeded. The latency of each attempt that succeeded is added to
+// test.Samples.
+func retryConnect(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	retries, backoff := 0, defaultRetryBackoff
+	if v := test.Options["retries"]; v != "" {
+		var err error
+		if retries, err = strconv.Atoi(v); err != nil || retries < 0 {
+			return "ERROR", 0, fmt.Sprintf("Invalid retries %q", v)
+		}
+	}
+	for _, key := range []string{"timeout", "connect_timeout"} {
+		if v := test.Options[key]; v != "" {
+			if _, err := time.ParseDuration(v); err != nil {
+				return "ERROR", 0, fmt.Sprintf("Invalid %s: %v", key, err)
+			}
+		}
+	}
+	if v := test.Options["retry_backoff"]; v != "" {
+		var err error
+		if backoff, err = time.ParseDuration(v); err != nil {
+			return "ERROR", 0, fmt.Sprintf("Invalid retry_backoff: %v", err)
+		}
+	}
+
+	status, latency, errMsg := testConnect(ctx, test)
+	if errMsg == "" {
+		test.Samples = append(test.Samples, latency)
+	}
+	attempt := 1
+	for ; errMsg != "" && attempt <= retries; attempt++ {
+		select {
+		case <-ctx.Done():
+			return status, latency, errMsg
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		test.Details, test.Trace = nil, nil
+		status, latency, errMsg = testConnect(ctx, test)
+		if errMsg == "" {
+			test.Samples = append(test.Samples, latency)
+		}
+	}
+	if retries > 0 {
+		setDetail(test, "attempts", strconv.Itoa(attempt))
+		if attempt > 1 && errMsg == "" {
+			setDetail(test, "retried", "true")
+		}
+	}
+	return status, latency, errMsg
+}
+
+// latencyStatus applies the "warn_latency" and "fail_latency" options to a
+// completed test: an OK target slower than warn_latency is degraded to
+// WARN, and an OK or WARN one slower than fail_latency fails. Other
+// results, such as "HTTP 503", keep their status. It returns the resulting
+// status and error message.
+func latencyStatus(test *ConnectionTest) (string, string) {
+	if test.Error != "" || (test.Status != "OK" && test.Status != "WARN") {
+		return test.Status, test.Error
+	}
+	for _, key := range []string{"fail_latency", "warn_latency"} {
+		v := test.Options[key]
+		if v == "" {
+			continue
+		}
+		limit, err := time.ParseDuration(v)
+		if err != nil {
+			return "ERROR", fmt.Sprintf("Invalid %s: %v", key, err)
+		}
+		if test.Latency <= limit {
+			continue
+		}
+		if key == "fail_latency" {
+			return "FAIL", fmt.Sprintf("Latency %s exceeds fail_latency %s", formatDuration(test.Latency), v)
+		}
+		if test.Status != "OK" {
+			continue
+		}
+		setDetail(test, "warn_latency", v)
+		return "WARN", ""
+	}
+	return test.Status, test.Error
+}
+
+// certStatus applies the certificate expiry thresholds to a completed test
+// that recorded "cert_days": fewer days left than "cert_fail_days" (or
+// -cert-fail-days) fails, and fewer than "cert_warn_days" (or
+// -cert-warn-days) is degraded to WARN. A threshold of 0 disables it.
+func certStatus(test *ConnectionTest) (string, string) {
+	days, err := strconv.Atoi(test.Details["cert_days"])
+	if test.Error != "" || err != nil {
+		return test.Status, test.Error
+	}
+	for _, key := range []string{"cert_fail_days", "cert_warn_days"} {
+		limit := *certFailDays
+		if key == "cert_warn_days" {
+			limit = *certWarnDays
+		}
+		if v := test.Options[key]; v != "" {
+			if limit, err = strconv.Atoi(v); err != nil || limit < 0 {
+				return "ERROR", fmt.Sprintf("Invalid %s %q", key, v)
+			}
+		}
+		if limit == 0 || days >= limit {
+			continue
+		}
+		if key == "cert_fail_days" {
+			return "FAIL", fmt.Sprintf("Certificate expires in %d days (%s %d)", days, key, limit)
+		}
+		return "WARN", ""
+	}
+	return test.Status, test.Error
+}
+
+// checkFunc tests a single target and reports its status, latency and, on
+// failure, an error message.
+type checkFunc func(ctx context.Context, test *ConnectionTest) (string, time.Duration, string)
+
+// checkers maps URL schemes to protocol-aware checks. Targets with any other
+// scheme fall back to the plain TCP/HTTP checks in testConnect.
+var checkers = map[string]checkFunc{
+	"grpc":        checkGRPC,
+	"grpcs":       checkGRPC,
+	"ws":          checkWebSocket,
+	"wss":         checkWebSocket,
+	"postgres":    checkPostgres,
+	"postgresql":  checkPostgres,
+	"mysql":       checkMySQL,
+	"mariadb":     checkMySQL,
+	"redis":       checkRedis,
+	"rediss":      checkRedis,
+	"mongodb":     checkMongoDB,
+	"kafka":       checkKafka,
+	"amqp":        checkAMQP,
+	"amqps":       checkAMQP,
+	"nats":        checkNATS,
+	"smtp":        checkSMTP,
+	"smtps":       checkSMTP,
+	"imap":        checkIMAP,
+	"imaps":       checkIMAP,
+	"pop3":        checkPOP3,
+	"pop3s":       checkPOP3,
+	"ftp":         checkFTP,
+	"ftps":        checkFTP,
+	"ssh":         checkSSH,
+	"sftp":        checkSSH,
+	"ldap":        checkLDAP,
+	"ldaps":       checkLDAP,
+	"dns":         checkDNS,
+	"srv":         checkSRV,
+	"tcp":         checkTCP,
+	"icmp":        checkICMP,
+	"udp":         checkUDP,
+	"ntp":         checkNTP,
+	"snmp":        checkSNMP,
+	"h3":          checkHTTP3,
+	"es":          checkElasticsearch,
+	"ess":         checkElasticsearch,
+	"cassandra":   checkCassandra,
+	"memcached":   checkMemcached,
+	"etcd":        checkEtcd,
+	"etcds":       checkEtcd,
+	"graphql":     checkGraphQL,
+	"graphqls":    checkGraphQL,
+	"soap":        checkSOAP,
+	"soaps":       checkSOAP,
+	"tls":         checkTLS,
+	"stomp":       checkSTOMP,
+	"stomps":      checkSTOMP,
+	"syslog":      checkSyslog,
+	"sip":         checkSIP,
+	"sips":        checkSIP,
+	"clickhouse":  checkClickHouse,
+	"clickhouses": checkClickHouse,
+	"rtsp":        checkRTSP,
+	"rtsps":       checkRTSP,
+	"rtmp":        checkRTMP,
+	"rtmps":       checkRTMP,
+	"influx":      checkInflux,
+	"influxs":     checkInflux,
+	"prom":        checkPrometheus,
+	"proms":       checkPrometheus,
+}
+
+// defaultTimeout bounds every dial and request made by a check unless the
+// -timeout flag or a test's "timeout" option says otherwise.
+const defaultTimeout = 5 * time.Second
+
+var (
+	checkTimeout   = flag.Duration("timeout", defaultTimeout, "`duration` allowed for each check's connections and requests")
+	connectTimeout = flag.Duration("connect-timeout", 0, "`duration` allowed for establishing each connection (default the -timeout)")
+)
+
+// testTimeout returns how long test's connections and requests may take:
+// the "timeout" option, or the -timeout flag.
+func testTimeout(test *ConnectionTest) time.Duration {
+	if test != nil {
+		if d, err := time.ParseDuration(test.Options["timeout"]); err == nil {
+			return d
+		}
+	}
+	return *checkTimeout
+}
+
+// testConnectTimeout returns how long establishing one of test's
+// connections may take: the "connect_timeout" option, the -connect-timeout
+// flag, or else testTimeout.
+func testConnectTimeout(test *ConnectionTest) time.Duration {
+	if test != nil {
+		if d, err := time.ParseDuration(test.Options["connect_timeout"]); err == nil {
+			return d
+		}
+	}
+	if *connectTimeout > 0 {
+		return *connectTimeout
+	}
+	return testTimeout(test)
+}
+
+func testConnect(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
 	start := time.Now()
+	url := test.URL
 
 	// Check context cancellation
 	select {
@@ -126,6 +561,10 @@ func testConnect(ctx context.Context, url string) (string, time.Duration, string
 	default:
 	}
 
+	if check, ok := checkers[scheme(url)]; ok {
+		return check(ctx, test)
+	}
+
 	// Parse URL
 	parsedURL := parseURL(url)
 	if parsedURL == "" {
@@ -135,7 +574,7 @@ func testConnect(ctx context.Context, url string) (string, time.Duration, string
 	// Check port connectivity
 	port := getPort(url)
 	if port != "" {
-		conn, err := net.DialTimeout("tcp", parsedURL+":"+port, 5*time.Second)
+		conn, err := net.DialTimeout("tcp", parsedURL+":"+port, testConnectTimeout(test))
 		if err != nil {
 			return "FAIL", 0, fmt.Sprintf("Port %s unreachable: %v", port, err)
 		}
@@ -144,44 +583,141 @@ func testConnect(ctx context.Context, url string) (string, time.Duration, string
 
 	// Check HTTP endpoint if it's an HTTP URL
 	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
-		client := &http.Client{
-			Timeout: 5 * time.Second,
-			CheckRedirect: func(req *http.Request, via []*http.Request) error {
-				return http.ErrUseLastResponse
-			},
-		}
+		return checkHTTP(ctx, test)
+	}
 
-		// Create request with context
-		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-		if err != nil {
-			return "ERROR", 0, fmt.Sprintf("Request creation error: %v", err)
-		}
+	return "OK", time.Since(start), ""
+}
 
-		resp, err := client.Do(req)
-		if err != nil {
-			return "FAIL", 0, fmt.Sprintf("HTTP error: %v", err)
-		}
-		defer resp.Body.Close()
+// scheme returns the lower-cased scheme of a target URL, or "" if it has none.
+func scheme(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Scheme)
+}
 
-		latency := time.Since(start)
-		status := "OK"
-		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-			status = "OK"
-		} else {
-			status = fmt.Sprintf("HTTP %d", resp.StatusCode)
+// hostPort returns the host:port to dial for u, using defaultPort when the
+// URL does not name one.
+func hostPort(u *url.URL, defaultPort string) string {
+	port := u.Port()
+	if port == "" {
+		port = defaultPort
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// dial opens a network connection for test over its address family (see
+// familyNetwork), bounded by testConnectTimeout and ctx. Hosts given to
+// -resolve or "resolve" connect to the address given there (see
+// resolveAddr), other host names are resolved and timed by lookupHost (and
+// the address connected to looked up with "ptr", see lookupPTR),
+// connections go through a SOCKS5 proxy when one is configured (see
+// socksDialer), and when the test sets "proxy_protocol", TCP connections
+// start with a PROXY protocol header.
+func dial(ctx context.Context, test *ConnectionTest, network, addr string) (net.Conn, error) {
+	if test != nil {
+		network = familyNetwork(test, network)
+	}
+	dialer, err := socksDialer(test, network)
+	if err != nil {
+		return nil, err
+	}
+	addr, ip, err := resolveAddr(test, addr)
+	if err != nil {
+		return nil, err
+	}
+	if ip != "" && test != nil {
+		setDetail(test, "resolve", ip)
+	}
+	var conn net.Conn
+	if test == nil || viaSOCKS(test) {
+		conn, err = dialer.DialContext(ctx, network, addr)
+	} else if conn, err = dialResolved(ctx, test, dialer, network, addr); err == nil && reversePTR(test) {
+		lookupPTR(ctx, test, conn.RemoteAddr())
+	} else if err == nil && (verbose > 0 || tableColumn("ip")) {
+		if host, _, err := net.SplitHostPort(conn.RemoteAddr().String()); err == nil {
+			setDetail(test, "ip", host)
 		}
+	}
+	if err != nil || test == nil || test.Options["proxy_protocol"] == "" || !strings.HasPrefix(network, "tcp") {
+		return conn, err
+	}
 
-		return status, latency, ""
+	header, err := proxyHeader(test.Options["proxy_protocol"], conn.LocalAddr(), conn.RemoteAddr())
+	if err == nil {
+		_, err = conn.Write(header)
 	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
 
-	return "OK", time.Since(start), ""
+// tlsRootCAs holds the roots used to verify server certificates, which
+// rootCAs extends with configured CAs; nil means the system pool.
+var tlsRootCAs *x509.CertPool
+
+// tlsClient performs a TLS handshake over conn for test, verifying the
+// server certificate against serverName and offering the ALPN protocols in
+// the "alpn" option, and records the certificate expiry.
+func tlsClient(ctx context.Context, test *ConnectionTest, conn net.Conn, serverName string) (net.Conn, error) {
+	config, err := tlsConfig(test, serverName)
+	if err != nil {
+		return nil, err
+	}
+	if alpn := test.Options["alpn"]; alpn != "" {
+		config.NextProtos = strings.Split(alpn, ",")
+	}
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		recordChainError(test, err)
+		return nil, err
+	}
+	setCertExpiry(test, tlsConn.ConnectionState())
+	return tlsConn, nil
+}
+
+// setCertExpiry records the leaf certificate expiry date of a TLS connection
+// and the whole days left until then ("cert_days"), which certStatus checks.
+func setCertExpiry(test *ConnectionTest, state tls.ConnectionState) {
+	if len(state.PeerCertificates) == 0 {
+		return
+	}
+	notAfter := state.PeerCertificates[0].NotAfter
+	setDetail(test, "cert_expires", notAfter.UTC().Format("2006-01-02"))
+	setDetail(test, "cert_days", strconv.Itoa(int(math.Floor(time.Until(notAfter).Hours()/24))))
+}
+
+// setDetail records an extra fact about a test result.
+func setDetail(test *ConnectionTest, key, value string) {
+	if test.Details == nil {
+		test.Details = make(map[string]string)
+	}
+	test.Details[key] = value
+}
+
+// cloneTest returns a copy of test with its own options, setting the key
+// option to value, and none of its results, for checking test once more
+// under a variation such as another address.
+func cloneTest(test *ConnectionTest, key, value string) ConnectionTest {
+	run := *test
+	run.Options = make(map[string]string, len(test.Options)+1)
+	for k, v := range test.Options {
+		run.Options[k] = v
+	}
+	run.Options[key] = value
+	run.Details, run.Samples, run.Trace = nil, nil, nil
+	return run
 }
 
 func parseURL(url string) string {
 	// Remove protocol
 	url = strings.TrimPrefix(url, "http://")
 	url = strings.TrimPrefix(url, "https://")
-	
+
 	// Get hostname
 	parts := strings.Split(url, "/")
 	if len(parts) > 0 {
@@ -213,4 +749,22 @@ func formatDuration(d time.Duration) string {
 		return fmt.Sprintf("%dµs", d.Microseconds())
 	}
 	return fmt.Sprintf("%dms", d.Milliseconds())
-}
\ No newline at end of file
+}
+
+// formatDetails renders result details as " key=value ..." in key order.
+func formatDetails(details map[string]string) string {
+	if len(details) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(details))
+	for k := range details {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, " %s=%s", k, details[k])
+	}
+	return b.String()
+}
@@ -1,6 +1,36 @@
 package main
 
-import "testing"
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// serveOnce starts a TCP listener that hands its first connection to handle
+// and returns the listener address.
+func serveOnce(t *testing.T, handle func(conn net.Conn)) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lis.Close() })
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		handle(conn)
+	}()
+	return lis.Addr().String()
+}
 
 func TestParseTestConfig(t *testing.T) {
 	tests := []struct {
@@ -21,6 +51,14 @@ func TestParseTestConfig(t *testing.T) {
 				URL:     "postgres://localhost:5432",
 			},
 		},
+		{
+			in: "api=POST http://localhost:8080/health",
+			expect: ConnectionTest{
+				Service: "api",
+				Method:  "POST",
+				URL:     "http://localhost:8080/health",
+			},
+		},
 		{
 			// Missing '=' should result in empty Service and URL
 			in: "",
@@ -41,8 +79,200 @@ func TestParseTestConfig(t *testing.T) {
 
 	for _, tt := range tests {
 		got := parseTestConfig(tt.in)
-		if got.Service != tt.expect.Service || got.URL != tt.expect.URL {
+		if got.Service != tt.expect.Service || got.Method != tt.expect.Method || got.URL != tt.expect.URL {
 			t.Errorf("parseTestConfig(%q) = %+v, want %+v", tt.in, got, tt.expect)
 		}
 	}
-}
\ No newline at end of file
+}
+
+func TestParseTestConfigOptions(t *testing.T) {
+	got := parseTestConfig("ws=wss://example.com/socket ping Timeout=3s")
+	if got.URL != "wss://example.com/socket" {
+		t.Errorf("URL = %q, want wss://example.com/socket", got.URL)
+	}
+	if got.Options["ping"] != "true" || got.Options["timeout"] != "3s" {
+		t.Errorf("Options = %v, want ping=true timeout=3s", got.Options)
+	}
+	if !boolOption(&got, "ping") || boolOption(&got, "missing") {
+		t.Errorf("boolOption gave unexpected results for %v", got.Options)
+	}
+}
+
+func TestParseTestConfigHeaders(t *testing.T) {
+	got := parseTestConfig("api=http://10.0.0.5/health Host:api.example.com x-api-key:abc:123 host_key=SHA256:xyz")
+	want := map[string]string{"Host": "api.example.com", "X-Api-Key": "abc:123"}
+	if !reflect.DeepEqual(got.Headers, want) {
+		t.Errorf("Headers = %v, want %v", got.Headers, want)
+	}
+	if got.Options["host_key"] != "SHA256:xyz" {
+		t.Errorf("Options = %v, want host_key=SHA256:xyz", got.Options)
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("API_HOST", "api.internal:8443")
+	t.Setenv("API_TOKEN", "s3cr3t")
+	t.Setenv("EMPTY", "")
+
+	test := parseTestConfig(`api=https://${API_HOST}/health X-Api-Key:${API_TOKEN} body={"token":"${API_TOKEN}"} expect_json=$.status==up x=${EMPTY}`)
+	if err := expandEnv(&test); err != nil {
+		t.Fatal(err)
+	}
+	if test.URL != "https://api.internal:8443/health" {
+		t.Errorf("URL = %q", test.URL)
+	}
+	if test.Headers["X-Api-Key"] != "s3cr3t" {
+		t.Errorf("Headers = %v", test.Headers)
+	}
+	want := map[string]string{"body": `{"token":"s3cr3t"}`, "expect_json": "$.status==up", "x": ""}
+	if !reflect.DeepEqual(test.Options, want) {
+		t.Errorf("Options = %v, want %v", test.Options, want)
+	}
+
+	test = parseTestConfig("api=https://${API_HOST}/ bearer=${MISSING_TOKEN}")
+	if err := expandEnv(&test); err == nil || !strings.Contains(err.Error(), "MISSING_TOKEN") {
+		t.Errorf("expandEnv with unset variable = %v, want error naming MISSING_TOKEN", err)
+	}
+}
+
+func TestLatencyStatus(t *testing.T) {
+	tests := []struct {
+		options string
+		from    string
+		latency time.Duration
+		status  string
+		failed  bool
+	}{
+		{"", "OK", time.Second, "OK", false},
+		{"warn_latency=500ms", "OK", 100 * time.Millisecond, "OK", false},
+		{"warn_latency=500ms", "OK", time.Second, "WARN", false},
+		{"warn_latency=500ms fail_latency=2s", "OK", time.Second, "WARN", false},
+		{"warn_latency=500ms fail_latency=2s", "OK", 3 * time.Second, "FAIL", true},
+		{"fail_latency=soon", "OK", time.Second, "ERROR", true},
+		{"warn_latency=1ns", "HTTP 503", time.Second, "HTTP 503", false},
+		{"fail_latency=1ns", "HTTP 503", time.Second, "HTTP 503", false},
+		{"warn_latency=1ns", "WARN", time.Second, "WARN", false},
+		{"fail_latency=1ns", "WARN", time.Second, "FAIL", true},
+	}
+	for _, tt := range tests {
+		test := parseTestConfig("api=http://localhost " + tt.options)
+		test.Status, test.Latency = tt.from, tt.latency
+		status, errMsg := latencyStatus(&test)
+		if status != tt.status || (errMsg != "") != tt.failed {
+			t.Errorf("latencyStatus(%s, %s, %s) = %s (%s), want %s", tt.from, tt.options, tt.latency, status, errMsg, tt.status)
+		}
+		if tt.from == "WARN" && test.Details["warn_latency"] != "" {
+			t.Errorf("latencyStatus(%s, %s) recorded warn_latency for an already degraded result", tt.from, tt.options)
+		}
+	}
+}
+
+func TestCertStatus(t *testing.T) {
+	tests := []struct {
+		options string
+		days    string
+		status  string
+		failed  bool
+	}{
+		{"", "", "OK", false},
+		{"", "90", "OK", false},
+		{"", "20", "WARN", false},
+		{"", "3", "FAIL", true},
+		{"cert_warn_days=0", "20", "OK", false},
+		{"cert_fail_days=0 cert_warn_days=0", "3", "OK", false},
+		{"cert_warn_days=120", "90", "WARN", false},
+		{"cert_fail_days=soon", "90", "ERROR", true},
+	}
+	for _, tt := range tests {
+		test := parseTestConfig("api=https://localhost " + tt.options)
+		test.Status = "OK"
+		if tt.days != "" {
+			setDetail(&test, "cert_days", tt.days)
+		}
+		status, errMsg := certStatus(&test)
+		if status != tt.status || (errMsg != "") != tt.failed {
+			t.Errorf("certStatus(%s, %s days) = %s (%s), want %s", tt.options, tt.days, status, errMsg, tt.status)
+		}
+	}
+}
+
+func TestRetryConnect(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= 2 {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		options  string
+		status   string
+		attempts string
+		retried  string
+		samples  int
+	}{
+		{"", "FAIL", "", "", 0},
+		{"retries=1 retry_backoff=1ms", "FAIL", "2", "", 0},
+		{"retries=3 retry_backoff=1ms", "OK", "3", "true", 1},
+		{"retries=x", "ERROR", "", "", 0},
+	}
+	for _, tt := range tests {
+		requests.Store(0)
+		test := parseTestConfig("api=" + srv.URL + " " + tt.options)
+		status, _, errMsg := retryConnect(context.Background(), &test)
+		if status != tt.status || test.Details["attempts"] != tt.attempts || test.Details["retried"] != tt.retried {
+			t.Errorf("retryConnect(%s) = %s (%s) %v, want %s attempts=%s retried=%s", tt.options, status, errMsg, test.Details, tt.status, tt.attempts, tt.retried)
+		}
+		if len(test.Samples) != tt.samples {
+			t.Errorf("retryConnect(%s) samples = %v, want %d from the attempts that succeeded", tt.options, test.Samples, tt.samples)
+		}
+	}
+}
+
+func TestTimeouts(t *testing.T) {
+	defer func() { *checkTimeout, *connectTimeout = defaultTimeout, 0 }()
+
+	test := parseTestConfig("api=http://localhost timeout=20s")
+	if got := testTimeout(&test); got != 20*time.Second {
+		t.Errorf("testTimeout with timeout=20s = %s", got)
+	}
+	if got := testConnectTimeout(&test); got != 20*time.Second {
+		t.Errorf("testConnectTimeout with timeout=20s = %s, want the timeout", got)
+	}
+	*checkTimeout, *connectTimeout = time.Second, 200*time.Millisecond
+	test = parseTestConfig("api=http://localhost")
+	if got := testTimeout(&test); got != time.Second {
+		t.Errorf("testTimeout with -timeout=1s = %s", got)
+	}
+	if got := testConnectTimeout(&test); got != 200*time.Millisecond {
+		t.Errorf("testConnectTimeout with -connect-timeout=200ms = %s", got)
+	}
+
+	// A server that accepts but never answers fails after the timeout.
+	addr := serveOnce(t, func(conn net.Conn) { time.Sleep(time.Second) })
+	test = parseTestConfig("cache=memcached://" + addr + " timeout=100ms")
+	start := time.Now()
+	if status, _, _ := retryConnect(context.Background(), &test); status != "FAIL" || time.Since(start) > 500*time.Millisecond {
+		t.Errorf("retryConnect with timeout=100ms = %s after %s, want FAIL within 500ms", status, time.Since(start))
+	}
+
+	test = parseTestConfig("cache=memcached://" + addr + " connect_timeout=soon")
+	if status, _, _ := retryConnect(context.Background(), &test); status != "ERROR" {
+		t.Errorf("retryConnect with connect_timeout=soon = %s, want ERROR", status)
+	}
+}
+
+func TestCloneTest(t *testing.T) {
+	test := parseTestConfig("api=http://localhost all_ips")
+	setDetail(&test, "dns", "1ms")
+	run := cloneTest(&test, "resolve", "10.0.0.5")
+	run.Options["timeout"] = "1s"
+	if run.Options["all_ips"] != "true" || run.Options["resolve"] != "10.0.0.5" || run.Details != nil {
+		t.Errorf("cloneTest = %v %v, want the options with resolve and no details", run.Options, run.Details)
+	}
+	if len(test.Options) != 1 || test.Details["dns"] != "1ms" {
+		t.Errorf("original test = %v %v, want it unchanged", test.Options, test.Details)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// writeMarkdown writes r as GitHub-flavored Markdown for pasting into pull
+// request comments or chat: a summary line, a table of results and, for
+// each failed check, its error and details.
+func writeMarkdown(w io.Writer, r *report) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "**%d OK, %d WARN, %d FAIL** of %d checks (%s)\n\n",
+		r.Summary.OK, r.Summary.Warn, r.Summary.Fail, len(r.Results), r.Started.UTC().Format(time.RFC3339))
+
+	fmt.Fprintln(bw, "| Service | URL | Status | Latency |")
+	fmt.Fprintln(bw, "|---------|-----|--------|--------:|")
+	for _, res := range r.Results {
+		fmt.Fprintf(bw, "| %s | %s | %s | %s |\n", markdownCell(res.Service), markdownCell(res.URL),
+			markdownStatus(res.Status), formatDuration(time.Duration(res.LatencyMS*float64(time.Millisecond))))
+	}
+
+	var failed []result
+	for _, res := range r.Results {
+		if res.Status == "FAIL" || res.Status == "ERROR" {
+			failed = append(failed, res)
+		}
+	}
+	if len(failed) > 0 {
+		fmt.Fprint(bw, "\n### Failures\n")
+		for _, res := range failed {
+			fmt.Fprintf(bw, "\n**%s** `%s`\n", markdownCell(res.Service), res.URL)
+			fmt.Fprintf(bw, "\n```\n%s\n", res.Error)
+			for _, d := range sortedDetails(res.Details) {
+				fmt.Fprintln(bw, d)
+			}
+			fmt.Fprintln(bw, "```")
+		}
+	}
+	return bw.Flush()
+}
+
+// markdownStatus marks a status with an emoji that GitHub and Slack both
+// render, so failures stand out in a long table.
+func markdownStatus(status string) string {
+	switch status {
+	case "OK":
+		return ":white_check_mark: OK"
+	case "WARN":
+		return ":warning: WARN"
+	}
+	return ":x: " + status
+}
+
+// markdownCell escapes s for a Markdown table cell, where a pipe would end
+// the cell and a newline the row.
+func markdownCell(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// checkMemcached sends "version" and "stats" and reports the server version,
+// uptime and get hit ratio. The "max_evictions" option fails the check when
+// the server has evicted more items than allowed.
+func checkMemcached(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	start := time.Now()
+
+	u, err := url.Parse(test.URL)
+	if err != nil || u.Hostname() == "" {
+		return "ERROR", 0, "Invalid URL"
+	}
+
+	maxEvictions := int64(-1)
+	if v := test.Options["max_evictions"]; v != "" {
+		if maxEvictions, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return "ERROR", 0, fmt.Sprintf("Invalid max_evictions: %v", err)
+		}
+	}
+
+	conn, err := dial(ctx, test, "tcp", hostPort(u, "11211"))
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("Connect error: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(testTimeout(test)))
+
+	br := bufio.NewReader(conn)
+	if _, err := conn.Write([]byte("version\r\n")); err != nil {
+		return "FAIL", 0, fmt.Sprintf("Send error: %v", err)
+	}
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("version error: %v", err)
+	}
+	version, ok := strings.CutPrefix(strings.TrimRight(line, "\r\n"), "VERSION ")
+	if !ok {
+		return "FAIL", 0, fmt.Sprintf("Unexpected version reply %q", strings.TrimSpace(line))
+	}
+	setDetail(test, "version", version)
+
+	if _, err := conn.Write([]byte("stats\r\n")); err != nil {
+		return "FAIL", 0, fmt.Sprintf("Send error: %v", err)
+	}
+	stats := make(map[string]string)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return "FAIL", 0, fmt.Sprintf("stats error: %v", err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "END" {
+			break
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[0] != "STAT" {
+			return "FAIL", 0, fmt.Sprintf("Unexpected stats reply %q", line)
+		}
+		stats[fields[1]] = fields[2]
+	}
+	latency := time.Since(start)
+
+	if secs, err := strconv.ParseInt(stats["uptime"], 10, 64); err == nil {
+		setDetail(test, "uptime", (time.Duration(secs) * time.Second).String())
+	}
+	hits, _ := strconv.ParseInt(stats["get_hits"], 10, 64)
+	misses, _ := strconv.ParseInt(stats["get_misses"], 10, 64)
+	if hits+misses > 0 {
+		setDetail(test, "hit_ratio", fmt.Sprintf("%.1f%%", 100*float64(hits)/float64(hits+misses)))
+	}
+	evictions, _ := strconv.ParseInt(stats["evictions"], 10, 64)
+	setDetail(test, "evictions", strconv.FormatInt(evictions, 10))
+
+	if maxEvictions >= 0 && evictions > maxEvictions {
+		return "FAIL", 0, fmt.Sprintf("%d evictions exceeds max_evictions %d", evictions, maxEvictions)
+	}
+
+	return "OK", latency, ""
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+)
+
+func fakeMemcached(conn net.Conn) {
+	br := bufio.NewReader(conn)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch strings.TrimSpace(line) {
+		case "version":
+			conn.Write([]byte("VERSION 1.6.21\r\n"))
+		case "stats":
+			conn.Write([]byte("STAT pid 1\r\nSTAT uptime 3600\r\nSTAT get_hits 90\r\nSTAT get_misses 10\r\nSTAT evictions 42\r\nEND\r\n"))
+		default:
+			conn.Write([]byte("ERROR\r\n"))
+		}
+	}
+}
+
+func TestCheckMemcached(t *testing.T) {
+	tests := []struct {
+		options string
+		status  string
+	}{
+		{"", "OK"},
+		{"max_evictions=100", "OK"},
+		{"max_evictions=0", "FAIL"},
+	}
+
+	for _, tt := range tests {
+		addr := serveOnce(t, fakeMemcached)
+		test := parseTestConfig("cache=memcached://" + addr + " " + tt.options)
+		status, _, errMsg := checkMemcached(context.Background(), &test)
+		if status != tt.status {
+			t.Errorf("checkMemcached(%q) = %s (%s), want %s", tt.options, status, errMsg, tt.status)
+		}
+		if test.Details["version"] != "1.6.21" || test.Details["hit_ratio"] != "90.0%" || test.Details["uptime"] != "1h0m0s" {
+			t.Errorf("checkMemcached(%q) details = %v", tt.options, test.Details)
+		}
+	}
+}
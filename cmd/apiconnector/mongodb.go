@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"time"
+)
+
+// mongoOpMsg is the wire protocol opcode for OP_MSG (MongoDB 3.6+).
+const mongoOpMsg = 2013
+
+// checkMongoDB runs the hello command (falling back to isMaster on older
+// servers) and reports the node's replica set role. The "role" option
+// (primary, secondary, arbiter, standalone, mongos) fails the check when the
+// node reports a different role.
+func checkMongoDB(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	start := time.Now()
+
+	u, err := url.Parse(test.URL)
+	if err != nil || u.Hostname() == "" {
+		return "ERROR", 0, "Invalid URL"
+	}
+
+	conn, err := dial(ctx, test, "tcp", hostPort(u, "27017"))
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("Connect error: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(testTimeout(test)))
+
+	var reply map[string]interface{}
+	for i, command := range []string{"hello", "isMaster"} {
+		reply, err = mongoCommand(conn, int32(i+1), command)
+		if err != nil {
+			return "FAIL", 0, fmt.Sprintf("%s error: %v", command, err)
+		}
+		if mongoNumber(reply["ok"]) == 1 {
+			break
+		}
+	}
+	if mongoNumber(reply["ok"]) != 1 {
+		return "FAIL", time.Since(start), fmt.Sprintf("Command failed: %v", reply["errmsg"])
+	}
+	latency := time.Since(start)
+
+	role := mongoRole(reply)
+	setDetail(test, "role", role)
+	if setName, ok := reply["setName"].(string); ok {
+		setDetail(test, "replset", setName)
+	}
+
+	if want := test.Options["role"]; want != "" && want != role {
+		return "FAIL", latency, fmt.Sprintf("Role is %s, expected %s", role, want)
+	}
+
+	return "OK", latency, ""
+}
+
+// mongoRole classifies a hello/isMaster reply.
+func mongoRole(reply map[string]interface{}) string {
+	switch {
+	case reply["msg"] == "isdbgrid":
+		return "mongos"
+	case reply["arbiterOnly"] == true:
+		return "arbiter"
+	case reply["setName"] == nil && (reply["isWritablePrimary"] == true || reply["ismaster"] == true):
+		return "standalone"
+	case reply["isWritablePrimary"] == true || reply["ismaster"] == true:
+		return "primary"
+	case reply["secondary"] == true:
+		return "secondary"
+	}
+	return "other"
+}
+
+// mongoCommand sends {command: 1, $db: "admin"} as an OP_MSG and decodes
+// the reply document.
+func mongoCommand(conn io.ReadWriter, requestID int32, command string) (map[string]interface{}, error) {
+	doc := bsonDocument([][2]interface{}{{command, int32(1)}, {"$db", "admin"}})
+
+	msg := make([]byte, 16, 16+5+len(doc))
+	binary.LittleEndian.PutUint32(msg[4:], uint32(requestID))
+	binary.LittleEndian.PutUint32(msg[12:], mongoOpMsg)
+	msg = append(msg, 0, 0, 0, 0, 0) // flagBits, section kind 0
+	msg = append(msg, doc...)
+	binary.LittleEndian.PutUint32(msg[0:], uint32(len(msg)))
+	if _, err := conn.Write(msg); err != nil {
+		return nil, err
+	}
+
+	var header [16]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		return nil, err
+	}
+	length := binary.LittleEndian.Uint32(header[0:])
+	if length < 21 || length > 48<<20 {
+		return nil, fmt.Errorf("invalid reply length %d", length)
+	}
+	if op := binary.LittleEndian.Uint32(header[12:]); op != mongoOpMsg {
+		return nil, fmt.Errorf("unexpected reply opcode %d", op)
+	}
+	body := make([]byte, length-16)
+	if _, err := io.ReadFull(conn, body); err != nil {
+		return nil, err
+	}
+	if body[4] != 0 {
+		return nil, fmt.Errorf("unexpected section kind %d", body[4])
+	}
+	return bsonDecode(body[5:])
+}
+
+// bsonDocument encodes an ordered list of string, int32 and bool fields.
+func bsonDocument(fields [][2]interface{}) []byte {
+	var b bytes.Buffer
+	b.Write([]byte{0, 0, 0, 0})
+	for _, f := range fields {
+		name := f[0].(string)
+		switch v := f[1].(type) {
+		case int32:
+			b.WriteByte(0x10)
+			b.WriteString(name)
+			b.WriteByte(0)
+			binary.Write(&b, binary.LittleEndian, v)
+		case string:
+			b.WriteByte(0x02)
+			b.WriteString(name)
+			b.WriteByte(0)
+			binary.Write(&b, binary.LittleEndian, int32(len(v)+1))
+			b.WriteString(v)
+			b.WriteByte(0)
+		case bool:
+			b.WriteByte(0x08)
+			b.WriteString(name)
+			b.WriteByte(0)
+			if v {
+				b.WriteByte(1)
+			} else {
+				b.WriteByte(0)
+			}
+		}
+	}
+	b.WriteByte(0)
+	doc := b.Bytes()
+	binary.LittleEndian.PutUint32(doc, uint32(len(doc)))
+	return doc
+}
+
+// bsonDecode decodes the top-level scalar fields of a BSON document.
+// Strings, booleans and numbers are returned as Go values; other types are
+// skipped.
+func bsonDecode(doc []byte) (map[string]interface{}, error) {
+	if len(doc) < 5 {
+		return nil, fmt.Errorf("truncated document")
+	}
+	n := int(binary.LittleEndian.Uint32(doc))
+	if n < 5 || n > len(doc) {
+		return nil, fmt.Errorf("invalid document length %d", n)
+	}
+	doc = doc[4:n]
+	fields := make(map[string]interface{})
+	for len(doc) > 1 {
+		typ := doc[0]
+		name, rest, ok := bytes.Cut(doc[1:], []byte{0})
+		if !ok {
+			return nil, fmt.Errorf("truncated field name")
+		}
+		var size int
+		switch typ {
+		case 0x01: // double
+			size = 8
+			if len(rest) >= size {
+				fields[string(name)] = math.Float64frombits(binary.LittleEndian.Uint64(rest))
+			}
+		case 0x02, 0x0D, 0x0E: // string, JavaScript, symbol
+			if len(rest) < 4 {
+				return nil, fmt.Errorf("truncated string")
+			}
+			size = 4 + int(binary.LittleEndian.Uint32(rest))
+			if typ == 0x02 && len(rest) >= size && size > 4 {
+				fields[string(name)] = string(rest[4 : size-1])
+			}
+		case 0x03, 0x04: // document, array
+			if len(rest) < 4 {
+				return nil, fmt.Errorf("truncated document")
+			}
+			size = int(binary.LittleEndian.Uint32(rest))
+		case 0x05: // binary
+			if len(rest) < 4 {
+				return nil, fmt.Errorf("truncated binary")
+			}
+			size = 5 + int(binary.LittleEndian.Uint32(rest))
+		case 0x07: // ObjectId
+			size = 12
+		case 0x08: // bool
+			size = 1
+			if len(rest) >= size {
+				fields[string(name)] = rest[0] == 1
+			}
+		case 0x09, 0x11: // datetime, timestamp
+			size = 8
+		case 0x0A, 0x06, 0xFF, 0x7F: // null, undefined, min/max key
+			size = 0
+		case 0x10: // int32
+			size = 4
+			if len(rest) >= size {
+				fields[string(name)] = int32(binary.LittleEndian.Uint32(rest))
+			}
+		case 0x12: // int64
+			size = 8
+			if len(rest) >= size {
+				fields[string(name)] = int64(binary.LittleEndian.Uint64(rest))
+			}
+		case 0x13: // decimal128
+			size = 16
+		default:
+			return nil, fmt.Errorf("unsupported BSON type 0x%02x", typ)
+		}
+		if len(rest) < size {
+			return nil, fmt.Errorf("truncated field %s", name)
+		}
+		doc = rest[size:]
+	}
+	return fields, nil
+}
+
+// mongoNumber converts a decoded BSON number to float64.
+func mongoNumber(v interface{}) float64 {
+	switch n := v.(type) {
+	case float64:
+		return n
+	case int32:
+		return float64(n)
+	case int64:
+		return float64(n)
+	}
+	return 0
+}
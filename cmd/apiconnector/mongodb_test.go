@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+)
+
+// fakeMongo answers every OP_MSG with reply.
+func fakeMongo(reply []byte) func(conn net.Conn) {
+	return func(conn net.Conn) {
+		for {
+			var header [16]byte
+			if _, err := io.ReadFull(conn, header[:]); err != nil {
+				return
+			}
+			body := make([]byte, binary.LittleEndian.Uint32(header[:])-16)
+			if _, err := io.ReadFull(conn, body); err != nil {
+				return
+			}
+			msg := make([]byte, 16)
+			binary.LittleEndian.PutUint32(msg[8:], binary.LittleEndian.Uint32(header[4:]))
+			binary.LittleEndian.PutUint32(msg[12:], mongoOpMsg)
+			msg = append(append(msg, 0, 0, 0, 0, 0), reply...)
+			binary.LittleEndian.PutUint32(msg, uint32(len(msg)))
+			conn.Write(msg)
+		}
+	}
+}
+
+func TestCheckMongoDB(t *testing.T) {
+	secondary := bsonDocument([][2]interface{}{
+		{"isWritablePrimary", false},
+		{"secondary", true},
+		{"setName", "rs0"},
+		{"ok", int32(1)},
+	})
+
+	tests := []struct {
+		options string
+		status  string
+	}{
+		{"", "OK"},
+		{" role=secondary", "OK"},
+		{" role=primary", "FAIL"},
+	}
+
+	for _, tt := range tests {
+		addr := serveOnce(t, fakeMongo(secondary))
+		test := parseTestConfig("db=mongodb://" + addr + tt.options)
+		status, _, errMsg := checkMongoDB(context.Background(), &test)
+		if status != tt.status {
+			t.Errorf("checkMongoDB(%q) = %s (%s), want %s", tt.options, status, errMsg, tt.status)
+		}
+		if test.Details["role"] != "secondary" || test.Details["replset"] != "rs0" {
+			t.Errorf("Details = %v, want role=secondary replset=rs0", test.Details)
+		}
+	}
+}
+
+func TestMongoRole(t *testing.T) {
+	tests := []struct {
+		reply map[string]interface{}
+		role  string
+	}{
+		{map[string]interface{}{"ismaster": true}, "standalone"},
+		{map[string]interface{}{"isWritablePrimary": true, "setName": "rs0"}, "primary"},
+		{map[string]interface{}{"secondary": true, "setName": "rs0"}, "secondary"},
+		{map[string]interface{}{"arbiterOnly": true, "setName": "rs0"}, "arbiter"},
+		{map[string]interface{}{"ismaster": true, "msg": "isdbgrid"}, "mongos"},
+	}
+	for _, tt := range tests {
+		if got := mongoRole(tt.reply); got != tt.role {
+			t.Errorf("mongoRole(%v) = %s, want %s", tt.reply, got, tt.role)
+		}
+	}
+}
+
+func TestBSONDecodeLength(t *testing.T) {
+	for _, n := range []uint32{0, 3, 4, 6} {
+		doc := []byte{0, 0, 0, 0, 0}
+		binary.LittleEndian.PutUint32(doc, n)
+		if _, err := bsonDecode(doc); err == nil {
+			t.Errorf("bsonDecode with length %d = nil, want an error", n)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// MySQL capability flags used in the handshake response.
+const (
+	mysqlClientLongPassword     = 0x00000001
+	mysqlClientConnectWithDB    = 0x00000008
+	mysqlClientProtocol41       = 0x00000200
+	mysqlClientSecureConnection = 0x00008000
+	mysqlClientPluginAuth       = 0x00080000
+)
+
+// checkMySQL reads the MySQL/MariaDB server greeting and, when the URL
+// carries a username, completes authentication with mysql_native_password
+// or caching_sha2_password. The server version is reported as a detail.
+func checkMySQL(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	start := time.Now()
+
+	u, err := url.Parse(test.URL)
+	if err != nil || u.Hostname() == "" {
+		return "ERROR", 0, "Invalid URL"
+	}
+
+	conn, err := dial(ctx, test, "tcp", hostPort(u, "3306"))
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("Connect error: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(testTimeout(test)))
+
+	br := bufio.NewReader(conn)
+	greeting, _, err := mysqlReadPacket(br)
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("Greeting read error: %v", err)
+	}
+	if len(greeting) > 0 && greeting[0] == 0xFF {
+		return "FAIL", time.Since(start), mysqlErrorMessage(greeting)
+	}
+	version, scramble, plugin, err := mysqlParseGreeting(greeting)
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("Invalid greeting: %v", err)
+	}
+	setDetail(test, "version", version)
+	setDetail(test, "handshake", formatDuration(time.Since(start)))
+
+	user := u.User.Username()
+	if user == "" {
+		return "OK", time.Since(start), ""
+	}
+	password, _ := u.User.Password()
+	database := strings.TrimPrefix(u.Path, "/")
+
+	if plugin != "mysql_native_password" && plugin != "caching_sha2_password" {
+		plugin = "mysql_native_password"
+	}
+	flags := uint32(mysqlClientLongPassword | mysqlClientProtocol41 | mysqlClientSecureConnection | mysqlClientPluginAuth)
+	if database != "" {
+		flags |= mysqlClientConnectWithDB
+	}
+	authData := mysqlScramble(plugin, password, scramble)
+
+	var resp []byte
+	resp = binary.LittleEndian.AppendUint32(resp, flags)
+	resp = binary.LittleEndian.AppendUint32(resp, 1<<24)
+	resp = append(resp, 45) // utf8mb4_general_ci
+	resp = append(resp, make([]byte, 23)...)
+	resp = append(append(resp, user...), 0)
+	resp = append(append(resp, byte(len(authData))), authData...)
+	if database != "" {
+		resp = append(append(resp, database...), 0)
+	}
+	resp = append(append(resp, plugin...), 0)
+
+	seq := byte(1)
+	if err := mysqlWritePacket(conn, seq, resp); err != nil {
+		return "FAIL", 0, fmt.Sprintf("Handshake write error: %v", err)
+	}
+
+	for {
+		packet, s, err := mysqlReadPacket(br)
+		if err != nil {
+			return "FAIL", 0, fmt.Sprintf("Authentication read error: %v", err)
+		}
+		seq = s + 1
+		if len(packet) == 0 {
+			return "FAIL", 0, "Empty authentication response"
+		}
+
+		var reply []byte
+		switch {
+		case packet[0] == 0x00:
+			setDetail(test, "auth", "ok")
+			return "OK", time.Since(start), ""
+		case packet[0] == 0xFF:
+			return "FAIL", time.Since(start), mysqlErrorMessage(packet)
+		case packet[0] == 0xFE: // AuthSwitchRequest
+			name, data, _ := bytes.Cut(packet[1:], []byte{0})
+			plugin = string(name)
+			scramble = bytes.TrimRight(data, "\x00")
+			if plugin != "mysql_native_password" && plugin != "caching_sha2_password" {
+				return "FAIL", 0, fmt.Sprintf("Unsupported auth plugin %s", plugin)
+			}
+			reply = mysqlScramble(plugin, password, scramble)
+		case packet[0] == 0x01 && len(packet) == 2 && packet[1] == 0x03:
+			// caching_sha2_password fast auth succeeded; an OK packet follows.
+			continue
+		case packet[0] == 0x01 && len(packet) == 2 && packet[1] == 0x04:
+			// Full authentication: request the server's RSA key.
+			reply = []byte{0x02}
+		case packet[0] == 0x01:
+			encrypted, err := mysqlEncryptPassword(packet[1:], password, scramble)
+			if err != nil {
+				return "FAIL", 0, fmt.Sprintf("Password encryption error: %v", err)
+			}
+			reply = encrypted
+		default:
+			return "FAIL", 0, fmt.Sprintf("Unexpected authentication packet 0x%02x", packet[0])
+		}
+		if err := mysqlWritePacket(conn, seq, reply); err != nil {
+			return "FAIL", 0, fmt.Sprintf("Authentication write error: %v", err)
+		}
+	}
+}
+
+// mysqlParseGreeting extracts the server version, auth scramble and default
+// auth plugin from a protocol 10 handshake packet.
+func mysqlParseGreeting(p []byte) (string, []byte, string, error) {
+	if len(p) < 1 || p[0] != 10 {
+		return "", nil, "", fmt.Errorf("unsupported protocol version")
+	}
+	version, rest, ok := bytes.Cut(p[1:], []byte{0})
+	if !ok || len(rest) < 4+8+1+2 {
+		return "", nil, "", fmt.Errorf("truncated packet")
+	}
+	scramble := append([]byte(nil), rest[4:12]...)
+	rest = rest[13:]
+	if len(rest) < 2+1+2+2+1+10 {
+		return string(version), scramble, "mysql_native_password", nil
+	}
+	authLen := int(rest[7])
+	rest = rest[18:]
+	part2 := max(13, authLen-8)
+	if len(rest) < part2 {
+		return "", nil, "", fmt.Errorf("truncated scramble")
+	}
+	scramble = append(scramble, bytes.TrimRight(rest[:part2], "\x00")...)
+	plugin, _, _ := bytes.Cut(rest[part2:], []byte{0})
+	return string(version), scramble, string(plugin), nil
+}
+
+// mysqlScramble computes the auth response for plugin.
+func mysqlScramble(plugin, password string, scramble []byte) []byte {
+	if password == "" {
+		return nil
+	}
+	if plugin == "caching_sha2_password" {
+		// XOR(SHA256(password), SHA256(SHA256(SHA256(password)), scramble))
+		h1 := sha256.Sum256([]byte(password))
+		h2 := sha256.Sum256(h1[:])
+		h3 := sha256.Sum256(append(h2[:], scramble...))
+		for i := range h1 {
+			h1[i] ^= h3[i]
+		}
+		return h1[:]
+	}
+	// SHA1(password) XOR SHA1(scramble + SHA1(SHA1(password)))
+	h1 := sha1.Sum([]byte(password))
+	h2 := sha1.Sum(h1[:])
+	h3 := sha1.Sum(append(append([]byte(nil), scramble...), h2[:]...))
+	for i := range h1 {
+		h1[i] ^= h3[i]
+	}
+	return h1[:]
+}
+
+// mysqlEncryptPassword encrypts the password with the server's RSA public
+// key for caching_sha2_password full authentication.
+func mysqlEncryptPassword(pemKey []byte, password string, scramble []byte) ([]byte, error) {
+	block, _ := pem.Decode(pemKey)
+	if block == nil {
+		return nil, fmt.Errorf("invalid public key")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key is not RSA")
+	}
+	plain := append([]byte(password), 0)
+	for i := range plain {
+		plain[i] ^= scramble[i%len(scramble)]
+	}
+	return rsa.EncryptOAEP(sha1.New(), rand.Reader, rsaKey, plain, nil)
+}
+
+// mysqlReadPacket reads one packet and returns its payload and sequence id.
+func mysqlReadPacket(r io.Reader) ([]byte, byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, 0, err
+	}
+	length := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, 0, err
+	}
+	return payload, header[3], nil
+}
+
+// mysqlWritePacket writes payload as a single packet with sequence id seq.
+func mysqlWritePacket(w io.Writer, seq byte, payload []byte) error {
+	n := len(payload)
+	packet := append([]byte{byte(n), byte(n >> 8), byte(n >> 16), seq}, payload...)
+	_, err := w.Write(packet)
+	return err
+}
+
+// mysqlErrorMessage formats an ERR packet.
+func mysqlErrorMessage(p []byte) string {
+	if len(p) < 3 {
+		return "Server error"
+	}
+	code := binary.LittleEndian.Uint16(p[1:3])
+	message := p[3:]
+	if len(message) >= 6 && message[0] == '#' {
+		message = message[6:]
+	}
+	return fmt.Sprintf("Server error %d: %s", code, message)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"testing"
+)
+
+// mysqlGreeting builds a protocol 10 handshake advertising plugin.
+func mysqlGreeting(version string, scramble []byte, plugin string) []byte {
+	p := append([]byte{10}, version...)
+	p = append(p, 0, 1, 0, 0, 0)
+	p = append(p, scramble[:8]...)
+	p = append(p, 0, 0xFF, 0xF7, 45, 2, 0, 0xFF, 0x81, byte(len(scramble)+1))
+	p = append(p, make([]byte, 10)...)
+	p = append(p, scramble[8:]...)
+	p = append(p, 0)
+	return append(append(p, plugin...), 0)
+}
+
+func TestCheckMySQLNativePassword(t *testing.T) {
+	scramble := []byte("abcdefghijklmnopqrst")
+	addr := serveOnce(t, func(conn net.Conn) {
+		mysqlWritePacket(conn, 0, mysqlGreeting("8.0.36", scramble, "mysql_native_password"))
+		resp, seq, err := mysqlReadPacket(bufio.NewReader(conn))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if !bytes.Contains(resp, mysqlScramble("mysql_native_password", "secret", scramble)) {
+			mysqlWritePacket(conn, seq+1, append([]byte{0xFF, 0x15, 0x04}, "#28000Access denied"...))
+			return
+		}
+		mysqlWritePacket(conn, seq+1, []byte{0, 0, 0, 2, 0, 0, 0})
+	})
+
+	test := &ConnectionTest{URL: "mysql://root:secret@" + addr + "/app"}
+	status, _, errMsg := checkMySQL(context.Background(), test)
+	if status != "OK" {
+		t.Fatalf("checkMySQL = %s (%s), want OK", status, errMsg)
+	}
+	if test.Details["version"] != "8.0.36" || test.Details["auth"] != "ok" {
+		t.Errorf("Details = %v, want version=8.0.36 auth=ok", test.Details)
+	}
+}
+
+func TestCheckMySQLGreetingOnly(t *testing.T) {
+	addr := serveOnce(t, func(conn net.Conn) {
+		mysqlWritePacket(conn, 0, mysqlGreeting("10.11.6-MariaDB", []byte("abcdefghijklmnopqrst"), "mysql_native_password"))
+	})
+
+	test := &ConnectionTest{URL: "mysql://" + addr}
+	if status, _, errMsg := checkMySQL(context.Background(), test); status != "OK" {
+		t.Fatalf("checkMySQL = %s (%s), want OK", status, errMsg)
+	}
+	if test.Details["version"] != "10.11.6-MariaDB" {
+		t.Errorf("version = %q, want 10.11.6-MariaDB", test.Details["version"])
+	}
+}
+
+func TestCheckMySQLErrorPacket(t *testing.T) {
+	addr := serveOnce(t, func(conn net.Conn) {
+		mysqlWritePacket(conn, 0, append([]byte{0xFF, 0x10, 0x04}, "Too many connections"...))
+	})
+
+	test := &ConnectionTest{URL: "mysql://" + addr}
+	status, _, errMsg := checkMySQL(context.Background(), test)
+	if status != "FAIL" || errMsg != "Server error 1040: Too many connections" {
+		t.Errorf("checkMySQL = %s (%s), want FAIL with error 1040", status, errMsg)
+	}
+}
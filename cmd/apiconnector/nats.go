@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// natsInfo holds the fields of the server INFO banner we report on.
+type natsInfo struct {
+	Version      string `json:"version"`
+	AuthRequired bool   `json:"auth_required"`
+	TLSRequired  bool   `json:"tls_required"`
+}
+
+// natsConnect is the client CONNECT payload.
+type natsConnect struct {
+	Verbose     bool   `json:"verbose"`
+	Pedantic    bool   `json:"pedantic"`
+	TLSRequired bool   `json:"tls_required"`
+	Name        string `json:"name"`
+	Lang        string `json:"lang"`
+	Version     string `json:"version"`
+	Protocol    int    `json:"protocol"`
+	User        string `json:"user,omitempty"`
+	Pass        string `json:"pass,omitempty"`
+	AuthToken   string `json:"auth_token,omitempty"`
+}
+
+// checkNATS reads the NATS INFO banner, upgrades to TLS if the server
+// requires it, then sends CONNECT and PING and expects PONG. URL userinfo
+// supplies user:password, or a token when no password is given.
+func checkNATS(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	start := time.Now()
+
+	u, err := url.Parse(test.URL)
+	if err != nil || u.Hostname() == "" {
+		return "ERROR", 0, "Invalid URL"
+	}
+
+	conn, err := dial(ctx, test, "tcp", hostPort(u, "4222"))
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("Connect error: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(testTimeout(test)))
+
+	br := bufio.NewReader(conn)
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("INFO read error: %v", err)
+	}
+	payload, ok := strings.CutPrefix(strings.TrimSpace(line), "INFO ")
+	if !ok {
+		return "FAIL", 0, fmt.Sprintf("Unexpected banner %q", strings.TrimSpace(line))
+	}
+	var info natsInfo
+	if err := json.Unmarshal([]byte(payload), &info); err != nil {
+		return "FAIL", 0, fmt.Sprintf("Invalid INFO: %v", err)
+	}
+	setDetail(test, "version", info.Version)
+	setDetail(test, "auth_required", strconv.FormatBool(info.AuthRequired))
+	setDetail(test, "tls_required", strconv.FormatBool(info.TLSRequired))
+
+	if info.TLSRequired {
+		conn, err = tlsClient(ctx, test, conn, u.Hostname())
+		if err != nil {
+			return "FAIL", 0, fmt.Sprintf("TLS handshake error: %v", err)
+		}
+		br = bufio.NewReader(conn)
+	}
+
+	connect := natsConnect{
+		TLSRequired: info.TLSRequired,
+		Name:        "apiconnector",
+		Lang:        "go",
+		Version:     "1.0.0",
+		Protocol:    1,
+	}
+	if password, ok := u.User.Password(); ok {
+		connect.User, connect.Pass = u.User.Username(), password
+	} else if u.User != nil {
+		connect.AuthToken = u.User.Username()
+	}
+	body, _ := json.Marshal(connect)
+	if _, err := io.WriteString(conn, "CONNECT "+string(body)+"\r\nPING\r\n"); err != nil {
+		return "FAIL", 0, fmt.Sprintf("CONNECT write error: %v", err)
+	}
+
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return "FAIL", 0, fmt.Sprintf("PONG read error: %v", err)
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return "OK", time.Since(start), ""
+		case strings.HasPrefix(line, "-ERR"):
+			return "FAIL", time.Since(start), fmt.Sprintf("Server error: %s", strings.Trim(strings.TrimSpace(line[4:]), "'"))
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+)
+
+// fakeNATS requires the token "t0ken" when auth is true.
+func fakeNATS(auth bool) func(conn net.Conn) {
+	return func(conn net.Conn) {
+		if auth {
+			conn.Write([]byte(`INFO {"server_id":"x","version":"2.10.11","auth_required":true}` + "\r\n"))
+		} else {
+			conn.Write([]byte(`INFO {"server_id":"x","version":"2.10.11"}` + "\r\n"))
+		}
+		br := bufio.NewReader(conn)
+		connect, _ := br.ReadString('\n')
+		br.ReadString('\n')
+		if auth && !strings.Contains(connect, `"auth_token":"t0ken"`) {
+			conn.Write([]byte("-ERR 'Authorization Violation'\r\n"))
+			return
+		}
+		conn.Write([]byte("PONG\r\n"))
+	}
+}
+
+func TestCheckNATS(t *testing.T) {
+	tests := []struct {
+		auth     bool
+		userinfo string
+		status   string
+	}{
+		{false, "", "OK"},
+		{true, "t0ken@", "OK"},
+		{true, "", "FAIL"},
+	}
+
+	for _, tt := range tests {
+		addr := serveOnce(t, fakeNATS(tt.auth))
+		test := &ConnectionTest{URL: "nats://" + tt.userinfo + addr}
+		status, _, errMsg := checkNATS(context.Background(), test)
+		if status != tt.status {
+			t.Errorf("checkNATS(%q) = %s (%s), want %s", test.URL, status, errMsg, tt.status)
+		}
+		if test.Details["version"] != "2.10.11" {
+			t.Errorf("version = %q, want 2.10.11", test.Details["version"])
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/md4"
+)
+
+// ntlmFlags are the NTLMSSP negotiate flags sent and answered: Unicode,
+// request target, NTLM, always sign, extended session security, target info,
+// 128-bit and 56-bit.
+const ntlmFlags = 0xa0888205
+
+// ntlmSignature opens every NTLMSSP message.
+var ntlmSignature = []byte("NTLMSSP\x00")
+
+// ntlmTransport performs NTLMv2 authentication for the "ntlm_auth" option.
+// A request refused with a 401 offering NTLM (or Negotiate, which accepts
+// raw NTLM tokens) is replayed with a negotiate message and then with the
+// authenticate message answering the server's challenge. Both replays rely
+// on the transport reusing the connection, as NTLM authenticates
+// connections rather than requests.
+type ntlmTransport struct {
+	base                   http.RoundTripper
+	domain, user, password string
+}
+
+// newNTLMTransport wraps base for an "ntlm_auth=[DOMAIN\]user[:password]"
+// option; without a password, $NTLM_AUTH_PASSWORD is used.
+func newNTLMTransport(base http.RoundTripper, auth string) ntlmTransport {
+	t := ntlmTransport{base: base}
+	account, password, ok := strings.Cut(auth, ":")
+	if !ok {
+		password = os.Getenv("NTLM_AUTH_PASSWORD")
+	}
+	t.password = password
+	if domain, user, ok := strings.Cut(account, `\`); ok {
+		t.domain, t.user = domain, user
+	} else {
+		t.user = account
+	}
+	return t
+}
+
+func (t ntlmTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || (req.Body != nil && req.GetBody == nil) {
+		return resp, err
+	}
+	scheme := ""
+	for _, s := range authSchemes(resp.Header.Values("WWW-Authenticate")) {
+		if s == "NTLM" || (s == "Negotiate" && scheme == "") {
+			scheme = s
+		}
+	}
+	if scheme == "" {
+		return resp, nil
+	}
+
+	negotiate := make([]byte, 32)
+	copy(negotiate, ntlmSignature)
+	binary.LittleEndian.PutUint32(negotiate[8:], 1)
+	binary.LittleEndian.PutUint32(negotiate[12:], ntlmFlags)
+	if resp, err = t.replay(req, resp, scheme, negotiate); err != nil {
+		return nil, err
+	}
+
+	var challenge []byte
+	for _, v := range resp.Header.Values("WWW-Authenticate") {
+		if token, ok := strings.CutPrefix(v, scheme+" "); ok {
+			challenge, _ = base64.StdEncoding.DecodeString(strings.TrimSpace(token))
+		}
+	}
+	if resp.StatusCode != http.StatusUnauthorized || challenge == nil {
+		return resp, nil
+	}
+	authenticate, err := t.authenticate(challenge)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return t.replay(req, resp, scheme, authenticate)
+}
+
+// replay drains and closes prev, so its connection can be reused, and sends
+// req again with an Authorization header carrying token.
+func (t ntlmTransport) replay(req *http.Request, prev *http.Response, scheme string, token []byte) (*http.Response, error) {
+	io.Copy(io.Discard, prev.Body)
+	prev.Body.Close()
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		var err error
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	retry.Header.Set("Authorization", scheme+" "+base64.StdEncoding.EncodeToString(token))
+	return t.base.RoundTrip(retry)
+}
+
+// authenticate builds the NTLMv2 authenticate message answering a
+// challenge message.
+func (t ntlmTransport) authenticate(challenge []byte) ([]byte, error) {
+	if len(challenge) < 48 || !bytes.Equal(challenge[:8], ntlmSignature) || binary.LittleEndian.Uint32(challenge[8:]) != 2 {
+		return nil, fmt.Errorf("NTLM: malformed challenge")
+	}
+	serverChallenge := challenge[24:32]
+	infoLen := int(binary.LittleEndian.Uint16(challenge[40:]))
+	infoOff := int(binary.LittleEndian.Uint32(challenge[44:]))
+	if infoOff+infoLen > len(challenge) {
+		return nil, fmt.Errorf("NTLM: malformed challenge")
+	}
+	targetInfo := challenge[infoOff : infoOff+infoLen]
+
+	clientChallenge := make([]byte, 8)
+	if _, err := rand.Read(clientChallenge); err != nil {
+		return nil, err
+	}
+	// Windows FILETIME: 100ns intervals since 1601-01-01.
+	timestamp := uint64(time.Now().UnixNano()/100 + 116444736000000000)
+	ntResponse, lmResponse := ntlmV2Response(t.domain, t.user, t.password, serverChallenge, clientChallenge, targetInfo, timestamp)
+
+	fields := [][]byte{lmResponse, ntResponse, ntlmUTF16(t.domain), ntlmUTF16(t.user), nil, nil}
+	msg := make([]byte, 64)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 3)
+	for i, f := range fields {
+		hdr := msg[12+8*i:]
+		binary.LittleEndian.PutUint16(hdr, uint16(len(f)))
+		binary.LittleEndian.PutUint16(hdr[2:], uint16(len(f)))
+		binary.LittleEndian.PutUint32(hdr[4:], uint32(len(msg)))
+		msg = append(msg, f...)
+	}
+	binary.LittleEndian.PutUint32(msg[60:], ntlmFlags)
+	return msg, nil
+}
+
+// ntlmV2Response computes the NTLMv2 and LMv2 challenge responses.
+func ntlmV2Response(domain, user, password string, serverChallenge, clientChallenge, targetInfo []byte, timestamp uint64) (nt, lm []byte) {
+	h := md4.New()
+	h.Write(ntlmUTF16(password))
+	ntowf := ntlmHMAC(h.Sum(nil), ntlmUTF16(strings.ToUpper(user)+domain))
+
+	blob := []byte{1, 1, 0, 0, 0, 0, 0, 0}
+	blob = binary.LittleEndian.AppendUint64(blob, timestamp)
+	blob = append(blob, clientChallenge...)
+	blob = append(blob, 0, 0, 0, 0)
+	blob = append(blob, targetInfo...)
+	blob = append(blob, 0, 0, 0, 0)
+
+	proof := ntlmHMAC(ntowf, serverChallenge, blob)
+	lm = append(ntlmHMAC(ntowf, serverChallenge, clientChallenge), clientChallenge...)
+	return append(proof, blob...), lm
+}
+
+func ntlmHMAC(key []byte, data ...[]byte) []byte {
+	mac := hmac.New(md5.New, key)
+	for _, d := range data {
+		mac.Write(d)
+	}
+	return mac.Sum(nil)
+}
+
+// ntlmUTF16 encodes s as UTF-16LE.
+func ntlmUTF16(s string) []byte {
+	var b []byte
+	for _, r := range utf16.Encode([]rune(s)) {
+		b = binary.LittleEndian.AppendUint16(b, r)
+	}
+	return b
+}
+
+// authSchemes lists the authentication schemes offered by WWW-Authenticate
+// or Proxy-Authenticate values, which may each carry several challenges.
+func authSchemes(values []string) []string {
+	var schemes []string
+	seen := make(map[string]bool)
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			word, _, _ := strings.Cut(strings.TrimSpace(part), " ")
+			if word == "" || strings.ContainsAny(word, `="`) || seen[word] {
+				continue
+			}
+			seen[word] = true
+			schemes = append(schemes, word)
+		}
+	}
+	return schemes
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/md4"
+)
+
+// ntlmServer accepts user CORP\alice with password "Winter2024!" over NTLM,
+// offering it under the scheme named by the "scheme" query parameter.
+func ntlmServer(t *testing.T) *httptest.Server {
+	serverChallenge := []byte("8bytes!!")
+	targetInfo := []byte{2, 0, 8, 0, 'C', 0, 'O', 0, 'R', 0, 'P', 0, 0, 0, 0, 0}
+	var mu sync.Mutex
+	negotiated := make(map[string]bool)
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scheme := r.URL.Query().Get("scheme")
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), scheme+" ")
+		msg, _ := base64.StdEncoding.DecodeString(token)
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case len(msg) >= 12 && binary.LittleEndian.Uint32(msg[8:]) == 1:
+			negotiated[r.RemoteAddr] = true
+			challenge := make([]byte, 48)
+			copy(challenge, ntlmSignature)
+			binary.LittleEndian.PutUint32(challenge[8:], 2)
+			binary.LittleEndian.PutUint32(challenge[20:], ntlmFlags)
+			copy(challenge[24:], serverChallenge)
+			binary.LittleEndian.PutUint16(challenge[40:], uint16(len(targetInfo)))
+			binary.LittleEndian.PutUint16(challenge[42:], uint16(len(targetInfo)))
+			binary.LittleEndian.PutUint32(challenge[44:], 48)
+			challenge = append(challenge, targetInfo...)
+			w.Header().Set("WWW-Authenticate", scheme+" "+base64.StdEncoding.EncodeToString(challenge))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+
+		case len(msg) >= 64 && binary.LittleEndian.Uint32(msg[8:]) == 3 && negotiated[r.RemoteAddr]:
+			field := func(i int) []byte {
+				n := binary.LittleEndian.Uint16(msg[12+8*i:])
+				off := binary.LittleEndian.Uint32(msg[16+8*i:])
+				return msg[off : off+uint32(n)]
+			}
+			nt := field(1)
+			h := md4.New()
+			h.Write(ntlmUTF16("Winter2024!"))
+			ntowf := ntlmHMAC(h.Sum(nil), ntlmUTF16("ALICE"+"CORP"))
+			if bytes.Equal(field(2), ntlmUTF16("CORP")) && bytes.Equal(field(3), ntlmUTF16("alice")) &&
+				len(nt) > 16 && bytes.Equal(ntlmHMAC(ntowf, serverChallenge, nt[16:]), nt[:16]) && bytes.Contains(nt, targetInfo) {
+				return
+			}
+		}
+		w.Header().Add("WWW-Authenticate", scheme)
+		w.Header().Add("WWW-Authenticate", `Basic realm="corp"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+}
+
+func TestCheckHTTPNTLM(t *testing.T) {
+	srv := ntlmServer(t)
+	defer srv.Close()
+
+	tests := []struct {
+		target  string
+		status  string
+		schemes string
+	}{
+		{`/?scheme=NTLM ntlm_auth=CORP\alice:Winter2024!`, "OK", ""},
+		{`/?scheme=Negotiate ntlm_auth=CORP\alice:Winter2024!`, "OK", ""},
+		{`/?scheme=NTLM ntlm_auth=CORP\alice:wrong`, "HTTP 401", "NTLM,Basic"},
+		{`/?scheme=Negotiate`, "HTTP 401", "Negotiate,Basic"},
+	}
+	for _, tt := range tests {
+		test := parseTestConfig("iis=" + srv.URL + tt.target)
+		status, _, errMsg := checkHTTP(context.Background(), &test)
+		if status != tt.status || test.Details["auth_schemes"] != tt.schemes {
+			t.Errorf("checkHTTP(%s) = %s (%s) auth_schemes %q, want %s %q", tt.target, status, errMsg, test.Details["auth_schemes"], tt.status, tt.schemes)
+		}
+	}
+}
+
+func TestAuthSchemes(t *testing.T) {
+	got := strings.Join(authSchemes([]string{`Basic realm="a, b", Digest realm="x", qop="auth"`, "Negotiate", "NTLM"}), ",")
+	if got != "Basic,Digest,Negotiate,NTLM" {
+		t.Errorf("authSchemes = %q, want Basic,Digest,Negotiate,NTLM", got)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ntpEpochOffset is the number of seconds between 1900-01-01 and 1970-01-01.
+const ntpEpochOffset = 2208988800
+
+// checkNTP performs an SNTP query and reports the server stratum, the local
+// clock offset and the round-trip delay. The "max_offset" option (e.g.
+// "max_offset=500ms") fails the check when the offset exceeds it.
+func checkNTP(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	u, err := url.Parse(test.URL)
+	if err != nil || u.Hostname() == "" {
+		return "ERROR", 0, "Invalid URL"
+	}
+
+	var maxOffset time.Duration
+	if v := test.Options["max_offset"]; v != "" {
+		if maxOffset, err = time.ParseDuration(v); err != nil {
+			return "ERROR", 0, fmt.Sprintf("Invalid max_offset: %v", err)
+		}
+	}
+
+	conn, err := dial(ctx, test, "udp", hostPort(u, "123"))
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("Connect error: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(testTimeout(test)))
+
+	req := make([]byte, 48)
+	req[0] = 0<<6 | 4<<3 | 3 // LI 0, version 4, client mode
+	t1 := time.Now()
+	ntpPutTime(req[40:], t1)
+	if _, err := conn.Write(req); err != nil {
+		return "FAIL", 0, fmt.Sprintf("Send error: %v", err)
+	}
+
+	resp := make([]byte, 512)
+	n, err := conn.Read(resp)
+	t4 := time.Now()
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("Receive error: %v", err)
+	}
+	if n < 48 {
+		return "FAIL", 0, fmt.Sprintf("Short NTP response (%d bytes)", n)
+	}
+	if mode := resp[0] & 0x07; mode != 4 {
+		return "FAIL", 0, fmt.Sprintf("Unexpected NTP mode %d", mode)
+	}
+	if string(resp[24:32]) != string(req[40:48]) {
+		return "FAIL", 0, "Response does not match request"
+	}
+
+	stratum := resp[1]
+	setDetail(test, "stratum", strconv.Itoa(int(stratum)))
+	if stratum == 0 {
+		return "FAIL", 0, fmt.Sprintf("Kiss-of-death %s", strings.TrimRight(string(resp[12:16]), "\x00"))
+	}
+	if resp[0]>>6 == 3 {
+		return "FAIL", 0, "Server clock unsynchronized"
+	}
+
+	t2 := ntpTime(resp[32:])
+	t3 := ntpTime(resp[40:])
+	offset := (t2.Sub(t1) + t3.Sub(t4)) / 2
+	delay := t4.Sub(t1) - t3.Sub(t2)
+	setDetail(test, "offset", offset.Round(time.Microsecond).String())
+	setDetail(test, "delay", formatDuration(delay))
+
+	if maxOffset > 0 && (offset > maxOffset || offset < -maxOffset) {
+		return "FAIL", delay, fmt.Sprintf("Clock offset %s exceeds %s", offset.Round(time.Millisecond), maxOffset)
+	}
+
+	return "OK", delay, ""
+}
+
+// ntpPutTime writes t as a 64-bit NTP timestamp.
+func ntpPutTime(b []byte, t time.Time) {
+	secs := uint64(t.Unix() + ntpEpochOffset)
+	frac := uint64(t.Nanosecond()) << 32 / 1e9
+	binary.BigEndian.PutUint64(b, secs<<32|frac)
+}
+
+// ntpTime decodes a 64-bit NTP timestamp.
+func ntpTime(b []byte) time.Time {
+	v := binary.BigEndian.Uint64(b)
+	secs := int64(v>>32) - ntpEpochOffset
+	nanos := int64((v & 0xFFFFFFFF) * 1e9 >> 32)
+	return time.Unix(secs, nanos)
+}
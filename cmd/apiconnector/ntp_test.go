@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// serveNTP answers SNTP requests with a clock skewed by skew.
+func serveNTP(t *testing.T, skew time.Duration) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	go func() {
+		buf := make([]byte, 48)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil || n < 48 {
+				return
+			}
+			resp := make([]byte, 48)
+			resp[0] = 4<<3 | 4
+			resp[1] = 2
+			copy(resp[24:32], buf[40:48])
+			ntpPutTime(resp[32:], time.Now().Add(skew))
+			ntpPutTime(resp[40:], time.Now().Add(skew))
+			pc.WriteTo(resp, addr)
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+func TestCheckNTP(t *testing.T) {
+	tests := []struct {
+		skew    time.Duration
+		options string
+		status  string
+	}{
+		{0, "", "OK"},
+		{0, " max_offset=1s", "OK"},
+		{5 * time.Second, " max_offset=1s", "FAIL"},
+		{-5 * time.Second, " max_offset=1s", "FAIL"},
+		{0, " max_offset=soon", "ERROR"},
+	}
+
+	for _, tt := range tests {
+		test := parseTestConfig("ntp=ntp://" + serveNTP(t, tt.skew) + tt.options)
+		status, _, errMsg := checkNTP(context.Background(), &test)
+		if status != tt.status {
+			t.Errorf("checkNTP(skew %s%s) = %s (%s), want %s", tt.skew, tt.options, status, errMsg, tt.status)
+		}
+	}
+}
+
+func TestNTPTimeRoundTrip(t *testing.T) {
+	want := time.Date(2024, 3, 1, 12, 30, 45, 123456000, time.UTC)
+	b := make([]byte, 8)
+	ntpPutTime(b, want)
+	if got := ntpTime(b); got.Sub(want).Abs() > time.Microsecond {
+		t.Errorf("ntpTime(ntpPutTime(%v)) = %v", want, got)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// ocspStapleWarn is how close to its next update a stapled OCSP response
+// makes a check WARN: a server that has not refreshed it by then is about
+// to staple an expired response, or none.
+const ocspStapleWarn = 24 * time.Hour
+
+// oidMustStaple identifies the TLS Feature certificate extension (RFC 7633)
+// by which a certificate requires an OCSP staple.
+var oidMustStaple = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}
+
+// ocspStatus names the certificate statuses of an OCSP response.
+var ocspStatus = map[int]string{
+	ocsp.Good:    "good",
+	ocsp.Revoked: "revoked",
+	ocsp.Unknown: "unknown",
+}
+
+// checkRevocation applies the "ocsp" option to a TLS connection. The
+// "ocsp_staple" detail reports whether the server stapled an OCSP response;
+// a staple is validated and its status reported as "revocation", and one
+// within ocspStapleWarn of expiry, or a missing staple on a must-staple
+// certificate, makes the check WARN. With "ocsp=check" a certificate without
+// a staple is checked online, with its OCSP responder or else its CRL; an
+// unreachable responder only leaves "revocation=unknown". A revoked
+// certificate fails. It returns "" when the certificate is good, and
+// otherwise a status and message.
+func checkRevocation(ctx context.Context, test *ConnectionTest, state tls.ConnectionState) (string, string) {
+	mode := test.Options["ocsp"]
+	switch mode {
+	case "", "false":
+		return "", ""
+	case "true", "check":
+	default:
+		return "ERROR", fmt.Sprintf("Invalid ocsp %q", mode)
+	}
+	if len(state.PeerCertificates) == 0 {
+		return "", ""
+	}
+	leaf, issuer := state.PeerCertificates[0], certIssuer(state)
+
+	status := ""
+	if len(state.OCSPResponse) == 0 {
+		setDetail(test, "ocsp_staple", "no")
+		if mustStaple(leaf) {
+			setDetail(test, "must_staple", "missing")
+			status = "WARN"
+		}
+		if mode != "check" {
+			return status, ""
+		}
+		revocation, source, err := queryRevocation(ctx, test, leaf, issuer)
+		setDetail(test, "revocation", revocation)
+		if err != nil {
+			setDetail(test, "revocation_error", err.Error())
+			return status, ""
+		}
+		setDetail(test, "revocation_source", source)
+		if revocation == "revoked" {
+			return "FAIL", fmt.Sprintf("Certificate revoked (%s)", source)
+		}
+		return status, ""
+	}
+
+	setDetail(test, "ocsp_staple", "yes")
+	resp, err := ocsp.ParseResponseForCert(state.OCSPResponse, leaf, issuer)
+	if err != nil {
+		return "FAIL", fmt.Sprintf("Invalid stapled OCSP response: %v", err)
+	}
+	setDetail(test, "revocation", ocspStatus[resp.Status])
+	setDetail(test, "revocation_source", "staple")
+	if resp.Status == ocsp.Revoked {
+		return "FAIL", "Certificate revoked (staple)"
+	}
+	if !resp.NextUpdate.IsZero() {
+		setDetail(test, "staple_expires", resp.NextUpdate.UTC().Format(time.RFC3339))
+		if time.Until(resp.NextUpdate) < ocspStapleWarn {
+			status = "WARN"
+		}
+	}
+	return status, ""
+}
+
+// certIssuer returns the certificate that issued the leaf of a TLS
+// connection, from the verified chain or else the presented one, or nil.
+func certIssuer(state tls.ConnectionState) *x509.Certificate {
+	if len(state.VerifiedChains) > 0 && len(state.VerifiedChains[0]) > 1 {
+		return state.VerifiedChains[0][1]
+	}
+	if len(state.PeerCertificates) > 1 {
+		return state.PeerCertificates[1]
+	}
+	return nil
+}
+
+// mustStaple reports whether cert carries the must-staple TLS Feature
+// extension.
+func mustStaple(cert *x509.Certificate) bool {
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidMustStaple) {
+			return true
+		}
+	}
+	return false
+}
+
+// revocationClient returns the HTTP client for test's OCSP and CRL
+// requests, which connect as its HTTP checks do: through its proxy (see
+// httpProxy) and dial settings (see dial), within its timeout. The
+// responder's connection details are not the target's, so they are kept
+// off test.
+func revocationClient(test *ConnectionTest) (*http.Client, error) {
+	scratch := *test
+	scratch.Details = nil
+	proxyFunc, err := httpProxy(&scratch)
+	if err != nil {
+		return nil, err
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dial(ctx, &scratch, network, addr)
+	}
+	t.Proxy = proxyFunc
+	return &http.Client{Timeout: testTimeout(test), Transport: t}, nil
+}
+
+// queryRevocation asks the OCSP responder named in leaf for its status, or
+// else checks the first CRL distribution point, and returns the status and
+// which source gave it. The requests go out as test's own would (see
+// revocationClient).
+func queryRevocation(ctx context.Context, test *ConnectionTest, leaf, issuer *x509.Certificate) (string, string, error) {
+	if issuer == nil {
+		return "unknown", "", fmt.Errorf("issuer certificate not available")
+	}
+	client, err := revocationClient(test)
+	if err != nil {
+		return "unknown", "", err
+	}
+
+	if len(leaf.OCSPServer) > 0 {
+		req, err := ocsp.CreateRequest(leaf, issuer, nil)
+		if err != nil {
+			return "unknown", "", err
+		}
+		body, err := revocationFetch(ctx, client, http.MethodPost, leaf.OCSPServer[0], req)
+		if err != nil {
+			return "unknown", "", fmt.Errorf("OCSP: %v", err)
+		}
+		resp, err := ocsp.ParseResponseForCert(body, leaf, issuer)
+		if err != nil {
+			return "unknown", "", fmt.Errorf("OCSP: %v", err)
+		}
+		return ocspStatus[resp.Status], "ocsp", nil
+	}
+
+	if len(leaf.CRLDistributionPoints) > 0 {
+		body, err := revocationFetch(ctx, client, http.MethodGet, leaf.CRLDistributionPoints[0], nil)
+		if err != nil {
+			return "unknown", "", fmt.Errorf("CRL: %v", err)
+		}
+		crl, err := x509.ParseRevocationList(body)
+		if err != nil {
+			return "unknown", "", fmt.Errorf("CRL: %v", err)
+		}
+		if err := crl.CheckSignatureFrom(issuer); err != nil {
+			return "unknown", "", fmt.Errorf("CRL: %v", err)
+		}
+		for _, entry := range crl.RevokedCertificateEntries {
+			if entry.SerialNumber.Cmp(leaf.SerialNumber) == 0 {
+				return "revoked", "crl", nil
+			}
+		}
+		return "good", "crl", nil
+	}
+
+	return "unknown", "", fmt.Errorf("certificate names no OCSP responder or CRL")
+}
+
+// revocationFetch makes a request to an OCSP responder or CRL distribution
+// point and returns the response body.
+func revocationFetch(ctx context.Context, client *http.Client, method, url string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/ocsp-request")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+}
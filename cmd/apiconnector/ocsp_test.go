@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestCheckRevocation(t *testing.T) {
+	root, rootKey := issueCert(t, "Test Root", true, nil, nil)
+
+	// The responder answers for every certificate with the status in
+	// ocspAnswer; the CRL lists the serial in crlRevoked.
+	var ocspAnswer int
+	var crlRevoked *big.Int
+	responder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/crl" {
+			tmpl := &x509.RevocationList{Number: big.NewInt(1), ThisUpdate: time.Now(), NextUpdate: time.Now().Add(time.Hour)}
+			if crlRevoked != nil {
+				tmpl.RevokedCertificateEntries = []x509.RevocationListEntry{{SerialNumber: crlRevoked, RevocationTime: time.Now()}}
+			}
+			crl, _ := x509.CreateRevocationList(nil, tmpl, root, rootKey)
+			w.Write(crl)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		req, err := ocsp.ParseRequest(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp, _ := ocsp.CreateResponse(root, root, ocsp.Response{Status: ocspAnswer, SerialNumber: req.SerialNumber, ThisUpdate: time.Now(), NextUpdate: time.Now().Add(time.Hour), RevokedAt: time.Now()}, rootKey)
+		w.Write(resp)
+	}))
+	defer responder.Close()
+
+	ocspLeaf, ocspKey := issueCert(t, "api.test", false, root, rootKey, func(c *x509.Certificate) { c.OCSPServer = []string{responder.URL} })
+	crlLeaf, crlKey := issueCert(t, "api.test", false, root, rootKey, func(c *x509.Certificate) { c.CRLDistributionPoints = []string{responder.URL + "/crl"} })
+	mustLeaf, mustKey := issueCert(t, "api.test", false, root, rootKey, func(c *x509.Certificate) {
+		c.ExtraExtensions = []pkix.Extension{{Id: oidMustStaple, Value: []byte{0x30, 0x03, 0x02, 0x01, 0x05}}}
+	})
+	staple := func(status int, nextUpdate time.Duration) []byte {
+		resp, err := ocsp.CreateResponse(root, root, ocsp.Response{Status: status, SerialNumber: ocspLeaf.SerialNumber, ThisUpdate: time.Now(), NextUpdate: time.Now().Add(nextUpdate), RevokedAt: time.Now()}, rootKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	tlsRootCAs = x509.NewCertPool()
+	tlsRootCAs.AddCert(root)
+	defer func() { tlsRootCAs = nil }()
+
+	tests := []struct {
+		name       string
+		cert       tls.Certificate
+		options    string
+		answer     int
+		crlRevoked bool
+		status     string
+		stapled    string
+		revocation string
+		source     string
+	}{
+		{"no option", tls.Certificate{Certificate: [][]byte{ocspLeaf.Raw}, PrivateKey: ocspKey}, "", 0, false, "OK", "", "", ""},
+		{"good staple", tls.Certificate{Certificate: [][]byte{ocspLeaf.Raw}, PrivateKey: ocspKey, OCSPStaple: staple(ocsp.Good, 72*time.Hour)}, "ocsp", 0, false, "OK", "yes", "good", "staple"},
+		{"revoked staple", tls.Certificate{Certificate: [][]byte{ocspLeaf.Raw}, PrivateKey: ocspKey, OCSPStaple: staple(ocsp.Revoked, 72*time.Hour)}, "ocsp", 0, false, "FAIL", "yes", "revoked", "staple"},
+		{"expiring staple", tls.Certificate{Certificate: [][]byte{ocspLeaf.Raw}, PrivateKey: ocspKey, OCSPStaple: staple(ocsp.Good, time.Hour)}, "ocsp", 0, false, "WARN", "yes", "good", "staple"},
+		{"no staple", tls.Certificate{Certificate: [][]byte{ocspLeaf.Raw}, PrivateKey: ocspKey}, "ocsp", 0, false, "OK", "no", "", ""},
+		{"must staple", tls.Certificate{Certificate: [][]byte{mustLeaf.Raw}, PrivateKey: mustKey}, "ocsp", 0, false, "WARN", "no", "", ""},
+		{"ocsp good", tls.Certificate{Certificate: [][]byte{ocspLeaf.Raw}, PrivateKey: ocspKey}, "ocsp=check", ocsp.Good, false, "OK", "no", "good", "ocsp"},
+		{"ocsp revoked", tls.Certificate{Certificate: [][]byte{ocspLeaf.Raw}, PrivateKey: ocspKey}, "ocsp=check", ocsp.Revoked, false, "FAIL", "no", "revoked", "ocsp"},
+		{"crl good", tls.Certificate{Certificate: [][]byte{crlLeaf.Raw}, PrivateKey: crlKey}, "ocsp=check", 0, false, "OK", "no", "good", "crl"},
+		{"crl revoked", tls.Certificate{Certificate: [][]byte{crlLeaf.Raw}, PrivateKey: crlKey}, "ocsp=check", 0, true, "FAIL", "no", "revoked", "crl"},
+		{"no responder", tls.Certificate{Certificate: [][]byte{mustLeaf.Raw}, PrivateKey: mustKey}, "ocsp=check", 0, false, "WARN", "no", "unknown", ""},
+		{"invalid", tls.Certificate{Certificate: [][]byte{ocspLeaf.Raw}, PrivateKey: ocspKey}, "ocsp=always", 0, false, "ERROR", "", "", ""},
+	}
+	for _, tt := range tests {
+		ocspAnswer, crlRevoked = tt.answer, nil
+		if tt.crlRevoked {
+			crlRevoked = crlLeaf.SerialNumber
+		}
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		srv.TLS = &tls.Config{Certificates: []tls.Certificate{tt.cert}}
+		srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+		srv.StartTLS()
+
+		for _, target := range []string{srv.URL, "tls://" + strings.TrimPrefix(srv.URL, "https://")} {
+			test := parseTestConfig("api=" + target + " " + tt.options)
+			check := checkHTTP
+			if strings.HasPrefix(target, "tls:") {
+				check = checkTLS
+			}
+			status, _, errMsg := check(context.Background(), &test)
+			if status != tt.status || test.Details["ocsp_staple"] != tt.stapled || test.Details["revocation"] != tt.revocation || test.Details["revocation_source"] != tt.source {
+				t.Errorf("%s: check(%s) = %s (%s) %v, want %s ocsp_staple=%q revocation=%q revocation_source=%q", tt.name, target, status, errMsg, test.Details, tt.status, tt.stapled, tt.revocation, tt.source)
+			}
+		}
+		srv.Close()
+	}
+}
+
+func TestRevocationProxy(t *testing.T) {
+	root, rootKey := issueCert(t, "Test Root", true, nil, nil)
+
+	// The responder is only reachable through the proxy.
+	var proxied []string
+	proxySrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+		if r.URL.Host != "ocsp.invalid" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		req, err := ocsp.ParseRequest(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp, _ := ocsp.CreateResponse(root, root, ocsp.Response{Status: ocsp.Good, SerialNumber: req.SerialNumber, ThisUpdate: time.Now(), NextUpdate: time.Now().Add(time.Hour)}, rootKey)
+		w.Write(resp)
+	}))
+	defer proxySrv.Close()
+
+	leaf, key := issueCert(t, "api.test", false, root, rootKey, func(c *x509.Certificate) { c.OCSPServer = []string{"http://ocsp.invalid/"} })
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{leaf.Raw}, PrivateKey: key}}}
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	defer srv.Close()
+	tlsRootCAs = x509.NewCertPool()
+	tlsRootCAs.AddCert(root)
+	defer func() { tlsRootCAs = nil }()
+
+	test := parseTestConfig("api=tls://" + strings.TrimPrefix(srv.URL, "https://") + " ocsp=check proxy=" + proxySrv.URL)
+	status, _, errMsg := checkTLS(context.Background(), &test)
+	if status != "OK" || test.Details["revocation"] != "good" || test.Details["revocation_source"] != "ocsp" {
+		t.Errorf("checkTLS(ocsp=check via proxy) = %s (%s) %v, want OK with an OCSP answer", status, errMsg, test.Details)
+	}
+	if len(proxied) != 1 || proxied[0] != "http://ocsp.invalid/" {
+		t.Errorf("proxied requests = %q, want the OCSP request", proxied)
+	}
+	if test.Details["proxy"] != "" {
+		t.Errorf("Details = %v, want no proxy detail from the responder request", test.Details)
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	outputFormat = flag.String("output", "text", "result `format`: text, json, ndjson, yaml, junit, prometheus, html or markdown")
+	reportFile   = flag.String("report-file", "", "write the -output report to `file`, printing text results as well")
+	quiet        = flag.Bool("q", false, "print only failed checks, and the summary when there are any")
+	summaryOnly  = flag.Bool("summary-only", false, "print only the summary line of the text output")
+	colorMode    = flag.String("color", "auto", "color the text output: `auto`, always or never")
+)
+
+// reports holds the -report flags: extra reports written to files
+// alongside the -output.
+var reports reportFlags
+
+func init() {
+	flag.Var(&reports, "report", "`format:file` also write a report in format (e.g. html:report.html) to file (repeatable)")
+}
+
+// reportFlags collects repeated -report flags in order.
+type reportFlags []reportTarget
+
+type reportTarget struct {
+	format, path string
+}
+
+func (r *reportFlags) String() string {
+	var targets []string
+	for _, t := range *r {
+		targets = append(targets, t.format+":"+t.path)
+	}
+	return strings.Join(targets, ", ")
+}
+
+func (r *reportFlags) Set(v string) error {
+	format, path, ok := strings.Cut(v, ":")
+	if !ok || path == "" {
+		return fmt.Errorf("expected format:file")
+	}
+	if _, ok := outputFormats[format]; !ok {
+		return fmt.Errorf("unknown report format %q", format)
+	}
+	*r = append(*r, reportTarget{format, path})
+	return nil
+}
+
+// outputFormats writes a run's report in each structured output format;
+// text output is printed as the tests run instead.
+var outputFormats = map[string]func(io.Writer, *report) error{
+	"json":       writeJSON,
+	"ndjson":     writeNDJSON,
+	"yaml":       writeYAML,
+	"junit":      writeJUnit,
+	"prometheus": writePrometheus,
+	"html":       writeHTML,
+	"markdown":   writeMarkdown,
+}
+
+// textOutput reports whether results are printed as text as the tests run:
+// with -output text, or alongside a -report-file, unless -format replaces
+// the text.
+func textOutput() bool {
+	return (*outputFormat == "text" || *reportFile != "") && *formatFlag == ""
+}
+
+// setColor applies the -color mode. "auto" keeps the color package's
+// choice: no color when stdout is not a terminal, TERM is dumb or NO_COLOR
+// is set.
+func setColor(mode string) error {
+	switch mode {
+	case "auto":
+	case "always":
+		color.NoColor = false
+	case "never":
+		color.NoColor = true
+	default:
+		return fmt.Errorf("invalid -color %q: want auto, always or never", mode)
+	}
+	return nil
+}
+
+// textResult reports whether test's result line is printed in the text
+// output: -summary-only prints none, and -q only failures.
+func textResult(test *ConnectionTest) bool {
+	if *summaryOnly {
+		return false
+	}
+	status := resultStatus(test)
+	return !*quiet || (status != "OK" && status != "WARN")
+}
+
+// textSummary reports whether the text output ends with the summary: -q
+// keeps a run where nothing failed silent, so cron mails only failures.
+func textSummary(failures int) bool {
+	return !*quiet || failures > 0
+}
+
+// streamOutput reports whether results are printed as NDJSON as the tests
+// run, rather than in a report at the end.
+func streamOutput() bool {
+	return *outputFormat == "ndjson" && *reportFile == ""
+}
+
+// writeReport writes r in the -output format to -report-file, or else to
+// stdout, and to each -report file. Text output has no report, and streamed
+// NDJSON has already been printed.
+func writeReport(r *report) error {
+	if write, ok := outputFormats[*outputFormat]; ok && !streamOutput() {
+		var err error
+		if *reportFile == "" {
+			err = write(os.Stdout, r)
+		} else {
+			err = writeReportFile(write, *reportFile, r)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for _, t := range reports {
+		if err := writeReportFile(outputFormats[t.format], t.path, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeReportFile writes r to path with write. The file is written under
+// a temporary name and renamed into place, so that a collector reading it,
+// such as node_exporter's, never sees a partial report.
+func writeReportFile(write func(io.Writer, *report) error, path string, r *report) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := write(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0o644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// report is the result of a run in structured output formats, which share
+// its schema.
+type report struct {
+	Started  time.Time `json:"started" yaml:"started"`
+	Finished time.Time `json:"finished" yaml:"finished"`
+	Summary  summary   `json:"summary" yaml:"summary"`
+	Results  []result  `json:"results" yaml:"results"`
+}
+
+// summary counts the results of a run by status, as the text summary does.
+type summary struct {
+	OK   int `json:"ok" yaml:"ok"`
+	Warn int `json:"warn" yaml:"warn"`
+	Fail int `json:"fail" yaml:"fail"`
+}
+
+// result is one test's outcome in structured output formats.
+type result struct {
+	Service   string            `json:"service" yaml:"service"`
+	Method    string            `json:"method,omitempty" yaml:"method,omitempty"`
+	URL       string            `json:"url" yaml:"url"`
+	Status    string            `json:"status" yaml:"status"`
+	Check     string            `json:"check_status,omitempty" yaml:"check_status,omitempty"`
+	LatencyMS float64           `json:"latency_ms" yaml:"latency_ms"`
+	Error     string            `json:"error,omitempty" yaml:"error,omitempty"`
+	Details   map[string]string `json:"details,omitempty" yaml:"details,omitempty"`
+	SamplesMS []float64         `json:"samples_ms,omitempty" yaml:"samples_ms,omitempty"`
+	Started   time.Time         `json:"started" yaml:"started"`
+	Finished  time.Time         `json:"finished" yaml:"finished"`
+}
+
+// resultStatus returns the status a completed test is reported and counted
+// with: OK or WARN when it has no error, otherwise FAIL, or ERROR for an
+// invalid configuration.
+func resultStatus(test *ConnectionTest) string {
+	switch {
+	case test.Error == "" && test.Status == "WARN":
+		return "WARN"
+	case test.Error == "":
+		return "OK"
+	case test.Status == "ERROR":
+		return "ERROR"
+	}
+	return "FAIL"
+}
+
+// checkStatus returns the status test's check reported when it says more
+// than its resultStatus, such as "HTTP 503" for a reachable target, or "".
+func checkStatus(test *ConnectionTest) string {
+	if test.Status == resultStatus(test) {
+		return ""
+	}
+	return test.Status
+}
+
+// newReport builds the report of a run that started at started.
+func newReport(tests []ConnectionTest, started time.Time) *report {
+	r := &report{Started: started, Finished: time.Now(), Results: []result{}}
+	for i := range tests {
+		test := &tests[i]
+		switch resultStatus(test) {
+		case "OK":
+			r.Summary.OK++
+		case "WARN":
+			r.Summary.Warn++
+		default:
+			r.Summary.Fail++
+		}
+		r.Results = append(r.Results, newResult(test))
+	}
+	return r
+}
+
+// newResult returns the report entry for the completed test.
+func newResult(test *ConnectionTest) result {
+	return result{
+		Service:   test.Service,
+		Method:    test.Method,
+		URL:       redactURL(test.URL),
+		Status:    resultStatus(test),
+		Check:     checkStatus(test),
+		LatencyMS: float64(test.Latency) / float64(time.Millisecond),
+		Error:     test.Error,
+		Details:   test.Details,
+		SamplesMS: samplesMS(test.Samples),
+		Started:   test.Started,
+		Finished:  test.Finished,
+	}
+}
+
+// redactURL returns rawURL with any password replaced by "xxxxx", so that
+// credentials expanded into a target (see expandEnv) stay out of reports.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Redacted()
+}
+
+// Latency returns the result's latency as a duration, for -format
+// templates.
+func (r result) Latency() time.Duration {
+	return time.Duration(r.LatencyMS * float64(time.Millisecond))
+}
+
+// samplesMS converts latency samples to milliseconds, or nil when there is
+// only the one latency.
+func samplesMS(samples []time.Duration) []float64 {
+	if len(samples) < 2 {
+		return nil
+	}
+	ms := make([]float64, len(samples))
+	for i, d := range samples {
+		ms[i] = float64(d) / float64(time.Millisecond)
+	}
+	return ms
+}
+
+// writeJSON writes r as an indented JSON document.
+func writeJSON(w io.Writer, r *report) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// writeNDJSON writes r's results as newline-delimited JSON, one object
+// per line.
+func writeNDJSON(w io.Writer, r *report) error {
+	for _, res := range r.Results {
+		if err := writeResultJSON(w, res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeResultJSON writes res as a single line of JSON.
+func writeResultJSON(w io.Writer, res result) error {
+	return json.NewEncoder(w).Encode(res)
+}
+
+// writeYAML writes r as a YAML document.
+func writeYAML(w io.Writer, r *report) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(r); err != nil {
+		return err
+	}
+	return enc.Close()
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// certPin is an expected SPKI hash or certificate fingerprint.
+type certPin struct {
+	spki bool // SHA-256 of the SubjectPublicKeyInfo rather than the certificate
+	hash []byte
+}
+
+// certPins parses the "pin" option: a comma-separated list of SPKI hashes
+// ("sha256/" and base64, as in HPKP and curl's --pinnedpubkey) and
+// certificate fingerprints ("sha256:" and hex, colons optional), so that
+// backup pins can be listed alongside the current one.
+func certPins(test *ConnectionTest) ([]certPin, error) {
+	v := test.Options["pin"]
+	if v == "" {
+		return nil, nil
+	}
+	var pins []certPin
+	for _, s := range strings.Split(v, ",") {
+		var pin certPin
+		var err error
+		if b64, ok := strings.CutPrefix(s, "sha256/"); ok {
+			pin.spki = true
+			pin.hash, err = base64.StdEncoding.DecodeString(b64)
+		} else if hexHash, ok := strings.CutPrefix(strings.ToLower(s), "sha256:"); ok {
+			pin.hash, err = hex.DecodeString(strings.ReplaceAll(hexHash, ":", ""))
+		} else {
+			err = fmt.Errorf("want sha256/<base64> or sha256:<hex>")
+		}
+		if err == nil && len(pin.hash) != sha256.Size {
+			err = fmt.Errorf("not a SHA-256 hash")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid pin %q: %v", s, err)
+		}
+		pins = append(pins, pin)
+	}
+	return pins, nil
+}
+
+// matchPins checks a presented certificate chain against pins: any pin
+// matching any certificate in the chain passes, and the "pin" detail
+// records the match. A mismatch names the leaf's SPKI hash, to help update
+// the pin after a legitimate rotation.
+func matchPins(test *ConnectionTest, pins []certPin, certs []*x509.Certificate) error {
+	for _, cert := range certs {
+		spki, fingerprint := sha256.Sum256(cert.RawSubjectPublicKeyInfo), sha256.Sum256(cert.Raw)
+		for _, pin := range pins {
+			if (pin.spki && bytes.Equal(pin.hash, spki[:])) || (!pin.spki && bytes.Equal(pin.hash, fingerprint[:])) {
+				setDetail(test, "pin", "ok")
+				return nil
+			}
+		}
+	}
+	if len(certs) == 0 {
+		return fmt.Errorf("certificate pin mismatch: no certificates")
+	}
+	spki := sha256.Sum256(certs[0].RawSubjectPublicKeyInfo)
+	return fmt.Errorf("certificate pin mismatch: leaf is sha256/%s", base64.StdEncoding.EncodeToString(spki[:]))
+}
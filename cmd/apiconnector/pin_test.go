@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCertPins(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	tlsRootCAs = x509.NewCertPool()
+	tlsRootCAs.AddCert(srv.Certificate())
+	defer func() { tlsRootCAs = nil }()
+
+	spki := sha256.Sum256(srv.Certificate().RawSubjectPublicKeyInfo)
+	fingerprint := sha256.Sum256(srv.Certificate().Raw)
+	spkiPin := "sha256/" + base64.StdEncoding.EncodeToString(spki[:])
+	other := "sha256/" + base64.StdEncoding.EncodeToString(make([]byte, 32))
+	colons := strings.ToUpper(hex.EncodeToString(fingerprint[:2])) + ":" + hex.EncodeToString(fingerprint[2:])
+
+	tests := []struct {
+		options string
+		status  string
+		errMsg  string
+	}{
+		{"", "OK", ""},
+		{"pin=" + spkiPin, "OK", ""},
+		{"pin=sha256:" + hex.EncodeToString(fingerprint[:]), "OK", ""},
+		{"pin=SHA256:" + colons, "OK", ""},
+		{"pin=" + other + "," + spkiPin, "OK", ""},
+		{"pin=" + other, "FAIL", "pin mismatch: leaf is " + spkiPin},
+		{"pin=" + other + " skip_verify", "FAIL", "pin mismatch"},
+		{"pin=md5:abcd", "FAIL", "invalid pin"},
+		{"pin=sha256/AAAA", "FAIL", "not a SHA-256 hash"},
+	}
+	for _, tt := range tests {
+		test := parseTestConfig("api=" + srv.URL + " " + tt.options)
+		status, _, errMsg := checkHTTP(context.Background(), &test)
+		if status != tt.status || !strings.Contains(errMsg, tt.errMsg) || (status == "OK" && tt.options != "" && test.Details["pin"] != "ok") {
+			t.Errorf("checkHTTP(%s) = %s (%s) %v, want %s (%s)", tt.options, status, errMsg, test.Details, tt.status, tt.errMsg)
+		}
+	}
+
+	test := parseTestConfig("api=tls://" + strings.TrimPrefix(srv.URL, "https://") + " pin=" + other)
+	if status, _, errMsg := checkTLS(context.Background(), &test); status != "FAIL" || !strings.Contains(errMsg, "pin mismatch") {
+		t.Errorf("checkTLS with wrong pin = %s (%s), want FAIL", status, errMsg)
+	}
+}
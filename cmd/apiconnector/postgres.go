@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Protocol codes sent in place of a version number in the startup packet.
+const (
+	pgProtocolVersion = 196608 // 3.0
+	pgSSLRequestCode  = 80877103
+)
+
+// checkPostgres performs a PostgreSQL startup and authentication handshake.
+// Credentials and database come from the URL or the PGUSER, PGPASSWORD and
+// PGDATABASE environment variables. Without a password the check passes as
+// soon as the server asks for one, since it has then accepted the
+// connection. The sslmode=require query parameter negotiates TLS first.
+func checkPostgres(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	start := time.Now()
+
+	u, err := url.Parse(test.URL)
+	if err != nil || u.Hostname() == "" {
+		return "ERROR", 0, "Invalid URL"
+	}
+
+	user := u.User.Username()
+	if user == "" {
+		user = os.Getenv("PGUSER")
+	}
+	if user == "" {
+		user = "postgres"
+	}
+	password, hasPassword := u.User.Password()
+	if !hasPassword {
+		password, hasPassword = os.LookupEnv("PGPASSWORD")
+	}
+	database := strings.TrimPrefix(u.Path, "/")
+	if database == "" {
+		database = os.Getenv("PGDATABASE")
+	}
+	if database == "" {
+		database = user
+	}
+
+	conn, err := dial(ctx, test, "tcp", hostPort(u, "5432"))
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("Connect error: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(testTimeout(test)))
+
+	if sslmode := u.Query().Get("sslmode"); sslmode == "require" || sslmode == "verify-full" {
+		tlsConn, err := pgStartTLS(ctx, conn, &tls.Config{
+			ServerName:         tlsServerName(test, u.Hostname()),
+			InsecureSkipVerify: sslmode == "require",
+		})
+		if err != nil {
+			return "FAIL", 0, fmt.Sprintf("TLS negotiation error: %v", err)
+		}
+		setCertExpiry(test, tlsConn.(*tls.Conn).ConnectionState())
+		conn = tlsConn
+	}
+
+	var startup []byte
+	startup = binary.BigEndian.AppendUint32(startup, pgProtocolVersion)
+	for _, kv := range [][2]string{{"user", user}, {"database", database}, {"application_name", "apiconnector"}} {
+		startup = append(startup, kv[0]...)
+		startup = append(startup, 0)
+		startup = append(startup, kv[1]...)
+		startup = append(startup, 0)
+	}
+	startup = append(startup, 0)
+	if err := pgWriteMessage(conn, 0, startup); err != nil {
+		return "FAIL", 0, fmt.Sprintf("Startup write error: %v", err)
+	}
+
+	br := bufio.NewReader(conn)
+	var scram *scramClient
+	for {
+		typ, payload, err := pgReadMessage(br)
+		if err != nil {
+			return "FAIL", 0, fmt.Sprintf("Handshake read error: %v", err)
+		}
+
+		switch typ {
+		case 'E':
+			return "FAIL", time.Since(start), pgErrorMessage(payload)
+
+		case 'S':
+			name, value, _ := strings.Cut(strings.TrimRight(string(payload), "\x00"), "\x00")
+			if name == "server_version" {
+				setDetail(test, "version", value)
+			}
+
+		case 'Z':
+			pgWriteMessage(conn, 'X', nil)
+			return "OK", time.Since(start), ""
+
+		case 'R':
+			if len(payload) < 4 {
+				return "FAIL", 0, "Malformed authentication request"
+			}
+			code := binary.BigEndian.Uint32(payload)
+			data := payload[4:]
+
+			if code != 0 && code != 11 && code != 12 && !hasPassword {
+				setDetail(test, "auth", "password required")
+				return "OK", time.Since(start), ""
+			}
+
+			var reply []byte
+			switch code {
+			case 0: // AuthenticationOk
+				setDetail(test, "auth", "ok")
+				continue
+			case 3: // AuthenticationCleartextPassword
+				reply = append([]byte(password), 0)
+			case 5: // AuthenticationMD5Password
+				inner := md5.Sum([]byte(password + user))
+				outer := md5.Sum(append([]byte(hex.EncodeToString(inner[:])), data...))
+				reply = append([]byte("md5"+hex.EncodeToString(outer[:])), 0)
+			case 10: // AuthenticationSASL
+				if !pgHasMechanism(data, "SCRAM-SHA-256") {
+					return "FAIL", 0, "Server offers no supported SASL mechanism"
+				}
+				scram, _ = newSCRAMClient("SCRAM-SHA-256", "", password)
+				first := scram.first()
+				reply = append([]byte("SCRAM-SHA-256\x00"), binary.BigEndian.AppendUint32(nil, uint32(len(first)))...)
+				reply = append(reply, first...)
+			case 11: // AuthenticationSASLContinue
+				if scram == nil {
+					return "FAIL", 0, "Unexpected SASL continuation"
+				}
+				final, err := scram.final(string(data))
+				if err != nil {
+					return "FAIL", 0, fmt.Sprintf("SCRAM error: %v", err)
+				}
+				reply = []byte(final)
+			case 12: // AuthenticationSASLFinal
+				if scram == nil {
+					return "FAIL", 0, "Unexpected SASL completion"
+				}
+				if err := scram.verify(string(data)); err != nil {
+					return "FAIL", 0, fmt.Sprintf("SCRAM error: %v", err)
+				}
+				continue
+			default:
+				return "FAIL", 0, fmt.Sprintf("Unsupported authentication method %d", code)
+			}
+			if err := pgWriteMessage(conn, 'p', reply); err != nil {
+				return "FAIL", 0, fmt.Sprintf("Authentication write error: %v", err)
+			}
+		}
+	}
+}
+
+// pgStartTLS sends an SSLRequest and upgrades conn if the server agrees.
+func pgStartTLS(ctx context.Context, conn net.Conn, config *tls.Config) (net.Conn, error) {
+	if err := pgWriteMessage(conn, 0, binary.BigEndian.AppendUint32(nil, pgSSLRequestCode)); err != nil {
+		return nil, err
+	}
+	var answer [1]byte
+	if _, err := io.ReadFull(conn, answer[:]); err != nil {
+		return nil, err
+	}
+	if answer[0] != 'S' {
+		return nil, fmt.Errorf("server does not support SSL")
+	}
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// pgWriteMessage writes a frontend message. A zero typ writes an untyped
+// message, as used by the startup and SSL request packets.
+func pgWriteMessage(w io.Writer, typ byte, payload []byte) error {
+	var msg []byte
+	if typ != 0 {
+		msg = append(msg, typ)
+	}
+	msg = binary.BigEndian.AppendUint32(msg, uint32(len(payload)+4))
+	msg = append(msg, payload...)
+	_, err := w.Write(msg)
+	return err
+}
+
+// pgReadMessage reads one backend message.
+func pgReadMessage(r io.Reader) (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	length := binary.BigEndian.Uint32(header[1:])
+	if length < 4 || length > 1<<20 {
+		return 0, nil, fmt.Errorf("invalid message length %d", length)
+	}
+	payload := make([]byte, length-4)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return header[0], payload, nil
+}
+
+// pgErrorMessage formats the code and message fields of an ErrorResponse.
+func pgErrorMessage(payload []byte) string {
+	var code, message string
+	for _, field := range strings.Split(string(payload), "\x00") {
+		if field == "" {
+			continue
+		}
+		switch field[0] {
+		case 'C':
+			code = field[1:]
+		case 'M':
+			message = field[1:]
+		}
+	}
+	return fmt.Sprintf("Server error %s: %s", code, message)
+}
+
+// pgHasMechanism reports whether a SASL mechanism list contains mechanism.
+func pgHasMechanism(list []byte, mechanism string) bool {
+	for _, m := range strings.Split(string(list), "\x00") {
+		if m == mechanism {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"net"
+	"os"
+	"testing"
+)
+
+// pgReadStartup consumes an untyped startup packet.
+func pgReadStartup(conn net.Conn) ([]byte, error) {
+	var length [4]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+	body := make([]byte, binary.BigEndian.Uint32(length[:])-4)
+	_, err := io.ReadFull(conn, body)
+	return body, err
+}
+
+func pgAuthRequest(code uint32, data ...byte) []byte {
+	return append(binary.BigEndian.AppendUint32(nil, code), data...)
+}
+
+func TestCheckPostgresMD5(t *testing.T) {
+	salt := []byte{1, 2, 3, 4}
+	addr := serveOnce(t, func(conn net.Conn) {
+		if _, err := pgReadStartup(conn); err != nil {
+			t.Error(err)
+			return
+		}
+		pgWriteMessage(conn, 'R', pgAuthRequest(5, salt...))
+		typ, payload, err := pgReadMessage(conn)
+		if err != nil || typ != 'p' {
+			t.Errorf("expected password message, got %c %v", typ, err)
+			return
+		}
+		inner := md5.Sum([]byte("secretalice"))
+		outer := md5.Sum(append([]byte(hex.EncodeToString(inner[:])), salt...))
+		if string(payload) != "md5"+hex.EncodeToString(outer[:])+"\x00" {
+			pgWriteMessage(conn, 'E', []byte("SFATAL\x00C28P01\x00Mpassword authentication failed\x00\x00"))
+			return
+		}
+		pgWriteMessage(conn, 'R', pgAuthRequest(0))
+		pgWriteMessage(conn, 'S', []byte("server_version\x0016.2\x00"))
+		pgWriteMessage(conn, 'Z', []byte("I"))
+	})
+
+	test := &ConnectionTest{URL: "postgres://alice:secret@" + addr + "/app"}
+	status, _, errMsg := checkPostgres(context.Background(), test)
+	if status != "OK" {
+		t.Fatalf("checkPostgres = %s (%s), want OK", status, errMsg)
+	}
+	if test.Details["version"] != "16.2" || test.Details["auth"] != "ok" {
+		t.Errorf("Details = %v, want version=16.2 auth=ok", test.Details)
+	}
+}
+
+func TestCheckPostgresStartingUp(t *testing.T) {
+	addr := serveOnce(t, func(conn net.Conn) {
+		pgReadStartup(conn)
+		pgWriteMessage(conn, 'E', []byte("SFATAL\x00C57P03\x00Mthe database system is starting up\x00\x00"))
+	})
+
+	test := &ConnectionTest{URL: "postgres://" + addr}
+	status, _, errMsg := checkPostgres(context.Background(), test)
+	if status != "FAIL" || errMsg != "Server error 57P03: the database system is starting up" {
+		t.Errorf("checkPostgres = %s (%s), want FAIL with server error", status, errMsg)
+	}
+}
+
+func TestCheckPostgresNoPassword(t *testing.T) {
+	// t.Setenv restores the original value once the test finishes.
+	t.Setenv("PGPASSWORD", "")
+	os.Unsetenv("PGPASSWORD")
+
+	addr := serveOnce(t, func(conn net.Conn) {
+		pgReadStartup(conn)
+		pgWriteMessage(conn, 'R', pgAuthRequest(3))
+		io.Copy(io.Discard, conn)
+	})
+
+	test := &ConnectionTest{URL: "postgres://" + addr}
+	status, _, errMsg := checkPostgres(context.Background(), test)
+	if status != "OK" || test.Details["auth"] != "password required" {
+		t.Errorf("checkPostgres = %s (%s) %v, want OK with auth=password required", status, errMsg, test.Details)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// checkPrometheus requires both /-/healthy and /-/ready to return 200 on a
+// Prometheus server (prom:// on port 9090, proms:// over HTTPS); a server
+// still replaying its WAL is healthy but not ready. The version is reported
+// from the build info API when available.
+func checkPrometheus(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	start := time.Now()
+
+	u, err := url.Parse(test.URL)
+	if err != nil || u.Hostname() == "" {
+		return "ERROR", 0, "Invalid URL"
+	}
+
+	base := url.URL{Scheme: "http", Host: hostPort(u, "9090"), User: u.User}
+	if u.Scheme == "proms" {
+		base.Scheme = "https"
+	}
+	client := newHTTPClient(test)
+
+	for _, endpoint := range []string{"healthy", "ready"} {
+		req, err := http.NewRequestWithContext(ctx, "GET", base.String()+"/-/"+endpoint, nil)
+		if err != nil {
+			return "ERROR", 0, fmt.Sprintf("Request creation error: %v", err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return "FAIL", 0, fmt.Sprintf("HTTP error: %v", err)
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "FAIL", 0, fmt.Sprintf("Not %s (HTTP %d): %s", endpoint, resp.StatusCode, strings.TrimSpace(string(body)))
+		}
+	}
+	latency := time.Since(start)
+
+	var info struct {
+		Data struct {
+			Version string `json:"version"`
+		} `json:"data"`
+	}
+	if httpGetJSON(ctx, client, base.String()+"/api/v1/status/buildinfo", &info) == "" && info.Data.Version != "" {
+		setDetail(test, "version", info.Data.Version)
+	}
+
+	return "OK", latency, ""
+}
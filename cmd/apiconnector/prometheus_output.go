@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// writePrometheus writes r in the Prometheus text exposition format, for
+// the node_exporter textfile collector: per-service gauges for whether the
+// target is up (OK or WARN, with no other check_status such as HTTP 503),
+// its status, latency and, for TLS targets, the days left on its
+// certificate, plus the time of the run.
+func writePrometheus(w io.Writer, r *report) error {
+	bw := bufio.NewWriter(w)
+	metric := func(name, help string, samples func(sample func(labels string, value float64))) {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+		samples(func(labels string, value float64) {
+			if labels != "" {
+				labels = "{" + labels + "}"
+			}
+			fmt.Fprintf(bw, "%s%s %s\n", name, labels, strconv.FormatFloat(value, 'g', -1, 64))
+		})
+	}
+
+	metric("apiconnector_up", "Whether the target's check passed (OK or WARN, and a 2xx HTTP response).", func(sample func(string, float64)) {
+		for _, res := range r.Results {
+			up := 0.0
+			if (res.Status == "OK" || res.Status == "WARN") && res.Check == "" {
+				up = 1
+			}
+			sample(promLabels("service", res.Service), up)
+		}
+	})
+	metric("apiconnector_status", "The target's check status, 1 for the status it had.", func(sample func(string, float64)) {
+		for _, res := range r.Results {
+			for _, status := range []string{"OK", "WARN", "FAIL", "ERROR"} {
+				v := 0.0
+				if res.Status == status {
+					v = 1
+				}
+				sample(promLabels("service", res.Service, "status", status), v)
+			}
+		}
+	})
+	metric("apiconnector_latency_seconds", "Latency of the target's check.", func(sample func(string, float64)) {
+		for _, res := range r.Results {
+			sample(promLabels("service", res.Service), res.LatencyMS/1000)
+		}
+	})
+	metric("apiconnector_cert_days_left", "Days until the target's TLS certificate expires.", func(sample func(string, float64)) {
+		for _, res := range r.Results {
+			if days, err := strconv.Atoi(res.Details["cert_days"]); err == nil {
+				sample(promLabels("service", res.Service), float64(days))
+			}
+		}
+	})
+	metric("apiconnector_last_run_timestamp_seconds", "When the run finished, in seconds since the epoch.", func(sample func(string, float64)) {
+		sample("", float64(r.Finished.UnixNano())/1e9)
+	})
+	return bw.Flush()
+}
+
+// promLabels renders name/value pairs as a label set, escaping values as
+// the exposition format requires.
+func promLabels(pairs ...string) string {
+	var labels []string
+	for i := 0; i+1 < len(pairs); i += 2 {
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(pairs[i+1])
+		labels = append(labels, fmt.Sprintf(`%s="%s"`, pairs[i], v))
+	}
+	return strings.Join(labels, ",")
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckPrometheus(t *testing.T) {
+	tests := []struct {
+		ready  bool
+		status string
+	}{
+		{true, "OK"},
+		{false, "FAIL"},
+	}
+
+	for _, tt := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/-/healthy":
+				w.Write([]byte("Prometheus Server is Healthy.\n"))
+			case "/-/ready":
+				if !tt.ready {
+					http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+					return
+				}
+				w.Write([]byte("Prometheus Server is Ready.\n"))
+			case "/api/v1/status/buildinfo":
+				w.Write([]byte(`{"status":"success","data":{"version":"2.50.1","revision":"8c9b0285"}}`))
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+
+		test := &ConnectionTest{URL: strings.Replace(srv.URL, "http://", "prom://", 1)}
+		status, _, errMsg := checkPrometheus(context.Background(), test)
+		if status != tt.status {
+			t.Errorf("checkPrometheus(ready=%v) = %s (%s), want %s", tt.ready, status, errMsg, tt.status)
+		}
+		if status == "OK" && test.Details["version"] != "2.50.1" {
+			t.Errorf("version = %q, want 2.50.1", test.Details["version"])
+		}
+		srv.Close()
+	}
+}
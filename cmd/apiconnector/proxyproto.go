@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+// proxyV2Signature opens every PROXY protocol v2 header.
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// proxyHeader builds a HAProxy PROXY protocol header announcing a TCP
+// connection from src to dst. version is "v1" or "v2" ("1", "2" and "true"
+// are accepted as well, "true" meaning v1).
+func proxyHeader(version string, src, dst net.Addr) ([]byte, error) {
+	s, ok1 := src.(*net.TCPAddr)
+	d, ok2 := dst.(*net.TCPAddr)
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("PROXY protocol requires TCP addresses")
+	}
+	v4 := s.IP.To4() != nil && d.IP.To4() != nil
+
+	switch version {
+	case "v1", "1", "true":
+		family := "TCP6"
+		if v4 {
+			family = "TCP4"
+		}
+		return []byte(fmt.Sprintf("PROXY %s %s %s %d %d\r\n", family, s.IP, d.IP, s.Port, d.Port)), nil
+
+	case "v2", "2":
+		b := append([]byte{}, proxyV2Signature...)
+		b = append(b, 0x21) // version 2, PROXY command
+		var addrs []byte
+		if v4 {
+			b = append(b, 0x11) // AF_INET, STREAM
+			addrs = append(append(addrs, s.IP.To4()...), d.IP.To4()...)
+		} else {
+			b = append(b, 0x21) // AF_INET6, STREAM
+			addrs = append(append(addrs, s.IP.To16()...), d.IP.To16()...)
+		}
+		addrs = binary.BigEndian.AppendUint16(addrs, uint16(s.Port))
+		addrs = binary.BigEndian.AppendUint16(addrs, uint16(d.Port))
+		b = binary.BigEndian.AppendUint16(b, uint16(len(addrs)))
+		return append(b, addrs...), nil
+	}
+	return nil, fmt.Errorf("invalid proxy_protocol %q (v1 or v2)", version)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestProxyHeader(t *testing.T) {
+	src := &net.TCPAddr{IP: net.ParseIP("192.0.2.10"), Port: 51000}
+	dst := &net.TCPAddr{IP: net.ParseIP("198.51.100.1"), Port: 443}
+
+	v1, err := proxyHeader("v1", src, dst)
+	if err != nil || string(v1) != "PROXY TCP4 192.0.2.10 198.51.100.1 51000 443\r\n" {
+		t.Errorf("v1 header = %q, %v", v1, err)
+	}
+
+	v2, err := proxyHeader("v2", src, dst)
+	want := "0d0a0d0a000d0a515549540a" + "2111000c" + "c000020a" + "c6336401" + "c738" + "01bb"
+	if err != nil || hex.EncodeToString(v2) != want {
+		t.Errorf("v2 header = %x, %v, want %s", v2, err, want)
+	}
+
+	v6, err := proxyHeader("v1", &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 1}, &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 2})
+	if err != nil || string(v6) != "PROXY TCP6 2001:db8::1 2001:db8::2 1 2\r\n" {
+		t.Errorf("v6 header = %q, %v", v6, err)
+	}
+
+	if _, err := proxyHeader("v3", src, dst); err == nil {
+		t.Error("proxyHeader(v3) succeeded, want error")
+	}
+}
+
+func TestDialProxyProtocol(t *testing.T) {
+	tests := []struct {
+		version string
+		prefix  []byte
+	}{
+		{"v1", []byte("PROXY TCP4 127.0.0.1 127.0.0.1 ")},
+		{"v2", proxyV2Signature},
+	}
+
+	for _, tt := range tests {
+		addr := serveOnce(t, func(conn net.Conn) {
+			br := bufio.NewReader(conn)
+			header := make([]byte, len(tt.prefix))
+			if _, err := io.ReadFull(br, header); err != nil || !bytes.Equal(header, tt.prefix) {
+				return
+			}
+			if tt.version == "v1" {
+				br.ReadString('\n')
+			} else {
+				io.ReadFull(br, make([]byte, 4+12))
+			}
+			if line, _ := br.ReadString('\n'); strings.TrimSpace(line) == "version" {
+				conn.Write([]byte("VERSION 1.6.21\r\n"))
+			}
+			if line, _ := br.ReadString('\n'); strings.TrimSpace(line) == "stats" {
+				conn.Write([]byte("STAT uptime 1\r\nEND\r\n"))
+			}
+		})
+
+		test := parseTestConfig("cache=memcached://" + addr + " proxy_protocol=" + tt.version)
+		if status, _, errMsg := checkMemcached(context.Background(), &test); status != "OK" {
+			t.Errorf("checkMemcached with proxy_protocol=%s = %s (%s), want OK", tt.version, status, errMsg)
+		}
+	}
+}
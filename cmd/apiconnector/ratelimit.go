@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// rateLimitHeaders lists, per reported detail, the response headers that
+// may carry it: the common X-RateLimit-* names, the IETF draft RateLimit-*
+// names, and Retry-After.
+var rateLimitHeaders = []struct {
+	detail string
+	names  []string
+}{
+	{"ratelimit_limit", []string{"X-Ratelimit-Limit", "Ratelimit-Limit", "X-Rate-Limit-Limit"}},
+	{"ratelimit_remaining", []string{"X-Ratelimit-Remaining", "Ratelimit-Remaining", "X-Rate-Limit-Remaining"}},
+	{"ratelimit_reset", []string{"X-Ratelimit-Reset", "Ratelimit-Reset", "X-Rate-Limit-Reset"}},
+	{"retry_after", []string{"Retry-After"}},
+}
+
+// checkRateLimit reports the rate limit headers of a response as details.
+// With the "ratelimit_warn" option, a remaining quota at or below that
+// count (or percentage of the limit, e.g. "10%") is a warning, so
+// monitoring notices before it gets throttled itself. It returns true when
+// the quota is low, or an error for an invalid option.
+func checkRateLimit(test *ConnectionTest, header http.Header) (bool, error) {
+	for _, h := range rateLimitHeaders {
+		for _, name := range h.names {
+			if v := header.Get(name); v != "" {
+				setDetail(test, h.detail, v)
+				break
+			}
+		}
+	}
+
+	threshold := test.Options["ratelimit_warn"]
+	if threshold == "" {
+		return false, nil
+	}
+	pct, percent := strings.CutSuffix(threshold, "%")
+	limit, err := strconv.ParseFloat(pct, 64)
+	if err != nil || limit < 0 {
+		return false, fmt.Errorf("%q is not a count or percentage", threshold)
+	}
+
+	remaining, err := strconv.ParseFloat(test.Details["ratelimit_remaining"], 64)
+	if err != nil {
+		return false, nil
+	}
+	if percent {
+		total, err := strconv.ParseFloat(test.Details["ratelimit_limit"], 64)
+		if err != nil || total <= 0 {
+			return false, nil
+		}
+		return remaining/total*100 <= limit, nil
+	}
+	return remaining <= limit, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckHTTPRateLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/github":
+			w.Header().Set("X-RateLimit-Limit", "5000")
+			w.Header().Set("X-RateLimit-Remaining", "120")
+			w.Header().Set("X-RateLimit-Reset", "1700000000")
+		case "/ietf":
+			w.Header().Set("RateLimit-Limit", "100")
+			w.Header().Set("RateLimit-Remaining", "0")
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		target    string
+		status    string
+		remaining string
+	}{
+		{"/github", "OK", "120"},
+		{"/github ratelimit_warn=100", "OK", "120"},
+		{"/github ratelimit_warn=200", "WARN", "120"},
+		{"/github ratelimit_warn=5%", "WARN", "120"},
+		{"/github ratelimit_warn=1%", "OK", "120"},
+		{"/github ratelimit_warn=lots", "ERROR", "120"},
+		{"/ietf ratelimit_warn=10", "HTTP 429", "0"},
+		{"/plain ratelimit_warn=10", "OK", ""},
+	}
+	for _, tt := range tests {
+		test := parseTestConfig("api=" + srv.URL + tt.target)
+		status, _, errMsg := checkHTTP(context.Background(), &test)
+		if status != tt.status || test.Details["ratelimit_remaining"] != tt.remaining {
+			t.Errorf("checkHTTP(%s) = %s (%s) remaining %q, want %s %q", tt.target, status, errMsg, test.Details["ratelimit_remaining"], tt.status, tt.remaining)
+		}
+	}
+
+	test := parseTestConfig("api=" + srv.URL + "/ietf")
+	checkHTTP(context.Background(), &test)
+	if test.Details["retry_after"] != "30" || test.Details["ratelimit_limit"] != "100" {
+		t.Errorf("checkHTTP(/ietf) details = %v, want retry_after=30 ratelimit_limit=100", test.Details)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultMaxRedirects bounds a followed redirect chain when the
+// "follow_redirects" option does not name a limit.
+const defaultMaxRedirects = 10
+
+// redirectChain follows and records the redirects of one HTTP check. Each
+// hop is kept with the status it answered and the time it took, loops and
+// chains longer than max stop the request, and a step from https:// to
+// http:// is noted as a downgrade.
+type redirectChain struct {
+	max       int
+	last      time.Time
+	hops      []string
+	downgrade string
+	err       string
+}
+
+// newRedirectChain reads the "follow_redirects" option: bare or "true"
+// follows up to defaultMaxRedirects hops, a number sets the limit, and
+// "false" or "0" disables following. It returns nil when redirects are not
+// followed.
+func newRedirectChain(test *ConnectionTest, start time.Time) (*redirectChain, error) {
+	v, ok := test.Options["follow_redirects"]
+	if !ok {
+		return nil, nil
+	}
+	max := defaultMaxRedirects
+	if b, err := strconv.ParseBool(v); err == nil {
+		if !b {
+			return nil, nil
+		}
+	} else if max, err = strconv.Atoi(v); err != nil || max < 0 {
+		return nil, fmt.Errorf("%q is not a hop count", v)
+	}
+	if max == 0 {
+		return nil, nil
+	}
+	return &redirectChain{max: max, last: start}, nil
+}
+
+// checkRedirect is the http.Client CheckRedirect hook. req.Response is the
+// redirect that produced req.
+func (c *redirectChain) checkRedirect(req *http.Request, via []*http.Request) error {
+	prev := via[len(via)-1]
+	c.record(prev, req.Response.StatusCode)
+
+	for _, v := range via {
+		if v.URL.String() == req.URL.String() {
+			c.err = fmt.Sprintf("Redirect loop at %s", req.URL)
+			return errors.New(c.err)
+		}
+	}
+	if len(via) > c.max {
+		c.err = fmt.Sprintf("Too many redirects (limit %d)", c.max)
+		return errors.New(c.err)
+	}
+	if prev.URL.Scheme == "https" && req.URL.Scheme == "http" && c.downgrade == "" {
+		c.downgrade = req.URL.String()
+	}
+	return nil
+}
+
+// record adds the hop for req, answered with status.
+func (c *redirectChain) record(req *http.Request, status int) {
+	now := time.Now()
+	c.hops = append(c.hops, fmt.Sprintf("%s[%d,%s]", req.URL, status, formatDuration(now.Sub(c.last))))
+	c.last = now
+}
+
+// String renders the chain as "url[status,latency]->...".
+func (c *redirectChain) String() string {
+	return strings.Join(c.hops, "->")
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func TestCheckHTTPRedirects(t *testing.T) {
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/old":
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+		case "/loop1":
+			http.Redirect(w, r, "/loop2", http.StatusFound)
+		case "/loop2":
+			http.Redirect(w, r, "/loop1", http.StatusFound)
+		}
+	}))
+	defer plain.Close()
+
+	secure := httptest.NewTLSServer(http.RedirectHandler(plain.URL+"/new", http.StatusFound))
+	defer secure.Close()
+	tlsRootCAs = x509.NewCertPool()
+	tlsRootCAs.AddCert(secure.Certificate())
+	defer func() { tlsRootCAs = nil }()
+
+	tests := []struct {
+		target    string
+		status    string
+		redirects string
+		downgrade bool
+	}{
+		{plain.URL + "/old", "HTTP 301", "", false},
+		{plain.URL + "/old follow_redirects", "OK", `^http://\S+/old\[301,\S+\]->http://\S+/new\[200,\S+\]$`, false},
+		{plain.URL + "/old follow_redirects=false", "HTTP 301", "", false},
+		{plain.URL + "/loop1 follow_redirects", "FAIL", `^\S+/loop1\[302,\S+\]->\S+/loop2\[302,\S+\]$`, false},
+		{plain.URL + "/old follow_redirects=x", "ERROR", "", false},
+		{secure.URL + "/ follow_redirects=3", "WARN", `^https://\S+\[302,\S+\]->http://\S+/new\[200,\S+\]$`, true},
+	}
+	for _, tt := range tests {
+		test := parseTestConfig("api=" + tt.target)
+		status, _, errMsg := checkHTTP(context.Background(), &test)
+		if status != tt.status {
+			t.Errorf("checkHTTP(%s) = %s (%s), want %s", tt.target, status, errMsg, tt.status)
+		}
+		if got := test.Details["redirects"]; tt.redirects == "" && got != "" || tt.redirects != "" && !regexp.MustCompile(tt.redirects).MatchString(got) {
+			t.Errorf("checkHTTP(%s) redirects = %q, want match for %q", tt.target, got, tt.redirects)
+		}
+		if _, ok := test.Details["downgrade"]; ok != tt.downgrade {
+			t.Errorf("checkHTTP(%s) downgrade detail = %v, want %v", tt.target, ok, tt.downgrade)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// checkRedis sends AUTH (when the URL carries a password) followed by PING
+// and expects a PONG reply. The rediss scheme connects over TLS.
+func checkRedis(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	start := time.Now()
+
+	u, err := url.Parse(test.URL)
+	if err != nil || u.Hostname() == "" {
+		return "ERROR", 0, "Invalid URL"
+	}
+
+	conn, err := dial(ctx, test, "tcp", hostPort(u, "6379"))
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("Connect error: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(testTimeout(test)))
+
+	if u.Scheme == "rediss" {
+		conn, err = tlsClient(ctx, test, conn, u.Hostname())
+		if err != nil {
+			return "FAIL", 0, fmt.Sprintf("TLS handshake error: %v", err)
+		}
+	}
+
+	br := bufio.NewReader(conn)
+	if password, ok := u.User.Password(); ok {
+		args := []string{"AUTH", password}
+		if user := u.User.Username(); user != "" {
+			args = []string{"AUTH", user, password}
+		}
+		reply, err := redisCommand(conn, br, args...)
+		if err != nil {
+			return "FAIL", 0, fmt.Sprintf("AUTH error: %v", err)
+		}
+		if reply != "OK" {
+			return "FAIL", 0, fmt.Sprintf("Unexpected AUTH reply %q", reply)
+		}
+	}
+
+	reply, err := redisCommand(conn, br, "PING")
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("PING error: %v", err)
+	}
+	if reply != "PONG" {
+		return "FAIL", 0, fmt.Sprintf("Unexpected PING reply %q", reply)
+	}
+
+	return "OK", time.Since(start), ""
+}
+
+// redisCommand sends a RESP command and returns its simple-string or bulk
+// reply. Error replies are returned as errors.
+func redisCommand(w io.Writer, br *bufio.Reader, args ...string) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return "", err
+	}
+
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return "", fmt.Errorf("empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return "", fmt.Errorf("%s", line[1:])
+	case '$':
+		var n int
+		if _, err := fmt.Sscanf(line[1:], "%d", &n); err != nil || n < 0 {
+			return "", nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return "", err
+		}
+		return string(buf[:n]), nil
+	}
+	return line, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+// fakeRedis answers AUTH and PING commands, requiring password if non-empty.
+func fakeRedis(password string) func(conn net.Conn) {
+	return func(conn net.Conn) {
+		br := bufio.NewReader(conn)
+		authed := password == ""
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				return
+			}
+			var n int
+			if _, err := fmt.Sscanf(line, "*%d", &n); err != nil {
+				return
+			}
+			args := make([]string, n)
+			for i := range args {
+				br.ReadString('\n')
+				arg, _ := br.ReadString('\n')
+				args[i] = strings.TrimRight(arg, "\r\n")
+			}
+			switch {
+			case args[0] == "AUTH" && args[len(args)-1] == password:
+				authed = true
+				conn.Write([]byte("+OK\r\n"))
+			case args[0] == "AUTH":
+				conn.Write([]byte("-WRONGPASS invalid username-password pair\r\n"))
+			case !authed:
+				conn.Write([]byte("-NOAUTH Authentication required.\r\n"))
+			case args[0] == "PING":
+				conn.Write([]byte("+PONG\r\n"))
+			}
+		}
+	}
+}
+
+func TestCheckRedis(t *testing.T) {
+	tests := []struct {
+		userinfo string
+		status   string
+	}{
+		{":s3cret@", "OK"},
+		{"default:s3cret@", "OK"},
+		{":wrong@", "FAIL"},
+		{"", "FAIL"},
+	}
+
+	for _, tt := range tests {
+		addr := serveOnce(t, fakeRedis("s3cret"))
+		test := &ConnectionTest{URL: "redis://" + tt.userinfo + addr}
+		status, _, errMsg := checkRedis(context.Background(), test)
+		if status != tt.status {
+			t.Errorf("checkRedis(%q) = %s (%s), want %s", test.URL, status, errMsg, tt.status)
+		}
+	}
+}
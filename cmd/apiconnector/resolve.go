@@ -0,0 +1,127 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// resolveOverrides holds the -resolve flags and -hosts-file entries: an
+// address for a host, or for one host:port, used instead of DNS.
+var resolveOverrides = resolveFlags{}
+
+func init() {
+	flag.Var(resolveOverrides, "resolve", "`host[:port]:ip` connect to ip instead of resolving host (repeatable)")
+	flag.Var(hostsFile{resolveOverrides}, "hosts-file", "hosts(5)-format `file` of addresses used instead of resolving the names in it (repeatable)")
+}
+
+// resolveFlags collects repeated -resolve flags, keyed by "host" or
+// "host:port". IPv6 addresses are bracketed, as with curl's --resolve.
+type resolveFlags map[string]string
+
+func (r resolveFlags) String() string {
+	keys := make([]string, 0, len(r))
+	for key := range r {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for i, key := range keys {
+		keys[i] = key + ":" + r[key]
+	}
+	return strings.Join(keys, ", ")
+}
+
+func (r resolveFlags) Set(v string) error {
+	host, rest, ok := strings.Cut(v, ":")
+	if !ok || host == "" {
+		return fmt.Errorf("expected host[:port]:ip")
+	}
+	key := strings.ToLower(host)
+	if port, ip, ok := strings.Cut(rest, ":"); ok && !strings.HasPrefix(rest, "[") {
+		if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+			return fmt.Errorf("invalid port %q", port)
+		}
+		key, rest = net.JoinHostPort(key, port), ip
+	}
+	ip := net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(rest, "["), "]"))
+	if ip == nil {
+		return fmt.Errorf("invalid IP address %q", rest)
+	}
+	r[key] = ip.String()
+	return nil
+}
+
+// resolveAddr applies the "resolve" option, for the target's own host, and
+// else the -resolve overrides to a dial address, preferring one for the
+// exact host:port, and returns the address to connect to and the override
+// used, if any.
+func resolveAddr(test *ConnectionTest, addr string) (string, string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr, "", nil
+	}
+	host = strings.ToLower(host)
+	if test != nil && test.Options["resolve"] != "" && strings.EqualFold(host, targetHost(test)) {
+		ip := net.ParseIP(strings.Trim(test.Options["resolve"], "[]"))
+		if ip == nil {
+			return "", "", fmt.Errorf("invalid resolve address %q", test.Options["resolve"])
+		}
+		return net.JoinHostPort(ip.String(), port), ip.String(), nil
+	}
+	ip, ok := resolveOverrides[net.JoinHostPort(host, port)]
+	if !ok {
+		if ip, ok = resolveOverrides[host]; !ok {
+			return addr, "", nil
+		}
+	}
+	return net.JoinHostPort(ip, port), ip, nil
+}
+
+// targetHost returns the host name in test's URL, or "".
+func targetHost(test *ConnectionTest) string {
+	u, err := url.Parse(test.URL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// hostsFile loads -hosts-file flags into resolve overrides. Each line holds
+// an address and the names it is used for, as in /etc/hosts; "#" starts a
+// comment. The first address for a name wins, and -resolve flags win over
+// any file.
+type hostsFile struct {
+	overrides resolveFlags
+}
+
+func (h hostsFile) String() string { return "" }
+
+func (h hostsFile) Set(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	for n, line := range strings.Split(string(b), "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		ip := net.ParseIP(fields[0])
+		if ip == nil || len(fields) < 2 {
+			return fmt.Errorf("%s:%d: expected an address and host names", path, n+1)
+		}
+		for _, name := range fields[1:] {
+			key := strings.ToLower(name)
+			if _, ok := h.overrides[key]; !ok {
+				h.overrides[key] = ip.String()
+			}
+		}
+	}
+	return nil
+}
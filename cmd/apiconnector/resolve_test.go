@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveFlags(t *testing.T) {
+	tests := []struct {
+		in, key, ip string
+	}{
+		{"api.example.com:10.0.0.5", "api.example.com", "10.0.0.5"},
+		{"API.example.com:443:10.0.0.5", "api.example.com:443", "10.0.0.5"},
+		{"api.example.com:[2001:db8::1]", "api.example.com", "2001:db8::1"},
+		{"api.example.com:8443:[2001:db8::1]", "api.example.com:8443", "2001:db8::1"},
+		{"api.example.com", "", ""},
+		{"api.example.com:backend", "", ""},
+		{"api.example.com:http:10.0.0.5", "", ""},
+	}
+	for _, tt := range tests {
+		r := resolveFlags{}
+		err := r.Set(tt.in)
+		if tt.key == "" {
+			if err == nil {
+				t.Errorf("Set(%q) = %v, want error", tt.in, r)
+			}
+			continue
+		}
+		if err != nil || r[tt.key] != tt.ip {
+			t.Errorf("Set(%q) = %v (%v), want %s=%s", tt.in, r, err, tt.key, tt.ip)
+		}
+	}
+}
+
+func TestSNIAndResolve(t *testing.T) {
+	root, rootKey := issueCert(t, "Test Root", true, nil, nil)
+	leaf, leafKey := issueCert(t, "api.test", false, root, rootKey)
+
+	var sni string
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sni = r.TLS.ServerName
+	}))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{leaf.Raw}, PrivateKey: leafKey}}}
+	srv.StartTLS()
+	defer srv.Close()
+	port := srv.URL[strings.LastIndex(srv.URL, ":")+1:]
+	tlsRootCAs = x509.NewCertPool()
+	tlsRootCAs.AddCert(root)
+	defer func() { tlsRootCAs = nil }()
+
+	test := parseTestConfig("api=" + srv.URL + " sni=api.test")
+	if status, _, errMsg := checkHTTP(context.Background(), &test); status != "OK" || sni != "api.test" {
+		t.Errorf("checkHTTP with sni=api.test = %s (%s), server saw SNI %q", status, errMsg, sni)
+	}
+	test = parseTestConfig("api=tls://" + strings.TrimPrefix(srv.URL, "https://") + " sni=other.test")
+	if status, _, errMsg := checkTLS(context.Background(), &test); status != "FAIL" || !strings.Contains(errMsg, "other.test") {
+		t.Errorf("checkTLS with sni=other.test = %s (%s), want FAIL naming other.test", status, errMsg)
+	}
+
+	resolveOverrides.Set("api.test:" + port + ":127.0.0.1")
+	defer delete(resolveOverrides, "api.test:"+port)
+	sni = ""
+	test = parseTestConfig("api=https://api.test:" + port + "/")
+	if status, _, errMsg := checkHTTP(context.Background(), &test); status != "OK" || sni != "api.test" || test.Details["resolve"] != "127.0.0.1" {
+		t.Errorf("checkHTTP with -resolve = %s (%s) %v, server saw SNI %q", status, errMsg, test.Details, sni)
+	}
+}
+
+func TestHostsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts")
+	os.WriteFile(path, []byte("# cutover backends\n10.0.0.5 api.example.com API2.example.com  # new\n\n10.0.0.6 api.example.com\n2001:db8::1 v6.example.com\n"), 0o644)
+
+	r := resolveFlags{"api2.example.com": "10.0.0.9"}
+	if err := (hostsFile{r}).Set(path); err != nil {
+		t.Fatal(err)
+	}
+	want := resolveFlags{"api.example.com": "10.0.0.5", "api2.example.com": "10.0.0.9", "v6.example.com": "2001:db8::1"}
+	if r.String() != want.String() {
+		t.Errorf("hosts file overrides = %v, want %v", r, want)
+	}
+
+	os.WriteFile(path, []byte("api.example.com 10.0.0.5\n"), 0o644)
+	if err := (hostsFile{resolveFlags{}}).Set(path); err == nil || !strings.Contains(err.Error(), ":1:") {
+		t.Errorf("Set with reversed fields = %v, want a line 1 error", err)
+	}
+}
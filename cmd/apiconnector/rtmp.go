@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+)
+
+// rtmpHandshakeSize is the length of the C1/S1/C2/S2 handshake chunks.
+const rtmpHandshakeSize = 1536
+
+// checkRTMP performs the simple RTMP handshake (C0/C1, S0/S1/S2, C2) and
+// verifies the server speaks RTMP version 3 and echoes our C1. rtmps://
+// connects over TLS.
+func checkRTMP(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	start := time.Now()
+
+	u, err := url.Parse(test.URL)
+	if err != nil || u.Hostname() == "" {
+		return "ERROR", 0, "Invalid URL"
+	}
+
+	defaultPort := "1935"
+	if u.Scheme == "rtmps" {
+		defaultPort = "443"
+	}
+	conn, err := dial(ctx, test, "tcp", hostPort(u, defaultPort))
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("Connect error: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(testTimeout(test)))
+
+	if u.Scheme == "rtmps" {
+		conn, err = tlsClient(ctx, test, conn, u.Hostname())
+		if err != nil {
+			return "FAIL", 0, fmt.Sprintf("TLS handshake error: %v", err)
+		}
+	}
+
+	// C1: 4-byte time, 4 zero bytes, random fill.
+	c1 := make([]byte, rtmpHandshakeSize)
+	rand.Read(c1[8:])
+	if _, err := conn.Write(append([]byte{3}, c1...)); err != nil {
+		return "FAIL", 0, fmt.Sprintf("Handshake write error: %v", err)
+	}
+
+	s := make([]byte, 1+2*rtmpHandshakeSize)
+	if _, err := io.ReadFull(conn, s); err != nil {
+		return "FAIL", 0, fmt.Sprintf("Handshake read error: %v", err)
+	}
+	if s[0] != 3 {
+		return "FAIL", 0, fmt.Sprintf("Unsupported RTMP version %d", s[0])
+	}
+	s1, s2 := s[1:1+rtmpHandshakeSize], s[1+rtmpHandshakeSize:]
+	if !bytes.Equal(s2[8:], c1[8:]) {
+		return "FAIL", 0, "Server did not echo the handshake"
+	}
+	if _, err := conn.Write(s1); err != nil {
+		return "FAIL", 0, fmt.Sprintf("Handshake write error: %v", err)
+	}
+
+	return "OK", time.Since(start), ""
+}
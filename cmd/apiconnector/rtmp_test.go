@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestCheckRTMP(t *testing.T) {
+	tests := []struct {
+		name    string
+		version byte
+		echo    bool
+		status  string
+	}{
+		{"handshake", 3, true, "OK"},
+		{"wrong version", 6, true, "FAIL"},
+		{"no echo", 3, false, "FAIL"},
+	}
+
+	for _, tt := range tests {
+		addr := serveOnce(t, func(conn net.Conn) {
+			c := make([]byte, 1+rtmpHandshakeSize)
+			if _, err := io.ReadFull(conn, c); err != nil {
+				return
+			}
+			s2 := c[1:]
+			if !tt.echo {
+				s2 = make([]byte, rtmpHandshakeSize)
+			}
+			conn.Write(append(append([]byte{tt.version}, make([]byte, rtmpHandshakeSize)...), s2...))
+			io.ReadFull(conn, make([]byte, rtmpHandshakeSize))
+		})
+
+		test := &ConnectionTest{URL: "rtmp://" + addr + "/live"}
+		if status, _, errMsg := checkRTMP(context.Background(), test); status != tt.status {
+			t.Errorf("%s: checkRTMP = %s (%s), want %s", tt.name, status, errMsg, tt.status)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// checkRTSP sends RTSP OPTIONS and, when the URL names a stream path,
+// DESCRIBE, requiring 200 responses. It reports the advertised methods and
+// the number of media sections in the stream's SDP. URL credentials are sent
+// with Basic authentication; rtsps:// connects over TLS.
+func checkRTSP(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	start := time.Now()
+
+	u, err := url.Parse(test.URL)
+	if err != nil || u.Hostname() == "" {
+		return "ERROR", 0, "Invalid URL"
+	}
+
+	defaultPort := "554"
+	if u.Scheme == "rtsps" {
+		defaultPort = "322"
+	}
+	conn, err := dial(ctx, test, "tcp", hostPort(u, defaultPort))
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("Connect error: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(testTimeout(test)))
+
+	if u.Scheme == "rtsps" {
+		conn, err = tlsClient(ctx, test, conn, u.Hostname())
+		if err != nil {
+			return "FAIL", 0, fmt.Sprintf("TLS handshake error: %v", err)
+		}
+	}
+
+	stream := *u
+	stream.User = nil
+	var auth string
+	if u.User != nil {
+		password, _ := u.User.Password()
+		auth = "Basic " + base64.StdEncoding.EncodeToString([]byte(u.User.Username()+":"+password))
+	}
+
+	br := bufio.NewReader(conn)
+	code, reason, headers, _, err := rtspRequest(conn, br, "OPTIONS", stream.String(), 1, auth)
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("OPTIONS error: %v", err)
+	}
+	if code != 200 {
+		return "FAIL", time.Since(start), fmt.Sprintf("OPTIONS returned RTSP %d %s", code, reason)
+	}
+	if public := headers["public"]; public != "" {
+		setDetail(test, "methods", strings.ReplaceAll(public, " ", ""))
+	}
+
+	if strings.Trim(u.Path, "/") == "" {
+		return "OK", time.Since(start), ""
+	}
+
+	code, reason, _, body, err := rtspRequest(conn, br, "DESCRIBE", stream.String(), 2, auth)
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("DESCRIBE error: %v", err)
+	}
+	if code != 200 {
+		return "FAIL", time.Since(start), fmt.Sprintf("DESCRIBE returned RTSP %d %s", code, reason)
+	}
+	media := 0
+	for _, line := range strings.Split(string(body), "\n") {
+		if strings.HasPrefix(line, "m=") {
+			media++
+		}
+	}
+	setDetail(test, "media", strconv.Itoa(media))
+
+	return "OK", time.Since(start), ""
+}
+
+// rtspRequest sends one RTSP request and reads the response, returning the
+// status, lower-cased headers and body.
+func rtspRequest(conn net.Conn, br *bufio.Reader, method, target string, cseq int, auth string) (int, string, map[string]string, []byte, error) {
+	var req strings.Builder
+	fmt.Fprintf(&req, "%s %s RTSP/1.0\r\nCSeq: %d\r\nUser-Agent: apiconnector\r\n", method, target, cseq)
+	if method == "DESCRIBE" {
+		req.WriteString("Accept: application/sdp\r\n")
+	}
+	if auth != "" {
+		fmt.Fprintf(&req, "Authorization: %s\r\n", auth)
+	}
+	req.WriteString("\r\n")
+	if _, err := conn.Write([]byte(req.String())); err != nil {
+		return 0, "", nil, nil, err
+	}
+
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return 0, "", nil, nil, err
+	}
+	fields := strings.SplitN(strings.TrimSpace(line), " ", 3)
+	if len(fields) < 2 || !strings.HasPrefix(fields[0], "RTSP/") {
+		return 0, "", nil, nil, fmt.Errorf("invalid status line %q", strings.TrimSpace(line))
+	}
+	code, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return 0, "", nil, nil, fmt.Errorf("invalid status code %q", fields[1])
+	}
+	reason := ""
+	if len(fields) == 3 {
+		reason = fields[2]
+	}
+
+	headers := make(map[string]string)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return 0, "", nil, nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		k, v, _ := strings.Cut(line, ":")
+		headers[strings.ToLower(strings.TrimSpace(k))] = strings.TrimSpace(v)
+	}
+
+	var body []byte
+	if n, _ := strconv.Atoi(headers["content-length"]); n > 0 {
+		body = make([]byte, n)
+		if _, err := io.ReadFull(br, body); err != nil {
+			return 0, "", nil, nil, err
+		}
+	}
+	return code, reason, headers, body, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+const testSDP = "v=0\r\no=- 0 0 IN IP4 127.0.0.1\r\ns=cam\r\nt=0 0\r\nm=video 0 RTP/AVP 96\r\nm=audio 0 RTP/AVP 97\r\n"
+
+// fakeRTSP answers OPTIONS and DESCRIBE for /live, requiring admin:admin.
+func fakeRTSP(conn net.Conn) {
+	br := bufio.NewReader(conn)
+	for {
+		var lines []string
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if line == "\r\n" {
+				break
+			}
+			lines = append(lines, strings.TrimSpace(line))
+		}
+		req := strings.Join(lines, "\n")
+		cseq := strings.Fields(lines[1])[1]
+		switch {
+		case !strings.Contains(req, "Authorization: Basic YWRtaW46YWRtaW4="):
+			fmt.Fprintf(conn, "RTSP/1.0 401 Unauthorized\r\nCSeq: %s\r\n\r\n", cseq)
+		case strings.HasPrefix(req, "OPTIONS "):
+			fmt.Fprintf(conn, "RTSP/1.0 200 OK\r\nCSeq: %s\r\nPublic: OPTIONS, DESCRIBE, SETUP, PLAY, TEARDOWN\r\n\r\n", cseq)
+		case strings.HasPrefix(req, "DESCRIBE ") && strings.Contains(lines[0], "/live "):
+			fmt.Fprintf(conn, "RTSP/1.0 200 OK\r\nCSeq: %s\r\nContent-Type: application/sdp\r\nContent-Length: %d\r\n\r\n%s", cseq, len(testSDP), testSDP)
+		default:
+			fmt.Fprintf(conn, "RTSP/1.0 404 Not Found\r\nCSeq: %s\r\n\r\n", cseq)
+		}
+	}
+}
+
+func TestCheckRTSP(t *testing.T) {
+	tests := []struct {
+		url    string
+		status string
+		media  string
+	}{
+		{"rtsp://admin:admin@%s", "OK", ""},
+		{"rtsp://admin:admin@%s/live", "OK", "2"},
+		{"rtsp://admin:admin@%s/missing", "FAIL", ""},
+		{"rtsp://%s/live", "FAIL", ""},
+	}
+
+	for _, tt := range tests {
+		test := &ConnectionTest{URL: fmt.Sprintf(tt.url, serveOnce(t, fakeRTSP))}
+		status, _, errMsg := checkRTSP(context.Background(), test)
+		if status != tt.status || test.Details["media"] != tt.media {
+			t.Errorf("checkRTSP(%q) = %s (%s) %v, want %s media=%s", test.URL, status, errMsg, test.Details, tt.status, tt.media)
+		}
+		if status == "OK" && test.Details["methods"] != "OPTIONS,DESCRIBE,SETUP,PLAY,TEARDOWN" {
+			t.Errorf("methods = %q", test.Details["methods"])
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// scramClient implements the client side of a SCRAM exchange (RFC 5802,
+// RFC 7677) without channel binding.
+type scramClient struct {
+	newHash   func() hash.Hash
+	username  string
+	password  string
+	nonce     string
+	firstBare string
+	authMsg   string
+	salted    []byte
+}
+
+// newSCRAMClient returns a client for mechanism "SCRAM-SHA-1" or
+// "SCRAM-SHA-256".
+func newSCRAMClient(mechanism, username, password string) (*scramClient, error) {
+	c := &scramClient{username: username, password: password}
+	switch mechanism {
+	case "SCRAM-SHA-1":
+		c.newHash = sha1.New
+	case "SCRAM-SHA-256":
+		c.newHash = sha256.New
+	default:
+		return nil, fmt.Errorf("unsupported SASL mechanism %s", mechanism)
+	}
+	var raw [18]byte
+	if _, err := rand.Read(raw[:]); err != nil {
+		return nil, err
+	}
+	c.nonce = base64.RawStdEncoding.EncodeToString(raw[:])
+	return c, nil
+}
+
+// first returns the client-first-message.
+func (c *scramClient) first() string {
+	name := strings.NewReplacer("=", "=3D", ",", "=2C").Replace(c.username)
+	c.firstBare = "n=" + name + ",r=" + c.nonce
+	return "n,," + c.firstBare
+}
+
+// final consumes the server-first-message and returns the
+// client-final-message carrying the proof.
+func (c *scramClient) final(serverFirst string) (string, error) {
+	attrs := scramAttributes(serverFirst)
+	nonce, salt64, iterStr := attrs["r"], attrs["s"], attrs["i"]
+	if !strings.HasPrefix(nonce, c.nonce) {
+		return "", fmt.Errorf("server nonce does not extend client nonce")
+	}
+	salt, err := base64.StdEncoding.DecodeString(salt64)
+	if err != nil {
+		return "", fmt.Errorf("invalid salt: %v", err)
+	}
+	iterations, err := strconv.Atoi(iterStr)
+	if err != nil || iterations <= 0 {
+		return "", fmt.Errorf("invalid iteration count %q", iterStr)
+	}
+
+	c.salted = pbkdf2.Key([]byte(c.password), salt, iterations, c.newHash().Size(), c.newHash)
+	clientKey := c.hmac(c.salted, "Client Key")
+	h := c.newHash()
+	h.Write(clientKey)
+	storedKey := h.Sum(nil)
+
+	withoutProof := "c=biws,r=" + nonce
+	c.authMsg = c.firstBare + "," + serverFirst + "," + withoutProof
+	signature := c.hmac(storedKey, c.authMsg)
+	proof := make([]byte, len(clientKey))
+	for i := range clientKey {
+		proof[i] = clientKey[i] ^ signature[i]
+	}
+	return withoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof), nil
+}
+
+// verify checks the server-final-message signature.
+func (c *scramClient) verify(serverFinal string) error {
+	attrs := scramAttributes(serverFinal)
+	if e := attrs["e"]; e != "" {
+		return fmt.Errorf("server rejected authentication: %s", e)
+	}
+	serverKey := c.hmac(c.salted, "Server Key")
+	want := base64.StdEncoding.EncodeToString(c.hmac(serverKey, c.authMsg))
+	if !hmac.Equal([]byte(attrs["v"]), []byte(want)) {
+		return fmt.Errorf("server signature mismatch")
+	}
+	return nil
+}
+
+func (c *scramClient) hmac(key []byte, msg string) []byte {
+	mac := hmac.New(c.newHash, key)
+	mac.Write([]byte(msg))
+	return mac.Sum(nil)
+}
+
+// scramAttributes splits a SCRAM message into its single-letter attributes.
+func scramAttributes(msg string) map[string]string {
+	attrs := make(map[string]string)
+	for _, part := range strings.Split(msg, ",") {
+		if key, value, ok := strings.Cut(part, "="); ok {
+			attrs[key] = value
+		}
+	}
+	return attrs
+}
@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+// TestSCRAMClient replays the SCRAM-SHA-256 exchange from RFC 7677 section 3.
+func TestSCRAMClient(t *testing.T) {
+	c, err := newSCRAMClient("SCRAM-SHA-256", "user", "pencil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.nonce = "rOprNGfwEbeRWgbNEkqO"
+
+	if got, want := c.first(), "n,,n=user,r=rOprNGfwEbeRWgbNEkqO"; got != want {
+		t.Errorf("first() = %q, want %q", got, want)
+	}
+
+	serverFirst := "r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"
+	final, err := c.final(serverFirst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ="
+	if final != want {
+		t.Errorf("final() = %q, want %q", final, want)
+	}
+
+	if err := c.verify("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="); err != nil {
+		t.Errorf("verify() = %v", err)
+	}
+	if err := c.verify("v=AAAA"); err == nil {
+		t.Error("verify() accepted a bad server signature")
+	}
+}
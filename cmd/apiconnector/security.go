@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var auditSecurityHeaders = flag.Bool("audit-security-headers", false, "grade the security headers of every HTTPS target")
+
+// securityHeaderChecks are the headers graded by the security header
+// audit, each with a short name for the report and a test of the response.
+var securityHeaderChecks = []struct {
+	name string
+	ok   func(h http.Header) bool
+}{
+	{"hsts", func(h http.Header) bool {
+		for _, directive := range strings.Split(h.Get("Strict-Transport-Security"), ";") {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(strings.ToLower(directive)), "max-age="); ok {
+				age, err := strconv.Atoi(strings.Trim(v, `"`))
+				return err == nil && age > 0
+			}
+		}
+		return false
+	}},
+	{"nosniff", func(h http.Header) bool {
+		return strings.EqualFold(strings.TrimSpace(h.Get("X-Content-Type-Options")), "nosniff")
+	}},
+	{"frame", func(h http.Header) bool {
+		switch strings.ToUpper(strings.TrimSpace(h.Get("X-Frame-Options"))) {
+		case "DENY", "SAMEORIGIN":
+			return true
+		}
+		return strings.Contains(strings.ToLower(h.Get("Content-Security-Policy")), "frame-ancestors")
+	}},
+	{"csp", func(h http.Header) bool { return h.Get("Content-Security-Policy") != "" }},
+	{"referrer", func(h http.Header) bool { return h.Get("Referrer-Policy") != "" }},
+}
+
+// auditSecurity grades the security headers of an HTTPS response when the
+// -audit-security-headers flag or the "audit_security_headers" option is
+// set: HSTS with a max-age, X-Content-Type-Options: nosniff, framing
+// protection (X-Frame-Options or CSP frame-ancestors), a CSP and a
+// Referrer-Policy. The "security_headers" detail is "pass" when all are
+// present and "warn" otherwise, with the missing ones listed in
+// "missing_headers". The grade is reported alongside the check's result
+// and does not change it.
+func auditSecurity(test *ConnectionTest, resp *http.Response) {
+	if !*auditSecurityHeaders && !boolOption(test, "audit_security_headers") || resp.Request.URL.Scheme != "https" {
+		return
+	}
+	var missing []string
+	for _, c := range securityHeaderChecks {
+		if !c.ok(resp.Header) {
+			missing = append(missing, c.name)
+		}
+	}
+	if len(missing) > 0 {
+		setDetail(test, "security_headers", "warn")
+		setDetail(test, "missing_headers", strings.Join(missing, ","))
+		return
+	}
+	setDetail(test, "security_headers", "pass")
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuditSecurityHeaders(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/hardened" {
+			w.Header().Set("Strict-Transport-Security", "max-age=31536000; includeSubDomains")
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			w.Header().Set("Content-Security-Policy", "default-src 'self'; frame-ancestors 'none'")
+			w.Header().Set("Referrer-Policy", "no-referrer")
+		} else {
+			w.Header().Set("X-Frame-Options", "DENY")
+			w.Header().Set("Strict-Transport-Security", "max-age=0")
+		}
+	}))
+	defer srv.Close()
+	tlsRootCAs = x509.NewCertPool()
+	tlsRootCAs.AddCert(srv.Certificate())
+	defer func() { tlsRootCAs = nil }()
+
+	tests := []struct {
+		target  string
+		flag    bool
+		grade   string
+		missing string
+	}{
+		{"/hardened audit_security_headers", false, "pass", ""},
+		{"/hardened", true, "pass", ""},
+		{"/legacy", true, "warn", "hsts,nosniff,csp,referrer"},
+		{"/legacy", false, "", ""},
+	}
+	for _, tt := range tests {
+		*auditSecurityHeaders = tt.flag
+		test := parseTestConfig("web=" + srv.URL + tt.target)
+		status, _, errMsg := checkHTTP(context.Background(), &test)
+		if status != "OK" || test.Details["security_headers"] != tt.grade || test.Details["missing_headers"] != tt.missing {
+			t.Errorf("checkHTTP(%s, flag %v) = %s (%s) %v, want OK security_headers=%q missing_headers=%q", tt.target, tt.flag, status, errMsg, test.Details, tt.grade, tt.missing)
+		}
+	}
+	*auditSecurityHeaders = false
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SFTP v3 packet types (draft-ietf-secsh-filexfer-02).
+const (
+	sftpFxpInit    = 1
+	sftpFxpVersion = 2
+	sftpFxpStat    = 17
+	sftpFxpStatus  = 101
+	sftpFxpAttrs   = 105
+)
+
+// sftpStat opens the SFTP subsystem on client, negotiates the protocol
+// version and stats path, returning the server's SFTP version.
+func sftpStat(client *ssh.Client, path string) (uint32, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return 0, err
+	}
+	defer session.Close()
+
+	w, err := session.StdinPipe()
+	if err != nil {
+		return 0, err
+	}
+	r, err := session.StdoutPipe()
+	if err != nil {
+		return 0, err
+	}
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		return 0, err
+	}
+
+	if err := sftpWritePacket(w, sftpFxpInit, binary.BigEndian.AppendUint32(nil, 3)); err != nil {
+		return 0, err
+	}
+	typ, payload, err := sftpReadPacket(r)
+	if err != nil {
+		return 0, err
+	}
+	if typ != sftpFxpVersion || len(payload) < 4 {
+		return 0, fmt.Errorf("unexpected packet type %d in reply to INIT", typ)
+	}
+	version := binary.BigEndian.Uint32(payload)
+
+	req := binary.BigEndian.AppendUint32(nil, 1) // request id
+	req = binary.BigEndian.AppendUint32(req, uint32(len(path)))
+	req = append(req, path...)
+	if err := sftpWritePacket(w, sftpFxpStat, req); err != nil {
+		return 0, err
+	}
+	typ, payload, err = sftpReadPacket(r)
+	if err != nil {
+		return 0, err
+	}
+	switch typ {
+	case sftpFxpAttrs:
+		return version, nil
+	case sftpFxpStatus:
+		if len(payload) < 8 {
+			return 0, errors.New("malformed status")
+		}
+		code := binary.BigEndian.Uint32(payload[4:])
+		msg := ""
+		if len(payload) >= 12 {
+			n := binary.BigEndian.Uint32(payload[8:])
+			if uint32(len(payload)-12) >= n {
+				msg = string(payload[12 : 12+n])
+			}
+		}
+		return 0, fmt.Errorf("stat %s: status %d %s", path, code, msg)
+	default:
+		return 0, fmt.Errorf("unexpected packet type %d in reply to STAT", typ)
+	}
+}
+
+func sftpWritePacket(w io.Writer, typ byte, payload []byte) error {
+	b := binary.BigEndian.AppendUint32(nil, uint32(len(payload)+1))
+	b = append(b, typ)
+	_, err := w.Write(append(b, payload...))
+	return err
+}
+
+func sftpReadPacket(r io.Reader) (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	n := binary.BigEndian.Uint32(header[:4])
+	if n < 1 || n > 1<<18 {
+		return 0, nil, fmt.Errorf("invalid packet length %d", n)
+	}
+	payload := make([]byte, n-1)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return header[4], payload, nil
+}
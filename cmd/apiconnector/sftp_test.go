@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// fakeSFTP runs an SSH server for alice/pw whose sftp subsystem answers
+// STAT for "data" and reports no such file for anything else.
+func fakeSFTP(t *testing.T) func(conn net.Conn) {
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return func(conn net.Conn) {
+		config := &ssh.ServerConfig{
+			PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+				if c.User() == "alice" && string(pass) == "pw" {
+					return nil, nil
+				}
+				return nil, ssh.ErrNoAuth
+			},
+		}
+		config.AddHostKey(signer)
+		sconn, chans, reqs, err := ssh.NewServerConn(conn, config)
+		if err != nil {
+			return
+		}
+		defer sconn.Close()
+		go ssh.DiscardRequests(reqs)
+
+		for nc := range chans {
+			ch, reqs, err := nc.Accept()
+			if err != nil {
+				return
+			}
+			req := <-reqs
+			req.Reply(req.Type == "subsystem" && string(req.Payload[4:]) == "sftp", nil)
+			go ssh.DiscardRequests(reqs)
+
+			for {
+				typ, payload, err := sftpReadPacket(ch)
+				if err != nil {
+					break
+				}
+				switch typ {
+				case sftpFxpInit:
+					sftpWritePacket(ch, sftpFxpVersion, binary.BigEndian.AppendUint32(nil, 3))
+				case sftpFxpStat:
+					id := payload[:4]
+					if string(payload[8:]) == "data" {
+						sftpWritePacket(ch, sftpFxpAttrs, append(id, 0, 0, 0, 0))
+						continue
+					}
+					status := binary.BigEndian.AppendUint32(append([]byte{}, id...), 2)
+					status = binary.BigEndian.AppendUint32(status, 14)
+					status = append(status, "No such file"...)
+					sftpWritePacket(ch, sftpFxpStatus, append(status, 0, 0, 0, 0))
+				}
+			}
+			ch.Close()
+		}
+	}
+}
+
+func TestCheckSFTP(t *testing.T) {
+	tests := []struct {
+		url    string
+		status string
+	}{
+		{"sftp://alice:pw@%s/data", "OK"},
+		{"sftp://alice:pw@%s/missing", "FAIL"},
+		{"sftp://alice:wrong@%s/data", "FAIL"},
+		{"sftp://%s/data", "FAIL"},
+	}
+
+	for _, tt := range tests {
+		addr := serveOnce(t, fakeSFTP(t))
+		test := &ConnectionTest{URL: fmt.Sprintf(tt.url, addr)}
+		status, _, errMsg := checkSSH(context.Background(), test)
+		if status != tt.status {
+			t.Errorf("checkSSH(%q) = %s (%s), want %s", test.URL, status, errMsg, tt.status)
+		}
+		if status == "OK" && test.Details["sftp"] != "v3" {
+			t.Errorf("checkSSH(%q) Details = %v, want sftp=v3", test.URL, test.Details)
+		}
+	}
+}
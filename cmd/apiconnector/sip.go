@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// checkSIP sends a SIP OPTIONS request and expects a 200 response,
+// reporting the server's User-Agent or Server header. sip:// uses UDP unless
+// "transport=tcp" is given; sips:// uses TLS. Provisional 1xx responses are
+// skipped.
+func checkSIP(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	start := time.Now()
+
+	u, err := url.Parse(test.URL)
+	if err != nil || u.Hostname() == "" {
+		return "ERROR", 0, "Invalid URL"
+	}
+
+	transport, network, defaultPort := "UDP", "udp", "5060"
+	switch {
+	case u.Scheme == "sips":
+		transport, network, defaultPort = "TLS", "tcp", "5061"
+	case test.Options["transport"] == "tcp":
+		transport, network = "TCP", "tcp"
+	case test.Options["transport"] != "" && test.Options["transport"] != "udp":
+		return "ERROR", 0, fmt.Sprintf("Invalid transport %q (udp or tcp)", test.Options["transport"])
+	}
+
+	conn, err := dial(ctx, test, network, hostPort(u, defaultPort))
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("Connect error: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(testTimeout(test)))
+
+	if transport == "TLS" {
+		conn, err = tlsClient(ctx, test, conn, u.Hostname())
+		if err != nil {
+			return "FAIL", 0, fmt.Sprintf("TLS handshake error: %v", err)
+		}
+	}
+
+	target := "sip:" + u.Host
+	if user := u.User.Username(); user != "" {
+		target = "sip:" + user + "@" + u.Host
+	}
+	local := conn.LocalAddr().String()
+	branch, tag, callID := sipToken(), sipToken(), sipToken()
+
+	var req strings.Builder
+	fmt.Fprintf(&req, "OPTIONS %s SIP/2.0\r\n", target)
+	fmt.Fprintf(&req, "Via: SIP/2.0/%s %s;branch=z9hG4bK%s;rport\r\n", transport, local, branch)
+	req.WriteString("Max-Forwards: 70\r\n")
+	fmt.Fprintf(&req, "From: <sip:apiconnector@%s>;tag=%s\r\n", local, tag)
+	fmt.Fprintf(&req, "To: <%s>\r\n", target)
+	fmt.Fprintf(&req, "Call-ID: %s@apiconnector\r\n", callID)
+	req.WriteString("CSeq: 1 OPTIONS\r\n")
+	fmt.Fprintf(&req, "Contact: <sip:apiconnector@%s>\r\n", local)
+	req.WriteString("Accept: application/sdp\r\n")
+	req.WriteString("Content-Length: 0\r\n\r\n")
+	if _, err := conn.Write([]byte(req.String())); err != nil {
+		return "FAIL", 0, fmt.Sprintf("Send error: %v", err)
+	}
+
+	br := bufio.NewReader(conn)
+	for {
+		code, reason, headers, err := sipReadResponse(br)
+		if err != nil {
+			return "FAIL", 0, fmt.Sprintf("Receive error: %v", err)
+		}
+		if code < 200 {
+			continue
+		}
+		if ua := headers["user-agent"]; ua != "" {
+			setDetail(test, "server", ua)
+		} else if server := headers["server"]; server != "" {
+			setDetail(test, "server", server)
+		}
+		if code != 200 {
+			return "FAIL", time.Since(start), fmt.Sprintf("SIP %d %s", code, reason)
+		}
+		return "OK", time.Since(start), ""
+	}
+}
+
+// sipReadResponse reads a SIP response status line and headers, skipping
+// any body. Header names are lower-cased.
+func sipReadResponse(br *bufio.Reader) (int, string, map[string]string, error) {
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return 0, "", nil, err
+	}
+	fields := strings.SplitN(strings.TrimSpace(line), " ", 3)
+	if len(fields) < 2 || fields[0] != "SIP/2.0" {
+		return 0, "", nil, fmt.Errorf("invalid status line %q", strings.TrimSpace(line))
+	}
+	code, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return 0, "", nil, fmt.Errorf("invalid status code %q", fields[1])
+	}
+	reason := ""
+	if len(fields) == 3 {
+		reason = fields[2]
+	}
+
+	headers := make(map[string]string)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return 0, "", nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		k, v, _ := strings.Cut(line, ":")
+		headers[strings.ToLower(strings.TrimSpace(k))] = strings.TrimSpace(v)
+	}
+	if n, _ := strconv.Atoi(headers["content-length"]); n > 0 {
+		br.Discard(n)
+	}
+	return code, reason, headers, nil
+}
+
+// sipToken returns a random token for branch, tag and Call-ID values.
+func sipToken() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+// sipReply builds a response echoing the request's Via, From, To, Call-ID
+// and CSeq headers.
+func sipReply(req, status string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "SIP/2.0 %s\r\n", status)
+	for _, line := range strings.Split(req, "\r\n") {
+		for _, h := range []string{"Via:", "From:", "To:", "Call-ID:", "CSeq:"} {
+			if strings.HasPrefix(line, h) {
+				b.WriteString(line + "\r\n")
+			}
+		}
+	}
+	b.WriteString("User-Agent: Asterisk PBX 20.5.0\r\nContent-Length: 0\r\n\r\n")
+	return b.String()
+}
+
+func TestCheckSIPUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	go func() {
+		buf := make([]byte, 4096)
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil || !strings.HasPrefix(string(buf[:n]), "OPTIONS sip:") {
+			return
+		}
+		pc.WriteTo([]byte(sipReply(string(buf[:n]), "100 Trying")), addr)
+		pc.WriteTo([]byte(sipReply(string(buf[:n]), "200 OK")), addr)
+	}()
+
+	test := &ConnectionTest{URL: "sip://" + pc.LocalAddr().String()}
+	status, _, errMsg := checkSIP(context.Background(), test)
+	if status != "OK" || test.Details["server"] != "Asterisk PBX 20.5.0" {
+		t.Errorf("checkSIP = %s (%s) %v, want OK from Asterisk", status, errMsg, test.Details)
+	}
+}
+
+func TestCheckSIPTCP(t *testing.T) {
+	tests := []struct {
+		reply  string
+		status string
+		errMsg string
+	}{
+		{"200 OK", "OK", ""},
+		{"404 Not Found", "FAIL", "SIP 404 Not Found"},
+	}
+
+	for _, tt := range tests {
+		addr := serveOnce(t, func(conn net.Conn) {
+			br := bufio.NewReader(conn)
+			var req strings.Builder
+			for {
+				line, err := br.ReadString('\n')
+				if err != nil {
+					return
+				}
+				req.WriteString(line)
+				if line == "\r\n" {
+					break
+				}
+			}
+			if !strings.Contains(req.String(), "Via: SIP/2.0/TCP ") {
+				return
+			}
+			conn.Write([]byte(sipReply(req.String(), tt.reply)))
+		})
+
+		test := parseTestConfig("voip=sip://" + addr + " transport=tcp")
+		status, _, errMsg := checkSIP(context.Background(), &test)
+		if status != tt.status || errMsg != tt.errMsg {
+			t.Errorf("checkSIP = %s (%s), want %s (%s)", status, errMsg, tt.status, tt.errMsg)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// checkSMTP reads the 220 greeting and issues EHLO, reporting the
+// advertised extensions. With the "starttls" option it also negotiates
+// STARTTLS and reports the certificate expiry date; the smtps scheme uses
+// implicit TLS instead.
+func checkSMTP(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	start := time.Now()
+
+	u, err := url.Parse(test.URL)
+	if err != nil || u.Hostname() == "" {
+		return "ERROR", 0, "Invalid URL"
+	}
+
+	defaultPort := "25"
+	if u.Scheme == "smtps" {
+		defaultPort = "465"
+	}
+	conn, err := dial(ctx, test, "tcp", hostPort(u, defaultPort))
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("Connect error: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(testTimeout(test)))
+
+	if u.Scheme == "smtps" {
+		conn, err = tlsClient(ctx, test, conn, u.Hostname())
+		if err != nil {
+			return "FAIL", 0, fmt.Sprintf("TLS handshake error: %v", err)
+		}
+	}
+
+	text := textproto.NewConn(conn)
+	if _, _, err := text.ReadResponse(220); err != nil {
+		return "FAIL", time.Since(start), fmt.Sprintf("Greeting error: %v", err)
+	}
+
+	extensions, err := smtpEHLO(text)
+	if err != nil {
+		return "FAIL", time.Since(start), fmt.Sprintf("EHLO error: %v", err)
+	}
+
+	if boolOption(test, "starttls") && u.Scheme != "smtps" {
+		if !smtpHasExtension(extensions, "STARTTLS") {
+			return "FAIL", time.Since(start), "STARTTLS not advertised"
+		}
+		if _, err := text.Cmd("STARTTLS"); err != nil {
+			return "FAIL", 0, fmt.Sprintf("STARTTLS error: %v", err)
+		}
+		if _, _, err := text.ReadResponse(220); err != nil {
+			return "FAIL", time.Since(start), fmt.Sprintf("STARTTLS error: %v", err)
+		}
+		conn, err = tlsClient(ctx, test, conn, u.Hostname())
+		if err != nil {
+			return "FAIL", 0, fmt.Sprintf("TLS handshake error: %v", err)
+		}
+		text = textproto.NewConn(conn)
+		if extensions, err = smtpEHLO(text); err != nil {
+			return "FAIL", time.Since(start), fmt.Sprintf("EHLO after STARTTLS error: %v", err)
+		}
+	}
+	latency := time.Since(start)
+	setDetail(test, "extensions", strings.Join(extensions, ","))
+
+	if id, err := text.Cmd("QUIT"); err == nil {
+		text.StartResponse(id)
+		text.ReadResponse(221)
+		text.EndResponse(id)
+	}
+
+	return "OK", latency, ""
+}
+
+// smtpEHLO sends EHLO and returns the advertised extension keywords.
+func smtpEHLO(text *textproto.Conn) ([]string, error) {
+	id, err := text.Cmd("EHLO apiconnector")
+	if err != nil {
+		return nil, err
+	}
+	text.StartResponse(id)
+	defer text.EndResponse(id)
+	_, msg, err := text.ReadResponse(250)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := strings.Split(msg, "\n")
+	var extensions []string
+	for _, line := range lines[1:] {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			extensions = append(extensions, strings.ToUpper(fields[0]))
+		}
+	}
+	return extensions, nil
+}
+
+func smtpHasExtension(extensions []string, name string) bool {
+	for _, ext := range extensions {
+		if ext == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+)
+
+// fakeSMTP greets, answers EHLO without STARTTLS and acknowledges QUIT.
+func fakeSMTP(conn net.Conn) {
+	conn.Write([]byte("220 mx.example.com ESMTP\r\n"))
+	br := bufio.NewReader(conn)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch {
+		case strings.HasPrefix(line, "EHLO"):
+			conn.Write([]byte("250-mx.example.com\r\n250-PIPELINING\r\n250-SIZE 10240000\r\n250 8BITMIME\r\n"))
+		case strings.HasPrefix(line, "QUIT"):
+			conn.Write([]byte("221 Bye\r\n"))
+			return
+		default:
+			conn.Write([]byte("502 Not implemented\r\n"))
+		}
+	}
+}
+
+func TestCheckSMTP(t *testing.T) {
+	test := &ConnectionTest{URL: "smtp://" + serveOnce(t, fakeSMTP)}
+	status, _, errMsg := checkSMTP(context.Background(), test)
+	if status != "OK" {
+		t.Fatalf("checkSMTP = %s (%s), want OK", status, errMsg)
+	}
+	if got := test.Details["extensions"]; got != "PIPELINING,SIZE,8BITMIME" {
+		t.Errorf("extensions = %q, want PIPELINING,SIZE,8BITMIME", got)
+	}
+}
+
+func TestCheckSMTPStartTLSNotAdvertised(t *testing.T) {
+	test := parseTestConfig("mail=smtp://" + serveOnce(t, fakeSMTP) + " starttls")
+	status, _, errMsg := checkSMTP(context.Background(), &test)
+	if status != "FAIL" || errMsg != "STARTTLS not advertised" {
+		t.Errorf("checkSMTP = %s (%s), want FAIL with STARTTLS not advertised", status, errMsg)
+	}
+}
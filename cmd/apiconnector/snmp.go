@@ -0,0 +1,489 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// snmpSysUpTime is the default OID queried (SNMPv2-MIB::sysUpTime.0).
+const snmpSysUpTime = "1.3.6.1.2.1.1.3.0"
+
+// SNMP PDU tags.
+const (
+	snmpGetRequest = 0xA0
+	snmpResponse   = 0xA2
+	snmpReport     = 0xA8
+)
+
+// USM message flags.
+const (
+	snmpFlagAuth       = 0x01
+	snmpFlagPriv       = 0x02
+	snmpFlagReportable = 0x04
+)
+
+// checkSNMP issues an SNMP GET for sysUpTime, or the OID in the "oid"
+// option, and reports the value. By default it uses v2c with the URL
+// username as community (snmp://public@switch1). With "version=3" the URL
+// username and password are the USM user and auth password ("auth=md5" or
+// "auth=sha", default sha), and "priv_password" enables AES-128 privacy.
+func checkSNMP(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	start := time.Now()
+
+	u, err := url.Parse(test.URL)
+	if err != nil || u.Hostname() == "" {
+		return "ERROR", 0, "Invalid URL"
+	}
+	oid := test.Options["oid"]
+	if oid == "" {
+		oid = snmpSysUpTime
+	}
+	encodedOID, err := snmpEncodeOID(oid)
+	if err != nil {
+		return "ERROR", 0, fmt.Sprintf("Invalid OID %q", oid)
+	}
+
+	conn, err := dial(ctx, test, "udp", hostPort(u, "161"))
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("Connect error: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(testTimeout(test)))
+
+	varbinds := berTLV(0x30, berTLV(0x30, berConcat(berTLV(0x06, encodedOID), berTLV(0x05, nil))))
+
+	var pdu []byte
+	switch test.Options["version"] {
+	case "", "2", "2c":
+		community := u.User.Username()
+		if community == "" {
+			community = "public"
+		}
+		pdu, err = snmpGetV2c(conn, community, varbinds)
+	case "3":
+		user := &snmpUser{name: u.User.Username(), privPassword: test.Options["priv_password"]}
+		user.authPassword, _ = u.User.Password()
+		switch strings.ToLower(test.Options["auth"]) {
+		case "", "sha":
+			user.hash = sha1.New
+		case "md5":
+			user.hash = md5.New
+		default:
+			return "ERROR", 0, fmt.Sprintf("Unsupported auth protocol %q", test.Options["auth"])
+		}
+		pdu, err = snmpGetV3(conn, user, varbinds)
+	default:
+		return "ERROR", 0, fmt.Sprintf("Unsupported SNMP version %q", test.Options["version"])
+	}
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("SNMP error: %v", err)
+	}
+	latency := time.Since(start)
+
+	value, err := snmpResponseValue(pdu)
+	if err != nil {
+		return "FAIL", latency, err.Error()
+	}
+	setDetail(test, "value", value)
+
+	return "OK", latency, ""
+}
+
+// snmpGetV2c sends a community-based GET and returns the response PDU.
+func snmpGetV2c(conn net.Conn, community string, varbinds []byte) ([]byte, error) {
+	id := snmpRequestID()
+	msg := berTLV(0x30, berConcat(
+		berInt(1),
+		berTLV(0x04, []byte(community)),
+		snmpPDU(snmpGetRequest, id, varbinds),
+	))
+	reply, err := snmpExchange(conn, msg)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := berElements(reply)
+	if err != nil || len(fields) < 3 {
+		return nil, fmt.Errorf("malformed response")
+	}
+	return berTLV(fields[2].tag, fields[2].value), nil
+}
+
+// snmpUser holds USM credentials and the keys localized to an engine.
+type snmpUser struct {
+	name         string
+	authPassword string
+	privPassword string
+	hash         func() hash.Hash
+	authKey      []byte
+	privKey      []byte
+}
+
+// snmpEngine holds the authoritative engine parameters learned by discovery.
+type snmpEngine struct {
+	id    []byte
+	boots int64
+	time  int64
+}
+
+// snmpGetV3 discovers the agent's engine parameters and sends a USM GET,
+// returning the decrypted response PDU.
+func snmpGetV3(conn net.Conn, user *snmpUser, varbinds []byte) ([]byte, error) {
+	// Discovery: an unauthenticated, reportable request with no varbinds.
+	discovery := snmpV3Message(snmpFlagReportable, &snmpEngine{}, "", nil, nil,
+		berTLV(0x30, berConcat(berTLV(0x04, nil), berTLV(0x04, nil), snmpPDU(snmpGetRequest, snmpRequestID(), berTLV(0x30, nil)))))
+	reply, err := snmpExchange(conn, discovery)
+	if err != nil {
+		return nil, fmt.Errorf("engine discovery: %v", err)
+	}
+	engine, _, _, err := snmpParseV3(reply)
+	if err != nil {
+		return nil, fmt.Errorf("engine discovery: %v", err)
+	}
+
+	flags := byte(snmpFlagReportable)
+	if user.authPassword != "" {
+		flags |= snmpFlagAuth
+		user.authKey = snmpLocalizeKey(user.hash, user.authPassword, engine.id)
+		if user.privPassword != "" {
+			flags |= snmpFlagPriv
+			user.privKey = snmpLocalizeKey(user.hash, user.privPassword, engine.id)[:16]
+		}
+	}
+
+	scoped := berTLV(0x30, berConcat(berTLV(0x04, engine.id), berTLV(0x04, nil), snmpPDU(snmpGetRequest, snmpRequestID(), varbinds)))
+	var privParams []byte
+	if flags&snmpFlagPriv != 0 {
+		privParams = make([]byte, 8)
+		if _, err := rand.Read(privParams); err != nil {
+			return nil, err
+		}
+		scoped = berTLV(0x04, snmpAESCrypt(user.privKey, engine, privParams, scoped, true))
+	}
+
+	msg := snmpV3Message(flags, engine, user.name, user, privParams, scoped)
+	reply, err = snmpExchange(conn, msg)
+	if err != nil {
+		return nil, err
+	}
+	respEngine, respPriv, data, err := snmpParseV3(reply)
+	if err != nil {
+		return nil, err
+	}
+	if flags&snmpFlagPriv != 0 && data[0] == 0x04 {
+		fields, err := berElements(data)
+		if err != nil || len(fields) != 1 {
+			return nil, fmt.Errorf("malformed encrypted PDU")
+		}
+		data = snmpAESCrypt(user.privKey, respEngine, respPriv, fields[0].value, false)
+	}
+
+	scopedFields, err := berElements(data)
+	if err != nil || len(scopedFields) != 1 {
+		return nil, fmt.Errorf("malformed scoped PDU")
+	}
+	inner, err := berElements(scopedFields[0].value)
+	if err != nil || len(inner) < 3 {
+		return nil, fmt.Errorf("malformed scoped PDU")
+	}
+	pdu := inner[2]
+	if pdu.tag == snmpReport {
+		return nil, fmt.Errorf("agent returned report %s", snmpReportReason(pdu.value))
+	}
+	return berTLV(pdu.tag, pdu.value), nil
+}
+
+// snmpV3Message encodes a v3 message. When user has an auth key the message
+// is signed with HMAC-96 over the whole encoding.
+func snmpV3Message(flags byte, engine *snmpEngine, userName string, user *snmpUser, privParams, data []byte) []byte {
+	authParams := []byte(nil)
+	if flags&snmpFlagAuth != 0 {
+		authParams = make([]byte, 12)
+	}
+	secParams := berTLV(0x30, berConcat(
+		berTLV(0x04, engine.id),
+		berInt(engine.boots),
+		berInt(engine.time),
+		berTLV(0x04, []byte(userName)),
+		berTLV(0x04, authParams),
+		berTLV(0x04, privParams),
+	))
+	msg := berTLV(0x30, berConcat(
+		berInt(3),
+		berTLV(0x30, berConcat(berInt(int64(snmpRequestID())), berInt(65507), berTLV(0x04, []byte{flags}), berInt(3))),
+		berTLV(0x04, secParams),
+		data,
+	))
+
+	if flags&snmpFlagAuth != 0 {
+		mac := hmac.New(user.hash, user.authKey)
+		mac.Write(msg)
+		offset := bytes.Index(msg, secParams) + len(secParams) - len(berTLV(0x04, privParams)) - 12
+		copy(msg[offset:], mac.Sum(nil)[:12])
+	}
+	return msg
+}
+
+// snmpParseV3 decodes a v3 message, returning the sender's engine
+// parameters, its privacy parameters and the (possibly encrypted) data.
+func snmpParseV3(msg []byte) (*snmpEngine, []byte, []byte, error) {
+	fields, err := berElements(msg)
+	if err != nil || len(fields) < 4 || fields[2].tag != 0x04 {
+		return nil, nil, nil, fmt.Errorf("malformed v3 message")
+	}
+	sec, err := berElements(fields[2].value)
+	if err != nil || len(sec) != 1 {
+		return nil, nil, nil, fmt.Errorf("malformed security parameters")
+	}
+	params, err := berElements(sec[0].value)
+	if err != nil || len(params) < 6 {
+		return nil, nil, nil, fmt.Errorf("malformed security parameters")
+	}
+	engine := &snmpEngine{
+		id:    params[0].value,
+		boots: berIntValue(params[1].value),
+		time:  berIntValue(params[2].value),
+	}
+	return engine, params[5].value, berTLV(fields[3].tag, fields[3].value), nil
+}
+
+// snmpLocalizeKey derives a localized USM key from a password (RFC 3414
+// A.2): hash one megabyte of the repeated password, then hash that digest
+// around the engine id.
+func snmpLocalizeKey(newHash func() hash.Hash, password string, engineID []byte) []byte {
+	h := newHash()
+	buf := make([]byte, 64)
+	for i := 0; i < 1048576; i += 64 {
+		for j := range buf {
+			buf[j] = password[(i+j)%len(password)]
+		}
+		h.Write(buf)
+	}
+	ku := h.Sum(nil)
+
+	h = newHash()
+	h.Write(ku)
+	h.Write(engineID)
+	h.Write(ku)
+	return h.Sum(nil)
+}
+
+// snmpAESCrypt encrypts or decrypts with AES-128 CFB as defined by RFC 3826.
+func snmpAESCrypt(key []byte, engine *snmpEngine, salt, data []byte, encrypt bool) []byte {
+	block, _ := aes.NewCipher(key)
+	iv := binary.BigEndian.AppendUint32(nil, uint32(engine.boots))
+	iv = binary.BigEndian.AppendUint32(iv, uint32(engine.time))
+	iv = append(iv, salt...)
+	out := make([]byte, len(data))
+	if encrypt {
+		cipher.NewCFBEncrypter(block, iv).XORKeyStream(out, data)
+	} else {
+		cipher.NewCFBDecrypter(block, iv).XORKeyStream(out, data)
+	}
+	return out
+}
+
+// snmpReportReason names the usmStats counter carried by a report PDU.
+func snmpReportReason(pdu []byte) string {
+	reasons := map[string]string{
+		"1.3.6.1.6.3.15.1.1.1.0": "unsupportedSecLevel",
+		"1.3.6.1.6.3.15.1.1.2.0": "notInTimeWindow",
+		"1.3.6.1.6.3.15.1.1.3.0": "unknownUserName",
+		"1.3.6.1.6.3.15.1.1.4.0": "unknownEngineID",
+		"1.3.6.1.6.3.15.1.1.5.0": "wrongDigest",
+		"1.3.6.1.6.3.15.1.1.6.0": "decryptionError",
+	}
+	oid, _, err := snmpFirstVarbind(pdu)
+	if err != nil {
+		return "unknown"
+	}
+	if reason, ok := reasons[oid]; ok {
+		return reason
+	}
+	return oid
+}
+
+// snmpResponseValue checks a response PDU's error status and formats the
+// first varbind value.
+func snmpResponseValue(pdu []byte) (string, error) {
+	outer, err := berElements(pdu)
+	if err != nil || len(outer) != 1 || outer[0].tag != snmpResponse {
+		return "", fmt.Errorf("Unexpected PDU")
+	}
+	fields, err := berElements(outer[0].value)
+	if err != nil || len(fields) < 4 {
+		return "", fmt.Errorf("Malformed response PDU")
+	}
+	if status := berIntValue(fields[1].value); status != 0 {
+		return "", fmt.Errorf("Agent error status %d", status)
+	}
+	_, value, err := snmpFirstVarbind(outer[0].value)
+	if err != nil {
+		return "", err
+	}
+	switch value.tag {
+	case 0x80:
+		return "", fmt.Errorf("noSuchObject")
+	case 0x81:
+		return "", fmt.Errorf("noSuchInstance")
+	case 0x82:
+		return "", fmt.Errorf("endOfMibView")
+	}
+	return snmpFormatValue(value), nil
+}
+
+// snmpFirstVarbind returns the OID and value of the first varbind in a PDU
+// body.
+func snmpFirstVarbind(pduBody []byte) (string, berElement, error) {
+	fields, err := berElements(pduBody)
+	if err != nil || len(fields) < 4 {
+		return "", berElement{}, fmt.Errorf("Malformed PDU")
+	}
+	list, err := berElements(fields[3].value)
+	if err != nil || len(list) == 0 {
+		return "", berElement{}, fmt.Errorf("Empty varbind list")
+	}
+	vb, err := berElements(list[0].value)
+	if err != nil || len(vb) != 2 {
+		return "", berElement{}, fmt.Errorf("Malformed varbind")
+	}
+	return snmpDecodeOID(vb[0].value), vb[1], nil
+}
+
+// snmpFormatValue renders a varbind value for display.
+func snmpFormatValue(v berElement) string {
+	switch v.tag {
+	case 0x02, 0x41, 0x42, 0x46:
+		return strconv.FormatInt(berIntValue(v.value), 10)
+	case 0x43: // TimeTicks, in hundredths of a second
+		return (time.Duration(berIntValue(v.value)) * 10 * time.Millisecond).String()
+	case 0x40:
+		if len(v.value) == 4 {
+			return net.IP(v.value).String()
+		}
+	case 0x06:
+		return snmpDecodeOID(v.value)
+	case 0x04:
+		for _, r := range string(v.value) {
+			if !unicode.IsPrint(r) {
+				return hex.EncodeToString(v.value)
+			}
+		}
+		return string(v.value)
+	}
+	return hex.EncodeToString(v.value)
+}
+
+func snmpPDU(tag byte, id uint32, varbinds []byte) []byte {
+	return berTLV(tag, berConcat(berInt(int64(id)), berInt(0), berInt(0), varbinds))
+}
+
+// snmpExchange sends msg and returns the contents of the reply's outer
+// SEQUENCE.
+func snmpExchange(conn net.Conn, msg []byte) ([]byte, error) {
+	if _, err := conn.Write(msg); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 65535)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	outer, err := berElements(buf[:n])
+	if err != nil || len(outer) != 1 || outer[0].tag != 0x30 {
+		return nil, fmt.Errorf("malformed reply")
+	}
+	return outer[0].value, nil
+}
+
+func snmpRequestID() uint32 {
+	var b [4]byte
+	rand.Read(b[:])
+	return binary.BigEndian.Uint32(b[:]) & 0x7FFFFFFF
+}
+
+// snmpEncodeOID encodes a dotted OID in BER form.
+func snmpEncodeOID(oid string) ([]byte, error) {
+	parts := strings.Split(strings.TrimPrefix(oid, "."), ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("too few arcs")
+	}
+	arcs := make([]uint64, len(parts))
+	for i, p := range parts {
+		v, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		arcs[i] = v
+	}
+	var out []byte
+	for _, arc := range append([]uint64{arcs[0]*40 + arcs[1]}, arcs[2:]...) {
+		var tmp []byte
+		tmp = append(tmp, byte(arc&0x7F))
+		for arc >>= 7; arc > 0; arc >>= 7 {
+			tmp = append(tmp, byte(arc&0x7F)|0x80)
+		}
+		for i := len(tmp) - 1; i >= 0; i-- {
+			out = append(out, tmp[i])
+		}
+	}
+	return out, nil
+}
+
+// snmpDecodeOID renders a BER-encoded OID in dotted form.
+func snmpDecodeOID(b []byte) string {
+	var arcs []string
+	var v uint64
+	for _, c := range b {
+		v = v<<7 | uint64(c&0x7F)
+		if c&0x80 != 0 {
+			continue
+		}
+		if arcs == nil {
+			// The first subidentifier packs the first two arcs as 40*X+Y.
+			first := min(v/40, 2)
+			arcs = append(arcs, strconv.FormatUint(first, 10), strconv.FormatUint(v-first*40, 10))
+		} else {
+			arcs = append(arcs, strconv.FormatUint(v, 10))
+		}
+		v = 0
+	}
+	return strings.Join(arcs, ".")
+}
+
+// berInt encodes a minimal two's-complement INTEGER.
+func berInt(v int64) []byte {
+	b := binary.BigEndian.AppendUint64(nil, uint64(v))
+	for len(b) > 1 && ((b[0] == 0 && b[1]&0x80 == 0) || (b[0] == 0xFF && b[1]&0x80 != 0)) {
+		b = b[1:]
+	}
+	return berTLV(0x02, b)
+}
+
+// berIntValue decodes INTEGER content octets. Application types such as
+// Counter32 and TimeTicks are unsigned and may carry a leading zero.
+func berIntValue(b []byte) int64 {
+	var v int64
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		v = -1
+	}
+	for _, c := range b {
+		v = v<<8 | int64(c)
+	}
+	return v
+}
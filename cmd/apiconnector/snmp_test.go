@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"net"
+	"testing"
+)
+
+// snmpUptimeResponse is a response PDU carrying sysUpTime.0 = 1 day.
+func snmpUptimeResponse(id []byte) []byte {
+	oid, _ := snmpEncodeOID(snmpSysUpTime)
+	varbinds := berTLV(0x30, berTLV(0x30, berConcat(berTLV(0x06, oid), berTLV(0x43, []byte{0x00, 0x83, 0xD6, 0x00}))))
+	return berTLV(snmpResponse, berConcat(berTLV(0x02, id), berInt(0), berInt(0), varbinds))
+}
+
+// serveSNMP answers each datagram with handle's reply.
+func serveSNMP(t *testing.T, handle func(msg []byte) []byte) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if reply := handle(buf[:n]); reply != nil {
+				pc.WriteTo(reply, addr)
+			}
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+func TestCheckSNMPv2c(t *testing.T) {
+	addr := serveSNMP(t, func(msg []byte) []byte {
+		outer, _ := berElements(msg)
+		fields, _ := berElements(outer[0].value)
+		if string(fields[1].value) != "s3cret" {
+			return nil
+		}
+		pdu, _ := berElements(fields[2].value)
+		return berTLV(0x30, berConcat(berInt(1), berTLV(0x04, fields[1].value), snmpUptimeResponse(pdu[0].value)))
+	})
+
+	test := &ConnectionTest{URL: "snmp://s3cret@" + addr}
+	status, _, errMsg := checkSNMP(context.Background(), test)
+	if status != "OK" || test.Details["value"] != "24h0m0s" {
+		t.Errorf("checkSNMP v2c = %s (%s) %v, want OK with 24h0m0s", status, errMsg, test.Details)
+	}
+}
+
+func TestCheckSNMPv3AuthPriv(t *testing.T) {
+	engine := &snmpEngine{id: []byte{0x80, 0, 0x1F, 0x88, 1, 2, 3, 4}, boots: 3, time: 1000}
+	user := &snmpUser{name: "monitor", hash: sha1.New}
+	user.authKey = snmpLocalizeKey(sha1.New, "authpass1", engine.id)
+	user.privKey = snmpLocalizeKey(sha1.New, "privpass1", engine.id)[:16]
+
+	addr := serveSNMP(t, func(msg []byte) []byte {
+		outer, _ := berElements(msg)
+		_, privParams, data, err := snmpParseV3(outer[0].value)
+		if err != nil {
+			t.Error(err)
+			return nil
+		}
+		fields, _ := berElements(outer[0].value)
+		header, _ := berElements(fields[1].value)
+		flags := header[2].value[0]
+
+		if flags&snmpFlagAuth == 0 {
+			// Discovery: report our engine parameters.
+			report := berTLV(snmpReport, berConcat(berInt(0), berInt(0), berInt(0), berTLV(0x30, nil)))
+			scoped := berTLV(0x30, berConcat(berTLV(0x04, engine.id), berTLV(0x04, nil), report))
+			return snmpV3Message(0, engine, "", nil, nil, scoped)
+		}
+
+		// Verify the HMAC by zeroing the auth parameters and recomputing.
+		sec, _ := berElements(fields[2].value)
+		params, _ := berElements(sec[0].value)
+		digest := params[4].value
+		zeroed := bytes.Replace(msg, digest, make([]byte, 12), 1)
+		mac := hmac.New(sha1.New, user.authKey)
+		mac.Write(zeroed)
+		if !hmac.Equal(mac.Sum(nil)[:12], digest) || string(params[3].value) != "monitor" {
+			t.Error("request failed authentication")
+			return nil
+		}
+
+		encrypted, _ := berElements(data)
+		plain := snmpAESCrypt(user.privKey, engine, privParams, encrypted[0].value, false)
+		scoped, _ := berElements(plain)
+		inner, _ := berElements(scoped[0].value)
+		pdu, _ := berElements(inner[2].value)
+
+		reply := berTLV(0x30, berConcat(berTLV(0x04, engine.id), berTLV(0x04, nil), snmpUptimeResponse(pdu[0].value)))
+		salt := []byte{9, 9, 9, 9, 9, 9, 9, 9}
+		return snmpV3Message(snmpFlagAuth|snmpFlagPriv, engine, "monitor", user, salt,
+			berTLV(0x04, snmpAESCrypt(user.privKey, engine, salt, reply, true)))
+	})
+
+	test := parseTestConfig("sw=snmp://monitor:authpass1@" + addr + " version=3 priv_password=privpass1")
+	status, _, errMsg := checkSNMP(context.Background(), &test)
+	if status != "OK" || test.Details["value"] != "24h0m0s" {
+		t.Errorf("checkSNMP v3 = %s (%s) %v, want OK with 24h0m0s", status, errMsg, test.Details)
+	}
+}
+
+// TestSNMPLocalizeKey checks the RFC 3414 appendix A.3 vectors.
+func TestSNMPLocalizeKey(t *testing.T) {
+	engineID, _ := hex.DecodeString("000000000000000000000002")
+	if got := hex.EncodeToString(snmpLocalizeKey(md5.New, "maplesyrup", engineID)); got != "526f5eed9fcce26f8964c2930787d82b" {
+		t.Errorf("MD5 localized key = %s", got)
+	}
+	if got := hex.EncodeToString(snmpLocalizeKey(sha1.New, "maplesyrup", engineID)); got != "6695febc9288e36282235fc7151f128497b38f3f" {
+		t.Errorf("SHA localized key = %s", got)
+	}
+}
+
+func TestSNMPOIDRoundTrip(t *testing.T) {
+	for _, oid := range []string{snmpSysUpTime, "1.3.6.1.4.1.2021.10.1.3.1", "2.999.300000"} {
+		encoded, err := snmpEncodeOID(oid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := snmpDecodeOID(encoded); got != oid {
+			t.Errorf("snmpDecodeOID(snmpEncodeOID(%s)) = %s", oid, got)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// checkSOAP fetches the WSDL of a SOAP endpoint (soap:// over HTTP, soaps://
+// over HTTPS) and verifies it is a WSDL document, reporting the service name
+// and operation count. With "envelope=@file" it also POSTs that SOAP
+// envelope to the endpoint, with the "action" option as SOAPAction, and
+// fails on a SOAP Fault.
+func checkSOAP(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	u, err := url.Parse(test.URL)
+	if err != nil || u.Hostname() == "" {
+		return "ERROR", 0, "Invalid URL"
+	}
+
+	var envelope []byte
+	if v := test.Options["envelope"]; v != "" {
+		name, ok := strings.CutPrefix(v, "@")
+		if !ok {
+			return "ERROR", 0, "Invalid envelope: expected envelope=@file"
+		}
+		if envelope, err = os.ReadFile(name); err != nil {
+			return "ERROR", 0, fmt.Sprintf("Envelope file error: %v", err)
+		}
+	}
+
+	endpoint := *u
+	endpoint.Scheme = "http"
+	if u.Scheme == "soaps" {
+		endpoint.Scheme = "https"
+	}
+	wsdlURL := endpoint
+	wsdlURL.RawQuery = "wsdl"
+
+	client := newHTTPClient(test)
+	start := time.Now()
+
+	body, errMsg := soapDo(ctx, client, "GET", wsdlURL.String(), nil, nil)
+	if errMsg != "" {
+		return "FAIL", 0, errMsg
+	}
+	var wsdl struct {
+		XMLName   xml.Name
+		Name      string `xml:"name,attr"`
+		PortTypes []struct {
+			Operations []struct{} `xml:"operation"`
+		} `xml:"portType"`
+		Interfaces []struct {
+			Operations []struct{} `xml:"operation"`
+		} `xml:"interface"`
+	}
+	if err := xml.Unmarshal(body, &wsdl); err != nil {
+		return "FAIL", 0, fmt.Sprintf("Invalid WSDL: %v", err)
+	}
+	if wsdl.XMLName.Local != "definitions" && wsdl.XMLName.Local != "description" {
+		return "FAIL", 0, fmt.Sprintf("Invalid WSDL: unexpected root element <%s>", wsdl.XMLName.Local)
+	}
+	operations := 0
+	for _, pt := range wsdl.PortTypes {
+		operations += len(pt.Operations)
+	}
+	for _, in := range wsdl.Interfaces {
+		operations += len(in.Operations)
+	}
+	if wsdl.Name != "" {
+		setDetail(test, "service", wsdl.Name)
+	}
+	setDetail(test, "operations", strconv.Itoa(operations))
+
+	if envelope == nil {
+		return "OK", time.Since(start), ""
+	}
+
+	header := http.Header{"Content-Type": {"text/xml; charset=utf-8"}}
+	header.Set("SOAPAction", strconv.Quote(test.Options["action"]))
+	body, errMsg = soapDo(ctx, client, "POST", endpoint.String(), header, envelope)
+	if body == nil {
+		return "FAIL", 0, errMsg
+	}
+	if fault := soapFault(body); fault != "" {
+		return "FAIL", 0, fmt.Sprintf("SOAP Fault: %s", fault)
+	}
+	if errMsg != "" {
+		return "FAIL", 0, errMsg
+	}
+
+	return "OK", time.Since(start), ""
+}
+
+// soapDo performs a request and returns the response body. A non-2xx status
+// yields both the body (SOAP faults arrive with HTTP 500) and an error
+// message.
+func soapDo(ctx context.Context, client *http.Client, method, target string, header http.Header, body []byte) ([]byte, string) {
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Sprintf("Request creation error: %v", err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Sprintf("HTTP error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return nil, fmt.Sprintf("Read error: %v", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return b, fmt.Sprintf("HTTP %d", resp.StatusCode)
+	}
+	return b, ""
+}
+
+// soapFault returns the fault text of a SOAP 1.1 or 1.2 response, or "" if
+// the body has no Fault element.
+func soapFault(body []byte) string {
+	var env struct {
+		Body struct {
+			Fault *struct {
+				String string `xml:"faultstring"`
+				Reason string `xml:"Reason>Text"`
+			} `xml:"Fault"`
+		} `xml:"Body"`
+	}
+	if xml.Unmarshal(body, &env) != nil || env.Body.Fault == nil {
+		return ""
+	}
+	if env.Body.Fault.String != "" {
+		return env.Body.Fault.String
+	}
+	if env.Body.Fault.Reason != "" {
+		return env.Body.Fault.Reason
+	}
+	return "unknown fault"
+}
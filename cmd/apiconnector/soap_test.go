@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testWSDL = `<?xml version="1.0"?>
+<definitions name="StockQuote" xmlns="http://schemas.xmlsoap.org/wsdl/">
+  <portType name="StockQuotePortType">
+    <operation name="GetLastTradePrice"/>
+    <operation name="GetVolume"/>
+  </portType>
+</definitions>`
+
+func TestCheckSOAP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" && r.URL.RawQuery == "wsdl" {
+			w.Write([]byte(testWSDL))
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("SOAPAction") != `"GetVolume"` || !strings.Contains(string(body), "<GetVolume") {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault><faultcode>soap:Client</faultcode><faultstring>Unknown operation</faultstring></soap:Fault></soap:Body></soap:Envelope>`))
+			return
+		}
+		w.Write([]byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><GetVolumeResponse>42</GetVolumeResponse></soap:Body></soap:Envelope>`))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	envelope := filepath.Join(dir, "envelope.xml")
+	os.WriteFile(envelope, []byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><GetVolume/></soap:Body></soap:Envelope>`), 0o644)
+
+	tests := []struct {
+		options string
+		status  string
+		errMsg  string
+	}{
+		{"", "OK", ""},
+		{"envelope=@" + envelope + " action=GetVolume", "OK", ""},
+		{"envelope=@" + envelope + " action=Other", "FAIL", "SOAP Fault: Unknown operation"},
+	}
+	for _, tt := range tests {
+		url := strings.Replace(srv.URL, "http://", "soap://", 1) + "/StockQuote"
+		test := parseTestConfig("legacy=" + url + " " + tt.options)
+		status, _, errMsg := checkSOAP(context.Background(), &test)
+		if status != tt.status || errMsg != tt.errMsg {
+			t.Errorf("checkSOAP(%q) = %s (%s), want %s (%s)", tt.options, status, errMsg, tt.status, tt.errMsg)
+		}
+		if test.Details["service"] != "StockQuote" || test.Details["operations"] != "2" {
+			t.Errorf("checkSOAP(%q) details = %v", tt.options, test.Details)
+		}
+	}
+}
+
+func TestCheckSOAPInvalidWSDL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html><body>Service unavailable</body></html>"))
+	}))
+	defer srv.Close()
+
+	test := &ConnectionTest{URL: strings.Replace(srv.URL, "http://", "soap://", 1)}
+	if status, _, _ := checkSOAP(context.Background(), test); status != "FAIL" {
+		t.Errorf("checkSOAP = %s, want FAIL", status)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// serveSOCKS5 accepts one SOCKS5 connection requiring user/password auth,
+// sends the CONNECT target to targets and then answers as a memcached
+// server.
+func serveSOCKS5(t *testing.T, user, password string, targets chan<- string) string {
+	return serveOnce(t, func(conn net.Conn) {
+		br := bufio.NewReader(conn)
+		greeting := make([]byte, 2)
+		if _, err := io.ReadFull(br, greeting); err != nil {
+			return
+		}
+		io.ReadFull(br, make([]byte, greeting[1]))
+		conn.Write([]byte{5, 2})
+
+		readField := func() string {
+			n, _ := br.ReadByte()
+			b := make([]byte, n)
+			io.ReadFull(br, b)
+			return string(b)
+		}
+		br.ReadByte()
+		if readField() != user || readField() != password {
+			conn.Write([]byte{1, 1})
+			return
+		}
+		conn.Write([]byte{1, 0})
+
+		req := make([]byte, 4)
+		if _, err := io.ReadFull(br, req); err != nil || req[3] != 3 {
+			return
+		}
+		host := readField()
+		port := make([]byte, 2)
+		io.ReadFull(br, port)
+		targets <- fmt.Sprintf("%s:%d", host, int(port[0])<<8|int(port[1]))
+		conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+
+		if line, _ := br.ReadString('\n'); strings.TrimSpace(line) == "version" {
+			conn.Write([]byte("VERSION 1.6.21\r\n"))
+		}
+		if line, _ := br.ReadString('\n'); strings.TrimSpace(line) == "stats" {
+			conn.Write([]byte("STAT uptime 1\r\nEND\r\n"))
+		}
+	})
+}
+
+func TestDialSOCKS5(t *testing.T) {
+	targets := make(chan string, 1)
+	addr := serveSOCKS5(t, "alice", "secret", targets)
+
+	test := parseTestConfig("cache=memcached://cache.invalid socks=alice:secret@" + addr)
+	if status, _, errMsg := checkMemcached(context.Background(), &test); status != "OK" {
+		t.Fatalf("checkMemcached through SOCKS5 = %s (%s), want OK", status, errMsg)
+	}
+	if got := <-targets; got != "cache.invalid:11211" {
+		t.Errorf("SOCKS5 CONNECT target = %q, want cache.invalid:11211", got)
+	}
+	if test.Details["socks"] != addr {
+		t.Errorf("socks detail = %q, want %q", test.Details["socks"], addr)
+	}
+
+	t.Setenv("SOCKS_PASSWORD", "wrong")
+	addr = serveSOCKS5(t, "alice", "secret", targets)
+	test = parseTestConfig("cache=memcached://cache.invalid socks=socks5://alice@" + addr)
+	if status, _, _ := checkMemcached(context.Background(), &test); status == "OK" {
+		t.Errorf("checkMemcached with wrong SOCKS5 password = OK, want failure")
+	}
+
+	test = parseTestConfig("ns=dns://127.0.0.1/example.com socks=" + addr)
+	if _, err := dial(context.Background(), &test, "udp", "127.0.0.1:53"); err == nil {
+		t.Errorf("dial udp through SOCKS5 succeeded, want error")
+	}
+}
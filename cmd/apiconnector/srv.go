@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// expandSRV replaces each srv:// target with one target per host:port its
+// SRV records name, in the resolver's priority and weight order, so that
+// services published in Consul or as Kubernetes headless services are
+// checked instance by instance. An expanded target is named
+// "name[host:port]" and checked with the "scheme" option (default tcp),
+// keeping the path and options. A target whose lookup fails or finds no
+// instances is kept, and fails when checked (see checkSRV).
+func expandSRV(ctx context.Context, tests []ConnectionTest) []ConnectionTest {
+	var expanded []ConnectionTest
+	for _, test := range tests {
+		if scheme(test.URL) != "srv" {
+			expanded = append(expanded, test)
+			continue
+		}
+		u, records, err := lookupSRV(ctx, &test)
+		if err != nil || len(records) == 0 {
+			expanded = append(expanded, test)
+			continue
+		}
+		targetScheme := test.Options["scheme"]
+		if targetScheme == "" {
+			targetScheme = "tcp"
+		}
+		for _, srv := range records {
+			addr := net.JoinHostPort(strings.TrimSuffix(srv.Target, "."), fmt.Sprint(srv.Port))
+			instance := cloneTest(&test, "scheme", targetScheme)
+			instance.Service = fmt.Sprintf("%s[%s]", test.Service, addr)
+			instance.URL = (&url.URL{Scheme: targetScheme, Host: addr, Path: u.Path, RawQuery: u.RawQuery}).String()
+			expanded = append(expanded, instance)
+		}
+	}
+	return expanded
+}
+
+// lookupSRV looks up the SRV records named by the host of a srv:// URL,
+// such as srv://_http._tcp.web.service.consul, with test's resolver. A
+// single "." target means the service is deliberately unavailable (RFC
+// 2782) and yields no records.
+func lookupSRV(ctx context.Context, test *ConnectionTest) (*url.URL, []*net.SRV, error) {
+	u, err := url.Parse(test.URL)
+	if err != nil || u.Hostname() == "" {
+		return nil, nil, fmt.Errorf("invalid URL")
+	}
+	ctx, cancel := context.WithTimeout(ctx, testTimeout(test))
+	defer cancel()
+	_, records, err := newResolver(test, &dnsTrace{}).LookupSRV(ctx, "", "", u.Hostname())
+	if len(records) == 1 && records[0].Target == "." {
+		records = nil
+	}
+	return u, records, err
+}
+
+// checkSRV checks a srv:// target that expandSRV could not expand: it
+// repeats the lookup and fails with its error, or because no instances are
+// published.
+func checkSRV(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	start := time.Now()
+	_, records, err := lookupSRV(ctx, test)
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("SRV lookup error: %v", err)
+	}
+	if len(records) == 0 {
+		return "FAIL", 0, "No SRV targets"
+	}
+	setDetail(test, "targets", fmt.Sprint(len(records)))
+	return "OK", time.Since(start), ""
+}
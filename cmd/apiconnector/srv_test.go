@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestExpandSRV(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	port, _ := strconv.Atoi(srv.URL[strings.LastIndex(srv.URL, ":")+1:])
+	lis, _ := net.Listen("tcp", "127.0.0.1:0")
+	deadPort := lis.Addr().(*net.TCPAddr).Port
+	lis.Close()
+
+	server := serveDNS(t, func(b *dnsmessage.Builder, q dnsmessage.Question) {
+		if q.Type != dnsmessage.TypeSRV || q.Name.String() != "_web._tcp.svc.test." {
+			return
+		}
+		rh := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 60}
+		target := dnsmessage.MustNewName("localhost.")
+		b.SRVResource(rh, dnsmessage.SRVResource{Priority: 10, Weight: 1, Port: uint16(port), Target: target})
+		b.SRVResource(rh, dnsmessage.SRVResource{Priority: 20, Weight: 1, Port: uint16(deadPort), Target: target})
+	})
+
+	tests := expandSRV(context.Background(), []ConnectionTest{
+		parseTestConfig("web=srv://_web._tcp.svc.test/health scheme=http family=4 dns_server=" + server),
+		parseTestConfig("gone=srv://_gone._tcp.svc.test dns_server=" + server),
+	})
+	if len(tests) != 3 {
+		t.Fatalf("expandSRV = %d targets, want 3", len(tests))
+	}
+	live := "localhost:" + strconv.Itoa(port)
+	if tests[0].Service != "web["+live+"]" || tests[0].URL != "http://"+live+"/health" || tests[0].Options["dns_server"] != server {
+		t.Errorf("first instance = %s %s %v, want web[%s] http://%s/health", tests[0].Service, tests[0].URL, tests[0].Options, live, live)
+	}
+	if status, _, errMsg := testConnect(context.Background(), &tests[0]); status != "OK" {
+		t.Errorf("live instance = %s (%s), want OK", status, errMsg)
+	}
+	if status, _, _ := testConnect(context.Background(), &tests[1]); status != "FAIL" {
+		t.Errorf("dead instance %s = %s, want FAIL", tests[1].Service, status)
+	}
+	if status, _, errMsg := testConnect(context.Background(), &tests[2]); status != "FAIL" || tests[2].Service != "gone" {
+		t.Errorf("unexpanded %s = %s (%s), want FAIL", tests[2].Service, status, errMsg)
+	}
+
+	test := parseTestConfig("tcp=tcp://127.0.0.1:" + strconv.Itoa(port))
+	if status, _, errMsg := checkTCP(context.Background(), &test); status != "OK" {
+		t.Errorf("checkTCP = %s (%s), want OK", status, errMsg)
+	}
+}
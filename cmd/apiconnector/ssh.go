@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// checkSSH reads the SSH version banner. With the "kex" option, or when the
+// URL carries a password, it also completes key exchange and reports the
+// host key fingerprint; "host_key=SHA256:..." fails the check if the
+// presented key differs. The sftp scheme logs in with the URL credentials,
+// opens the SFTP subsystem and stats the URL path (default ".").
+func checkSSH(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	start := time.Now()
+
+	u, err := url.Parse(test.URL)
+	if err != nil || u.Hostname() == "" {
+		return "ERROR", 0, "Invalid URL"
+	}
+
+	addr := hostPort(u, "22")
+	conn, err := dial(ctx, test, "tcp", addr)
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("Connect error: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(testTimeout(test)))
+
+	// Servers may send other lines before the version string (RFC 4253 4.2).
+	br := bufio.NewReader(conn)
+	var banner string
+	for i := 0; i < 20; i++ {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return "FAIL", 0, fmt.Sprintf("Banner read error: %v", err)
+		}
+		if strings.HasPrefix(line, "SSH-") {
+			banner = line
+			break
+		}
+	}
+	if banner == "" {
+		return "FAIL", time.Since(start), "No SSH version banner"
+	}
+	setDetail(test, "version", strings.TrimSpace(banner))
+
+	password, hasPassword := u.User.Password()
+	if u.Scheme == "sftp" && !hasPassword {
+		return "FAIL", time.Since(start), "SFTP requires credentials in the URL"
+	}
+	if !boolOption(test, "kex") && !hasPassword && test.Options["host_key"] == "" {
+		return "OK", time.Since(start), ""
+	}
+
+	var fingerprint string
+	config := &ssh.ClientConfig{
+		User: u.User.Username(),
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			fingerprint = ssh.FingerprintSHA256(key)
+			setDetail(test, "host_key", fingerprint)
+			setDetail(test, "key_type", key.Type())
+			if pin := test.Options["host_key"]; pin != "" && pin != fingerprint {
+				return fmt.Errorf("host key %s does not match pinned %s", fingerprint, pin)
+			}
+			return nil
+		},
+		Timeout: testTimeout(test),
+	}
+	if hasPassword {
+		config.Auth = []ssh.AuthMethod{ssh.Password(password)}
+	}
+
+	replay := &replayConn{Conn: conn, r: io.MultiReader(strings.NewReader(banner), br)}
+	sshConn, chans, reqs, err := ssh.NewClientConn(replay, addr, config)
+	latency := time.Since(start)
+	if err != nil {
+		if fingerprint == "" || hasPassword || strings.Contains(err.Error(), "does not match pinned") {
+			return "FAIL", latency, fmt.Sprintf("SSH handshake error: %v", err)
+		}
+		// Key exchange completed; only authentication was refused.
+		return "OK", latency, ""
+	}
+	client := ssh.NewClient(sshConn, chans, reqs)
+	defer client.Close()
+	if hasPassword {
+		setDetail(test, "auth", "ok")
+	}
+
+	if u.Scheme == "sftp" {
+		path := strings.TrimPrefix(u.Path, "/")
+		if path == "" {
+			path = "."
+		}
+		version, err := sftpStat(client, path)
+		if err != nil {
+			return "FAIL", 0, fmt.Sprintf("SFTP error: %v", err)
+		}
+		setDetail(test, "sftp", fmt.Sprintf("v%d", version))
+		latency = time.Since(start)
+	}
+
+	return "OK", latency, ""
+}
+
+// replayConn is a net.Conn whose reads come from r, used to hand already
+// buffered bytes back to a protocol library.
+type replayConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *replayConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// fakeSSH runs an SSH server accepting user "alice" with password "pw".
+func fakeSSH(t *testing.T, signer ssh.Signer) func(conn net.Conn) {
+	return func(conn net.Conn) {
+		config := &ssh.ServerConfig{
+			PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+				if c.User() == "alice" && string(pass) == "pw" {
+					return nil, nil
+				}
+				return nil, ssh.ErrNoAuth
+			},
+			ServerVersion: "SSH-2.0-FakeSSH_1.0",
+		}
+		config.AddHostKey(signer)
+		sconn, chans, reqs, err := ssh.NewServerConn(conn, config)
+		if err != nil {
+			return
+		}
+		defer sconn.Close()
+		go ssh.DiscardRequests(reqs)
+		for range chans {
+		}
+	}
+}
+
+func TestCheckSSH(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprint := ssh.FingerprintSHA256(signer.PublicKey())
+
+	tests := []struct {
+		userinfo string
+		options  string
+		status   string
+		hostKey  string
+	}{
+		{"", "", "OK", ""},
+		{"", " kex", "OK", fingerprint},
+		{"", " host_key=" + fingerprint, "OK", fingerprint},
+		{"", " host_key=SHA256:bogus", "FAIL", fingerprint},
+		{"alice:pw@", "", "OK", fingerprint},
+		{"alice:wrong@", "", "FAIL", fingerprint},
+	}
+
+	for _, tt := range tests {
+		addr := serveOnce(t, fakeSSH(t, signer))
+		test := parseTestConfig("ssh=ssh://" + tt.userinfo + addr + tt.options)
+		status, _, errMsg := checkSSH(context.Background(), &test)
+		if status != tt.status {
+			t.Errorf("checkSSH(%q%s) = %s (%s), want %s", test.URL, tt.options, status, errMsg, tt.status)
+		}
+		if test.Details["version"] != "SSH-2.0-FakeSSH_1.0" || test.Details["host_key"] != tt.hostKey {
+			t.Errorf("checkSSH(%q%s) Details = %v", test.URL, tt.options, test.Details)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// checkSTOMP sends a STOMP CONNECT frame and expects CONNECTED, reporting the
+// negotiated version and server. URL credentials become login/passcode and
+// the URL path, if any, the virtual host. stomps:// connects over TLS.
+func checkSTOMP(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	start := time.Now()
+
+	u, err := url.Parse(test.URL)
+	if err != nil || u.Hostname() == "" {
+		return "ERROR", 0, "Invalid URL"
+	}
+
+	conn, err := dial(ctx, test, "tcp", hostPort(u, "61613"))
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("Connect error: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(testTimeout(test)))
+
+	if u.Scheme == "stomps" {
+		conn, err = tlsClient(ctx, test, conn, u.Hostname())
+		if err != nil {
+			return "FAIL", 0, fmt.Sprintf("TLS handshake error: %v", err)
+		}
+	}
+
+	vhost := strings.TrimPrefix(u.Path, "/")
+	if vhost == "" {
+		vhost = u.Hostname()
+	}
+	var frame strings.Builder
+	frame.WriteString("CONNECT\naccept-version:1.0,1.1,1.2\nheart-beat:0,0\n")
+	fmt.Fprintf(&frame, "host:%s\n", vhost)
+	if u.User != nil {
+		password, _ := u.User.Password()
+		fmt.Fprintf(&frame, "login:%s\npasscode:%s\n", u.User.Username(), password)
+	}
+	frame.WriteString("\n\x00")
+	if _, err := conn.Write([]byte(frame.String())); err != nil {
+		return "FAIL", 0, fmt.Sprintf("CONNECT error: %v", err)
+	}
+
+	command, headers, body, err := stompReadFrame(bufio.NewReader(conn))
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("Frame read error: %v", err)
+	}
+	switch command {
+	case "CONNECTED":
+	case "ERROR":
+		msg := headers["message"]
+		if msg == "" {
+			msg = strings.TrimSpace(body)
+		}
+		return "FAIL", time.Since(start), fmt.Sprintf("Broker error: %s", msg)
+	default:
+		return "FAIL", 0, fmt.Sprintf("Unexpected %s frame", command)
+	}
+
+	version := headers["version"]
+	if version == "" {
+		version = "1.0"
+	}
+	setDetail(test, "version", version)
+	if server := headers["server"]; server != "" {
+		setDetail(test, "server", server)
+	}
+
+	conn.Write([]byte("DISCONNECT\n\n\x00"))
+	return "OK", time.Since(start), ""
+}
+
+// stompReadFrame reads one frame, skipping heart-beat newlines. The first
+// occurrence of a repeated header wins, as the specification requires.
+func stompReadFrame(br *bufio.Reader) (command string, headers map[string]string, body string, err error) {
+	for command == "" {
+		if command, err = br.ReadString('\n'); err != nil {
+			return "", nil, "", err
+		}
+		command = strings.TrimRight(command, "\r\n")
+	}
+
+	headers = make(map[string]string)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return "", nil, "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		k, v, _ := strings.Cut(line, ":")
+		if _, ok := headers[k]; !ok {
+			headers[k] = v
+		}
+	}
+
+	body, err = br.ReadString(0)
+	if err != nil {
+		return "", nil, "", err
+	}
+	return command, headers, strings.TrimSuffix(body, "\x00"), nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"testing"
+)
+
+// fakeSTOMP accepts CONNECT frames carrying login admin/passcode admin.
+func fakeSTOMP(conn net.Conn) {
+	_, headers, _, err := stompReadFrame(bufio.NewReader(conn))
+	if err != nil {
+		return
+	}
+	if headers["login"] != "admin" || headers["passcode"] != "admin" {
+		conn.Write([]byte("ERROR\nmessage:Security Error\ncontent-length:0\n\n\x00"))
+		return
+	}
+	conn.Write([]byte("CONNECTED\nversion:1.2\nserver:ActiveMQ-Artemis/2.31.2\nheart-beat:0,0\n\n\x00"))
+}
+
+func TestCheckSTOMP(t *testing.T) {
+	tests := []struct {
+		url    string
+		status string
+		errMsg string
+	}{
+		{"stomp://admin:admin@%s", "OK", ""},
+		{"stomp://admin:wrong@%s", "FAIL", "Broker error: Security Error"},
+	}
+
+	for _, tt := range tests {
+		test := &ConnectionTest{URL: fmt.Sprintf(tt.url, serveOnce(t, fakeSTOMP))}
+		status, _, errMsg := checkSTOMP(context.Background(), test)
+		if status != tt.status || errMsg != tt.errMsg {
+			t.Errorf("checkSTOMP(%q) = %s (%s), want %s (%s)", test.URL, status, errMsg, tt.status, tt.errMsg)
+		}
+		if status == "OK" && (test.Details["version"] != "1.2" || test.Details["server"] != "ActiveMQ-Artemis/2.31.2") {
+			t.Errorf("Details = %v", test.Details)
+		}
+	}
+}
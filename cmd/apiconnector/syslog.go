@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// checkSyslog emits an RFC 5424 test message to a syslog receiver. The
+// "transport" option selects udp (default), tcp or tls; TCP and TLS use
+// octet-counting framing (RFC 6587). The message carries a unique MSGID,
+// reported as a detail, so it can be traced through the pipeline. With
+// "expect=<regexp>" a matching reply is required; otherwise the check fails
+// only if the receiver refuses or drops the connection.
+func checkSyslog(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	start := time.Now()
+
+	u, err := url.Parse(test.URL)
+	if err != nil || u.Hostname() == "" {
+		return "ERROR", 0, "Invalid URL"
+	}
+
+	transport := test.Options["transport"]
+	network, defaultPort := "tcp", "514"
+	switch transport {
+	case "", "udp":
+		transport, network = "udp", "udp"
+	case "tcp":
+	case "tls":
+		defaultPort = "6514"
+	default:
+		return "ERROR", 0, fmt.Sprintf("Invalid transport %q (udp, tcp or tls)", transport)
+	}
+	var expect *regexp.Regexp
+	if pattern := test.Options["expect"]; pattern != "" {
+		if expect, err = regexp.Compile(pattern); err != nil {
+			return "ERROR", 0, fmt.Sprintf("Invalid expect pattern: %v", err)
+		}
+	}
+
+	conn, err := dial(ctx, test, network, hostPort(u, defaultPort))
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("Connect error: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(testTimeout(test)))
+
+	if transport == "tls" {
+		conn, err = tlsClient(ctx, test, conn, u.Hostname())
+		if err != nil {
+			return "FAIL", 0, fmt.Sprintf("TLS handshake error: %v", err)
+		}
+	}
+
+	msgID := "apiconnector-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	msg := syslogMessage(msgID)
+	if network == "tcp" {
+		msg = strconv.Itoa(len(msg)) + " " + msg
+	}
+	if _, err := io.WriteString(conn, msg); err != nil {
+		return "FAIL", 0, fmt.Sprintf("Send error: %v", err)
+	}
+	setDetail(test, "transport", transport)
+	setDetail(test, "msgid", msgID)
+
+	wait := udpSilenceWindow
+	if expect != nil {
+		wait = testTimeout(test)
+	}
+	conn.SetReadDeadline(time.Now().Add(wait))
+
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	latency := time.Since(start)
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "FAIL", 0, "Receiver port unreachable"
+	case isTimeout(err) && expect == nil:
+		return "OK", latency, ""
+	case errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET):
+		return "FAIL", 0, "Connection closed by receiver"
+	case err != nil:
+		return "FAIL", 0, fmt.Sprintf("Receive error: %v", err)
+	}
+
+	if expect != nil && !expect.Match(buf[:n]) {
+		return "FAIL", latency, fmt.Sprintf("Reply does not match %q", expect)
+	}
+
+	return "OK", latency, ""
+}
+
+// syslogMessage formats an RFC 5424 user.notice message.
+func syslogMessage(msgID string) string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "-"
+	}
+	return fmt.Sprintf("<13>1 %s %s apiconnector %d %s - apiconnector connectivity test\n",
+		time.Now().UTC().Format(time.RFC3339Nano), host, os.Getpid(), msgID)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var syslogFrame = regexp.MustCompile(`^<13>1 \S+ \S+ apiconnector \d+ (apiconnector-\w+) - `)
+
+func TestCheckSyslogUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	received := make(chan string, 1)
+	go func() {
+		buf := make([]byte, 2048)
+		n, _, err := pc.ReadFrom(buf)
+		if err == nil {
+			received <- string(buf[:n])
+		}
+	}()
+
+	test := &ConnectionTest{URL: "syslog://" + pc.LocalAddr().String()}
+	if status, _, errMsg := checkSyslog(context.Background(), test); status != "OK" {
+		t.Fatalf("checkSyslog = %s (%s), want OK", status, errMsg)
+	}
+	m := syslogFrame.FindStringSubmatch(<-received)
+	if m == nil || m[1] != test.Details["msgid"] {
+		t.Errorf("received message does not match msgid %q", test.Details["msgid"])
+	}
+}
+
+func TestCheckSyslogTCP(t *testing.T) {
+	tests := []struct {
+		options string
+		reply   string
+		status  string
+	}{
+		{"transport=tcp", "", "OK"},
+		{"transport=tcp expect=^ACK", "ACK\n", "OK"},
+		{"transport=tcp expect=^ACK", "NAK\n", "FAIL"},
+	}
+
+	for _, tt := range tests {
+		tt := tt // the handler outlives the iteration before Go 1.22
+		addr := serveOnce(t, func(conn net.Conn) {
+			br := bufio.NewReader(conn)
+			length, err := br.ReadString(' ')
+			if err != nil {
+				return
+			}
+			n, _ := strconv.Atoi(strings.TrimSpace(length))
+			msg := make([]byte, n)
+			if _, err := io.ReadFull(br, msg); err != nil || !syslogFrame.Match(msg) {
+				return
+			}
+			if tt.reply != "" {
+				conn.Write([]byte(tt.reply))
+			}
+			br.ReadByte() // hold the connection open until the client closes
+		})
+
+		test := parseTestConfig("logs=syslog://" + addr + " " + tt.options)
+		status, _, errMsg := checkSyslog(context.Background(), &test)
+		if status != tt.status {
+			t.Errorf("checkSyslog(%q) = %s (%s), want %s", tt.options, status, errMsg, tt.status)
+		}
+	}
+}
+
+func TestCheckSyslogClosed(t *testing.T) {
+	addr := serveOnce(t, func(conn net.Conn) {})
+
+	test := parseTestConfig("logs=syslog://" + addr + " transport=tcp")
+	if status, _, errMsg := checkSyslog(context.Background(), &test); status != "FAIL" {
+		t.Errorf("checkSyslog = %s (%s), want FAIL", status, errMsg)
+	}
+}
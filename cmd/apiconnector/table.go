@@ -0,0 +1,141 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+var columnsFlag = flag.String("columns", "", "print the text results as an aligned table of these comma-separated `columns`, e.g. service,status,latency,ip,cert_expiry")
+
+// tableColumns are the columns a table cell can be given by name; any
+// other name is a result detail, such as ip or tls.
+var tableColumns = map[string]func(test *ConnectionTest) string{
+	"service": func(test *ConnectionTest) string { return test.Service },
+	"url":     func(test *ConnectionTest) string { return redactURL(test.URL) },
+	"method":  func(test *ConnectionTest) string { return test.Method },
+	"status":  textStatus,
+	"latency": func(test *ConnectionTest) string {
+		if test.Error != "" {
+			return ""
+		}
+		return formatDuration(test.Latency)
+	},
+	"error":   func(test *ConnectionTest) string { return test.Error },
+	"details": func(test *ConnectionTest) string { return strings.TrimSpace(formatDetails(test.Details)) },
+}
+
+// columnAliases name details for the columns people ask for.
+var columnAliases = map[string]string{
+	"cert_expiry": "cert_expires",
+}
+
+// resultColumns is the parsed -columns list, nil when the text results
+// are printed as lines.
+var resultColumns []string
+
+// parseColumns parses the -columns list.
+func parseColumns() error {
+	if *columnsFlag == "" {
+		return nil
+	}
+	var columns []string
+	for _, c := range strings.Split(*columnsFlag, ",") {
+		c = strings.ToLower(strings.TrimSpace(c))
+		if c == "" {
+			return fmt.Errorf("invalid -columns %q: empty column", *columnsFlag)
+		}
+		columns = append(columns, c)
+	}
+	resultColumns = columns
+	return nil
+}
+
+// tableColumn reports whether the -columns table shows column, so that
+// details only recorded on request, such as ip, are recorded for it.
+func tableColumn(column string) bool {
+	for _, c := range resultColumns {
+		if c == column {
+			return true
+		}
+	}
+	return false
+}
+
+// textStatus returns test's status as the text output shows it: OK, WARN
+// or FAIL.
+func textStatus(test *ConnectionTest) string {
+	switch {
+	case test.Error != "":
+		return "FAIL"
+	case test.Status == "WARN":
+		return "WARN"
+	}
+	return "OK"
+}
+
+// writeTable writes tests as a table of columns, each as wide as its widest
+// cell, with a header row. Empty cells show "-". Statuses are colored after
+// padding, so the escape codes do not upset the alignment.
+func writeTable(w io.Writer, columns []string, tests []*ConnectionTest) error {
+	rows := make([][]string, 0, len(tests)+1)
+	header := make([]string, len(columns))
+	for i, c := range columns {
+		header[i] = strings.ToUpper(c)
+	}
+	rows = append(rows, header)
+	for _, test := range tests {
+		row := make([]string, len(columns))
+		for i, c := range columns {
+			if cell, ok := tableColumns[c]; ok {
+				row[i] = cell(test)
+			} else if alias, ok := columnAliases[c]; ok {
+				row[i] = test.Details[alias]
+			} else {
+				row[i] = test.Details[c]
+			}
+			if row[i] == "" {
+				row[i] = "-"
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	widths := make([]int, len(columns))
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], len([]rune(cell)))
+		}
+	}
+	for r, row := range rows {
+		var b strings.Builder
+		for i, cell := range row {
+			last := i == len(row)-1
+			if !last {
+				cell += strings.Repeat(" ", widths[i]-len([]rune(cell))+2)
+			}
+			if r > 0 && columns[i] == "status" {
+				cell = statusColor(row[i]).Sprint(cell)
+			}
+			b.WriteString(cell)
+		}
+		if _, err := fmt.Fprintln(w, b.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// statusColor returns the color the text output shows status in.
+func statusColor(status string) *color.Color {
+	switch status {
+	case "OK":
+		return color.New(color.FgGreen)
+	case "WARN":
+		return color.New(color.FgYellow)
+	}
+	return color.New(color.FgRed)
+}
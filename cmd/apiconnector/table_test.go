@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+)
+
+func TestWriteTable(t *testing.T) {
+	defer func(noColor bool) { color.NoColor = noColor }(color.NoColor)
+	color.NoColor = true
+	defer func() { *columnsFlag, resultColumns = "", nil }()
+	*columnsFlag = "service, status,latency,ip,CERT_EXPIRY"
+	if err := parseColumns(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := sampleTests()
+	tests[0].Details["cert_expires"] = "2025-01-31"
+	tests[2].Service = "database-primary"
+	var rows []*ConnectionTest
+	for i := range tests {
+		rows = append(rows, &tests[i])
+	}
+	var buf bytes.Buffer
+	if err := writeTable(&buf, resultColumns, rows); err != nil {
+		t.Fatal(err)
+	}
+	want := `SERVICE           STATUS  LATENCY  IP  CERT_EXPIRY
+api               OK      15ms     -   2025-01-31
+slow              WARN    2000ms   -   -
+database-primary  FAIL    -        -   -
+bad               FAIL    -        -   -
+`
+	if buf.String() != want {
+		t.Errorf("table =\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	*columnsFlag = "service,,status"
+	if err := parseColumns(); err == nil {
+		t.Error("parseColumns with an empty column = nil, want an error")
+	}
+}
+
+func TestTableColumnIP(t *testing.T) {
+	defer func() { *columnsFlag, resultColumns = "", nil }()
+	*columnsFlag = "service,ip"
+	if err := parseColumns(); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	test := parseTestConfig("api=" + srv.URL)
+	if status, _, errMsg := checkHTTP(context.Background(), &test); status != "OK" {
+		t.Fatalf("checkHTTP = %s %q, want OK", status, errMsg)
+	}
+	var buf bytes.Buffer
+	if err := writeTable(&buf, resultColumns, []*ConnectionTest{&test}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "api      127.0.0.1") {
+		t.Errorf("table =\n%s\nwant the connected address in the ip column", buf.String())
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// checkTCP opens a TCP connection to tcp://host:port and closes it again,
+// for services that need no protocol check.
+func checkTCP(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	start := time.Now()
+
+	u, err := url.Parse(test.URL)
+	if err != nil || u.Hostname() == "" || u.Port() == "" {
+		return "ERROR", 0, "Invalid URL (tcp://host:port)"
+	}
+	conn, err := dial(ctx, test, "tcp", u.Host)
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("Connect error: %v", err)
+	}
+	latency := time.Since(start)
+	conn.Close()
+	return "OK", latency, ""
+}
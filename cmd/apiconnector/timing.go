@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// phaseTimer traces the phases of an HTTP request, so the latency of a TLS
+// target can be split into network, crypto and backend time.
+type phaseTimer struct {
+	mu                        sync.Mutex
+	connectStart, connectDone time.Time
+	tlsStart, tlsDone         time.Time
+	wroteRequest, firstByte   time.Time
+}
+
+// trace returns req with the timer attached. Connection phases are only
+// seen when the request opens a new connection.
+func (p *phaseTimer) trace(req *http.Request) *http.Request {
+	now := func(t *time.Time) {
+		p.mu.Lock()
+		*t = time.Now()
+		p.mu.Unlock()
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		ConnectStart:         func(string, string) { now(&p.connectStart) },
+		ConnectDone:          func(string, string, error) { now(&p.connectDone) },
+		TLSHandshakeStart:    func() { now(&p.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { now(&p.tlsDone) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { now(&p.wroteRequest) },
+		GotFirstResponseByte: func() { now(&p.firstByte) },
+	}))
+}
+
+// record sets the phase details: "connect" for the TCP connection,
+// "handshake" for the TLS handshake and "response" for the time from
+// sending the request to the first byte of the response.
+func (p *phaseTimer) record(test *ConnectionTest) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, phase := range []struct {
+		key        string
+		start, end time.Time
+	}{
+		{"connect", p.connectStart, p.connectDone},
+		{"handshake", p.tlsStart, p.tlsDone},
+		{"response", p.wroteRequest, p.firstByte},
+	} {
+		if !phase.start.IsZero() && !phase.end.IsZero() {
+			setDetail(test, phase.key, formatDuration(phase.end.Sub(phase.start)))
+		}
+	}
+}
+
+// traceConnect runs dial, a connection made outside net/http's own dialing
+// (as the forced HTTP/2 transports do), reporting it to the client trace
+// in ctx as net/http would.
+func traceConnect(ctx context.Context, network, addr string, dial func() (net.Conn, error)) (net.Conn, error) {
+	trace := httptrace.ContextClientTrace(ctx)
+	if trace != nil && trace.ConnectStart != nil {
+		trace.ConnectStart(network, addr)
+	}
+	conn, err := dial()
+	if trace != nil && trace.ConnectDone != nil {
+		trace.ConnectDone(network, addr, err)
+	}
+	return conn, err
+}
+
+// traceHandshake runs conn's TLS handshake, reporting it to the client
+// trace in ctx as net/http would.
+func traceHandshake(ctx context.Context, conn *tls.Conn) error {
+	trace := httptrace.ContextClientTrace(ctx)
+	if trace != nil && trace.TLSHandshakeStart != nil {
+		trace.TLSHandshakeStart()
+	}
+	err := conn.HandshakeContext(ctx)
+	if trace != nil && trace.TLSHandshakeDone != nil {
+		trace.TLSHandshakeDone(conn.ConnectionState(), err)
+	}
+	return err
+}
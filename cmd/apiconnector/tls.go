@@ -0,0 +1,442 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	clientCert  = flag.String("cert", "", "client certificate `file` (PEM) for mutual TLS")
+	clientKey   = flag.String("key", "", "client private key `file` (PEM); defaults to the -cert file")
+	caFile      = flag.String("ca-file", "", "CA certificate bundle `file` (PEM) trusted in addition to the system roots")
+	caDir       = flag.String("ca-dir", "", "`directory` of CA certificates (PEM) trusted in addition to the system roots")
+	insecureTLS = flag.Bool("insecure", false, "skip TLS certificate verification, reporting what it would have found")
+
+	weakCiphers = flag.String("weak-ciphers", "", "comma-separated cipher suite `names` or fragments (e.g. CBC,3DES) that make TLS checks WARN; \"default\" for Go's insecure suites")
+
+	certWarnDays = flag.Int("cert-warn-days", 30, "warn when a TLS certificate expires within this many `days` (0 disables)")
+	certFailDays = flag.Int("cert-fail-days", 7, "fail when a TLS certificate expires within this many `days` (0 disables)")
+)
+
+// checkTLS performs only a TLS handshake with the target, for services that
+// speak TLS but not HTTP. It offers the ALPN protocols listed in the
+// "alpn" option and reports the negotiated version, cipher suite, curve and
+// protocol (see setTLSState), which must satisfy "expect_alpn", the leaf
+// certificate subject, issuer and expiry, and the connect and handshake
+// times. With a client certificate configured it also reports whether the
+// server accepts connections without one, "min_tls"/"max_tls" are enforced
+// by checkTLSVersions, and "ocsp" by checkRevocation.
+func checkTLS(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	start := time.Now()
+
+	u, err := url.Parse(test.URL)
+	if err != nil || u.Hostname() == "" {
+		return "ERROR", 0, "Invalid URL"
+	}
+
+	conn, err := dial(ctx, test, "tcp", hostPort(u, "443"))
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("Connect error: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(testTimeout(test)))
+	setDetail(test, "connect", formatDuration(time.Since(start)))
+
+	handshakeStart := time.Now()
+	conn, err = tlsClient(ctx, test, conn, u.Hostname())
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("TLS handshake error: %v", err)
+	}
+	setDetail(test, "handshake", formatDuration(time.Since(handshakeStart)))
+
+	state := conn.(*tls.Conn).ConnectionState()
+	warn := setTLSState(test, state)
+	if errMsg := matchALPN(test); errMsg != "" {
+		return "FAIL", 0, errMsg
+	}
+	if len(state.PeerCertificates) > 0 {
+		leaf := state.PeerCertificates[0]
+		if name := certName(leaf.Subject); name != "" {
+			setDetail(test, "subject", name)
+		}
+		if name := certName(leaf.Issuer); name != "" {
+			setDetail(test, "issuer", name)
+		}
+	}
+	latency := time.Since(start)
+
+	if test.Details["client_cert"] == "requested" {
+		setDetail(test, "without_cert", probeWithoutClientCert(ctx, test, hostPort(u, "443"), u.Hostname()))
+	}
+	if status, errMsg := checkTLSVersions(ctx, test, hostPort(u, "443"), u.Hostname()); status != "" {
+		return status, 0, errMsg
+	}
+	switch status, errMsg := checkRevocation(ctx, test, state); status {
+	case "":
+	case "WARN":
+		warn = true
+	default:
+		return status, 0, errMsg
+	}
+
+	if warn {
+		return "WARN", latency, ""
+	}
+	return "OK", latency, ""
+}
+
+// tlsConfig builds the client TLS configuration for test. A client
+// certificate from the "cert"/"key" options (or the -cert/-key flags) is
+// presented when the server asks for one, and the "client_cert" detail
+// records whether it did, once a handshake has happened. Server certificates are verified against
+// rootCAs. With -show-certs the presented chain is recorded (see
+// recordChain), and with -insecure or "skip_verify" verification only
+// reports its outcome (see recordVerifyError). The chain must match any
+// "pin" (see matchPins), even when verification is skipped. The "sni"
+// option replaces serverName; an empty serverName lets HTTP transports fill
+// it in per host.
+func tlsConfig(test *ConnectionTest, serverName string) (*tls.Config, error) {
+	roots, err := rootCAs(test)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{ServerName: tlsServerName(test, serverName), RootCAs: roots}
+
+	pins, err := certPins(test)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := clientCertificate(test)
+	if err != nil {
+		return nil, err
+	}
+	skip := skipVerify(test)
+	if *showCerts || skip || len(pins) > 0 || cert != nil {
+		config.InsecureSkipVerify = skip
+		config.VerifyConnection = func(cs tls.ConnectionState) error {
+			if *showCerts {
+				recordChain(test, cs.PeerCertificates, config.RootCAs)
+			}
+			if skip {
+				recordVerifyError(test, cs, config.ServerName, config.RootCAs)
+			}
+			// The server's certificate is verified before the client's is
+			// asked for, which GetClientCertificate then records.
+			if cert != nil && test.Details["client_cert"] == "" {
+				setDetail(test, "client_cert", "not_requested")
+			}
+			if len(pins) > 0 {
+				return matchPins(test, pins, cs.PeerCertificates)
+			}
+			return nil
+		}
+	}
+	if cert != nil {
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			setDetail(test, "client_cert", "requested")
+			return cert, nil
+		}
+	}
+	return config, nil
+}
+
+// clientCertificate loads the client certificate from the "cert"/"key"
+// options, or the -cert/-key flags, or returns nil without one.
+func clientCertificate(test *ConnectionTest) (*tls.Certificate, error) {
+	certFile, keyFile := test.Options["cert"], test.Options["key"]
+	if certFile == "" {
+		certFile, keyFile = *clientCert, *clientKey
+	}
+	if certFile == "" {
+		return nil, nil
+	}
+	if keyFile == "" {
+		keyFile = certFile
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("client certificate: %v", err)
+	}
+	return &cert, nil
+}
+
+// rootCAs returns the roots that verify server certificates for test: the
+// system pool plus the CA certificates from the "ca" option, a PEM file or a
+// directory of them, or else from -ca-file and -ca-dir. It returns nil (the
+// system pool) when none are configured.
+func rootCAs(test *ConnectionTest) (*x509.CertPool, error) {
+	paths := []string{*caFile, *caDir}
+	if ca := test.Options["ca"]; ca != "" {
+		paths = []string{ca}
+	}
+
+	var pool *x509.CertPool
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if pool == nil {
+			if tlsRootCAs != nil {
+				pool = tlsRootCAs.Clone()
+			} else if pool, _ = x509.SystemCertPool(); pool == nil {
+				pool = x509.NewCertPool()
+			}
+		}
+		if err := addCAs(pool, path); err != nil {
+			return nil, err
+		}
+	}
+	if pool == nil {
+		return tlsRootCAs, nil
+	}
+	return pool, nil
+}
+
+// addCAs adds the PEM certificates in a file, or in the .pem, .crt and .cer
+// files of a directory, to pool.
+func addCAs(pool *x509.CertPool, path string) error {
+	files := []string{path}
+	if info, err := os.Stat(path); err != nil {
+		return fmt.Errorf("CA certificates: %v", err)
+	} else if info.IsDir() {
+		files = nil
+		for _, pattern := range []string{"*.pem", "*.crt", "*.cer"} {
+			matches, _ := filepath.Glob(filepath.Join(path, pattern))
+			files = append(files, matches...)
+		}
+	}
+	added := false
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("CA certificates: %v", err)
+		}
+		if pool.AppendCertsFromPEM(data) {
+			added = true
+		}
+	}
+	if !added {
+		return fmt.Errorf("CA certificates: no PEM certificates in %s", path)
+	}
+	return nil
+}
+
+// tlsServerName returns the name to send via SNI and verify the server
+// certificate against: the "sni" option, so that a specific backend can be
+// reached by IP or -resolve while presenting the production hostname, or
+// else host.
+func tlsServerName(test *ConnectionTest, host string) string {
+	if sni := test.Options["sni"]; sni != "" {
+		return sni
+	}
+	return host
+}
+
+// skipVerify reports whether test skips certificate verification, with the
+// -insecure flag or the "skip_verify" option ("skip_verify=false" overrides
+// the flag).
+func skipVerify(test *ConnectionTest) bool {
+	if _, ok := test.Options["skip_verify"]; ok {
+		return boolOption(test, "skip_verify")
+	}
+	return *insecureTLS
+}
+
+// recordVerifyError verifies a chain the handshake accepted unverified, so
+// that skipping verification keeps its outcome visible: "verify" is
+// "skipped", and "verify_error" holds the error crypto/tls would have
+// failed with. Without an SNI name (an IP target over HTTP) the URL host is
+// verified.
+func recordVerifyError(test *ConnectionTest, cs tls.ConnectionState, serverName string, roots *x509.CertPool) {
+	setDetail(test, "verify", "skipped")
+	if serverName == "" {
+		serverName = cs.ServerName
+	}
+	if u, err := url.Parse(test.URL); serverName == "" && err == nil {
+		serverName = u.Hostname()
+	}
+	if len(cs.PeerCertificates) == 0 {
+		setDetail(test, "verify_error", "no certificates")
+		return
+	}
+	opts := x509.VerifyOptions{DNSName: serverName, Roots: roots, Intermediates: x509.NewCertPool()}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	if _, err := cs.PeerCertificates[0].Verify(opts); err != nil {
+		setDetail(test, "verify_error", err.Error())
+	}
+}
+
+// probeWithoutClientCert repeats the TLS handshake with addr without a
+// client certificate and reports whether the server "accepted" or
+// "rejected" the connection. With TLS 1.3 a missing certificate is only
+// rejected after the handshake, so a short read waits for the alert.
+func probeWithoutClientCert(ctx context.Context, test *ConnectionTest, addr, serverName string) string {
+	conn, err := dial(ctx, test, "tcp", addr)
+	if err != nil {
+		return "unknown"
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(testTimeout(test)))
+
+	roots, _ := rootCAs(test)
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: tlsServerName(test, serverName), RootCAs: roots, InsecureSkipVerify: skipVerify(test)})
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return "rejected"
+	}
+	tlsConn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if _, err := tlsConn.Read(make([]byte, 1)); err != nil && !isTimeout(err) && !errors.Is(err, io.EOF) {
+		return "rejected"
+	}
+	return "accepted"
+}
+
+// setTLSState records the negotiated TLS version, cipher suite, ALPN
+// protocol and, where crypto/tls reports it, key exchange curve. It reports whether the cipher
+// suite is on the "weak_ciphers" option or -weak-ciphers list, which is
+// also recorded as the "weak_cipher" detail.
+func setTLSState(test *ConnectionTest, state tls.ConnectionState) bool {
+	cipher := tls.CipherSuiteName(state.CipherSuite)
+	setDetail(test, "tls", tls.VersionName(state.Version))
+	setDetail(test, "cipher", cipher)
+	if curve := curveName(state); curve != "" {
+		setDetail(test, "curve", curve)
+	}
+	if state.NegotiatedProtocol != "" {
+		setDetail(test, "alpn", state.NegotiatedProtocol)
+	}
+
+	list, ok := test.Options["weak_ciphers"]
+	if !ok {
+		list = *weakCiphers
+	}
+	for _, weak := range strings.Split(list, ",") {
+		weak = strings.ToUpper(strings.TrimSpace(weak))
+		if weak == "" || weak == "FALSE" || weak == "NONE" {
+			continue
+		}
+		if weak == "TRUE" || weak == "DEFAULT" {
+			for _, suite := range tls.InsecureCipherSuites() {
+				if suite.ID == state.CipherSuite {
+					setDetail(test, "weak_cipher", "true")
+					return true
+				}
+			}
+			continue
+		}
+		if strings.Contains(cipher, weak) {
+			setDetail(test, "weak_cipher", "true")
+			return true
+		}
+	}
+	return false
+}
+
+// matchALPN applies the "expect_alpn" option to the "alpn" detail recorded
+// by setTLSState, so that a target that stops negotiating e.g. h2 fails.
+// It returns a failure message, or "".
+func matchALPN(test *ConnectionTest) string {
+	want := test.Options["expect_alpn"]
+	if want == "" {
+		return ""
+	}
+	got := test.Details["alpn"]
+	if got == "" {
+		return fmt.Sprintf("No ALPN protocol negotiated, want %s", want)
+	}
+	if got != want {
+		return fmt.Sprintf("ALPN protocol is %s, want %s", got, want)
+	}
+	return ""
+}
+
+// tlsVersions maps the "min_tls"/"max_tls" option values to versions.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// checkTLSVersions enforces the "min_tls" and "max_tls" options against the
+// TLS server at addr with extra handshakes: min_tls fails a server that
+// still accepts an older version, and max_tls one that cannot negotiate
+// that version, e.g. "min_tls=1.2 max_tls=1.3" for a server that must have
+// dropped TLS 1.0/1.1 and enabled 1.3. It returns "" when neither option is
+// set or both hold, and otherwise a status and message.
+func checkTLSVersions(ctx context.Context, test *ConnectionTest, addr, serverName string) (string, string) {
+	for _, key := range []string{"min_tls", "max_tls"} {
+		v := strings.TrimPrefix(strings.ToLower(test.Options[key]), "tls")
+		if v == "" {
+			continue
+		}
+		version, ok := tlsVersions[v]
+		if !ok {
+			return "ERROR", fmt.Sprintf("Invalid %s %q", key, test.Options[key])
+		}
+		if key == "min_tls" {
+			if version == tls.VersionTLS10 {
+				continue
+			}
+			if got, err := probeTLSVersion(ctx, test, addr, serverName, tls.VersionTLS10, version-1); err == nil {
+				return "FAIL", fmt.Sprintf("Server accepts %s, below min_tls %s", tls.VersionName(got), v)
+			}
+		} else if _, err := probeTLSVersion(ctx, test, addr, serverName, version, version); err != nil {
+			return "FAIL", fmt.Sprintf("Server does not support TLS %s (max_tls): %v", v, err)
+		}
+	}
+	return "", ""
+}
+
+// probeTLSVersion performs a handshake with addr limited to the versions
+// from minVersion to maxVersion and returns the negotiated version. It offers every cipher
+// suite and skips certificate verification, since only whether the server
+// speaks one of those versions matters.
+func probeTLSVersion(ctx context.Context, test *ConnectionTest, addr, serverName string, minVersion, maxVersion uint16) (uint16, error) {
+	conn, err := dial(ctx, test, "tcp", addr)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(testTimeout(test)))
+
+	var suites []uint16
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		suites = append(suites, suite.ID)
+	}
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName:         tlsServerName(test, serverName),
+		InsecureSkipVerify: true,
+		MinVersion:         minVersion,
+		MaxVersion:         maxVersion,
+		CipherSuites:       suites,
+	})
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return 0, err
+	}
+	return tlsConn.ConnectionState().Version, nil
+}
+
+// certName returns the common name of a certificate subject or issuer,
+// falling back to its organization.
+func certName(name pkix.Name) string {
+	if name.CommonName != "" {
+		return name.CommonName
+	}
+	if len(name.Organization) > 0 {
+		return name.Organization[0]
+	}
+	return ""
+}
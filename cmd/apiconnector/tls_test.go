@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "https://")
+
+	test := &ConnectionTest{URL: "tls://" + addr}
+	if status, _, errMsg := checkTLS(context.Background(), test); status != "FAIL" || !strings.Contains(errMsg, "certificate") {
+		t.Errorf("checkTLS with untrusted cert = %s (%s), want FAIL with certificate error", status, errMsg)
+	}
+
+	tlsRootCAs = x509.NewCertPool()
+	tlsRootCAs.AddCert(srv.Certificate())
+	defer func() { tlsRootCAs = nil }()
+
+	test = &ConnectionTest{URL: "tls://" + addr}
+	status, _, errMsg := checkTLS(context.Background(), test)
+	if status != "OK" {
+		t.Fatalf("checkTLS = %s (%s), want OK", status, errMsg)
+	}
+	if test.Details["tls"] != "TLS 1.3" || test.Details["issuer"] != "Acme Co" || test.Details["cert_expires"] == "" || test.Details["cert_days"] == "" || test.Details["handshake"] == "" {
+		t.Errorf("Details = %v", test.Details)
+	}
+}
+
+// writeClientCert writes a self-signed client certificate and key to dir
+// and returns the certificate and the paths.
+func writeClientCert(t *testing.T, dir string) (*x509.Certificate, string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "apiconnector-client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	return cert, certFile, keyFile
+}
+
+func TestClientCertificate(t *testing.T) {
+	cert, certFile, keyFile := writeClientCert(t, t.TempDir())
+
+	tests := []struct {
+		auth        tls.ClientAuthType
+		options     string
+		status      string
+		clientCert  string
+		withoutCert string
+	}{
+		{tls.RequireAndVerifyClientCert, "cert=" + certFile + " key=" + keyFile, "OK", "requested", "rejected"},
+		{tls.VerifyClientCertIfGiven, "cert=" + certFile + " key=" + keyFile, "OK", "requested", "accepted"},
+		{tls.NoClientCert, "cert=" + certFile + " key=" + keyFile, "OK", "not_requested", ""},
+		{tls.RequireAndVerifyClientCert, "", "FAIL", "", ""},
+		{tls.RequireAndVerifyClientCert, "cert=" + keyFile, "FAIL", "", ""}, // unreadable certificate
+	}
+
+	for _, tt := range tests {
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		srv.TLS = &tls.Config{ClientAuth: tt.auth, ClientCAs: x509.NewCertPool()}
+		srv.TLS.ClientCAs.AddCert(cert)
+		srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+		srv.StartTLS()
+		tlsRootCAs = x509.NewCertPool()
+		tlsRootCAs.AddCert(srv.Certificate())
+
+		test := parseTestConfig("api=" + srv.URL + " " + tt.options)
+		status, _, errMsg := checkHTTP(context.Background(), &test)
+		if status != tt.status || test.Details["client_cert"] != tt.clientCert || test.Details["without_cert"] != tt.withoutCert {
+			t.Errorf("checkHTTP(%v, %q) = %s (%s) %v", tt.auth, tt.options, status, errMsg, test.Details)
+		}
+
+		srv.Close()
+	}
+	tlsRootCAs = nil
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	test := parseTestConfig("api=" + srv.URL + " cert=" + certFile + " key=" + keyFile)
+	if status, _, errMsg := checkHTTP(context.Background(), &test); status != "OK" || test.Details["client_cert"] != "" {
+		t.Errorf("checkHTTP(http://, cert) = %s (%s) %v, want OK without client_cert", status, errMsg, test.Details)
+	}
+}
+
+func TestTLSVersions(t *testing.T) {
+	tests := []struct {
+		minVersion, maxVersion uint16
+		options                string
+		status                 string
+	}{
+		{tls.VersionTLS12, tls.VersionTLS13, "min_tls=1.2 max_tls=1.3", "OK"},
+		{tls.VersionTLS10, tls.VersionTLS13, "min_tls=1.2", "FAIL"},
+		{tls.VersionTLS10, tls.VersionTLS13, "min_tls=1.0", "OK"},
+		{tls.VersionTLS12, tls.VersionTLS12, "min_tls=TLS1.2", "OK"},
+		{tls.VersionTLS12, tls.VersionTLS12, "max_tls=1.3", "FAIL"},
+		{tls.VersionTLS12, tls.VersionTLS13, "max_tls=1.4", "ERROR"},
+	}
+	for _, tt := range tests {
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		srv.TLS = &tls.Config{MinVersion: tt.minVersion, MaxVersion: tt.maxVersion}
+		srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+		srv.StartTLS()
+		tlsRootCAs = x509.NewCertPool()
+		tlsRootCAs.AddCert(srv.Certificate())
+
+		for _, target := range []string{srv.URL, "tls://" + strings.TrimPrefix(srv.URL, "https://")} {
+			test := parseTestConfig("api=" + target + " " + tt.options)
+			check := checkHTTP
+			if strings.HasPrefix(target, "tls:") {
+				check = checkTLS
+			}
+			if status, _, errMsg := check(context.Background(), &test); status != tt.status {
+				t.Errorf("check(%s, %s) against %s-%s = %s (%s), want %s", target, tt.options, tls.VersionName(tt.minVersion), tls.VersionName(tt.maxVersion), status, errMsg, tt.status)
+			}
+		}
+		srv.Close()
+	}
+	tlsRootCAs = nil
+}
+
+func TestWeakCiphers(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = &tls.Config{MaxVersion: tls.VersionTLS12, CipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA, tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA}}
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	defer srv.Close()
+	tlsRootCAs = x509.NewCertPool()
+	tlsRootCAs.AddCert(srv.Certificate())
+	defer func() { tlsRootCAs = nil; *weakCiphers = "" }()
+
+	tests := []struct {
+		options string
+		flag    string
+		status  string
+	}{
+		{"", "", "OK"},
+		{"weak_ciphers", "", "OK"}, // not one of Go's insecure suites
+		{"weak_ciphers=GCM,3DES", "", "OK"},
+		{"weak_ciphers=cbc", "", "WARN"},
+		{"", "CBC", "WARN"},
+		{"weak_ciphers=none", "CBC", "OK"},
+	}
+	for _, tt := range tests {
+		*weakCiphers = tt.flag
+		test := parseTestConfig("api=" + srv.URL + " " + tt.options)
+		status, _, errMsg := checkHTTP(context.Background(), &test)
+		if status != tt.status || !strings.Contains(test.Details["cipher"], "_CBC_SHA") || test.Details["tls"] != "TLS 1.2" {
+			t.Errorf("checkHTTP(%s, -weak-ciphers=%s) = %s (%s) %v, want %s", tt.options, tt.flag, status, errMsg, test.Details, tt.status)
+		}
+	}
+
+	// Go never offers its insecure suites, so check the default list directly.
+	test := parseTestConfig("api=https://localhost weak_ciphers")
+	if !setTLSState(&test, tls.ConnectionState{Version: tls.VersionTLS12, CipherSuite: tls.TLS_RSA_WITH_RC4_128_SHA}) || test.Details["weak_cipher"] != "true" {
+		t.Errorf("setTLSState with RC4 = %v, want weak_cipher", test.Details)
+	}
+}
+
+func TestSkipVerify(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "https://")
+	defer func() { *insecureTLS = false }()
+
+	tests := []struct {
+		target      string
+		flag        bool
+		trusted     bool
+		status      string
+		verifyError string
+	}{
+		{"tls://" + addr, false, false, "FAIL", ""},
+		{"tls://" + addr + " skip_verify", false, false, "OK", "unknown authority"},
+		{srv.URL + " skip_verify", false, false, "OK", "unknown authority"},
+		{srv.URL, true, false, "OK", "unknown authority"},
+		{srv.URL + " skip_verify=false", true, false, "FAIL", ""},
+		{srv.URL + " sni=api.test", true, true, "OK", "api.test"},
+		{srv.URL, true, true, "OK", ""},
+	}
+	for _, tt := range tests {
+		*insecureTLS = tt.flag
+		if tt.trusted {
+			tlsRootCAs = x509.NewCertPool()
+			tlsRootCAs.AddCert(srv.Certificate())
+		}
+		test := parseTestConfig("api=" + tt.target)
+		check := checkHTTP
+		if strings.HasPrefix(tt.target, "tls:") {
+			check = checkTLS
+		}
+		status, _, errMsg := check(context.Background(), &test)
+		tlsRootCAs = nil
+		if status != tt.status {
+			t.Errorf("check(%s, -insecure=%v) = %s (%s), want %s", tt.target, tt.flag, status, errMsg, tt.status)
+			continue
+		}
+		if status == "OK" && (test.Details["verify"] != "skipped" || !strings.Contains(test.Details["verify_error"], tt.verifyError) || (tt.verifyError == "") != (test.Details["verify_error"] == "")) {
+			t.Errorf("check(%s, -insecure=%v) details %v, want verify=skipped verify_error containing %q", tt.target, tt.flag, test.Details, tt.verifyError)
+		}
+	}
+}
+
+func TestCustomCA(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	defer srv.Close()
+
+	dir := t.TempDir()
+	bundle := filepath.Join(dir, "internal-ca.pem")
+	os.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0o600)
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	os.WriteFile(empty, nil, 0o600)
+	defer func() { *caFile, *caDir = "", "" }()
+
+	tests := []struct {
+		options   string
+		file, dir string
+		status    string
+		errMsg    string
+	}{
+		{"", "", "", "FAIL", "unknown authority"},
+		{"ca=" + bundle, "", "", "OK", ""},
+		{"ca=" + dir, "", "", "OK", ""},
+		{"", bundle, "", "OK", ""},
+		{"", "", dir, "OK", ""},
+		{"ca=" + empty, bundle, "", "FAIL", "no PEM certificates"},
+		{"ca=" + filepath.Join(dir, "missing.pem"), "", "", "FAIL", "missing.pem"},
+	}
+	for _, tt := range tests {
+		*caFile, *caDir = tt.file, tt.dir
+		test := parseTestConfig("api=" + srv.URL + " " + tt.options)
+		status, _, errMsg := checkHTTP(context.Background(), &test)
+		if status != tt.status || !strings.Contains(errMsg, tt.errMsg) {
+			t.Errorf("checkHTTP(%s, -ca-file=%s -ca-dir=%s) = %s (%s), want %s (%s)", tt.options, tt.file, tt.dir, status, errMsg, tt.status, tt.errMsg)
+		}
+	}
+}
+
+func TestALPN(t *testing.T) {
+	h2 := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	h2.EnableHTTP2 = true
+	h2.StartTLS()
+	defer h2.Close()
+	h1 := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer h1.Close()
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer plain.Close()
+	tlsRootCAs = x509.NewCertPool()
+	tlsRootCAs.AddCert(h2.Certificate())
+	tlsRootCAs.AddCert(h1.Certificate())
+	defer func() { tlsRootCAs = nil }()
+
+	tests := []struct {
+		target string
+		status string
+		alpn   string
+	}{
+		{h2.URL + " expect_alpn=h2", "OK", "h2"},
+		{h1.URL, "OK", "http/1.1"},
+		{h1.URL + " expect_alpn=h2", "FAIL", "http/1.1"},
+		{plain.URL + " expect_alpn=h2", "FAIL", ""},
+		{"tls://" + strings.TrimPrefix(h2.URL, "https://") + " alpn=h2,http/1.1 expect_alpn=h2", "OK", "h2"},
+		{"tls://" + strings.TrimPrefix(h1.URL, "https://") + " alpn=h2,http/1.1 expect_alpn=h2", "FAIL", "http/1.1"},
+		{"tls://" + strings.TrimPrefix(h2.URL, "https://") + " expect_alpn=h2", "FAIL", ""},
+	}
+	for _, tt := range tests {
+		test := parseTestConfig("api=" + tt.target)
+		check := checkHTTP
+		if strings.HasPrefix(tt.target, "tls:") {
+			check = checkTLS
+		}
+		if status, _, errMsg := check(context.Background(), &test); status != tt.status || test.Details["alpn"] != tt.alpn {
+			t.Errorf("check(%s) = %s (%s) %v, want %s alpn=%q", tt.target, status, errMsg, test.Details, tt.status, tt.alpn)
+		}
+	}
+}
+
+func TestPhaseTimings(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer plain.Close()
+	tlsRootCAs = x509.NewCertPool()
+	tlsRootCAs.AddCert(srv.Certificate())
+	defer func() { tlsRootCAs = nil }()
+
+	test := parseTestConfig("api=" + srv.URL)
+	if status, _, errMsg := checkHTTP(context.Background(), &test); status != "OK" {
+		t.Fatalf("checkHTTP = %s (%s)", status, errMsg)
+	}
+	if test.Details["connect"] == "" || test.Details["handshake"] == "" {
+		t.Errorf("Details = %v, want connect and handshake", test.Details)
+	}
+	if d, err := time.ParseDuration(test.Details["response"]); err != nil || d < 50*time.Millisecond {
+		t.Errorf("response = %q, want at least the server's 50ms", test.Details["response"])
+	}
+
+	test = parseTestConfig("api=" + srv.URL + " http2")
+	if status, _, errMsg := checkHTTP(context.Background(), &test); status != "OK" || test.Details["proto"] != "HTTP/2.0" {
+		t.Fatalf("checkHTTP with http2 = %s (%s) %v", status, errMsg, test.Details)
+	}
+	if test.Details["connect"] == "" || test.Details["handshake"] == "" || test.Details["response"] == "" {
+		t.Errorf("Details with http2 = %v, want connect, handshake and response", test.Details)
+	}
+
+	test = parseTestConfig("api=" + plain.URL)
+	if status, _, _ := checkHTTP(context.Background(), &test); status != "OK" || test.Details["response"] != "" {
+		t.Errorf("checkHTTP over plain HTTP details %v, want no phase timings", test.Details)
+	}
+
+	test = parseTestConfig("api=tls://" + strings.TrimPrefix(srv.URL, "https://"))
+	if status, _, _ := checkTLS(context.Background(), &test); status != "OK" || test.Details["connect"] == "" {
+		t.Errorf("checkTLS details %v, want connect", test.Details)
+	}
+}
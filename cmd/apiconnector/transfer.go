@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// readBody reads a response body to the end, keeping up to maxBodySize
+// bytes for assertions (decoded by decodeBody under the "compression"
+// option). With a "max_size" limit, reading stops once the body is known to
+// exceed it. readBody records the body size, the uncompressed size of the
+// status line and headers, and the effective throughput since start, and
+// returns the kept body and the number of body bytes read.
+func readBody(test *ConnectionTest, resp *http.Response, start time.Time, maxSize int64) ([]byte, int64, error) {
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		return nil, 0, err
+	}
+	size := int64(len(raw))
+	if size == maxBodySize {
+		rest := io.Reader(resp.Body)
+		if maxSize > 0 {
+			rest = io.LimitReader(rest, maxSize-size+1)
+		}
+		n, err := io.Copy(io.Discard, rest)
+		size += n
+		if err != nil {
+			return nil, size, err
+		}
+	}
+	elapsed := time.Since(start)
+
+	setDetail(test, "body_size", strconv.FormatInt(size, 10))
+	setDetail(test, "header_size", strconv.Itoa(headerSize(resp)))
+	if size > 0 && elapsed > 0 {
+		setDetail(test, "throughput", formatRate(float64(size)/elapsed.Seconds()))
+	}
+
+	if test.Options["compression"] != "" {
+		body, err := decodeBody(test, resp, raw, size)
+		return body, size, err
+	}
+	return raw, size, nil
+}
+
+// headerSize returns the size of resp's status line and headers as they
+// would appear in HTTP/1.1, ignoring any HTTP/2 or HTTP/3 header compression.
+func headerSize(resp *http.Response) int {
+	n := len(resp.Proto) + 1 + len(resp.Status) + 2
+	for name, values := range resp.Header {
+		for _, v := range values {
+			n += len(name) + 2 + len(v) + 2
+		}
+	}
+	return n + 2
+}
+
+// parseSize parses a byte count with an optional K, M or G suffix (powers
+// of 1024), as used by the "max_size" option.
+func parseSize(v string) (int64, error) {
+	mult := int64(1)
+	switch {
+	case strings.HasSuffix(v, "K"), strings.HasSuffix(v, "k"):
+		mult = 1 << 10
+	case strings.HasSuffix(v, "M"):
+		mult = 1 << 20
+	case strings.HasSuffix(v, "G"):
+		mult = 1 << 30
+	}
+	if mult > 1 {
+		v = v[:len(v)-1]
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", v)
+	}
+	return n * mult, nil
+}
+
+// formatRate renders a transfer rate in bytes per second.
+func formatRate(bps float64) string {
+	switch {
+	case bps >= 1<<20:
+		return fmt.Sprintf("%.1fMB/s", bps/(1<<20))
+	case bps >= 1<<10:
+		return fmt.Sprintf("%.1fKB/s", bps/(1<<10))
+	}
+	return fmt.Sprintf("%.0fB/s", bps)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCheckHTTPTransferMetrics(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(r.URL.Query().Get("n"))
+		w.Write([]byte(strings.Repeat("x", n)))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		target string
+		status string
+		size   string
+	}{
+		{"/?n=100", "OK", "100"},
+		{"/?n=2000000", "OK", "2000000"},
+		{"/?n=2048 max_size=2K", "OK", "2048"},
+		{"/?n=2049 max_size=2K", "FAIL", "2049"},
+		{"/?n=3000000 max_size=1M", "FAIL", "1048577"},
+		{"/?n=1 max_size=lots", "ERROR", ""},
+	}
+	for _, tt := range tests {
+		test := parseTestConfig("api=" + srv.URL + tt.target)
+		status, _, errMsg := checkHTTP(context.Background(), &test)
+		if status != tt.status || test.Details["body_size"] != tt.size {
+			t.Errorf("checkHTTP(%s) = %s (%s) body_size %q, want %s body_size %q", tt.target, status, errMsg, test.Details["body_size"], tt.status, tt.size)
+		}
+		if status == "OK" && (test.Details["header_size"] == "" || !strings.HasSuffix(test.Details["throughput"], "B/s")) {
+			t.Errorf("checkHTTP(%s) details = %v, want header_size and throughput", tt.target, test.Details)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := map[string]int64{"512": 512, "2K": 2048, "2k": 2048, "3M": 3 << 20, "1G": 1 << 30}
+	for in, want := range tests {
+		if got, err := parseSize(in); err != nil || got != want {
+			t.Errorf("parseSize(%q) = %d, %v, want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "M", "-1", "1.5M"} {
+		if _, err := parseSize(in); err == nil {
+			t.Errorf("parseSize(%q) succeeded, want error", in)
+		}
+	}
+}
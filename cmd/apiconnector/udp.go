@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// udpSilenceWindow is how long a probe without an "expect" option waits for
+// a reply or an ICMP port-unreachable before treating silence as success.
+const udpSilenceWindow = time.Second
+
+// checkUDP sends a datagram to udp://host:port. The payload comes from the
+// "payload" or "payload_hex" option. With "expect=<regexp>" a matching
+// reply is required; otherwise the check passes unless the host reports
+// the port unreachable.
+func checkUDP(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	start := time.Now()
+
+	u, err := url.Parse(test.URL)
+	if err != nil || u.Hostname() == "" || u.Port() == "" {
+		return "ERROR", 0, "Invalid URL (udp://host:port)"
+	}
+
+	payload := []byte(test.Options["payload"])
+	if h := test.Options["payload_hex"]; h != "" {
+		if payload, err = hex.DecodeString(h); err != nil {
+			return "ERROR", 0, fmt.Sprintf("Invalid payload_hex: %v", err)
+		}
+	}
+	var expect *regexp.Regexp
+	if pattern := test.Options["expect"]; pattern != "" {
+		if expect, err = regexp.Compile(pattern); err != nil {
+			return "ERROR", 0, fmt.Sprintf("Invalid expect pattern: %v", err)
+		}
+	}
+
+	conn, err := dial(ctx, test, "udp", u.Host)
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("Connect error: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write(payload); err != nil {
+		return "FAIL", 0, fmt.Sprintf("Send error: %v", err)
+	}
+
+	wait := udpSilenceWindow
+	if expect != nil {
+		wait = testTimeout(test)
+	}
+	conn.SetReadDeadline(time.Now().Add(wait))
+
+	buf := make([]byte, 65535)
+	n, err := conn.Read(buf)
+	latency := time.Since(start)
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "FAIL", 0, fmt.Sprintf("Port %s unreachable", u.Port())
+	case isTimeout(err) && expect == nil:
+		setDetail(test, "reply", "none")
+		return "OK", latency, ""
+	case err != nil:
+		return "FAIL", 0, fmt.Sprintf("Receive error: %v", err)
+	}
+
+	setDetail(test, "reply", strconv.Itoa(n)+"B")
+	if expect != nil && !expect.Match(buf[:n]) {
+		return "FAIL", latency, fmt.Sprintf("Reply does not match %q", expect)
+	}
+
+	return "OK", latency, ""
+}
+
+// isTimeout reports whether err is a network timeout.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
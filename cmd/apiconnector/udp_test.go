@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+)
+
+// serveUDPEcho replies to each datagram with "echo:" plus its contents.
+func serveUDPEcho(t *testing.T) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			pc.WriteTo(append([]byte("echo:"), buf[:n]...), addr)
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+func TestCheckUDP(t *testing.T) {
+	addr := serveUDPEcho(t)
+
+	tests := []struct {
+		options string
+		status  string
+	}{
+		{"", "OK"},
+		{" payload=hello expect=^echo:hello$", "OK"},
+		{" payload_hex=68690a expect=echo:hi", "OK"},
+		{" payload=hello expect=^pong", "FAIL"},
+		{" expect=(", "ERROR"},
+	}
+
+	for _, tt := range tests {
+		test := parseTestConfig("udp=udp://" + addr + tt.options)
+		status, _, errMsg := checkUDP(context.Background(), &test)
+		if status != tt.status {
+			t.Errorf("checkUDP(%q) = %s (%s), want %s", tt.options, status, errMsg, tt.status)
+		}
+	}
+}
+
+func TestCheckUDPPortUnreachable(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := pc.LocalAddr().String()
+	pc.Close()
+
+	test := &ConnectionTest{URL: "udp://" + addr}
+	status, _, errMsg := checkUDP(context.Background(), test)
+	if status != "FAIL" || !strings.Contains(errMsg, "unreachable") {
+		t.Errorf("checkUDP on closed port = %s (%s), want FAIL unreachable", status, errMsg)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// defaultUploadSize is the size of the generated file sent by a bare
+// "upload" option.
+const defaultUploadSize = 1 << 10
+
+// uploadBody builds the multipart/form-data body for the "upload" option, a
+// smoke test of ingest paths through proxies that often break uploads. The
+// option names a file to send ("upload=@photo.jpg") or the size of random
+// data to generate ("upload=256K", default 1K). The file goes in the form
+// field named by "upload_field" (default "file"), and "form.<name>=value"
+// options add plain fields. It returns the body and its Content-Type.
+func uploadBody(test *ConnectionTest) ([]byte, string, error) {
+	name, data := "apiconnector-upload.bin", []byte(nil)
+	if file, ok := strings.CutPrefix(test.Options["upload"], "@"); ok {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, "", err
+		}
+		name, data = filepath.Base(file), b
+	} else {
+		size := int64(defaultUploadSize)
+		if v := test.Options["upload"]; v != "true" {
+			var err error
+			if size, err = parseSize(v); err != nil {
+				return nil, "", err
+			}
+		}
+		data = make([]byte, size)
+		if _, err := rand.Read(data); err != nil {
+			return nil, "", err
+		}
+	}
+
+	field := test.Options["upload_field"]
+	if field == "" {
+		field = "file"
+	}
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	var keys []string
+	for key := range test.Options {
+		if strings.HasPrefix(key, "form.") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := w.WriteField(strings.TrimPrefix(key, "form."), test.Options[key]); err != nil {
+			return nil, "", err
+		}
+	}
+	part, err := w.CreateFormFile(field, name)
+	if err != nil {
+		return nil, "", err
+	}
+	part.Write(data)
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), w.FormDataContentType(), nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckHTTPUpload(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost && r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, 64<<10)
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		field := r.URL.Query().Get("field")
+		f, header, err := r.FormFile(field)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		n, _ := io.Copy(io.Discard, f)
+		fmt.Fprintf(w, `{"name":%q,"size":%d,"bucket":%q}`, header.Filename, n, r.FormValue("bucket"))
+	}))
+	defer srv.Close()
+
+	file := filepath.Join(t.TempDir(), "scan.pdf")
+	if err := os.WriteFile(file, []byte("%PDF-1.4"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		target string
+		status string
+	}{
+		{"/?field=file upload expect_json=$.size==1024", "OK"},
+		{"/?field=file upload=2K expect_json=$.size==2048", "OK"},
+		{"/?field=doc upload=@" + file + " upload_field=doc expect_json=$.name==scan.pdf", "OK"},
+		{"/?field=file upload form.bucket=ingest expect_json=$.bucket==ingest", "OK"},
+		{"/?field=file upload=1M", "HTTP 413"},
+		{"/?field=file upload=@" + file + ".missing", "ERROR"},
+	}
+	for _, tt := range tests {
+		test := parseTestConfig("ingest=" + srv.URL + tt.target)
+		if status, _, errMsg := checkHTTP(context.Background(), &test); status != tt.status {
+			t.Errorf("checkHTTP(%s) = %s (%s), want %s", tt.target, status, errMsg, tt.status)
+		}
+	}
+
+	test := parseTestConfig("ingest=PUT " + srv.URL + "/?field=file upload")
+	if status, _, errMsg := checkHTTP(context.Background(), &test); status != "OK" {
+		t.Errorf("checkHTTP(PUT upload) = %s (%s), want OK", status, errMsg)
+	}
+}
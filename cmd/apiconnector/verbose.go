@@ -0,0 +1,105 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// verbose is the -v level: 1 prints every detail of each result, including
+// failed ones, with resolved addresses and the phases of HTTP requests; 2
+// also prints HTTP request and response headers.
+var verbose int
+
+func init() {
+	flag.Var(verboseFlag(1), "v", "print each result's details, resolved addresses and timing phases")
+	flag.Var(verboseFlag(2), "vv", "as -v, and print HTTP request and response headers")
+}
+
+// verboseFlag is a boolean flag raising verbose to its level.
+type verboseFlag int
+
+func (f verboseFlag) String() string { return "false" }
+
+func (f verboseFlag) IsBoolFlag() bool { return true }
+
+func (f verboseFlag) Set(v string) error {
+	on, err := strconv.ParseBool(v)
+	if err != nil {
+		return err
+	}
+	if on && int(f) > verbose {
+		verbose = int(f)
+	}
+	return nil
+}
+
+// redactedHeaders are not printed by -vv, as CI logs outlive credentials'
+// secrecy.
+var redactedHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+// traceTransport records, at -vv, each request it sends and the response
+// headers in test's trace, curl -v style. It wraps the innermost transport,
+// so the headers are those sent, including any added by headerTransport
+// and the authentication transports.
+type traceTransport struct {
+	base http.RoundTripper
+	test *ConnectionTest
+}
+
+func (t traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	trace := []string{fmt.Sprintf("> %s %s", req.Method, req.URL), "> Host: " + host}
+	trace = append(trace, headerLines("> ", req.Header)...)
+	resp, err := t.base.RoundTrip(req)
+	if err == nil {
+		trace = append(trace, fmt.Sprintf("< %s %s", resp.Proto, resp.Status))
+		trace = append(trace, headerLines("< ", resp.Header)...)
+	}
+	t.test.Trace = append(t.test.Trace, trace...)
+	return resp, err
+}
+
+// headerLines renders h as "Name: value" lines in name order, behind
+// prefix, with credentials redacted.
+func headerLines(prefix string, h http.Header) []string {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var lines []string
+	for _, name := range names {
+		for _, v := range h[name] {
+			if redactedHeaders[http.CanonicalHeaderKey(name)] {
+				v = "[redacted]"
+			}
+			lines = append(lines, prefix+name+": "+v)
+		}
+	}
+	return lines
+}
+
+// formatVerbose renders test's details one per line, followed by its
+// trace, for printing under its result at -v.
+func formatVerbose(test *ConnectionTest) string {
+	var b strings.Builder
+	for _, d := range sortedDetails(test.Details) {
+		fmt.Fprintf(&b, "    %s\n", d)
+	}
+	for _, line := range test.Trace {
+		fmt.Fprintf(&b, "    %s\n", line)
+	}
+	return b.String()
+}
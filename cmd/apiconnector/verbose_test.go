@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestVerboseHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.Header().Set("X-Served-By", "edge-1")
+	}))
+	defer srv.Close()
+	url := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+
+	defer func() { verbose = 0 }()
+	for _, level := range []int{0, 1, 2} {
+		verbose = level
+		test := &ConnectionTest{Service: "api", URL: url, Headers: map[string]string{"Authorization": "Bearer secret", "X-Api-Key": "k", "Host": "tenant.example.com"}}
+		if status, _, errMsg := checkHTTP(context.Background(), test); status != "OK" {
+			t.Fatalf("-v level %d: checkHTTP = %s (%s)", level, status, errMsg)
+		}
+		if got, want := test.Details["resolved"] != "" && test.Details["ip"] == "127.0.0.1" && test.Details["response"] != "", level > 0; got != want {
+			t.Errorf("-v level %d: details = %v, want resolved addresses, ip and phases %v", level, test.Details, want)
+		}
+		out := formatVerbose(test)
+		if got, want := strings.Contains(out, "    > Host: tenant.example.com\n") && strings.Contains(out, "    > X-Api-Key: k\n") &&
+			strings.Contains(out, "    > Authorization: [redacted]\n") && strings.Contains(out, "    < X-Served-By: edge-1\n"), level > 1; got != want {
+			t.Errorf("-v level %d: output = %s\nwant headers %v", level, out, want)
+		}
+		if strings.Contains(out, "secret") {
+			t.Errorf("-v level %d: output = %s\nwant credentials redacted", level, out)
+		}
+	}
+}
+
+func TestVerboseFlag(t *testing.T) {
+	defer func() { verbose = 0 }()
+	for _, tc := range []struct {
+		flags []verboseFlag
+		want  int
+	}{
+		{[]verboseFlag{1}, 1},
+		{[]verboseFlag{2}, 2},
+		{[]verboseFlag{2, 1}, 2},
+	} {
+		verbose = 0
+		for _, f := range tc.flags {
+			if err := f.Set("true"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if verbose != tc.want {
+			t.Errorf("flags %v: verbose = %d, want %d", tc.flags, verbose, tc.want)
+		}
+	}
+	if err := verboseFlag(1).Set("loud"); err == nil {
+		t.Error(`Set("loud") = nil, want an error`)
+	}
+}
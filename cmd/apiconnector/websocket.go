@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// websocketGUID is the fixed value mixed into Sec-WebSocket-Accept (RFC 6455).
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// checkWebSocket completes a WebSocket upgrade handshake against a ws:// or
+// wss:// target, reporting TCP connect and handshake time separately. With
+// the "ping" option it also sends a ping frame and waits for the pong.
+func checkWebSocket(ctx context.Context, test *ConnectionTest) (string, time.Duration, string) {
+	start := time.Now()
+
+	u, err := url.Parse(test.URL)
+	if err != nil || u.Hostname() == "" {
+		return "ERROR", 0, "Invalid URL"
+	}
+
+	defaultPort := "80"
+	if u.Scheme == "wss" {
+		defaultPort = "443"
+	}
+
+	conn, err := dial(ctx, test, "tcp", hostPort(u, defaultPort))
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("Connect error: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(testTimeout(test)))
+	setDetail(test, "connect", formatDuration(time.Since(start)))
+
+	handshakeStart := time.Now()
+	if u.Scheme == "wss" {
+		conn, err = tlsClient(ctx, test, conn, u.Hostname())
+		if err != nil {
+			return "FAIL", 0, fmt.Sprintf("TLS handshake error: %v", err)
+		}
+	}
+
+	var nonce [16]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return "ERROR", 0, fmt.Sprintf("Key generation error: %v", err)
+	}
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+
+	httpURL := *u
+	httpURL.Scheme = "http"
+	if u.Scheme == "wss" {
+		httpURL.Scheme = "https"
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", httpURL.String(), nil)
+	if err != nil {
+		return "ERROR", 0, fmt.Sprintf("Request creation error: %v", err)
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if err := req.Write(conn); err != nil {
+		return "FAIL", 0, fmt.Sprintf("Handshake write error: %v", err)
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return "FAIL", 0, fmt.Sprintf("Handshake read error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return "FAIL", 0, fmt.Sprintf("Upgrade refused: HTTP %d", resp.StatusCode)
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != websocketAccept(key) {
+		return "FAIL", 0, "Invalid Sec-WebSocket-Accept"
+	}
+	setDetail(test, "handshake", formatDuration(time.Since(handshakeStart)))
+
+	if boolOption(test, "ping") {
+		pingStart := time.Now()
+		if err := websocketPing(conn, br); err != nil {
+			return "FAIL", 0, fmt.Sprintf("Ping error: %v", err)
+		}
+		setDetail(test, "ping", formatDuration(time.Since(pingStart)))
+	}
+
+	return "OK", time.Since(start), ""
+}
+
+// websocketAccept computes the Sec-WebSocket-Accept value expected for key.
+func websocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// websocketPing writes a masked ping frame and reads frames until the
+// matching pong arrives.
+func websocketPing(conn net.Conn, br *bufio.Reader) error {
+	payload := []byte("apiconnector")
+	frame := []byte{0x89, 0x80 | byte(len(payload)), 0, 0, 0, 0}
+	if _, err := rand.Read(frame[2:6]); err != nil {
+		return err
+	}
+	for i, b := range payload {
+		frame = append(frame, b^frame[2+i%4])
+	}
+	if _, err := conn.Write(frame); err != nil {
+		return err
+	}
+
+	for {
+		opcode, _, err := readWebSocketFrame(br)
+		if err != nil {
+			return err
+		}
+		switch opcode {
+		case 0xA:
+			return nil
+		case 0x8:
+			return fmt.Errorf("connection closed by server")
+		}
+	}
+}
+
+// readWebSocketFrame reads one unfragmented server frame.
+func readWebSocketFrame(br *bufio.Reader) (byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return 0, nil, err
+	}
+	opcode := header[0] & 0x0F
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(br, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(ext[0])<<8 | uint64(ext[1])
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(br, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = 0
+		for _, b := range ext {
+			length = length<<8 | uint64(b)
+		}
+	}
+	if header[1]&0x80 != 0 {
+		if _, err := br.Discard(4); err != nil {
+			return 0, nil, err
+		}
+	}
+	if length > 1<<20 {
+		return 0, nil, fmt.Errorf("frame too large (%d bytes)", length)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(br, payload); err != nil {
+		return 0, nil, err
+	}
+	return opcode, payload, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// websocketEchoServer accepts upgrades and answers every ping with a pong.
+func websocketEchoServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "websocket" {
+			http.Error(w, "upgrade required", http.StatusUpgradeRequired)
+			return
+		}
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		accept := websocketAccept(r.Header.Get("Sec-WebSocket-Key"))
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: " + accept + "\r\n\r\n")
+		rw.Flush()
+
+		opcode, payload, err := readWebSocketFrame(rw.Reader)
+		if err != nil {
+			if err != io.EOF {
+				t.Error(err)
+			}
+			return
+		}
+		if opcode == 0x9 {
+			conn.Write(append([]byte{0x8A, byte(len(payload))}, payload...))
+		}
+		bufio.NewReader(conn).ReadByte()
+	}))
+}
+
+func TestCheckWebSocket(t *testing.T) {
+	srv := websocketEchoServer(t)
+	defer srv.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/socket"
+	test := parseTestConfig("ws=" + wsURL + " ping")
+	status, _, errMsg := checkWebSocket(context.Background(), &test)
+	if status != "OK" {
+		t.Fatalf("checkWebSocket(%q) = %s (%s), want OK", wsURL, status, errMsg)
+	}
+	for _, key := range []string{"connect", "handshake", "ping"} {
+		if test.Details[key] == "" {
+			t.Errorf("missing %q detail in %v", key, test.Details)
+		}
+	}
+}
+
+func TestCheckWebSocketRefused(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	test := &ConnectionTest{URL: "ws" + strings.TrimPrefix(srv.URL, "http")}
+	if status, _, _ := checkWebSocket(context.Background(), test); status != "FAIL" {
+		t.Errorf("checkWebSocket against non-WebSocket server = %s, want FAIL", status)
+	}
+}